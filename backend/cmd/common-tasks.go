@@ -35,7 +35,7 @@ func Cleanup(s chan os.Signal) {
 	case signal := <-s:
 		fmt.Printf("\n\n")
 		z.Warn(fmt.Sprintf("\n***********************************\nservice terminated by %v", signal))
-		cmn.UtilCleanup()
+		cmn.Shutdown()
 
 		for _, v := range cleanProcesses {
 			v()
@@ -3,8 +3,6 @@
 package cmd
 
 import (
-	"fmt"
-	"w2w.io/cmn"
 	"w2w.io/sckserve"
 	"w2w.io/service"
 
@@ -24,8 +22,9 @@ func serve(cmd *cobra.Command, args []string) {
 	go sckserve.SocketServe(cmd, args)
 
 	z.Info("serve gate started")
-	_ = <-cmn.GetTerminateSignal()
-	fmt.Println("service stopped")
+
+	// Cleanup exits the process after the services stopped gracefully
+	select {}
 }
 
 func init() {
@@ -0,0 +1,191 @@
+package cmn
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//serviceCtxOf return the *ServiceCtx carried by ctx, nil if ctx isn't a request context
+func serviceCtxOf(ctx context.Context) *ServiceCtx {
+	if ctx == nil {
+		return nil
+	}
+	q, _ := ctx.Value(QNearKey).(*ServiceCtx)
+	return q
+}
+
+//accessControlLevel parse ep.AccessControlLevel, empty means CACLUnlimit
+func accessControlLevel(ep *ServeEndPoint) (level CAccessControlLevel, err error) {
+	if ep == nil || ep.AccessControlLevel == "" {
+		return
+	}
+
+	var n int64
+	n, err = strconv.ParseInt(strings.TrimSpace(ep.AccessControlLevel), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid access control level %s on %s", ep.AccessControlLevel, ep.Name)
+		z.Error(err.Error())
+		return
+	}
+
+	level = CAccessControlLevel(n)
+	switch level {
+	case CACLUnlimit, CACLScopeByOrgRole, CACLScopeByOrgRoleID, CACLScopeByOrgDeptRoleID:
+	default:
+		err = fmt.Errorf("unsupported access control level %s on %s", ep.AccessControlLevel, ep.Name)
+		z.Error(err.Error())
+	}
+	return
+}
+
+//roleDomain return the domain of the role the user currently using
+func (v *ServiceCtx) roleDomain() *TDomain {
+	for i := range v.Domains {
+		if v.Domains[i].ID.Int64 == v.Role {
+			return &v.Domains[i]
+		}
+	}
+	return nil
+}
+
+/*buildAuthFilter build the data scope condition of the requester by q.Ep.AccessControlLevel,
+the condition is in the same json form as ReqProto.Filter
+
+	level "0": nil, 可访问全部数据
+	level "2": 管理员为nil, 否则为 domain_id 属于用户角色所在机构及其下级的数据
+	level "4": 管理员为nil, 否则为 {"Creator":{"EQ":userID}}
+	level "8": 管理员为nil, 否则为 creator 或 domain_id 属于用户所在机构.部门及其下级的数据
+	level 不为 "0" 时要求用户已认证并且持有有效角色, 管理员即 q.IsAdmin */
+func buildAuthFilter(q *ServiceCtx) (authFilter interface{}, err error) {
+	var level CAccessControlLevel
+	level, err = accessControlLevel(q.Ep)
+	if err != nil {
+		return
+	}
+
+	if level == CACLUnlimit {
+		return
+	}
+
+	if q.SysUser == nil || !q.SysUser.ID.Valid || q.SysUser.ID.Int64 <= 0 {
+		err = fmt.Errorf("%s requires an authenticated user", q.Ep.Name)
+		z.Error(err.Error())
+		return
+	}
+
+	role := q.roleDomain()
+	if role == nil {
+		err = fmt.Errorf("user %d hasn't a valid role to access %s", q.SysUser.ID.Int64, q.Ep.Name)
+		z.Error(err.Error())
+		return
+	}
+
+	if q.IsAdmin {
+		return
+	}
+
+	if level == CACLScopeByOrgRole {
+		var domainIDs []interface{}
+		domainIDs, err = subDomainIDs(orgOf(role.Domain))
+		if err != nil {
+			return
+		}
+		if len(domainIDs) == 0 {
+			err = fmt.Errorf("organization of role %s has no domain", role.Domain)
+			z.Error(err.Error())
+			return
+		}
+		authFilter = map[string]interface{}{
+			"DomainID": map[string]interface{}{"IN": domainIDs},
+		}
+		return
+	}
+
+	byCreator := map[string]interface{}{
+		"Creator": map[string]interface{}{"EQ": q.SysUser.ID.Int64},
+	}
+
+	if level == CACLScopeByOrgRoleID {
+		authFilter = byCreator
+		return
+	}
+
+	var domainIDs []interface{}
+	domainIDs, err = subDomainIDs(role.Domain)
+	if err != nil {
+		return
+	}
+	if len(domainIDs) == 0 {
+		authFilter = byCreator
+		return
+	}
+
+	authFilter = []interface{}{
+		byCreator,
+		map[string]interface{}{
+			"DomainID":  map[string]interface{}{"IN": domainIDs},
+			"connectBy": "OR",
+		},
+	}
+	return
+}
+
+//orgOf return the organization of domain without the departments, e.g. xkb of xkb.school^admin
+func orgOf(domain string) string {
+	return strings.Split(strings.Split(strings.Split(domain, "!")[0], "^")[0], ".")[0]
+}
+
+/*subDomainIDs return t_domain.id of the organization/department of domain and its sub departments,
+domain 格式: 机构[部门.科室.组]^角色!userID, 例如 xkb.school^admin 的范围是 xkb.school 及 xkb.school.* */
+func subDomainIDs(domain string) (ids []interface{}, err error) {
+	org := strings.Split(strings.Split(domain, "!")[0], "^")[0]
+	if org == "" {
+		return
+	}
+
+	if sqlxDB == nil {
+		err = fmt.Errorf("please connect to dbms")
+		z.Error(err.Error())
+		return
+	}
+
+	s := `select id from t_domain
+		where coalesce(status, '01') != '02'
+			and (split_part(domain, '^', 1) = $1 or split_part(domain, '^', 1) like $2)`
+	var list []int64
+	err = sqlxDB.Select(&list, s, org, strings.ReplaceAll(org, "_", `\_`)+".%")
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	for _, v := range list {
+		ids = append(ids, v)
+	}
+	return
+}
+
+/*applyAuthFilter replace req.AuthFilter by the data scope of the requester.
+ctx 不是请求上下文(服务端内部调用)时保留调用者设置的 req.AuthFilter,
+否则客户端提交的 authFilter 一律被服务端生成的条件替换 */
+func applyAuthFilter(ctx context.Context, req *ReqProto) (err error) {
+	zr := LoggerOf(ctx)
+	q := serviceCtxOf(ctx)
+	if q == nil {
+		return
+	}
+
+	if q.Ep == nil {
+		err = fmt.Errorf("missing endpoint in request context")
+		zr.Error(err.Error())
+		return
+	}
+
+	if req.AuthFilter != nil {
+		zr.Warn(fmt.Sprintf("%s: authFilter from client ignored", q.Ep.Name))
+	}
+	req.AuthFilter, err = buildAuthFilter(q)
+	return
+}
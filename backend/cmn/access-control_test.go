@@ -0,0 +1,75 @@
+package cmn
+
+import (
+	"reflect"
+	"testing"
+
+	"w2w.io/null"
+)
+
+func TestOrgOf(t *testing.T) {
+	cases := map[string]string{
+		"xkb^admin":                   "xkb",
+		"xkb.school^admin":            "xkb",
+		"xkb.school.class1^teacher!3": "xkb",
+		"xkb!3":                       "xkb",
+		"":                            "",
+	}
+	for domain, want := range cases {
+		if got := orgOf(domain); got != want {
+			t.Errorf("orgOf(%q) = %q, want %q", domain, got, want)
+		}
+	}
+}
+
+func TestBuildAuthFilter(t *testing.T) {
+	db := sqlxDB
+	sqlxDB = nil
+	defer func() { sqlxDB = db }()
+
+	newCtx := func(level string, priority int64, admin bool) *ServiceCtx {
+		return &ServiceCtx{
+			Ep:      &ServeEndPoint{Name: "test", AccessControlLevel: level},
+			SysUser: &TUser{ID: null.IntFrom(7)},
+			Domains: []TDomain{{
+				ID:       null.IntFrom(100),
+				Domain:   "xkb.school^teacher",
+				Priority: null.IntFrom(priority),
+			}},
+			Role:    100,
+			IsAdmin: admin,
+		}
+	}
+	byCreator := map[string]interface{}{
+		"Creator": map[string]interface{}{"EQ": int64(7)},
+	}
+
+	cases := []struct {
+		name    string
+		q       *ServiceCtx
+		want    interface{}
+		wantErr bool
+	}{
+		{"unlimited", newCtx("0", 7, false), nil, false},
+		{"administrator of org role", newCtx("2", 3, true), nil, false},
+		{"administrator of dept role", newCtx("8", 0, true), nil, false},
+		{"creator", newCtx("4", 7, false), byCreator, false},
+
+		// the domains of the organization are required, never unscoped
+		{"org role of user", newCtx("2", 5, false), nil, true},
+		{"unauthenticated", &ServiceCtx{Ep: &ServeEndPoint{Name: "test", AccessControlLevel: "2"}}, nil, true},
+		{"without role", func() *ServiceCtx { q := newCtx("4", 7, false); q.Role = 1; return q }(), nil, true},
+		{"unsupported level", newCtx("3", 7, false), nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := buildAuthFilter(c.q)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, c.wantErr)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("authFilter = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+/*audit trail of DML
+
+	INSERT/UPDATE/DELETE/UPSERT/RESTORE 的每一行变更写入 t_account_opr_log, 与变更在同一事务中提交
+		user_id:     变更 t_user 时为被变更用户编号
+		original:    变更前数据, INSERT/UPSERT 为 null
+		creator:     操作者, ServiceCtx.SysUser.ID
+		domain_id:   操作者使用的角色, ServiceCtx.Role
+		addi:        {"table","rowID","action","api","method","after","changes"}
+		remark:      action + table
+	SensitiveColumns 中的列以 *** 记录
+
+	dbms.audit.enable: false 关闭审计, 缺省开启
+	dbms.audit.excludeTables: 不审计的表 */
+
+//auditMask value recorded for SensitiveColumns
+const auditMask = `"***"`
+
+//auditExcludeTables tables never audited
+var auditExcludeTables = map[string]bool{
+	"t_account_opr_log": true,
+	"t_log":             true,
+}
+
+//auditImage before/after image of a row in json, key is db column name
+type auditImage map[string]json.RawMessage
+
+//auditTrail collect images of the rows changed by a DML statement
+type auditTrail struct {
+	q       *ServiceCtx
+	ctx     context.Context
+	tx      *sqlx.Tx
+	tblName string
+	action  string
+	pk      string
+
+	// rows are locked by captureBefore, rows without after image are unchanged
+	locked bool
+
+	// row id in the order of being changed
+	rowIDs []string
+	before map[string]auditImage
+	after  map[string]auditImage
+}
+
+//auditEnabled report whether the changes of tblName should be audited
+func auditEnabled(tblName string) bool {
+	if viper.IsSet("dbms.audit.enable") && !viper.GetBool("dbms.audit.enable") {
+		return false
+	}
+	if auditExcludeTables[tblName] {
+		return false
+	}
+	for _, v := range viper.GetStringSlice("dbms.audit.excludeTables") {
+		if strings.EqualFold(v, tblName) {
+			return false
+		}
+	}
+	return true
+}
+
+/*beginAudit begin the transaction the change and its audit trail written in,
+return nil if tblName isn't audited, the caller should call finish at the end */
+func beginAudit(ctx context.Context, f *Filter, tblName, action string) (a *auditTrail, err error) {
+	zr := LoggerOf(ctx)
+	if !auditEnabled(tblName) {
+		return
+	}
+
+	var pkList []string
+	pkList, err = f.getPrimaryKeys(false)
+	if err != nil {
+		return
+	}
+	if len(pkList) == 0 {
+		zr.Warn(fmt.Sprintf("%s hasn't primary key, changes of it aren't audited", tblName))
+		return
+	}
+
+	a = &auditTrail{
+		q:       serviceCtxOf(ctx),
+		ctx:     ctx,
+		tblName: tblName,
+		action:  action,
+		pk:      pkList[0],
+		before:  make(map[string]auditImage),
+		after:   make(map[string]auditImage),
+	}
+	a.tx, err = sqlxDB.BeginTxx(ctx, nil)
+	if err != nil {
+		zr.Error(err.Error())
+		a = nil
+	}
+	return
+}
+
+//bind return stmt used in the audit transaction
+func (a *auditTrail) bind(stmt *sqlx.Stmt) *sqlx.Stmt {
+	if a == nil {
+		return stmt
+	}
+	return a.tx.Stmtx(stmt)
+}
+
+//returning the expression of the changed row image in RETURNING clause
+func (a *auditTrail) returning() string {
+	return fmt.Sprintf("to_jsonb(%s)", a.tblName)
+}
+
+//add record the image of a row
+func (a *auditTrail) add(buf []byte, isBefore bool) (err error) {
+	img := make(auditImage)
+	err = json.Unmarshal(buf, &img)
+	if err != nil {
+		LoggerOf(a.ctx).Error(err.Error())
+		return
+	}
+
+	for k := range img {
+		if SensitiveColumns[a.tblName+"."+k] && string(img[k]) != "null" {
+			img[k] = json.RawMessage(auditMask)
+		}
+	}
+
+	id := strings.Trim(string(img[a.pk]), `"`)
+	images := a.after
+	if isBefore {
+		images = a.before
+	}
+	if _, ok := a.before[id]; !ok {
+		if _, ok = a.after[id]; !ok {
+			a.rowIDs = append(a.rowIDs, id)
+		}
+	}
+	images[id] = img
+	return
+}
+
+//captureBefore lock and record the rows of req.Filter before they are updated
+func (a *auditTrail) captureBefore(f *Filter, req *ReqProto) (err error) {
+	zr := LoggerOf(a.ctx)
+	var expr string
+	var values []interface{}
+	expr, values, err = whereOf(f, req)
+	if err != nil {
+		return
+	}
+
+	a.locked = true
+	s := fmt.Sprintf("SELECT to_jsonb(%s) FROM %s WHERE %s FOR UPDATE", a.tblName, a.tblName, expr)
+	zr.Info(s)
+	var rows *sqlx.Rows
+	rows, err = a.tx.QueryxContext(a.ctx, s, values...)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf []byte
+		err = rows.Scan(&buf)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+		err = a.add(buf, true)
+		if err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		zr.Error(err.Error())
+	}
+	return
+}
+
+//query execute stmt with RETURNING the row image, return the count of rows changed
+func (a *auditTrail) query(stmt *sqlx.Stmt, values []interface{}, isBefore bool) (n int64, err error) {
+	zr := LoggerOf(a.ctx)
+	var rows *sqlx.Rows
+	rows, err = stmt.QueryxContext(a.ctx, values...)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf []byte
+		err = rows.Scan(&buf)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+		err = a.add(buf, isBefore)
+		if err != nil {
+			return
+		}
+		n++
+	}
+	err = rows.Err()
+	if err != nil {
+		zr.Error(err.Error())
+	}
+	return
+}
+
+//finish write the audit trail and commit the transaction if err is nil, otherwise rollback
+func (a *auditTrail) finish(err error) error {
+	if a == nil {
+		return err
+	}
+
+	if err == nil {
+		err = a.write()
+	}
+	if err != nil {
+		_ = a.tx.Rollback()
+		return err
+	}
+
+	err = a.tx.Commit()
+	if err != nil {
+		LoggerOf(a.ctx).Error(err.Error())
+	}
+	return err
+}
+
+//write insert audit trail of the changed rows into t_account_opr_log
+func (a *auditTrail) write() (err error) {
+	zr := LoggerOf(a.ctx)
+	var api, method string
+	var creator, role interface{}
+	if a.q != nil {
+		if a.q.R != nil {
+			api, method = a.q.R.URL.Path, a.q.R.Method
+		}
+		if a.q.SysUser != nil && a.q.SysUser.ID.Valid {
+			creator = a.q.SysUser.ID.Int64
+		}
+		if a.q.Role > 0 {
+			role = a.q.Role
+		}
+	}
+
+	s := `insert into t_account_opr_log(user_id, original, create_time, creator, domain_id, addi, remark)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+	var stmt *sqlx.Stmt
+	now := GetNowInMS()
+	for _, id := range a.rowIDs {
+		before, hasBefore := a.before[id]
+		after, hasAfter := a.after[id]
+		// rows locked but not changed
+		if a.locked && !hasAfter {
+			continue
+		}
+
+		var original interface{}
+		if hasBefore {
+			var buf []byte
+			buf, err = json.Marshal(before)
+			if err != nil {
+				zr.Error(err.Error())
+				return
+			}
+			original = string(buf)
+		}
+
+		addi := map[string]interface{}{
+			"table":  a.tblName,
+			"rowID":  id,
+			"action": a.action,
+			"api":    api,
+			"method": method,
+		}
+		if hasAfter {
+			addi["after"] = after
+		}
+		if hasBefore && hasAfter {
+			changes := make(map[string]interface{})
+			for k, v := range after {
+				if !bytes.Equal(before[k], v) {
+					changes[k] = map[string]json.RawMessage{"before": before[k], "after": v}
+				}
+			}
+			addi["changes"] = changes
+		}
+
+		var buf []byte
+		buf, err = json.Marshal(addi)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+
+		var userID interface{}
+		if a.tblName == "t_user" {
+			userID = id
+		}
+
+		if stmt == nil {
+			stmt, err = a.tx.PreparexContext(a.ctx, s)
+			if err != nil {
+				zr.Error(err.Error())
+				return
+			}
+			defer stmt.Close()
+		}
+		_, err = stmt.ExecContext(a.ctx, userID, original, now, creator, role, string(buf),
+			a.action+" "+a.tblName)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+	}
+	return
+}
+
+//whereOf build the where clause of req.Filter and req.AuthFilter with parameters begin at $1
+func whereOf(f *Filter, req *ReqProto) (expr string, values []interface{}, err error) {
+	c := &Filter{TableMap: f.TableMap}
+	expr, err = c.CreateFilter(req)
+	if err != nil {
+		return
+	}
+	if expr == "" {
+		expr = "1=1"
+	}
+	if c.AuthExpr != "" {
+		expr = fmt.Sprintf("(%s) and (%s)", expr, c.AuthExpr)
+		c.Values = append(c.Values, c.AuthWhereValues...)
+	}
+	values = c.Values
+	return
+}
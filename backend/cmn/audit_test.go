@@ -0,0 +1,163 @@
+package cmn
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"w2w.io/null"
+)
+
+type auditTestRow struct {
+	ID        null.Int    `json:"ID,omitempty" db:"id,true,bigint"`
+	Account   null.String `json:"Account,omitempty" db:"account,false,character varying"`
+	UserToken null.String `json:"UserToken,omitempty" db:"user_token,false,character varying"`
+	Remark    null.String `json:"Remark,omitempty" db:"remark,false,character varying"`
+}
+
+func (r *auditTestRow) GetTableName() string { return "t_user" }
+
+// auditTable answer the statements of an audited UPDATE on t_user, the rows of before are
+// locked, the rows of after are updated, the audit trail written are recorded in logs
+type auditTable struct {
+	before []string
+	after  []string
+
+	// the insert of audit trail fails if it's set
+	failed error
+
+	logs [][]driver.Value
+}
+
+func (a *auditTable) query(q string, args []driver.Value) (*fakeRows, error) {
+	images := func(list []string) *fakeRows {
+		r := &fakeRows{columns: []string{"to_jsonb"}}
+		for _, v := range list {
+			r.values = append(r.values, []driver.Value{[]byte(v)})
+		}
+		return r
+	}
+
+	switch {
+	case strings.HasPrefix(q, "SELECT to_jsonb(t_user) FROM t_user WHERE") && strings.HasSuffix(q, "FOR UPDATE"):
+		return images(a.before), nil
+	case strings.HasPrefix(q, "UPDATE t_user SET") && strings.HasSuffix(q, "RETURNING to_jsonb(t_user)"):
+		return images(a.after), nil
+	case strings.HasPrefix(q, "insert into t_account_opr_log("):
+		if a.failed != nil {
+			return nil, a.failed
+		}
+		a.logs = append(a.logs, args)
+		return &fakeRows{}, nil
+	}
+	return nil, errors.New("unexpected query: " + q)
+}
+
+// auditUpdate update the Account of the rows whose id > 0 by user 7 with role 100
+func auditUpdate(t *testing.T, a *auditTable) (db *fakeDB, err error) {
+	db = openFakeDB(t, a.query)
+
+	r := httptest.NewRequest("PUT", "/api/user", nil)
+	q := &ServiceCtx{R: r, Ep: &ServeEndPoint{}, SysUser: &TUser{ID: null.IntFrom(7)}, Role: 100}
+	ctx := context.WithValue(context.Background(), QNearKey, q)
+
+	err = DML(ctx, &Filter{TableMap: &auditTestRow{}}, &ReqProto{Action: "update",
+		Data:   json.RawMessage(`{"Account":"b"}`),
+		Filter: map[string]interface{}{"ID": map[string]interface{}{"GT": float64(0)}}})
+	return
+}
+
+func TestAuditWrite(t *testing.T) {
+	a := &auditTable{
+		before: []string{
+			`{"id": 1, "account": "a", "user_token": "old", "remark": null}`,
+			`{"id": 2, "account": "b", "user_token": null, "remark": "x"}`,
+		},
+		after: []string{`{"id": 1, "account": "b", "user_token": "old", "remark": null}`},
+	}
+	db, err := auditUpdate(t, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.commits != 1 || db.rollbacks != 0 {
+		t.Fatalf("%d commits, %d rollbacks", db.commits, db.rollbacks)
+	}
+
+	// the locked row 2 isn't changed
+	if len(a.logs) != 1 {
+		t.Fatalf("%d audit trails, want 1", len(a.logs))
+	}
+	l := a.logs[0]
+	if l[0] != "1" || l[3] != int64(7) || l[4] != int64(100) || l[6] != "UPDATE t_user" {
+		t.Fatalf("audit trail %v", l)
+	}
+
+	var original map[string]interface{}
+	if err = json.Unmarshal([]byte(l[1].(string)), &original); err != nil {
+		t.Fatal(err)
+	}
+	if original["account"] != "a" || original["user_token"] != "***" {
+		t.Fatalf("original %v", original)
+	}
+
+	var addi struct {
+		Table, RowID, Action, API, Method string
+		After                             map[string]interface{}
+		Changes                           map[string]map[string]interface{}
+	}
+	if err = json.Unmarshal([]byte(l[5].(string)), &addi); err != nil {
+		t.Fatal(err)
+	}
+	if addi.Table != "t_user" || addi.RowID != "1" || addi.Action != "UPDATE" ||
+		addi.API != "/api/user" || addi.Method != "PUT" {
+		t.Fatalf("addi %+v", addi)
+	}
+	if addi.After["account"] != "b" || addi.After["user_token"] != "***" {
+		t.Fatalf("after %v", addi.After)
+	}
+	if len(addi.Changes) != 1 || addi.Changes["account"]["before"] != "a" || addi.Changes["account"]["after"] != "b" {
+		t.Fatalf("changes %v", addi.Changes)
+	}
+}
+
+// TestAuditMaskNull the null sensitive column is recorded as null, its new value is masked
+func TestAuditMaskNull(t *testing.T) {
+	a := &auditTable{
+		before: []string{`{"id": 1, "account": "a", "user_token": null}`},
+		after:  []string{`{"id": 1, "account": "a", "user_token": "new"}`},
+	}
+	if _, err := auditUpdate(t, a); err != nil {
+		t.Fatal(err)
+	}
+
+	var addi struct {
+		Changes map[string]map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(a.logs[0][5].(string)), &addi); err != nil {
+		t.Fatal(err)
+	}
+	c, ok := addi.Changes["user_token"]
+	if len(addi.Changes) != 1 || !ok || c["before"] != nil || c["after"] != "***" {
+		t.Fatalf("changes %v", addi.Changes)
+	}
+}
+
+// TestAuditRollback the change is rolled back with its audit trail
+func TestAuditRollback(t *testing.T) {
+	a := &auditTable{
+		before: []string{`{"id": 1, "account": "a"}`},
+		after:  []string{`{"id": 1, "account": "b"}`},
+		failed: errors.New("t_account_opr_log unavailable"),
+	}
+	db, err := auditUpdate(t, a)
+	if err == nil || !strings.Contains(err.Error(), "t_account_opr_log unavailable") {
+		t.Fatalf("expect the error of audit trail, got %v", err)
+	}
+	if db.commits != 0 || db.rollbacks != 1 {
+		t.Fatalf("%d commits, %d rollbacks", db.commits, db.rollbacks)
+	}
+}
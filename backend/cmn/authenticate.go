@@ -0,0 +1,454 @@
+package cmn
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+
+	"w2w.io/null"
+)
+
+// 认证失败状态码, -410xx 均会导致 RespErr 清除 session
+const (
+	//CAuthNoCredential 未登录或未提供凭据
+	CAuthNoCredential = -41001
+
+	//CAuthInvalidCredential 凭据无效或已过期
+	CAuthInvalidCredential = -41002
+
+	//CAuthAccountDisabled 账号被禁止登录/锁定/标记为攻击者/过期
+	CAuthAccountDisabled = -41003
+
+	//CAuthNoDomain 账号没有任何有效的角色
+	CAuthNoDomain = -41004
+)
+
+//CSysUserByToken bearer token->指向sysUser(TUser).ID
+const CSysUserByToken = "tUserByToken"
+
+/*AuthenticateFn identify the requester by the credential it carried
+matched: false 表示请求中没有该认证方式的凭据, 交由下一个认证方式处理
+userID:  matched 且 err == nil 时为已认证的用户编号
+err:     凭据存在但无效, 应返回 CAuthInvalidCredential */
+type AuthenticateFn func(q *ServiceCtx) (matched bool, userID int64, err error)
+
+type authenticator struct {
+	name     string
+	priority int
+	fn       AuthenticateFn
+}
+
+var (
+	authenticators     []*authenticator
+	authenticatorMutex sync.RWMutex
+)
+
+func init() {
+	_ = AddAuthenticator("session", 0, sessionAuthenticate)
+	_ = AddAuthenticator("bearer", 10, bearerAuthenticate)
+	_ = AddAuthenticator("basic", 20, basicAuthenticate)
+}
+
+//AddAuthenticator register an authenticator, lower priority run first
+func AddAuthenticator(name string, priority int, fn AuthenticateFn) (err error) {
+	switch {
+	case name == "":
+		err = errors.New("authenticator name empty")
+	case fn == nil:
+		err = fmt.Errorf("authenticator %s with nil fn", name)
+	}
+	if err != nil {
+		if z != nil {
+			z.Error(err.Error())
+		}
+		return
+	}
+
+	authenticatorMutex.Lock()
+	defer authenticatorMutex.Unlock()
+
+	for _, v := range authenticators {
+		if v.name == name {
+			err = fmt.Errorf("authenticator %s already exists", name)
+			if z != nil {
+				z.Error(err.Error())
+			}
+			return
+		}
+	}
+
+	authenticators = append(authenticators, &authenticator{name: name, priority: priority, fn: fn})
+	sort.SliceStable(authenticators, func(i, j int) bool {
+		return authenticators[i].priority < authenticators[j].priority
+	})
+	return
+}
+
+/*Authenticate identify the requester and fill q.SysUser/Role/Domains/IsAdmin
+1 依次调用已注册的认证方式, 第一个匹配的认证方式决定认证结果
+2 q.Ep.WhiteList 为 true 时认证失败或无凭据不阻止访问, 仅不填充用户信息
+3 无凭据时, 如果 q.Ep.LoginPath 非空且为非 API 请求则重定向到登录页面
+4 失败时设置 q.Err 并以 -410xx 状态返回 */
+func Authenticate(ctx context.Context) {
+	zr := LoggerOf(ctx)
+	q := GetCtxValue(ctx)
+
+	if q.Ep == nil {
+		q.Err = fmt.Errorf("call Authenticate with nil q.Ep")
+		zr.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+	q.WhiteList = q.Ep.WhiteList
+
+	var matched bool
+	var userID int64
+	var err error
+
+	authenticatorMutex.RLock()
+	list := authenticators
+	authenticatorMutex.RUnlock()
+
+	for _, v := range list {
+		matched, userID, err = v.fn(q)
+		if !matched {
+			continue
+		}
+		if err != nil {
+			zr.Warn(fmt.Sprintf("%s authenticate failed: %s", v.name, err.Error()))
+		}
+		break
+	}
+
+	if !matched {
+		if q.WhiteList {
+			return
+		}
+
+		if q.Ep.LoginPath != "" && !rIsAPI.MatchString(q.R.URL.Path) {
+			q.Err = fmt.Errorf("redirect to %s", q.Ep.LoginPath)
+			q.Responded = true
+			q.Stop = true
+			http.Redirect(q.W, q.R, q.Ep.LoginPath+"?redirect="+url.QueryEscape(buildURL(q.R)), http.StatusFound)
+			return
+		}
+
+		q.Err = fmt.Errorf("please login")
+		q.Msg.Status = CAuthNoCredential
+		q.RespErr()
+		return
+	}
+
+	if err != nil {
+		if q.WhiteList {
+			return
+		}
+		q.Err = err
+		q.Msg.Status = CAuthInvalidCredential
+		q.RespErr()
+		return
+	}
+
+	var status int
+	status, err = loadSysUser(q, userID)
+	if err != nil {
+		if q.WhiteList {
+			q.SysUser = nil
+			q.Domains = nil
+			q.DomainList = nil
+			q.Role = 0
+			q.IsAdmin = false
+			return
+		}
+		q.Err = err
+		q.Msg.Status = status
+		q.RespErr()
+		return
+	}
+}
+
+//loadSysUser fill q.SysUser, q.Domains, q.DomainList, q.Role and q.IsAdmin by userID
+func loadSysUser(q *ServiceCtx, userID int64) (status int, err error) {
+	if userID <= 0 {
+		err = fmt.Errorf("invalid user id: %d", userID)
+		z.Error(err.Error())
+		status = CAuthInvalidCredential
+		return
+	}
+
+	if sqlxDB == nil {
+		err = fmt.Errorf("please connect to dbms")
+		z.Error(err.Error())
+		status = -1
+		return
+	}
+
+	var u *TUser
+	u, err = GetTUserByPk(sqlxDB, null.IntFrom(userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("user %d not found", userID)
+		z.Error(err.Error())
+		status = CAuthInvalidCredential
+		return
+	}
+	if err != nil {
+		z.Error(err.Error())
+		status = -1
+		return
+	}
+
+	//00: 有效, 02: 禁止登录, 04: 锁定, 06: 攻击者, 08: 过期
+	if u.Status.Valid && u.Status.String != "00" {
+		err = fmt.Errorf("account %d unavailable with status %s", userID, u.Status.String)
+		z.Warn(err.Error())
+		if u.Status.String == "06" {
+			q.Attacker = true
+		}
+		status = CAuthAccountDisabled
+		return
+	}
+
+	var domains []TDomain
+	domains, err = userDomains(userID)
+	if err != nil {
+		status = -1
+		return
+	}
+	if len(domains) == 0 {
+		err = fmt.Errorf("user %d has no available role", userID)
+		z.Warn(err.Error())
+		status = CAuthNoDomain
+		return
+	}
+
+	q.SysUser = u
+	q.Domains = domains
+	q.DomainList = q.DomainList[:0]
+	q.IsAdmin = false
+	for _, v := range domains {
+		q.DomainList = append(q.DomainList, v.Domain)
+
+		//0: 超级管理员, 3: 普通管理员
+		if v.Priority.Valid && v.Priority.Int64 <= 3 {
+			q.IsAdmin = true
+		}
+	}
+
+	// 选用角色: session 中记录的角色, 用户最近使用的角色, 用户的第一个角色
+	var role int64
+	if q.Session != nil {
+		role, _ = q.Session.Values["Role"].(int64)
+	}
+	if role == 0 && u.Role.Valid {
+		role = u.Role.Int64
+	}
+
+	q.Role = domains[0].ID.Int64
+	for _, v := range domains {
+		if v.ID.Int64 == role {
+			q.Role = role
+			break
+		}
+	}
+	return
+}
+
+//userDomains return the valid t_domain records the user belongs to
+func userDomains(userID int64) (domains []TDomain, err error) {
+	s := `select d.id, d.name, d.domain, d.priority, d.domain_id, d.status
+		from t_user_domain ud
+			join t_domain d on d.id = ud.domain
+		where ud.sys_user = $1
+			and coalesce(ud.status, '01') != '02'
+			and coalesce(d.status, '01') != '02'
+		order by d.priority asc, d.id asc`
+
+	var stmt *sqlx.Stmt
+	stmt, err = sqlxDB.Preparex(s)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	defer stmt.Close()
+
+	var rows *sqlx.Rows
+	rows, err = stmt.Queryx(userID)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d TDomain
+		err = rows.Scan(&d.ID, &d.Name, &d.Domain, &d.Priority, &d.DomainID, &d.Status)
+		if err != nil {
+			z.Error(err.Error())
+			return
+		}
+		domains = append(domains, d)
+	}
+	err = rows.Err()
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
+
+//sessionAuthenticate authenticate by the qNearSessions cookie
+func sessionAuthenticate(q *ServiceCtx) (matched bool, userID int64, err error) {
+	if q.Session == nil || q.Session.IsNew {
+		return
+	}
+
+	userID, _ = q.Session.Values["ID"].(int64)
+	if userID == 0 {
+		return
+	}
+
+	matched = true
+	if userID < 0 {
+		err = fmt.Errorf("invalid session user id: %d", userID)
+	}
+	return
+}
+
+//bearerAuthenticate authenticate by Authorization: Bearer <token>
+func bearerAuthenticate(q *ServiceCtx) (matched bool, userID int64, err error) {
+	token, ok := authorizationValue(q.R, "Bearer")
+	if !ok {
+		return
+	}
+	matched = true
+
+	if token == "" {
+		err = fmt.Errorf("empty bearer token")
+		return
+	}
+
+	r := q.Redis
+	if r == nil {
+		r = GetRedisConn()
+	}
+	if r == nil {
+		err = fmt.Errorf("redis unavailable to verify bearer token")
+		z.Error(err.Error())
+		return
+	}
+
+	userID, err = redis.Int64(r.Do("GET", fmt.Sprintf("%s:%s", CSysUserByToken, token)))
+	if errors.Is(err, redis.ErrNil) {
+		err = fmt.Errorf("invalid or expired bearer token")
+	}
+	return
+}
+
+//basicAuthenticate authenticate by Authorization: Basic base64(account:password)
+func basicAuthenticate(q *ServiceCtx) (matched bool, userID int64, err error) {
+	if _, ok := authorizationValue(q.R, "Basic"); !ok {
+		return
+	}
+	matched = true
+
+	account, pwd, ok := q.R.BasicAuth()
+	if !ok || account == "" || pwd == "" {
+		err = fmt.Errorf("malformed basic credential")
+		return
+	}
+
+	if sqlxDB == nil {
+		err = fmt.Errorf("please connect to dbms")
+		z.Error(err.Error())
+		return
+	}
+
+	//user_token: crypt('pwd',gen_salt('bf'))
+	s := `select id from t_user where account = $1 and user_token = crypt($2, user_token)`
+	err = sqlxDB.QueryRowx(s, account, pwd).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("invalid account or password")
+	}
+	return
+}
+
+//authorizationValue return the credential of the Authorization header with scheme
+func authorizationValue(r *http.Request, scheme string) (credential string, ok bool) {
+	if r == nil {
+		return
+	}
+	h := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(h) < len(scheme) || !strings.EqualFold(h[:len(scheme)], scheme) {
+		return
+	}
+	if len(h) > len(scheme) && h[len(scheme)] != ' ' {
+		return
+	}
+	return strings.TrimSpace(h[len(scheme):]), true
+}
+
+//IssueBearerToken create a bearer token for userID, it expires after ttl
+func IssueBearerToken(userID int64, ttl time.Duration) (token string, err error) {
+	if userID <= 0 {
+		err = fmt.Errorf("zero/Invalid userID")
+		z.Error(err.Error())
+		return
+	}
+	if ttl <= 0 {
+		err = fmt.Errorf("bearer token ttl should be positive")
+		z.Error(err.Error())
+		return
+	}
+
+	r := GetRedisConn()
+	if r == nil {
+		err = fmt.Errorf("redis unavailable to issue bearer token")
+		z.Error(err.Error())
+		return
+	}
+
+	buf := make([]byte, 24)
+	_, err = rand.Read(buf)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	token = hex.EncodeToString(buf)
+
+	_, err = r.Do("SET", fmt.Sprintf("%s:%s", CSysUserByToken, token), userID,
+		"EX", int64(ttl/time.Second))
+	if err != nil {
+		z.Error(err.Error())
+		token = ""
+	}
+	return
+}
+
+//RevokeBearerToken drop the bearer token
+func RevokeBearerToken(token string) (err error) {
+	if token == "" {
+		return
+	}
+	r := GetRedisConn()
+	if r == nil {
+		err = fmt.Errorf("redis unavailable to revoke bearer token")
+		z.Error(err.Error())
+		return
+	}
+	_, err = r.Do("DEL", fmt.Sprintf("%s:%s", CSysUserByToken, token))
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
@@ -0,0 +1,254 @@
+package cmn
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/gorilla/sessions"
+)
+
+// fakeRedis answers GET of the bearer tokens
+type fakeRedis struct {
+	tokens map[string]int64
+}
+
+func (c *fakeRedis) Close() error                      { return nil }
+func (c *fakeRedis) Err() error                        { return nil }
+func (c *fakeRedis) Send(string, ...interface{}) error { return nil }
+func (c *fakeRedis) Flush() error                      { return nil }
+func (c *fakeRedis) Receive() (interface{}, error)     { return nil, nil }
+func (c *fakeRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd != "GET" || len(args) != 1 {
+		return nil, errors.New("unexpected redis command " + cmd)
+	}
+	id, ok := c.tokens[args[0].(string)]
+	if !ok {
+		return nil, nil
+	}
+	return id, nil
+}
+
+// openAuthDB answer the user, domain and basic credential queries of the users,
+// status of each user is its t_user.status, users without domain have no role
+func openAuthDB(t *testing.T, users map[int64]string, domains map[int64][][]driver.Value) *fakeDB {
+	return openFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT id, external_id_type,"):
+			id := args[0].(int64)
+			status, ok := users[id]
+			if !ok {
+				return &fakeRows{columns: []string{"id"}}, nil
+			}
+			row := make([]driver.Value, 45)
+			row[0], row[3], row[26], row[44] = id, "", int64(0), status
+			return &fakeRows{values: [][]driver.Value{row}}, nil
+
+		case strings.Contains(query, "from t_user_domain ud"):
+			return &fakeRows{columns: make([]string, 6), values: domains[args[0].(int64)]}, nil
+
+		case strings.HasPrefix(query, "select id from t_user where account = $1"):
+			if args[0] == "bob" && args[1] == "secret" {
+				return &fakeRows{values: [][]driver.Value{{int64(6)}}}, nil
+			}
+			return &fakeRows{columns: []string{"id"}}, nil
+		}
+		return nil, errors.New("unexpected query: " + query)
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	openAuthDB(t, map[int64]string{5: "00", 6: "00", 7: "00", 8: "02", 9: "06", 10: "00"},
+		map[int64][][]driver.Value{
+			5:  {{int64(100), "user", "sys^user", int64(10), nil, "00"}},
+			6:  {{int64(101), "admin", "sys^admin", int64(3), nil, "00"}, {int64(100), "user", "sys^user", int64(10), nil, "00"}},
+			7:  {{int64(100), "user", "sys^user", int64(10), nil, "00"}},
+			8:  {{int64(100), "user", "sys^user", int64(10), nil, "00"}},
+			9:  {{int64(100), "user", "sys^user", int64(10), nil, "00"}},
+			10: nil,
+		})
+	redisConn := &fakeRedis{tokens: map[string]int64{"tUserByToken:t7": 7, "tUserByToken:t4": 4,
+		"tUserByToken:t8": 8, "tUserByToken:t9": 9, "tUserByToken:t10": 10}}
+
+	cases := []struct {
+		name      string
+		path      string
+		ep        ServeEndPoint
+		sessionID int64
+		header    string
+
+		status   int
+		userID   int64
+		isAdmin  bool
+		attacker bool
+		location string
+	}{
+		{name: "no credential", path: "/api/order", status: CAuthNoCredential},
+		{name: "no credential in white list", path: "/api/order", ep: ServeEndPoint{WhiteList: true}},
+		{name: "redirect to login page", path: "/order.html", ep: ServeEndPoint{LoginPath: "/login"},
+			location: "/login?redirect="},
+		{name: "session", path: "/api/order", sessionID: 5, userID: 5},
+		{name: "session before bearer", path: "/api/order", sessionID: 5, header: "Bearer t7", userID: 5},
+		{name: "negative session id", path: "/api/order", sessionID: -1, status: CAuthInvalidCredential},
+		{name: "bearer", path: "/api/order", header: "bearer t7", userID: 7},
+		{name: "expired bearer", path: "/api/order", header: "Bearer t0", status: CAuthInvalidCredential},
+		{name: "expired bearer in white list", path: "/api/order", header: "Bearer t0",
+			ep: ServeEndPoint{WhiteList: true}},
+		{name: "basic administrator", path: "/api/order", header: basicHeader("bob", "secret"), userID: 6, isAdmin: true},
+		{name: "basic wrong password", path: "/api/order", header: basicHeader("bob", "guess"),
+			status: CAuthInvalidCredential},
+		{name: "malformed basic", path: "/api/order", header: "Basic !!", status: CAuthInvalidCredential},
+		{name: "unknown user", path: "/api/order", header: "Bearer t4", status: CAuthInvalidCredential},
+		{name: "forbidden account", path: "/api/order", header: "Bearer t8", status: CAuthAccountDisabled},
+		{name: "attacker", path: "/api/order", header: "Bearer t9", status: CAuthAccountDisabled, attacker: true},
+		{name: "no domain", path: "/api/order", header: "Bearer t10", status: CAuthNoDomain},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", c.path, nil)
+			if c.header != "" {
+				r.Header.Set("Authorization", c.header)
+			}
+			s := sessions.NewSession(nil, "qNearSessions")
+			if c.sessionID != 0 {
+				s.IsNew = false
+				s.Values["ID"] = c.sessionID
+			}
+			ep := c.ep
+			q := &ServiceCtx{W: w, R: r, Ep: &ep, Session: s, Redis: redisConn,
+				Msg: &ReplyProto{API: r.URL.Path, Method: r.Method}}
+
+			Authenticate(context.WithValue(context.Background(), QNearKey, q))
+
+			if c.location != "" {
+				if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), c.location) {
+					t.Fatalf("expect redirect to %s, got %d %s", c.location, w.Code, w.Header().Get("Location"))
+				}
+				return
+			}
+			if q.Msg.Status != c.status {
+				t.Fatalf("expect status %d, got %d: %v", c.status, q.Msg.Status, q.Err)
+			}
+			if q.Attacker != c.attacker {
+				t.Fatalf("expect attacker %v", c.attacker)
+			}
+			if c.userID == 0 {
+				if q.SysUser != nil || q.Responded != (c.status != 0) {
+					t.Fatalf("user %v, responded %v", q.SysUser, q.Responded)
+				}
+				return
+			}
+			if q.SysUser == nil || q.SysUser.ID.Int64 != c.userID || q.IsAdmin != c.isAdmin {
+				t.Fatalf("expect user %d admin %v, got %+v admin %v", c.userID, c.isAdmin, q.SysUser, q.IsAdmin)
+			}
+			if q.Role != q.Domains[0].ID.Int64 || len(q.DomainList) != len(q.Domains) {
+				t.Fatalf("role %d, domains %v", q.Role, q.DomainList)
+			}
+		})
+	}
+}
+
+// TestAuthenticateRole the role recorded in session is selected if the user has it
+func TestAuthenticateRole(t *testing.T) {
+	openAuthDB(t, map[int64]string{6: "00"}, map[int64][][]driver.Value{
+		6: {{int64(101), "admin", "sys^admin", int64(3), nil, "00"}, {int64(100), "user", "sys^user", int64(10), nil, "00"}},
+	})
+
+	for _, c := range []struct {
+		role   int64
+		expect int64
+	}{{100, 100}, {101, 101}, {999, 101}} {
+		s := sessions.NewSession(nil, "qNearSessions")
+		s.IsNew = false
+		s.Values["ID"] = int64(6)
+		s.Values["Role"] = c.role
+		r := httptest.NewRequest("GET", "/api/order", nil)
+		q := &ServiceCtx{W: httptest.NewRecorder(), R: r, Ep: &ServeEndPoint{}, Session: s,
+			Msg: &ReplyProto{API: r.URL.Path, Method: r.Method}}
+
+		Authenticate(context.WithValue(context.Background(), QNearKey, q))
+		if q.Role != c.expect {
+			t.Fatalf("session role %d: expect %d, got %d", c.role, c.expect, q.Role)
+		}
+	}
+}
+
+func TestAddAuthenticator(t *testing.T) {
+	list := authenticators
+	t.Cleanup(func() { authenticators = list })
+
+	if AddAuthenticator("", 0, sessionAuthenticate) == nil {
+		t.Fatal("empty name should be refused")
+	}
+	if AddAuthenticator("nil", 0, nil) == nil {
+		t.Fatal("nil fn should be refused")
+	}
+	if AddAuthenticator("session", 5, sessionAuthenticate) == nil {
+		t.Fatal("duplicated name should be refused")
+	}
+
+	var called []string
+	fn := func(name string, matched bool) AuthenticateFn {
+		return func(q *ServiceCtx) (bool, int64, error) {
+			called = append(called, name)
+			return matched, 0, errors.New(name + " rejected")
+		}
+	}
+	if err := AddAuthenticator("last", 100, fn("last", true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAuthenticator("first", -1, fn("first", false)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/api/order", nil)
+	q := &ServiceCtx{W: httptest.NewRecorder(), R: r, Ep: &ServeEndPoint{},
+		Session: sessions.NewSession(nil, "qNearSessions"),
+		Msg:     &ReplyProto{API: r.URL.Path, Method: r.Method}}
+	Authenticate(context.WithValue(context.Background(), QNearKey, q))
+
+	if strings.Join(called, ",") != "first,last" {
+		t.Fatalf("authenticators called in %v", called)
+	}
+	if q.Msg.Status != CAuthInvalidCredential || q.Msg.Msg != "last rejected" {
+		t.Fatalf("status %d, msg %s", q.Msg.Status, q.Msg.Msg)
+	}
+}
+
+func TestAuthorizationValue(t *testing.T) {
+	for _, c := range []struct {
+		header, scheme, credential string
+		ok                         bool
+	}{
+		{"", "Bearer", "", false},
+		{"Bearer abc", "Bearer", "abc", true},
+		{"  bearer   abc ", "Bearer", "abc", true},
+		{"Bearer", "Bearer", "", true},
+		{"Bearerabc", "Bearer", "", false},
+		{"Basic abc", "Bearer", "", false},
+		{"Bear", "Bearer", "", false},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", c.header)
+		credential, ok := authorizationValue(r, c.scheme)
+		if credential != c.credential || ok != c.ok {
+			t.Fatalf("%q: expect %q %v, got %q %v", c.header, c.credential, c.ok, credential, ok)
+		}
+	}
+}
+
+// basicHeader the Authorization header of the basic credential
+func basicHeader(account, pwd string) string {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth(account, pwd)
+	return r.Header.Get("Authorization")
+}
+
+var _ redis.Conn = (*fakeRedis)(nil)
@@ -20,6 +20,9 @@ type ReplyProto struct {
 	// RowCount, just row count
 	RowCount int64 `json:"rowCount,omitempty"`
 
+	//NextCursor, cursor of the next page for keyset pagination, empty means the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+
 	//API, call target
 	API string `json:"API,omitempty"`
 
@@ -40,12 +43,50 @@ type ReqProto struct {
 	Page     int64 `json:"page,omitempty"`
 	PageSize int64 `json:"pageSize,omitempty"`
 
+	//Cursor 非nil时使用 keyset 分页(忽略 Page), 空字符串为第一页,
+	//  之后使用上一次应答的 nextCursor, 排序条件须与生成 cursor 的请求一致
+	Cursor *string `json:"cursor,omitempty"`
+
+	//Aggregates 聚合列, 例如 [{"fn":"sum","field":"amount","as":"totalAmount"},{"fn":"count","field":"*"}]
+	Aggregates []AggregateProto `json:"aggregates,omitempty"`
+
+	//GroupBy 分组列, 例如 ["status","domainID"]
+	GroupBy []string `json:"groupBy,omitempty"`
+
+	//Having 分组过滤条件, 格式与 Filter 相同, 键可以使用 Aggregates 的别名
+	Having interface{} `json:"having,omitempty"`
+
+	//Expand 展开外键关联的数据, 例如 {"Creator":["ID","OfficialName"]},
+	//  结果中以关联名作为键返回嵌套对象, 关联见 cmn.TableRelations
+	Expand map[string][]string `json:"expand,omitempty"`
+
+	//Version 乐观锁, UPDATE 时提交读取到的 version 或 update_time 值,
+	//  数据已被他人修改时应答 status 为 CDMLConflict, data 为当前数据
+	Version interface{} `json:"version,omitempty"`
+
+	//IncludeDeleted SELECT 时包含已软删除的数据
+	IncludeDeleted bool `json:"includeDeleted,omitempty"`
+
 	Data   json.RawMessage `json:"data,omitempty"`
 	Filter interface{}     `json:"filter,omitempty"`
 
+	//AuthFilter 数据范围条件, 由服务端依据 ServeEndPoint.AccessControlLevel 生成,
+	//  客户端提交的值会被忽略
 	AuthFilter interface{} `json:"authFilter,omitempty"`
 }
 
+//AggregateProto aggregate projection of ReqProto
+type AggregateProto struct {
+	//Fn, count, countDistinct, sum, avg, min, max
+	Fn string `json:"fn"`
+
+	//Field, column name or json name of the TableMap, "*" only for count
+	Field string `json:"field"`
+
+	//As, alias of the result, default to fn_column
+	As string `json:"as,omitempty"`
+}
+
 //QNearTime for customize json.Unmarshal
 type QNearTime struct {
 	time.Time
@@ -0,0 +1,235 @@
+package cmn
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// keyset pagination: 可为空的列按 NULLS LAST 排序(ASC/DESC 相同), cursor 中该列为 null 时,
+// 之后的行为该列 IS NULL 且后续列在 cursor 之后的行; 主键及非 null.* 类型的列视为非空
+
+//keysetColumn a column of keyset pagination, desc: order by descending
+type keysetColumn struct {
+	name     string
+	desc     bool
+	nullable bool
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+//nullableColumn whether the column of t may be null, by the type of its field
+func nullableColumn(t reflect.Type, column string) bool {
+	if t == nil {
+		return true
+	}
+	f, found := dbColumnOf(t, column)
+	if !found {
+		return true
+	}
+	switch f.Type.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	}
+	return f.Type.Implements(valuerType)
+}
+
+//keysetCursor the content of ReqProto.Cursor/ReplyProto.NextCursor
+type keysetCursor struct {
+	// Key the order by clause the cursor created with
+	Key string `json:"k"`
+
+	// Values the keyset values of the last row of previous page
+	Values []interface{} `json:"v"`
+}
+
+/*keysetColumns build keyset from order by list and primary keys of t, the TableMap struct type,
+primary keys are appended to make the keyset unique, their direction follow
+the last order by column */
+func keysetColumns(orderByList []string, pkList []string, t reflect.Type) (columns []keysetColumn) {
+	isPK := make(map[string]bool)
+	for _, v := range pkList {
+		isPK[strings.ToLower(v)] = true
+	}
+
+	exists := make(map[string]bool)
+	desc := false
+	for _, v := range orderByList {
+		a := strings.Fields(v)
+		if len(a) == 0 {
+			continue
+		}
+		desc = len(a) > 1 && strings.ToUpper(a[1]) == "DESC"
+		columns = append(columns, keysetColumn{name: a[0], desc: desc,
+			nullable: !isPK[strings.ToLower(a[0])] && nullableColumn(t, a[0])})
+		exists[strings.ToLower(a[0])] = true
+	}
+
+	for _, v := range pkList {
+		if exists[strings.ToLower(v)] {
+			continue
+		}
+		columns = append(columns, keysetColumn{name: v, desc: desc})
+	}
+	return
+}
+
+//keysetOrderBy return the order by clause of the keyset
+func keysetOrderBy(columns []keysetColumn) string {
+	var a []string
+	for _, v := range columns {
+		s := v.name + " ASC"
+		if v.desc {
+			s = v.name + " DESC"
+		}
+		if v.nullable {
+			s = s + " NULLS LAST"
+		}
+		a = append(a, s)
+	}
+	return strings.Join(a, ",")
+}
+
+//decodeCursor parse the cursor created by encodeCursor, empty cursor means the first page
+func decodeCursor(cursor string, columns []keysetColumn) (values []interface{}, err error) {
+	if cursor == "" {
+		return
+	}
+
+	var buf []byte
+	buf, err = base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		err = fmt.Errorf("invalid cursor: %s", err.Error())
+		z.Error(err.Error())
+		return
+	}
+
+	var c keysetCursor
+	err = json.Unmarshal(buf, &c)
+	if err != nil {
+		err = fmt.Errorf("invalid cursor: %s", err.Error())
+		z.Error(err.Error())
+		return
+	}
+
+	if c.Key != keysetOrderBy(columns) || len(c.Values) != len(columns) {
+		err = fmt.Errorf("the cursor doesn't match the orderBy of the request")
+		z.Error(err.Error())
+		return
+	}
+
+	for i, v := range c.Values {
+		if v == nil && !columns[i].nullable {
+			err = fmt.Errorf("the cursor contains null value of %s", columns[i].name)
+			z.Error(err.Error())
+			return
+		}
+	}
+
+	jsonDataTypeToGo(c.Values)
+	values = c.Values
+	return
+}
+
+//encodeCursor create cursor by the keyset values of the last row
+func encodeCursor(columns []keysetColumn, values []interface{}) (cursor string, err error) {
+	var buf []byte
+	buf, err = json.Marshal(&keysetCursor{Key: keysetOrderBy(columns), Values: values})
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	cursor = base64.RawURLEncoding.EncodeToString(buf)
+	return
+}
+
+/*keysetExpr build where clause that locate rows after the cursor values, for order by a ASC, b DESC, id ASC
+	(a > $1) OR (a = $1 AND b < $2) OR (a = $1 AND b = $2 AND id > $3)
+  the nulls of nullable column are the last, for b DESC NULLS LAST with b null in the cursor
+	(a > $1) OR (a = $1 AND b IS NULL AND id > $2)
+  beginPos is the count of the parameters before the clause, args are the parameters of the non-null values */
+func keysetExpr(columns []keysetColumn, values []interface{}, beginPos int) (expr string, args []interface{}) {
+	params := make([]string, len(columns))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		args = append(args, v)
+		params[i] = fmt.Sprintf("$%d", beginPos+len(args))
+	}
+
+	var terms []string
+	for i, v := range columns {
+		// no row is after null in the column, the rows with null are ordered by the next columns
+		if values[i] == nil {
+			continue
+		}
+
+		var conditions []string
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				conditions = append(conditions, columns[j].name+" IS NULL")
+				continue
+			}
+			conditions = append(conditions, fmt.Sprintf("%s = %s", columns[j].name, params[j]))
+		}
+		opr := ">"
+		if v.desc {
+			opr = "<"
+		}
+		c := fmt.Sprintf("%s %s %s", v.name, opr, params[i])
+		if v.nullable {
+			c = fmt.Sprintf("(%s OR %s IS NULL)", c, v.name)
+		}
+		conditions = append(conditions, c)
+		terms = append(terms, "("+strings.Join(conditions, " AND ")+")")
+	}
+	if len(terms) == 0 {
+		expr = "false"
+		return
+	}
+	expr = strings.Join(terms, " OR ")
+	return
+}
+
+//encodeCursorOf create cursor by p, the last row of current page
+func encodeCursorOf(p interface{}, columns []keysetColumn) (cursor string, err error) {
+	var values []interface{}
+	values, err = keysetValues(p, columns)
+	if err != nil {
+		return
+	}
+	cursor, err = encodeCursor(columns, values)
+	return
+}
+
+//keysetValues get the keyset values from p, a pointer to the TableMap struct
+func keysetValues(p interface{}, columns []keysetColumn) (values []interface{}, err error) {
+	v := reflect.ValueOf(p)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	t := v.Type()
+
+	for _, c := range columns {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			s, ok := t.Field(i).Tag.Lookup("db")
+			if !ok || !strings.EqualFold(strings.Split(s, ",")[0], c.name) {
+				continue
+			}
+			found = true
+			values = append(values, v.Field(i).Interface())
+			break
+		}
+		if !found {
+			err = fmt.Errorf("keyset column %s not found on %s", c.name, t.Name())
+			z.Error(err.Error())
+			return
+		}
+	}
+	return
+}
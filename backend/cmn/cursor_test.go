@@ -0,0 +1,137 @@
+package cmn
+
+import (
+	"reflect"
+	"testing"
+
+	"w2w.io/null"
+)
+
+type keysetTestRow struct {
+	ID         null.Int    `db:"id,true,bigint"`
+	Name       null.String `db:"name,false,character varying"`
+	CreateTime int64       `db:"create_time,false,bigint"`
+}
+
+func TestKeysetColumns(t *testing.T) {
+	columns := keysetColumns([]string{"name desc", "create_time"}, []string{"id"}, reflect.TypeOf(keysetTestRow{}))
+	want := []keysetColumn{
+		{name: "name", desc: true, nullable: true},
+		{name: "create_time"},
+		{name: "id"},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Fatalf("keysetColumns = %+v, want %+v", columns, want)
+	}
+	if s := keysetOrderBy(columns); s != "name DESC NULLS LAST,create_time ASC,id ASC" {
+		t.Fatalf("keysetOrderBy = %s", s)
+	}
+
+	// the primary key is never null even if it is in the order by list
+	columns = keysetColumns([]string{"id desc"}, []string{"id"}, reflect.TypeOf(keysetTestRow{}))
+	if !reflect.DeepEqual(columns, []keysetColumn{{name: "id", desc: true}}) {
+		t.Fatalf("keysetColumns = %+v", columns)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	columns := []keysetColumn{{name: "name", nullable: true}, {name: "create_time", desc: true}, {name: "id"}}
+	cases := []struct {
+		name string
+		row  keysetTestRow
+		want []interface{}
+	}{
+		{"values", keysetTestRow{ID: null.IntFrom(3), Name: null.StringFrom("a"), CreateTime: 1650000000000},
+			[]interface{}{"a", int64(1650000000000), int64(3)}},
+		{"null value", keysetTestRow{ID: null.IntFrom(4), CreateTime: 7},
+			[]interface{}{nil, int64(7), int64(4)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cursor, err := encodeCursorOf(&c.row, columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, err := decodeCursor(cursor, columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, c.want) {
+				t.Fatalf("decodeCursor = %#v, want %#v", values, c.want)
+			}
+		})
+	}
+
+	cursor, err := encodeCursor(columns, []interface{}{"a", 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := []struct {
+		name    string
+		cursor  string
+		columns []keysetColumn
+	}{
+		{"not base64", "not base64", columns},
+		{"not json", "bm90IGpzb24", columns},
+		{"another order by", cursor, []keysetColumn{{name: "name", nullable: true}, {name: "id"}}},
+		{"without values", "eyJrIjoiaWQgQVNDIn0", []keysetColumn{{name: "id"}}},
+	}
+	for _, c := range invalid {
+		if _, err := decodeCursor(c.cursor, c.columns); err == nil {
+			t.Errorf("%s: decodeCursor should fail", c.name)
+		}
+	}
+
+	// null is rejected on the column that isn't nullable
+	cursor, _ = encodeCursor([]keysetColumn{{name: "id"}}, []interface{}{nil})
+	if _, err = decodeCursor(cursor, []keysetColumn{{name: "id"}}); err == nil {
+		t.Error("null value of id should be rejected")
+	}
+}
+
+func TestKeysetExpr(t *testing.T) {
+	cases := []struct {
+		name    string
+		columns []keysetColumn
+		values  []interface{}
+		expr    string
+		args    []interface{}
+	}{
+		{"ascending",
+			[]keysetColumn{{name: "a"}, {name: "id"}},
+			[]interface{}{1, 2},
+			"(a > $3) OR (a = $3 AND id > $4)",
+			[]interface{}{1, 2}},
+		{"descending",
+			[]keysetColumn{{name: "a", desc: true}, {name: "id", desc: true}},
+			[]interface{}{1, 2},
+			"(a < $3) OR (a = $3 AND id < $4)",
+			[]interface{}{1, 2}},
+		{"nullable",
+			[]keysetColumn{{name: "a", nullable: true}, {name: "id"}},
+			[]interface{}{"x", 2},
+			"((a > $3 OR a IS NULL)) OR (a = $3 AND id > $4)",
+			[]interface{}{"x", 2}},
+		{"null in the cursor",
+			[]keysetColumn{{name: "a"}, {name: "b", desc: true, nullable: true}, {name: "id"}},
+			[]interface{}{1, nil, 2},
+			"(a > $3) OR (a = $3 AND b IS NULL AND id > $4)",
+			[]interface{}{1, 2}},
+		{"nothing after",
+			[]keysetColumn{{name: "a", nullable: true}},
+			[]interface{}{nil},
+			"false",
+			nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expr, args := keysetExpr(c.columns, c.values, 2)
+			if expr != c.expr {
+				t.Fatalf("expr = %s, want %s", expr, c.expr)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("args = %v, want %v", args, c.args)
+			}
+		})
+	}
+}
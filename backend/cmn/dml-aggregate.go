@@ -0,0 +1,291 @@
+package cmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//aggregateFnList aggregate function supported by ReqProto.Aggregates
+var aggregateFnList = map[string]string{
+	"COUNT":         "count(%s)",
+	"COUNTDISTINCT": "count(DISTINCT %s)",
+	"SUM":           "sum(%s)",
+	"AVG":           "avg(%s)",
+	"MIN":           "min(%s)",
+	"MAX":           "max(%s)",
+}
+
+var aggregateAliasRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+//isAggregate report whether req is an aggregate query
+func isAggregate(req *ReqProto) bool {
+	return len(req.Aggregates) > 0 || len(req.GroupBy) > 0
+}
+
+/*aggregateColumns validate req.Aggregates by f.mapKey, return the select list
+and map of upper case alias to aggregate expression */
+func (r *Filter) aggregateColumns(req *ReqProto, tblName string) (columns []string,
+	exprByAlias map[string]string, err error) {
+	zr := LoggerOf(r.ctx)
+
+	exprByAlias = make(map[string]string)
+	for i, v := range req.Aggregates {
+		fn, ok := aggregateFnList[strings.ToUpper(v.Fn)]
+		if !ok {
+			err = fmt.Errorf("aggregates[%d]: unsupported aggregate function %s", i, v.Fn)
+			zr.Error(err.Error())
+			return
+		}
+
+		columnName := "*"
+		if v.Field != "*" {
+			var found bool
+			columnName, found = r.mapKey(v.Field)
+			if !found {
+				err = fmt.Errorf("aggregates[%d]: unknown %s on %s", i, v.Field, tblName)
+				zr.Error(err.Error())
+				return
+			}
+		} else if strings.ToUpper(v.Fn) != "COUNT" {
+			err = fmt.Errorf("aggregates[%d]: %s(*) is not allowed", i, v.Fn)
+			zr.Error(err.Error())
+			return
+		}
+
+		alias := v.As
+		if alias == "" {
+			alias = strings.ToLower(v.Fn)
+			if columnName != "*" {
+				alias = alias + "_" + columnName
+			}
+		}
+		if !aggregateAliasRe.MatchString(alias) {
+			err = fmt.Errorf("aggregates[%d]: invalid alias %s", i, alias)
+			zr.Error(err.Error())
+			return
+		}
+		if _, ok := exprByAlias[strings.ToUpper(alias)]; ok {
+			err = fmt.Errorf("aggregates[%d]: duplicated alias %s", i, alias)
+			zr.Error(err.Error())
+			return
+		}
+		if _, found := r.mapKey(alias); found {
+			err = fmt.Errorf("aggregates[%d]: alias %s conflicts with column on %s", i, alias, tblName)
+			zr.Error(err.Error())
+			return
+		}
+
+		expr := fmt.Sprintf(fn, columnName)
+		exprByAlias[strings.ToUpper(alias)] = expr
+		columns = append(columns, fmt.Sprintf(`%s AS "%s"`, expr, alias))
+	}
+	return
+}
+
+/*aggregateSelect SELECT with aggregates/groupBy/having
+	sets 与 aggregates 不能同时使用, groupBy 列自动加入查询列
+	having 与 filter 格式相同, 键可以是聚合列的别名或表的列名
+	orderBy 键可以是聚合列的别名或 groupBy 中的列, 缺省按 groupBy 排序
+	f.RowCount 为分组数, f.QryResult 为 json 数组字符串 */
+func aggregateSelect(f *Filter, req *ReqProto, tblName string) (err error) {
+	zr := LoggerOf(f.ctx)
+	if len(req.Sets) > 0 {
+		err = fmt.Errorf("sets can't be used with aggregates/groupBy on " + tblName)
+		zr.Error(err.Error())
+		return
+	}
+	if len(req.Expand) > 0 {
+		err = fmt.Errorf("expand can't be used with aggregates/groupBy on " + tblName)
+		zr.Error(err.Error())
+		return
+	}
+	if req.Cursor != nil {
+		err = fmt.Errorf("cursor pagination can't be used with aggregates/groupBy on " + tblName)
+		zr.Error(err.Error())
+		return
+	}
+
+	var groupBy []string
+	for _, v := range req.GroupBy {
+		columnName, found := f.mapKey(v)
+		if !found {
+			err = fmt.Errorf("unknown " + v + " in groupBy on " + tblName)
+			zr.Error(err.Error())
+			return
+		}
+		groupBy = append(groupBy, columnName)
+	}
+
+	var aggregates []string
+	var exprByAlias map[string]string
+	aggregates, exprByAlias, err = f.aggregateColumns(req, tblName)
+	if err != nil {
+		return
+	}
+	columns := append(append([]string{}, groupBy...), aggregates...)
+	if len(columns) == 0 {
+		err = fmt.Errorf("empty select list on " + tblName)
+		zr.Error(err.Error())
+		return
+	}
+
+	var orderByList []string
+	for i := 0; i < len(req.OrderBy); i++ {
+		for key, value := range req.OrderBy[i] {
+			value = strings.ToUpper(value)
+			if value != "ASC" && value != "DESC" {
+				err = fmt.Errorf("unknown " + value + " order type with " + key + " on " + tblName)
+				zr.Error(err.Error())
+				return
+			}
+
+			if _, ok := exprByAlias[strings.ToUpper(key)]; ok {
+				orderByList = append(orderByList, exprByAlias[strings.ToUpper(key)]+" "+value)
+				continue
+			}
+
+			columnName, found := f.mapKey(key)
+			if !found {
+				err = fmt.Errorf("unknown " + key + " on " + tblName)
+				zr.Error(err.Error())
+				return
+			}
+			orderByList = append(orderByList, columnName+" "+value)
+		}
+	}
+	if len(orderByList) == 0 {
+		orderByList = groupBy
+	}
+
+	var expr string
+	expr, err = f.CreateFilter(req)
+	if err != nil {
+		return
+	}
+	if expr == "" {
+		expr = "1=1"
+	}
+	if f.AuthExpr != "" {
+		expr = fmt.Sprintf("(%s) and (%s)", expr, f.AuthExpr)
+		f.Values = append(f.Values, f.AuthWhereValues...)
+	}
+	if sd := softDeleteOf(reflect.TypeOf(f.TableMap).Elem()); sd != nil && !req.IncludeDeleted {
+		cond, v := sd.excludeDeleted(len(f.Values))
+		expr = fmt.Sprintf("(%s) and %s", expr, cond)
+		f.Values = append(f.Values, v)
+	}
+
+	s := fmt.Sprintf("FROM %s WHERE %s", tblName, expr)
+	if len(groupBy) > 0 {
+		s = s + " GROUP BY " + strings.Join(groupBy, ",")
+	}
+
+	if req.Having != nil {
+		jsonDataTypeToGo(req.Having)
+
+		// the keys of having are resolved to aggregate expression first
+		f.AuthProc = false
+		f.aggregates = exprByAlias
+		var having string
+		having, err = f.MakeFilter(req.Having)
+		f.aggregates = nil
+		if err != nil {
+			return
+		}
+		having = strings.TrimSpace(having)
+		if having != "" {
+			s = s + " HAVING " + having
+		}
+	}
+
+	// ---------
+	// get row count
+	var stmt *sqlx.Stmt
+	if len(groupBy) > 0 {
+		q := fmt.Sprintf("SELECT count(*) as row_count FROM (SELECT 1 %s) t", s)
+		zr.Info(q)
+		var release func()
+		stmt, release, err = acquireStmt(q)
+		if err != nil {
+			return
+		}
+		defer release()
+
+		err = stmt.QueryRowxContext(f.dbCtx(), f.Values...).Scan(&f.RowCount)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+	}
+
+	// ---------
+	q := fmt.Sprintf("SELECT %s %s", strings.Join(columns, ","), s)
+	if len(orderByList) > 0 {
+		q = q + " ORDER BY " + strings.Join(orderByList, ",")
+	}
+	values := f.Values
+	if req.PageSize != 0 {
+		q = q + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(values)+1, len(values)+2)
+		values = append(values, req.PageSize, req.Page*req.PageSize)
+	}
+	zr.Info(q)
+	zr.Info(fmt.Sprintf("%v", values))
+
+	var release func()
+	stmt, release, err = acquireStmt(q)
+	if err != nil {
+		return
+	}
+	defer release()
+
+	var rows *sqlx.Rows
+	rows, err = stmt.QueryxContext(f.dbCtx(), values...)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	var qryResults []string
+	for rows.Next() {
+		m := make(map[string]interface{})
+		err = rows.MapScan(m)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+		for k, v := range m {
+			// numeric is scanned as []byte
+			if b, ok := v.([]byte); ok {
+				m[k] = json.RawMessage(b)
+				if !json.Valid(b) {
+					m[k] = string(b)
+				}
+			}
+		}
+
+		var buf []byte
+		buf, err = json.Marshal(m)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+		qryResults = append(qryResults, string(buf))
+	}
+	err = rows.Err()
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+
+	if len(groupBy) == 0 {
+		f.RowCount = int64(len(qryResults))
+	}
+	f.QryResult = "[" + strings.Join(qryResults, ",") + "]"
+	return
+}
@@ -0,0 +1,156 @@
+package cmn
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"w2w.io/null"
+)
+
+type aggregateTestRow struct {
+	ID       null.Int    `json:"ID,omitempty" db:"id,true,bigint"`
+	Status   null.String `json:"Status,omitempty" db:"status,false,character varying"`
+	Amount   null.Float  `json:"Amount,omitempty" db:"amount,false,numeric"`
+	DomainID null.Int    `json:"DomainID,omitempty" db:"domain_id,false,bigint"`
+}
+
+func (r *aggregateTestRow) GetTableName() string { return "t_aggregate" }
+func (r *aggregateTestRow) Fields() []string     { return []string{"ID", "Status", "Amount", "DomainID"} }
+
+func TestAggregateColumns(t *testing.T) {
+	cases := []struct {
+		name       string
+		aggregates string
+		columns    []string
+		err        string
+	}{
+		{"default alias", `[{"fn":"sum","field":"Amount"},{"fn":"COUNT","field":"*"}]`,
+			[]string{`sum(amount) AS "sum_amount"`, `count(*) AS "count"`}, ""},
+		{"alias", `[{"fn":"countDistinct","field":"DomainID","as":"domains"},{"fn":"avg","field":"amount","as":"avgAmount"}]`,
+			[]string{`count(DISTINCT domain_id) AS "domains"`, `avg(amount) AS "avgAmount"`}, ""},
+		{"unsupported function", `[{"fn":"median","field":"Amount"}]`, nil, "unsupported aggregate function median"},
+		{"star of sum", `[{"fn":"sum","field":"*"}]`, nil, "sum(*) is not allowed"},
+		{"unknown field", `[{"fn":"max","field":"Price"}]`, nil, "unknown Price on t_aggregate"},
+		{"invalid alias", `[{"fn":"max","field":"Amount","as":"x\"; drop table t_user; --"}]`, nil, "invalid alias"},
+		{"duplicated alias", `[{"fn":"max","field":"Amount","as":"total"},{"fn":"min","field":"Amount","as":"TOTAL"}]`,
+			nil, "aggregates[1]: duplicated alias TOTAL"},
+		{"alias of column", `[{"fn":"max","field":"Amount","as":"status"}]`, nil, "alias status conflicts with column"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := &ReqProto{}
+			if err := json.Unmarshal([]byte(`{"aggregates":`+c.aggregates+`}`), req); err != nil {
+				t.Fatal(err)
+			}
+			f := &Filter{TableMap: &aggregateTestRow{}}
+			columns, exprByAlias, err := f.aggregateColumns(req, "t_aggregate")
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expect error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(columns, c.columns) {
+				t.Fatalf("expect %v, got %v", c.columns, columns)
+			}
+			if len(exprByAlias) != len(columns) {
+				t.Fatalf("aliases %v", exprByAlias)
+			}
+		})
+	}
+}
+
+// aggregateDML run the aggregate select of req on t_aggregate, return the statements and their arguments
+func aggregateDML(t *testing.T, req string) (f *Filter, statements []string, args [][]driver.Value, err error) {
+	openFakeDB(t, func(query string, a []driver.Value) (*fakeRows, error) {
+		statements = append(statements, query)
+		args = append(args, a)
+		if strings.HasPrefix(query, "SELECT count(*) as row_count FROM") {
+			return &fakeRows{values: [][]driver.Value{{int64(2)}}}, nil
+		}
+		return &fakeRows{columns: []string{"status", "total"},
+			values: [][]driver.Value{{"00", []byte("150.50")}, {"02", []byte("120")}}}, nil
+	})
+
+	r := &ReqProto{Action: "select"}
+	if err = json.Unmarshal([]byte(req), r); err != nil {
+		t.Fatal(err)
+	}
+	f = &Filter{TableMap: &aggregateTestRow{}}
+	err = DML(context.Background(), f, r)
+	return
+}
+
+func TestAggregateSelect(t *testing.T) {
+	f, statements, args, err := aggregateDML(t, `{
+		"aggregates": [{"fn":"sum","field":"Amount","as":"total"}],
+		"groupBy": ["Status"],
+		"filter": {"DomainID": {"EQ": 3}},
+		"having": {"total": {"GT": 100}},
+		"orderBy": [{"total": "desc"}],
+		"pageSize": 10, "page": 1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	where := "FROM t_aggregate WHERE domain_id = $1 GROUP BY status HAVING sum(amount) > $2"
+	expect := []string{
+		fmt.Sprintf("SELECT count(*) as row_count FROM (SELECT 1 %s) t", where),
+		fmt.Sprintf(`SELECT status,sum(amount) AS "total" %s ORDER BY sum(amount) DESC LIMIT $3 OFFSET $4`, where),
+	}
+	if !reflect.DeepEqual(statements, expect) {
+		t.Fatalf("expect\n%s\ngot\n%s", strings.Join(expect, "\n"), strings.Join(statements, "\n"))
+	}
+	if fmt.Sprint(args[1]) != "[3 100 10 10]" {
+		t.Fatalf("arguments %v", args[1])
+	}
+	if f.RowCount != 2 {
+		t.Fatalf("row count %d, want the group count 2", f.RowCount)
+	}
+	if f.QryResult != `[{"status":"00","total":150.50},{"status":"02","total":120}]` {
+		t.Fatalf("result %s", f.QryResult)
+	}
+}
+
+// TestAggregateSelectWithoutGroup the row count is the count of the returned rows without groupBy
+func TestAggregateSelectWithoutGroup(t *testing.T) {
+	f, statements, _, err := aggregateDML(t, `{"aggregates": [{"fn":"count","field":"*"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 1 || statements[0] != `SELECT count(*) AS "count" FROM t_aggregate WHERE 1=1` {
+		t.Fatalf("statements %v", statements)
+	}
+	if f.RowCount != 2 {
+		t.Fatalf("row count %d", f.RowCount)
+	}
+}
+
+func TestAggregateSelectInvalid(t *testing.T) {
+	for _, c := range []struct {
+		req, err string
+	}{
+		{`{"groupBy": ["Price"]}`, "unknown Price in groupBy"},
+		{`{"groupBy": ["Status"], "sets": ["ID"]}`, "sets can't be used with aggregates/groupBy"},
+		{`{"groupBy": ["Status"], "orderBy": [{"Status": "up"}]}`, "unknown UP order type"},
+		{`{"groupBy": ["Status"], "orderBy": [{"total": "asc"}]}`, "unknown total on t_aggregate"},
+		{`{"groupBy": ["Status"], "having": {"total": {"GT": 1}}}`, "invalid key:total"},
+	} {
+		_, statements, _, err := aggregateDML(t, c.req)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%s: expect error %q, got %v", c.req, c.err, err)
+		}
+		if len(statements) != 0 {
+			t.Fatalf("%s: statements %v", c.req, statements)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package cmn
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//maxStmtParams postgresql limit the bind parameters of one statement to 65535
+const maxStmtParams = 65535
+
+//isJSONArray report whether d is a json array
+func isJSONArray(d json.RawMessage) bool {
+	d = bytes.TrimSpace(d)
+	return len(d) > 0 && d[0] == '['
+}
+
+//batchRow a row of batch insert/upsert, idx is its position in req.Data, key is its primary key by batchKey
+type batchRow struct {
+	idx    int
+	key    string
+	values []interface{}
+}
+
+//batchGroup rows with the same column set are written by the same statement
+type batchGroup struct {
+	columns []string
+	rows    []*batchRow
+}
+
+/*batchInsert insert/upsert req.Data in one transaction
+	req.Data 可以是单个对象或对象数组, 相同列集合的数据使用一条多行 VALUES 语句写入
+	UPSERT 以 Filter.getPrimaryKeys 返回的主键作为 ON CONFLICT 目标, 非主键列以 EXCLUDED 值更新,
+		更新已存在的数据时受 req.AuthFilter 数据范围限制, 审计记录只包含变更后的数据
+	RETURNING 的行序不确定, 返回的 ID 按主键对应到 req.Data 中的位置:
+		未提供主键的数据先由 allocateIDs 从主键的序列取值, 主键由多列组成时必须提供
+		主键重复的数据返回错误, 同一 UPSERT 语句不能更新同一行两次
+	audit 非nil时在 audit.tx 中写入, 由调用者提交
+	成功后 f.QryResult 为与 req.Data 顺序一致的 ID 数组(json字符串), f.RowCount 为写入行数 */
+func batchInsert(f *Filter, req *ReqProto, tblName string, objT reflect.Type, action string,
+	audit *auditTrail) (err error) {
+	zr := LoggerOf(f.ctx)
+	var items []json.RawMessage
+	if isJSONArray(req.Data) {
+		err = json.Unmarshal(req.Data, &items)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+	} else if len(req.Data) > 0 {
+		items = append(items, req.Data)
+	}
+
+	if len(items) == 0 {
+		err = fmt.Errorf("empty data to %s into %s", strings.ToLower(action), tblName)
+		zr.Error(err.Error())
+		return
+	}
+
+	// the returned ids are mapped to the rows by the primary key
+	var keyList []string
+	keyList, err = f.getPrimaryKeys(true)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	if len(keyList) == 0 {
+		err = fmt.Errorf("missing primary key on %s to %s", tblName, strings.ToLower(action))
+		zr.Error(err.Error())
+		return
+	}
+	var pkList []string
+	if action == "UPSERT" {
+		pkList = keyList
+	}
+
+	// group rows by column set
+	var groups []*batchGroup
+	groupByColumns := make(map[string]*batchGroup)
+	rowByKey := make(map[string]int)
+	for i, v := range items {
+		pValue := reflect.New(objT)
+		err = json.Unmarshal(v, pValue.Interface())
+		if err != nil {
+			zr.Error(fmt.Sprintf("data[%d]: %s", i, err.Error()))
+			return
+		}
+
+		var columns []string
+		var values []interface{}
+		columns, values, err = columnValues(objT, pValue.Elem(), action)
+		if err != nil {
+			return
+		}
+		if len(columns) == 0 {
+			err = fmt.Errorf("data[%d]: empty column list", i)
+			zr.Error(err.Error())
+			return
+		}
+		jsonDataTypeToGo(values)
+
+		// rows without primary key get it by allocateIDs
+		var key string
+		key, err = rowKey(keyList, columns, values)
+		if err != nil {
+			err = fmt.Errorf("data[%d]: %s", i, err.Error())
+			zr.Error(err.Error())
+			return
+		}
+		if key != "" {
+			if j, ok := rowByKey[key]; ok {
+				err = fmt.Errorf("data[%d] and data[%d] have the same primary key (%s) on %s",
+					j, i, strings.Join(keyList, ","), tblName)
+				zr.Error(err.Error())
+				return
+			}
+			rowByKey[key] = i
+		}
+
+		s := strings.Join(columns, ",")
+		g, ok := groupByColumns[s]
+		if !ok {
+			g = &batchGroup{columns: columns}
+			groupByColumns[s] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, &batchRow{idx: i, key: key, values: values})
+	}
+
+	// the transaction of audit trail is committed by the caller
+	var tx *sqlx.Tx
+	if audit != nil {
+		tx = audit.tx
+	} else {
+		tx, err = sqlxDB.BeginTxx(f.dbCtx(), nil)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+		defer func() {
+			if err != nil {
+				_ = tx.Rollback()
+			}
+		}()
+	}
+
+	ids := make([]int64, len(items))
+	for _, g := range groups {
+		if g.rows[0].key == "" {
+			err = f.allocateIDs(tx, tblName, keyList[0], g)
+			if err != nil {
+				return
+			}
+		}
+
+		// reserve parameters for the data scope condition
+		rowsPerStmt := (maxStmtParams - 1024) / len(g.columns)
+		for begin := 0; begin < len(g.rows); begin += rowsPerStmt {
+			end := begin + rowsPerStmt
+			if end > len(g.rows) {
+				end = len(g.rows)
+			}
+			err = f.batchExec(tx, req, tblName, g.columns, g.rows[begin:end], pkList, keyList, ids, audit)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if audit == nil {
+		err = tx.Commit()
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+	}
+
+	var buf []byte
+	buf, err = json.Marshal(ids)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	f.QryResult = string(buf)
+	f.RowCount = int64(len(ids))
+	zr.Info(fmt.Sprintf("%s %d rows into %s successfully", strings.ToLower(action), len(ids), tblName))
+	return
+}
+
+//batchKey the primary key of a row in text, the value written and the one returned by RETURNING have the same key
+func batchKey(values []interface{}) string {
+	var list []string
+	for _, v := range values {
+		if d, ok := v.(driver.Valuer); ok {
+			v, _ = d.Value()
+		}
+		switch val := v.(type) {
+		case time.Time:
+			v = val.UTC().Format(time.RFC3339Nano)
+		case []byte:
+			v = string(val)
+		}
+		list = append(list, strconv.Quote(fmt.Sprint(v)))
+	}
+	return strings.Join(list, ",")
+}
+
+//rowKey the batchKey of the primary key of the row, empty if the row hasn't primary key and it's a single column
+func rowKey(keyList []string, columns []string, values []interface{}) (key string, err error) {
+	var keyValues []interface{}
+	for _, k := range keyList {
+		for i, c := range columns {
+			if strings.EqualFold(c, k) {
+				keyValues = append(keyValues, values[i])
+				break
+			}
+		}
+	}
+
+	switch {
+	case len(keyValues) == len(keyList):
+		key = batchKey(keyValues)
+	case len(keyValues) > 0 || len(keyList) > 1:
+		err = fmt.Errorf("missing primary key (%s)", strings.Join(keyList, ","))
+	}
+	return
+}
+
+/*allocateIDs take the primary key of the rows in g from it's sequence, then the rows have the key
+to map the returned ids to */
+func (r *Filter) allocateIDs(tx *sqlx.Tx, tblName, column string, g *batchGroup) (err error) {
+	zr := LoggerOf(r.ctx)
+
+	var list []sql.NullInt64
+	s := `SELECT nextval(pg_get_serial_sequence($1, $2)) FROM generate_series(1, $3)`
+	err = tx.SelectContext(r.dbCtx(), &list, s, tblName, column, len(g.rows))
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	if len(list) != len(g.rows) {
+		err = fmt.Errorf("allocate %d ids of %s, got %d", len(g.rows), tblName, len(list))
+		zr.Error(err.Error())
+		return
+	}
+
+	g.columns = append(g.columns[:len(g.columns):len(g.columns)], column)
+	for i, row := range g.rows {
+		if !list[i].Valid {
+			err = fmt.Errorf("%s.%s has no sequence, data[%d] should have it", tblName, column, row.idx)
+			zr.Error(err.Error())
+			return
+		}
+		row.values = append(row.values, list[i].Int64)
+		row.key = batchKey([]interface{}{list[i].Int64})
+	}
+	return
+}
+
+/*batchExec write rows by a multi-row INSERT ... VALUES, the returned id of rows[i] is saved to ids[rows[i].idx],
+the returned rows are mapped to rows by the primary key keyList */
+func (r *Filter) batchExec(tx *sqlx.Tx, req *ReqProto, tblName string, columns []string,
+	rows []*batchRow, pkList []string, keyList []string, ids []int64, audit *auditTrail) (err error) {
+	zr := LoggerOf(r.ctx)
+
+	var values []interface{}
+	var valueList []string
+	for _, row := range rows {
+		var params []string
+		for _, v := range row.values {
+			values = append(values, v)
+			params = append(params, fmt.Sprintf("$%d", len(values)))
+		}
+		valueList = append(valueList, "("+strings.Join(params, ",")+")")
+	}
+
+	s := fmt.Sprintf(`INSERT INTO %s(%s) VALUES %s`, tblName,
+		strings.Join(columns, ","), strings.Join(valueList, ","))
+
+	if len(pkList) > 0 {
+		isPK := make(map[string]bool)
+		for _, v := range pkList {
+			isPK[strings.ToLower(v)] = true
+		}
+
+		var sets []string
+		for _, v := range columns {
+			if isPK[strings.ToLower(v)] {
+				continue
+			}
+			sets = append(sets, fmt.Sprintf("%s=EXCLUDED.%s", v, v))
+		}
+		// all columns are primary key, update it self to get it's id returned
+		if len(sets) == 0 {
+			sets = append(sets, fmt.Sprintf("%s=EXCLUDED.%s", pkList[0], pkList[0]))
+		}
+
+		s = fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", s,
+			strings.Join(pkList, ","), strings.Join(sets, ","))
+
+		// the existing rows should be in the data scope of the requester, the condition
+		//  is wrapped in a sub query since it's columns are ambiguous with EXCLUDED's
+		r.AuthProc = true
+		r.AuthWhereBeginPos = len(values)
+		r.AuthWhereValues = r.AuthWhereValues[:0]
+		var authExpr string
+		authExpr, err = r.MakeFilter(req.AuthFilter)
+		if err != nil {
+			return
+		}
+		authExpr = strings.TrimSpace(authExpr)
+		if authExpr != "" {
+			pk := strings.Join(pkList, ",")
+			s = fmt.Sprintf("%s WHERE (%s.%s) IN (SELECT %s FROM %s WHERE %s)", s,
+				tblName, strings.Join(pkList, ","+tblName+"."), pk, tblName, authExpr)
+			values = append(values, r.AuthWhereValues...)
+		}
+	}
+	s = s + " RETURNING ID," + strings.Join(keyList, ",")
+	if audit != nil {
+		s = s + "," + audit.returning()
+	}
+
+	zr.Info(s)
+	zr.Info(fmt.Sprintf("%v", values))
+
+	var result *sqlx.Rows
+	result, err = tx.QueryxContext(r.dbCtx(), s, values...)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	defer result.Close()
+
+	rowByKey := make(map[string]*batchRow)
+	for _, row := range rows {
+		rowByKey[row.key] = row
+	}
+
+	for result.Next() {
+		var id int64
+		var img []byte
+		keyValues := make([]interface{}, len(keyList))
+		dest := []interface{}{&id}
+		for i := range keyValues {
+			dest = append(dest, &keyValues[i])
+		}
+		if audit != nil {
+			dest = append(dest, &img)
+		}
+		err = result.Scan(dest...)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+
+		key := batchKey(keyValues)
+		row, ok := rowByKey[key]
+		if !ok {
+			err = fmt.Errorf("%s returned the row of unknown primary key %s", tblName, key)
+			zr.Error(err.Error())
+			return
+		}
+		delete(rowByKey, key)
+		ids[row.idx] = id
+
+		if audit != nil {
+			err = audit.add(img, false)
+			if err != nil {
+				return
+			}
+		}
+	}
+	err = result.Err()
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+
+	if len(rowByKey) > 0 {
+		var idx []int
+		for _, row := range rowByKey {
+			idx = append(idx, row.idx)
+		}
+		sort.Ints(idx)
+		var unwritten []string
+		for _, i := range idx {
+			unwritten = append(unwritten, fmt.Sprintf("data[%d]", i))
+		}
+		err = fmt.Errorf("%s unwritten on %s, they conflict with rows out of your data scope",
+			strings.Join(unwritten, ", "), tblName)
+		zr.Error(err.Error())
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package cmn
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"w2w.io/null"
+)
+
+type batchTestRow struct {
+	ID     null.Int    `json:"ID,omitempty" db:"id,true,bigint"`
+	Name   null.String `json:"Name,omitempty" db:"name,false,character varying"`
+	Remark null.String `json:"Remark,omitempty" db:"remark,false,character varying"`
+}
+
+func (r *batchTestRow) GetTableName() string { return "t_batch" }
+
+// batchTable answer the statements of batchInsert, the rows are returned in the reverse order
+type batchTable struct {
+	seq int64
+
+	// the count of the rows returned by the next INSERT, all if it's 0
+	returned int
+}
+
+func (b *batchTable) query(q string, args []driver.Value) (*fakeRows, error) {
+	r := &fakeRows{}
+	switch {
+	case strings.HasPrefix(q, "SELECT nextval(pg_get_serial_sequence($1, $2))"):
+		for i := int64(0); i < args[2].(int64); i++ {
+			b.seq++
+			r.values = append(r.values, []driver.Value{b.seq})
+		}
+
+	case strings.HasPrefix(q, "INSERT INTO t_batch("):
+		columns := strings.Split(q[len("INSERT INTO t_batch("):strings.Index(q, ")")], ",")
+		pos := -1
+		for i, c := range columns {
+			if c == "id" {
+				pos = i
+			}
+		}
+		if pos < 0 {
+			return nil, fmt.Errorf("id isn't written: %s", q)
+		}
+		for i := len(args) - len(columns); i >= 0; i -= len(columns) {
+			r.values = append(r.values, []driver.Value{args[i+pos], args[i+pos]})
+		}
+		if b.returned > 0 {
+			r.values = r.values[:b.returned]
+		}
+
+	default:
+		return nil, fmt.Errorf("unexpected statement: %s", q)
+	}
+	return r, nil
+}
+
+// batchDML run action of data on t_batch without audit trail
+func batchDML(t *testing.T, b *batchTable, action, data string) (f *Filter, db *fakeDB, err error) {
+	viper.Set("dbms.audit.enable", false)
+	t.Cleanup(func() { viper.Set("dbms.audit.enable", true) })
+
+	db = openFakeDB(t, b.query)
+	f = &Filter{TableMap: &batchTestRow{}}
+	err = DML(context.Background(), f, &ReqProto{Action: action, Data: json.RawMessage(data)})
+	return
+}
+
+// TestBatchInsert the ids of rows without id are allocated, the returned ids are mapped by id
+func TestBatchInsert(t *testing.T) {
+	b := &batchTable{seq: 10}
+	f, db, err := batchDML(t, b, "insert", `[{"Name":"a"},{"Name":"b","Remark":"x"},{"ID":100,"Name":"c"},{"Name":"d"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[11,13,100,12]"; f.QryResult != want {
+		t.Errorf("ids %v, want %s", f.QryResult, want)
+	}
+	if f.RowCount != 4 {
+		t.Errorf("row count %d, want 4", f.RowCount)
+	}
+	if db.commits != 1 {
+		t.Errorf("%d commits, want 1", db.commits)
+	}
+	for _, s := range db.statements {
+		if strings.Contains(s, "ON CONFLICT") {
+			t.Errorf("INSERT shouldn't upsert: %s", s)
+		}
+	}
+}
+
+func TestBatchUpsert(t *testing.T) {
+	b := &batchTable{seq: 10}
+	f, db, err := batchDML(t, b, "upsert", `[{"ID":5,"Name":"a"},{"ID":3,"Name":"b"},{"Name":"c"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[5,3,11]"; f.QryResult != want {
+		t.Errorf("ids %v, want %s", f.QryResult, want)
+	}
+
+	want := "INSERT INTO t_batch(id,name) VALUES ($1,$2),($3,$4) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name RETURNING ID,id"
+	found := false
+	for _, s := range db.statements {
+		found = found || s == want
+	}
+	if !found {
+		t.Errorf("statements %q, want %q", db.statements, want)
+	}
+}
+
+// TestBatchUpsertDuplicateKey the same row can't be updated twice by one statement
+func TestBatchUpsertDuplicateKey(t *testing.T) {
+	_, db, err := batchDML(t, &batchTable{}, "upsert", `[{"ID":5},{"Name":"b"},{"ID":5,"Name":"c"}]`)
+	if err == nil || !strings.Contains(err.Error(), "data[0] and data[2]") {
+		t.Fatalf("error %v, want the duplicate key of data[0] and data[2]", err)
+	}
+	if len(db.statements) != 0 {
+		t.Errorf("statements %q executed", db.statements)
+	}
+}
+
+// TestBatchUpsertOutOfScope the rows not returned conflict with rows out of the data scope
+func TestBatchUpsertOutOfScope(t *testing.T) {
+	_, db, err := batchDML(t, &batchTable{returned: 1}, "upsert", `[{"ID":5,"Name":"a"},{"ID":3,"Name":"b"}]`)
+	if err == nil || !strings.Contains(err.Error(), "data[0] unwritten") {
+		t.Fatalf("error %v, want data[0] unwritten", err)
+	}
+	if db.commits != 0 || db.rollbacks != 1 {
+		t.Errorf("commits %d, rollbacks %d, want 0, 1", db.commits, db.rollbacks)
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	cases := []struct {
+		keys    []string
+		columns []string
+		values  []interface{}
+		key     string
+		err     bool
+	}{
+		{[]string{"id"}, []string{"name", "ID"}, []interface{}{"a", null.IntFrom(7)}, `"7"`, false},
+		{[]string{"id"}, []string{"name"}, []interface{}{"a"}, "", false},
+		{[]string{"org_id", "code"}, []string{"code", "org_id"}, []interface{}{"x,y", int64(2)}, `"2","x,y"`, false},
+		{[]string{"org_id", "code"}, []string{"code"}, []interface{}{"x"}, "", true},
+		{[]string{"org_id", "code"}, []string{"name"}, []interface{}{"x"}, "", true},
+	}
+	for _, c := range cases {
+		key, err := rowKey(c.keys, c.columns, c.values)
+		if key != c.key || (err != nil) != c.err {
+			t.Errorf("rowKey(%v, %v) = %q, %v, want %q, error %v", c.keys, c.columns, key, err, c.key, c.err)
+		}
+	}
+
+	// the key written and the one returned by RETURNING
+	if batchKey([]interface{}{null.IntFrom(7), null.StringFrom("a")}) != batchKey([]interface{}{int64(7), []byte("a")}) {
+		t.Error("the keys of the same values should be the same")
+	}
+}
@@ -0,0 +1,219 @@
+package cmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+//expandColumnPrefix prefix of the result column of the expanded relation
+const expandColumnPrefix = "expand_"
+
+//expandRowNumber the result column keep the order of the rows
+const expandRowNumber = "expand_rn"
+
+//jsonb_build_object accept at most 100 arguments
+const maxJSONBuildPairs = 50
+
+//expandJoin the LEFT JOIN and the select list of the relations in ReqProto.Expand
+type expandJoin struct {
+	// names of the relation, the order of columns are expand_0, expand_1...
+	names []string
+
+	// foreign key columns should be selected from the main table
+	fkColumns []string
+
+	columns []string
+	joins   []expandTable
+
+	// data scope of the requester, applied to each joined table
+	authFilter interface{}
+}
+
+//expandTable the table joined for a relation
+type expandTable struct {
+	rel   *Relation
+	alias string
+	refT  reflect.Type
+}
+
+/*expandRelations build LEFT JOIN of req.Expand, relations come from TableRelations
+	req.Expand 例如 {"Creator":["ID","OfficialName"]}, 只支持一层展开,
+	关联表的列经其 TableMap 的 mapKey 校验, SensitiveColumns 中的列不可展开,
+	关联表同样受 req.AuthFilter 数据范围限制, 范围外的关联数据展开为 null */
+func (r *Filter) expandRelations(req *ReqProto, tblName string) (e *expandJoin, err error) {
+	zr := LoggerOf(r.ctx)
+	var names []string
+	for k := range req.Expand {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	e = &expandJoin{authFilter: req.AuthFilter}
+	for i, name := range names {
+		rel, found := findRelation(tblName, name)
+		if !found {
+			err = fmt.Errorf("unknown relation %s on %s", name, tblName)
+			zr.Error(err.Error())
+			return
+		}
+
+		fields := req.Expand[name]
+		if len(fields) == 0 {
+			err = fmt.Errorf("empty field list to expand %s on %s", name, tblName)
+			zr.Error(err.Error())
+			return
+		}
+
+		refT, _ := tableMapType(rel.RefTable)
+		refFilter := &Filter{TableMap: reflect.New(refT).Interface()}
+
+		alias := fmt.Sprintf("t%d", i+1)
+		var pairs []string
+		for _, v := range fields {
+			columnName, found := refFilter.mapKey(v)
+			if !found {
+				err = fmt.Errorf("unknown %s on %s", v, rel.RefTable)
+				zr.Error(err.Error())
+				return
+			}
+			if SensitiveColumns[rel.RefTable+"."+columnName] {
+				err = fmt.Errorf("%s on %s can't be expanded", v, rel.RefTable)
+				zr.Error(err.Error())
+				return
+			}
+			f, _ := dbColumnOf(refT, columnName)
+			pairs = append(pairs, fmt.Sprintf("'%s',%s.%s", jsonName(f), alias, columnName))
+		}
+
+		var objects []string
+		for begin := 0; begin < len(pairs); begin += maxJSONBuildPairs {
+			end := begin + maxJSONBuildPairs
+			if end > len(pairs) {
+				end = len(pairs)
+			}
+			objects = append(objects, "jsonb_build_object("+strings.Join(pairs[begin:end], ",")+")")
+		}
+
+		e.names = append(e.names, rel.Name)
+		e.fkColumns = append(e.fkColumns, rel.Column)
+		e.columns = append(e.columns, fmt.Sprintf(
+			"CASE WHEN %s.%s IS NULL THEN NULL ELSE %s END AS %s%d",
+			alias, rel.RefColumn, strings.Join(objects, "||"), expandColumnPrefix, i))
+		e.joins = append(e.joins, expandTable{rel: rel, alias: alias, refT: refT})
+	}
+	return
+}
+
+/*selectSQL wrap the paged query of the main table as t0 then LEFT JOIN the relations,
+the order of rows are kept by row_number(), the parameters of the data scope of the joined
+tables are appended to values */
+func (e *expandJoin) selectSQL(sets, tblName, expr, orderBy, pageExpr string,
+	values []interface{}) (s string, result []interface{}, err error) {
+
+	result = values
+	var joins []string
+	for _, t := range e.joins {
+		from := t.rel.RefTable
+		if e.authFilter != nil {
+			f := &Filter{TableMap: reflect.New(t.refT).Interface(),
+				AuthProc: true, AuthWhereBeginPos: len(result)}
+			var authExpr string
+			authExpr, err = f.MakeFilter(e.authFilter)
+			if err != nil {
+				err = fmt.Errorf("data scope can't be applied to %s: %s", t.rel.RefTable, err.Error())
+				z.Error(err.Error())
+				return
+			}
+			if authExpr = strings.TrimSpace(authExpr); authExpr != "" {
+				from = fmt.Sprintf("(SELECT * FROM %s WHERE %s)", t.rel.RefTable, authExpr)
+				result = append(result, f.AuthWhereValues...)
+			}
+		}
+		joins = append(joins, fmt.Sprintf("LEFT JOIN %s %s ON %s.%s = t0.%s",
+			from, t.alias, t.alias, t.rel.RefColumn, t.rel.Column))
+	}
+
+	s = fmt.Sprintf(`SELECT t0.*,%s FROM (SELECT %s,row_number() OVER (ORDER BY %s) AS %s`+
+		` FROM %s WHERE %s ORDER BY %s %s) t0 %s ORDER BY t0.%s`,
+		strings.Join(e.columns, ","), sets, orderBy, expandRowNumber,
+		tblName, expr, orderBy, pageExpr, strings.Join(joins, " "), expandRowNumber)
+	return
+}
+
+//scan scan a row into p, the pointer of TableMap struct, and return the expanded objects
+func (e *expandJoin) scan(rows *sqlx.Rows, p interface{}) (expanded map[string]json.RawMessage, err error) {
+	var columns []string
+	columns, err = rows.Columns()
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	v := reflect.ValueOf(p).Elem()
+	tm := rows.Mapper.TypeMap(v.Type())
+	objects := make([]types.NullJSONText, len(e.names))
+	var rowNumber int64
+	dest := make([]interface{}, len(columns))
+	for i, c := range columns {
+		if c == expandRowNumber {
+			dest[i] = &rowNumber
+			continue
+		}
+
+		var n int
+		if _, err = fmt.Sscanf(c, expandColumnPrefix+"%d", &n); err == nil && n < len(objects) {
+			dest[i] = &objects[n]
+			continue
+		}
+		err = nil
+
+		fi, ok := tm.Names[c]
+		if !ok {
+			err = fmt.Errorf("missing destination name %s in %s", c, v.Type().Name())
+			z.Error(err.Error())
+			return
+		}
+		dest[i] = reflectx.FieldByIndexes(v, fi.Index).Addr().Interface()
+	}
+
+	err = rows.Scan(dest...)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	expanded = make(map[string]json.RawMessage)
+	for i, name := range e.names {
+		if !objects[i].Valid {
+			expanded[name] = json.RawMessage("null")
+			continue
+		}
+		expanded[name] = json.RawMessage(objects[i].JSONText)
+	}
+	return
+}
+
+//mergeExpanded add the expanded objects to the json object of the row
+func mergeExpanded(buf []byte, expanded map[string]json.RawMessage) (result []byte, err error) {
+	row := make(map[string]json.RawMessage)
+	err = json.Unmarshal(buf, &row)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	for k, v := range expanded {
+		row[k] = v
+	}
+	result, err = json.Marshal(row)
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package cmn
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"w2w.io/null"
+)
+
+func TestExpandJoinAuthFilter(t *testing.T) {
+	if findRelationByColumn("t_order", "creator") == nil {
+		err := AddRelation(Relation{Table: "t_order", Column: "creator", RefTable: "t_user", RefColumn: "id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rel := findRelationByColumn("t_order", "creator")
+
+	byCreator := map[string]interface{}{
+		"Creator": map[string]interface{}{"EQ": int64(7)},
+	}
+	cases := []struct {
+		name       string
+		authFilter interface{}
+		join       string
+		values     []interface{}
+		wantErr    bool
+	}{
+		{"unscoped", nil,
+			"LEFT JOIN t_user t1 ON t1.id = t0.creator", []interface{}{"x", 10}, false},
+		{"scoped by creator", byCreator,
+			"LEFT JOIN (SELECT * FROM t_user WHERE creator = $3) t1 ON t1.id = t0.creator",
+			[]interface{}{"x", 10, int64(7)}, false},
+		{"scope not applicable", map[string]interface{}{"NoSuchColumn": map[string]interface{}{"EQ": 1}},
+			"", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := &ReqProto{
+				Expand:     map[string][]string{rel.Name: {"ID", "OfficialName"}},
+				AuthFilter: c.authFilter,
+			}
+			f := &Filter{TableMap: &TOrder{}}
+			e, err := f.expandRelations(req, "t_order")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, values, err := e.selectSQL("id,creator", "t_order", "trade_no = $1", "id",
+				"LIMIT $2", []interface{}{"x", 10})
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+			if !strings.Contains(s, c.join) {
+				t.Fatalf("%s should contain %s", s, c.join)
+			}
+			if !reflect.DeepEqual(values, c.values) {
+				t.Fatalf("values = %v, want %v", values, c.values)
+			}
+			if !strings.Contains(s, "'OfficialName',t1.official_name") {
+				t.Fatalf("%s should select the expanded columns of t1", s)
+			}
+		})
+	}
+}
+
+type relationTestRow struct {
+	ID      null.Int `json:"ID,omitempty" db:"id,true,bigint"`
+	Creator null.Int `json:"Creator,omitempty" db:"creator,false,bigint"`
+	OrgID   null.Int `json:"OrgID,omitempty" db:"org_id,false,bigint"`
+}
+
+func (r *relationTestRow) GetTableName() string { return "t_relation_test" }
+
+//TestGeneratedRelations the relations of the generated models are added at the first call of TableRelations
+func TestGeneratedRelations(t *testing.T) {
+	// no dbms is needed
+	db := sqlxDB
+	sqlxDB = nil
+	defer func() { sqlxDB = db }()
+
+	registerTableMap(func() interface{} { return &relationTestRow{} },
+		refRelation("creator", "t_user.id 创建者"),
+		refRelation("org_id", "t_domain"),
+		refRelation("id", "t_no_such_table.id"))
+	relations.addGenerated = sync.Once{}
+
+	want := []Relation{
+		{Name: "CreatorRef", Table: "t_relation_test", Column: "creator", RefTable: "t_user", RefColumn: "id"},
+		{Name: "Org", Table: "t_relation_test", Column: "org_id", RefTable: "t_domain", RefColumn: "id"},
+	}
+	if got := TableRelations("t_relation_test"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("relations %+v, want %+v", got, want)
+	}
+	if r, found := findRelation("t_relation_test", "OrgID"); !found || r.RefTable != "t_domain" {
+		t.Fatalf("relation of OrgID %+v, %v", r, found)
+	}
+}
+
+//TestStructTmplRelations the relation list generated by tmpl/struct.tmpl from the column comment marker
+func TestStructTmplRelations(t *testing.T) {
+	s := execStructTmpl(t, []tmplField{
+		{"ID", "null.Int", "编号", tmplColumn{"id", true, "bigint"}},
+		{"Creator", "null.Int", "ref:t_user.id 创建者", tmplColumn{"creator", false, "bigint"}},
+		{"Remark", "null.String", "备注 ref:t_user", tmplColumn{"remark", false, "character varying"}},
+	})
+	for _, want := range []string{
+		"var TOrderRelations = []Relation{\n\trefRelation(\"creator\", \"t_user.id 创建者\"),\n}",
+		"registerTableMap(func() interface{} { return &TOrder{} }, TOrderRelations...)",
+	} {
+		if !strings.Contains(strings.ReplaceAll(s, "\r", ""), want) {
+			t.Errorf("%s isn't generated", want)
+		}
+	}
+
+	// the model without relations is generated as before
+	s = execStructTmpl(t, []tmplField{{"ID", "null.Int", "编号", tmplColumn{"id", true, "bigint"}}})
+	if strings.Contains(s, "Relations") {
+		t.Error("relation list is generated without ref: comment")
+	}
+	if !strings.Contains(strings.ReplaceAll(s, "\r", ""), "\treturn tableName\n}\n\n//register TOrder") {
+		t.Error("the blank lines before init are changed")
+	}
+}
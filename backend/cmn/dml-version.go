@@ -0,0 +1,127 @@
+package cmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//CDMLConflict the row has been modified by others since the requester read it
+const CDMLConflict = -40901
+
+//ConflictError returned by DML UPDATE with req.Version while the row has been modified,
+//  Current is the row in the database now, RespErr reply it with status CDMLConflict
+type ConflictError struct {
+	Table   string
+	Current json.RawMessage
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s has been modified by others, please reload and try again", e.Table)
+}
+
+//lockColumns columns used by optimistic locking in order of priority
+var lockColumns = []string{"version", "update_time"}
+
+//lockColumnOf return the optimistic locking column of objT, empty if it hasn't any
+func lockColumnOf(objT reflect.Type) string {
+	for _, v := range lockColumns {
+		if _, found := dbColumnOf(objT, v); found {
+			return v
+		}
+	}
+	return ""
+}
+
+/*versionExpr build the optimistic locking part of UPDATE by req.Version
+	version:     SET version = version + 1 WHERE version = req.Version
+	update_time: SET update_time = greatest(now, update_time + 1) WHERE update_time = req.Version
+	req.Data 中已设置锁定列时使用 req.Data 的值 */
+func (r *Filter) versionExpr(req *ReqProto, objT reflect.Type, tblName string) (set string, cond string, err error) {
+	column := lockColumnOf(objT)
+	if column == "" {
+		err = fmt.Errorf("%s hasn't version or update_time column for optimistic locking", tblName)
+		LoggerOf(r.ctx).Error(err.Error())
+		return
+	}
+
+	setByData := false
+	for _, v := range r.Columns {
+		if strings.EqualFold(v, column) {
+			setByData = true
+			break
+		}
+	}
+
+	if !setByData {
+		switch column {
+		case "version":
+			set = "version=version+1"
+		default:
+			set = fmt.Sprintf("%s=greatest($%d,%s+1)", column, len(r.Values)+1, column)
+			r.Values = append(r.Values, GetNowInMS())
+		}
+	}
+
+	version := req.Version
+	if v, ok := version.(float64); ok {
+		version = int64(v)
+	}
+	cond = fmt.Sprintf("%s = $%d", column, len(r.Values)+1)
+	r.Values = append(r.Values, version)
+	return
+}
+
+//conflictError return ConflictError with the current row if the row of req.Filter exists
+func conflictError(f *Filter, req *ReqProto, tblName string, objT reflect.Type) (err error) {
+	zr := LoggerOf(f.ctx)
+	var expr string
+	var values []interface{}
+	expr, values, err = whereOf(f, req)
+	if err != nil {
+		return
+	}
+
+	var columns []string
+	for i := 0; i < objT.NumField(); i++ {
+		s, ok := objT.Field(i).Tag.Lookup("db")
+		if !ok || strings.Split(s, ",")[0] == "" {
+			continue
+		}
+		columns = append(columns, strings.Split(s, ",")[0])
+	}
+
+	s := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT 1", strings.Join(columns, ","), tblName, expr)
+	zr.Info(s)
+	rows, err := sqlxDB.QueryxContext(f.dbCtx(), s, values...)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		// the row has been deleted or is out of the data scope
+		err = rows.Err()
+		return
+	}
+
+	p := reflect.New(objT).Interface()
+	err = rows.StructScan(p)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+
+	var buf []byte
+	buf, err = MarshalJSON(p)
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+
+	err = &ConflictError{Table: tblName, Current: buf}
+	zr.Warn(err.Error())
+	return
+}
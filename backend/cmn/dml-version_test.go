@@ -0,0 +1,174 @@
+package cmn
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"w2w.io/null"
+)
+
+type versionTestRow struct {
+	ID         null.Int    `json:"ID,omitempty" db:"id,true,bigint"`
+	Name       null.String `json:"Name,omitempty" db:"name,false,character varying"`
+	UpdateTime null.Int    `json:"UpdateTime,omitempty" db:"update_time,false,bigint"`
+	Version    null.Int    `json:"Version,omitempty" db:"version,false,bigint"`
+}
+
+func (r *versionTestRow) GetTableName() string { return "t_version" }
+
+type updateTimeTestRow struct {
+	ID         null.Int    `json:"ID,omitempty" db:"id,true,bigint"`
+	Name       null.String `json:"Name,omitempty" db:"name,false,character varying"`
+	UpdateTime null.Int    `json:"UpdateTime,omitempty" db:"update_time,false,bigint"`
+}
+
+func (r *updateTimeTestRow) GetTableName() string { return "t_update_time" }
+
+func TestVersionExpr(t *testing.T) {
+	cases := []struct {
+		name    string
+		row     interface{}
+		columns []string
+		version interface{}
+
+		set, cond string
+		values    int
+		err       string
+	}{
+		{name: "version before update_time", row: &versionTestRow{}, columns: []string{"name"},
+			version: float64(3), set: "version=version+1", cond: "version = $2", values: 2},
+		{name: "version set by data", row: &versionTestRow{}, columns: []string{"name", "Version"},
+			version: float64(3), cond: "version = $3", values: 3},
+		{name: "update_time", row: &updateTimeTestRow{}, columns: []string{"name"},
+			version: float64(1700000000000), set: "update_time=greatest($2,update_time+1)", cond: "update_time = $3", values: 3},
+		{name: "without locking column", row: &batchTestRow{}, columns: []string{"name"},
+			version: float64(1), err: "hasn't version or update_time column"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := &Filter{TableMap: c.row, Columns: c.columns}
+			for range c.columns {
+				f.Values = append(f.Values, "x")
+			}
+			set, cond, err := f.versionExpr(&ReqProto{Version: c.version}, reflect.TypeOf(c.row).Elem(), "t")
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expect error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if set != c.set || cond != c.cond || len(f.Values) != c.values {
+				t.Fatalf("expect %q %q with %d values, got %q %q with %v", c.set, c.cond, c.values, set, cond, f.Values)
+			}
+
+			// the version in json is float64, it's compared as bigint
+			if v := f.Values[len(f.Values)-1]; v != int64(c.version.(float64)) {
+				t.Fatalf("version %v(%T)", v, v)
+			}
+		})
+	}
+}
+
+// versionUpdate run the UPDATE of data with version on t_version whose row 1 is current,
+// the update succeeds only if the version is the current one
+func versionUpdate(t *testing.T, current []driver.Value, data string, version interface{}) (
+	f *Filter, statements []string, err error) {
+	viper.Set("dbms.audit.enable", false)
+	t.Cleanup(func() { viper.Set("dbms.audit.enable", true) })
+
+	openFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		statements = append(statements, query)
+		switch {
+		case strings.HasPrefix(query, "UPDATE t_version SET"):
+			if current != nil && args[len(args)-1] == current[3] {
+				return &fakeRows{values: [][]driver.Value{{int64(1)}}}, nil
+			}
+			return &fakeRows{}, nil
+
+		case strings.HasPrefix(query, "SELECT id,name,update_time,version FROM t_version WHERE"):
+			r := &fakeRows{columns: []string{"id", "name", "update_time", "version"}}
+			if current != nil {
+				r.values = [][]driver.Value{current}
+			}
+			return r, nil
+		}
+		return nil, errors.New("unexpected query: " + query)
+	})
+
+	f = &Filter{TableMap: &versionTestRow{}}
+	err = DML(context.Background(), f, &ReqProto{Action: "update", Data: json.RawMessage(data),
+		Filter: map[string]interface{}{"ID": map[string]interface{}{"EQ": float64(1)}}, Version: version})
+	return
+}
+
+func TestVersionUpdate(t *testing.T) {
+	current := []driver.Value{int64(1), "b", int64(1700000000000), int64(4)}
+	f, statements, err := versionUpdate(t, current, `{"Name":"c"}`, float64(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 1 ||
+		statements[0] != "UPDATE t_version SET name=$1,version=version+1 WHERE (id = $2) and version = $3" {
+		t.Fatalf("statements %v", statements)
+	}
+	if f.QryResult != int64(1) {
+		t.Fatalf("result %v", f.QryResult)
+	}
+}
+
+// TestVersionConflict the current row is replied with CDMLConflict by RespErr
+func TestVersionConflict(t *testing.T) {
+	current := []driver.Value{int64(1), "b", int64(1700000000000), int64(5)}
+	_, statements, err := versionUpdate(t, current, `{"Name":"c"}`, float64(4))
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expect ConflictError, got %v", err)
+	}
+	if len(statements) != 2 || !strings.HasSuffix(statements[1], "WHERE id = $1 LIMIT 1") {
+		t.Fatalf("statements %v", statements)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/version", nil)
+	q := &ServiceCtx{W: w, R: r, Err: err, Msg: &ReplyProto{API: r.URL.Path, Method: r.Method}}
+	q.RespErr()
+
+	var reply struct {
+		Status int
+		Msg    string
+		Data   map[string]interface{}
+	}
+	if err = json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Status != CDMLConflict || !strings.Contains(reply.Msg, "t_version has been modified by others") {
+		t.Fatalf("reply %s", w.Body.String())
+	}
+	if fmt.Sprintf("%v %v", reply.Data["Name"], reply.Data["Version"]) != "b 5" {
+		t.Fatalf("current row %v", reply.Data)
+	}
+}
+
+// TestVersionConflictDeleted the update of the deleted row affects nothing without conflict
+func TestVersionConflictDeleted(t *testing.T) {
+	f, statements, err := versionUpdate(t, nil, `{"Name":"c"}`, float64(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 || f.QryResult != int64(0) {
+		t.Fatalf("statements %v, result %v", statements, f.QryResult)
+	}
+}
@@ -1,6 +1,7 @@
 package cmn
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -22,6 +23,9 @@ func jsonDataTypeToGo(v interface{}) {
 	case reflect.Slice, reflect.Array:
 		array, _ := v.([]interface{})
 		for i, e := range array {
+			if e == nil {
+				continue
+			}
 			switch reflect.TypeOf(e).Kind() {
 			case reflect.Slice, reflect.Array:
 				jsonDataTypeToGo(e)
@@ -73,26 +77,113 @@ func jsonDataTypeToGo(v interface{}) {
 	}
 }
 
+//columnValues collect db columns and values of the non-empty fields of objV,
+//  id is excluded while action is UPDATE
+func columnValues(objT reflect.Type, objV reflect.Value, action string) (columns []string, values []interface{}, err error) {
+	// generate columns set and values set
+	fieldNum := objV.NumField()
+
+	// *** ATTENTION: we only support null.types
+nextField: // for continue using this label
+	for i := 0; i < fieldNum; i++ {
+		fieldType := objT.Field(i)
+		fieldValue := objV.Field(i)
+		if !fieldValue.CanInterface() { //non-exported field
+			continue
+		}
+
+		var ok bool
+		var dbTag string
+		kind := fieldValue.Kind()
+
+		dbTag, ok = fieldType.Tag.Lookup("db")
+		if !ok { // not a db column field
+			continue
+		}
+		// --------------
+		// value check
+		for {
+			switch {
+			case kind == reflect.Struct && fieldValue.FieldByName("Valid").IsValid():
+				var valid bool
+				valid, ok = fieldValue.FieldByName("Valid").Interface().(bool)
+				if !ok {
+					err = fmt.Errorf("valid field's data type should be bool, or you not using null.types")
+					z.Error(err.Error())
+					return
+				}
+				if !valid { // empty/nil field
+					continue nextField
+				}
+			case (kind == reflect.Slice || kind == reflect.Array ||
+				kind == reflect.Map) && fieldValue.Len() == 0:
+				continue nextField
+			}
+
+			switch val := fieldValue.Interface().(type) {
+			case bool:
+				if !val {
+					continue nextField
+				}
+			case int, int8, int16, int32, int64, float32, float64, uint, uint16, uint32, uint64:
+				if val == 0 {
+					continue nextField
+				}
+			case string:
+				if val == "" {
+					continue nextField
+				}
+			default:
+				// it's struct/slice/array
+				break
+			}
+
+			break
+		}
+		// ------------------
+
+		columnName := strings.Trim(strings.Split(dbTag, ",")[0], " ")
+		if action == "UPDATE" && strings.ToLower(columnName) == "id" {
+			z.Info("id update disabled")
+			continue
+		}
+		columns = append(columns, columnName)
+		values = append(values, fieldValue.Interface())
+	}
+	return
+}
+
 //DML Data Management Language
-func DML(f *Filter, req *ReqProto) (err error) {
+//  action: INSERT, UPDATE, DELETE, SELECT, UPSERT; INSERT/UPSERT accept json array
+//  in req.Data and return the generated IDs in f.QryResult as json array
+//  when ctx is a request context, the data scope of the requester is ANDed
+//  into every SELECT/UPDATE/DELETE by q.Ep.AccessControlLevel
+//  SELECT with req.Cursor uses keyset pagination, the next cursor is returned in f.NextCursor
+//  SELECT with req.Aggregates/req.GroupBy returns aggregate rows, see aggregateSelect
+//  SELECT with req.Expand returns the related rows as nested json, see expandRelations
+//  UPDATE with req.Version uses optimistic locking, returns *ConflictError if the row has been modified
+//  INSERT/UPDATE/DELETE/UPSERT are recorded into t_account_opr_log in the same transaction, see audit.go
+//  DELETE/RESTORE mark/unmark rows as deleted on table with softDelete tag, see soft-delete.go
+func DML(ctx context.Context, f *Filter, req *ReqProto) (err error) {
+	zr := LoggerOf(ctx)
 	if sqlxDB == nil {
 		err = fmt.Errorf("please connect to dbms")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if f == nil {
 		err = fmt.Errorf("call executeDML with nil param f")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if f.TableMap == nil {
 		err = fmt.Errorf("call executeDML with nil param f.tableMap")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if req.Action == "" {
 		err = fmt.Errorf("call executeDML with empty param action")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -100,7 +191,7 @@ func DML(f *Filter, req *ReqProto) (err error) {
 
 	if reflect.TypeOf(reflect.ValueOf(f.TableMap).Interface()).Kind() != reflect.Ptr {
 		err = fmt.Errorf("f.tableMap should be pointer, please using &struct to set it")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -109,20 +200,30 @@ func DML(f *Filter, req *ReqProto) (err error) {
 	fnc := reflect.ValueOf(f.TableMap).MethodByName("GetTableName")
 	if !fnc.IsValid() {
 		err = fmt.Errorf("missing GetTableName on struct " + objT.Name())
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	r := fnc.Call([]reflect.Value{})
 	if len(r) == 0 {
 		err = fmt.Errorf("GetTableName on struct " + objT.Name() + " return empty")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
 	tblName, ok := r[0].Interface().(string)
 	if !ok {
 		err = fmt.Errorf("GetTableName on struct " + objT.Name() + " return non string value")
-		z.Error(err.Error())
+		zr.Error(err.Error())
+		return
+	}
+
+	var span *Span
+	ctx, span = startDBSpan(ctx, action, tblName)
+	defer func() { span.End(err) }()
+	f.ctx = ctx
+
+	err = applyAuthFilter(ctx, req)
+	if err != nil {
 		return
 	}
 
@@ -133,13 +234,32 @@ func DML(f *Filter, req *ReqProto) (err error) {
 		jsonDataTypeToGo(req.AuthFilter)
 	}
 
+	// changes and their audit trail are written in the same transaction
+	var audit *auditTrail
+	switch action {
+	case "INSERT", "UPDATE", "DELETE", "UPSERT", "RESTORE":
+		audit, err = beginAudit(ctx, f, tblName, action)
+		if err != nil {
+			return
+		}
+		defer func() {
+			err = audit.finish(err)
+		}()
+	}
+
+	// batch insert and upsert
+	if action == "UPSERT" || (action == "INSERT" && isJSONArray(req.Data)) {
+		err = batchInsert(f, req, tblName, objT, action, audit)
+		return
+	}
+
 	//Query data prepare
 	switch action {
 	case "UPDATE", "INSERT":
 		if len(req.Data) > 0 {
 			err = json.Unmarshal(req.Data, f.TableMap)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 		}
@@ -147,99 +267,34 @@ func DML(f *Filter, req *ReqProto) (err error) {
 		// from pointer of struct to struct it self.
 		objV := reflect.ValueOf(reflect.ValueOf(f.TableMap).Elem().Interface())
 
-		// generate columns set and values set
-		fieldNum := objV.NumField()
-
-		// *** ATTENTION: we only support null.types
-	nextField: // for continue using this label
-		for i := 0; i < fieldNum; i++ {
-			fieldType := objT.Field(i)
-			fieldValue := objV.Field(i)
-			if !fieldValue.CanInterface() { //non-exported field
-				continue
-			}
-
-			var ok bool
-			var dbTag string
-			kind := fieldValue.Kind()
-
-			dbTag, ok = fieldType.Tag.Lookup("db")
-			if !ok { // not a db column field
-				continue
-			}
-			// --------------
-			// value check
-			for {
-				switch {
-				case kind == reflect.Struct && fieldValue.FieldByName("Valid").IsValid():
-					var valid bool
-					valid, ok = fieldValue.FieldByName("Valid").Interface().(bool)
-					if !ok {
-						err = fmt.Errorf("valid field's data type should be bool, or you not using null.types")
-						z.Error(err.Error())
-						return
-					}
-					if !valid { // empty/nil field
-						continue nextField
-					}
-				case (kind == reflect.Slice || kind == reflect.Array ||
-					kind == reflect.Map) && fieldValue.Len() == 0:
-					continue nextField
-				}
-
-				switch val := fieldValue.Interface().(type) {
-				case bool:
-					if !val {
-						continue nextField
-					}
-				case int, int8, int16, int32, int64, float32, float64, uint, uint16, uint32, uint64:
-					if val == 0 {
-						continue nextField
-					}
-				case string:
-					if val == "" {
-						continue nextField
-					}
-				default:
-					// it's struct/slice/array
-					break
-				}
-
-				break
-			}
-			// ------------------
-
-			columnName := strings.Trim(strings.Split(dbTag, ",")[0], " ")
-			if action == "UPDATE" && strings.ToLower(columnName) == "id" {
-				z.Info("id update disabled")
-				continue
-			}
-			f.Columns = append(f.Columns, columnName)
-			f.Values = append(f.Values, fieldValue.Interface())
+		f.Columns, f.Values, err = columnValues(objT, objV, action)
+		if err != nil {
+			return
 		}
 		jsonDataTypeToGo(f.Values)
 
 	case "SELECT":
-		if len(req.Sets) != 0 {
+		// the select list of aggregate query is built by aggregateSelect
+		if len(req.Sets) != 0 || isAggregate(req) {
 			break
 		}
 		fnc := reflect.ValueOf(f.TableMap).MethodByName("Fields")
 		if !fnc.IsValid() {
 			err = fmt.Errorf("missing Fields on struct " + objT.Name())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		r := fnc.Call([]reflect.Value{})
 		if len(r) == 0 {
 			err = fmt.Errorf("Fields on struct " + objT.Name() + " return empty")
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
 		fields, ok := r[0].Interface().([]string)
 		if !ok {
 			err = fmt.Errorf("Fields on struct " + objT.Name() + " return non []string value")
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		req.Sets = fields
@@ -250,12 +305,12 @@ func DML(f *Filter, req *ReqProto) (err error) {
 	case "INSERT":
 		if len(f.Columns) == 0 {
 			err = fmt.Errorf("empty column list")
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		if len(f.Columns) != len(f.Values) {
 			err = fmt.Errorf("number of columns not equal to number of values")
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		var columns string
@@ -268,33 +323,45 @@ func DML(f *Filter, req *ReqProto) (err error) {
 		values = values[:len(values)-1]
 
 		s := fmt.Sprintf(`INSERT INTO %s(%s) VALUES(%s) RETURNING ID`, tblName, columns, values)
-		var stmt *sql.Stmt
-		stmt, err = sqlxDB.Prepare(s)
+		if audit != nil {
+			s = s + "," + audit.returning()
+		}
+		var stmt *sqlx.Stmt
+		var release func()
+		stmt, release, err = acquireStmt(s)
 		if err != nil {
-			z.Error(err.Error())
 			return
 		}
-		defer stmt.Close()
+		defer release()
+		stmt = audit.bind(stmt)
 
-		z.Info(s)
-		z.Info(fmt.Sprintf("%v", f.Values))
+		zr.Info(s)
+		zr.Info(fmt.Sprintf("%v", f.Values))
 
-		r := stmt.QueryRow(f.Values...)
+		r := stmt.QueryRowContext(f.dbCtx(), f.Values...)
 		var id int64
-		err = r.Scan(&id)
+		if audit != nil {
+			var img []byte
+			err = r.Scan(&id, &img)
+			if err == nil {
+				err = audit.add(img, false)
+			}
+		} else {
+			err = r.Scan(&id)
+		}
 		if err != nil {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		if id > 0 {
-			z.Info(fmt.Sprintf("insert successfully with id = %d", id))
+			zr.Info(fmt.Sprintf("insert successfully with id = %d", id))
 			f.QryResult = id
 		}
 
 	case "UPDATE":
 		if len(f.Columns) == 0 {
 			f.QryResult = 1
-			z.Info("len(f.column)==0, update needless.")
+			zr.Info("len(f.column)==0, update needless.")
 			return
 		}
 
@@ -316,39 +383,74 @@ func DML(f *Filter, req *ReqProto) (err error) {
 			}
 		}
 
-		s := fmt.Sprintf("UPDATE %s SET %s WHERE %s", tblName, sets, expr)
-		var stmt *sql.Stmt
-		stmt, err = sqlxDB.Prepare(s)
-		if err != nil {
-			z.Error(err.Error())
-			return
+		if req.Version != nil {
+			var versionSet, versionCond string
+			versionSet, versionCond, err = f.versionExpr(req, objT, tblName)
+			if err != nil {
+				return
+			}
+			if versionSet != "" {
+				sets = sets + "," + versionSet
+			}
+			expr = fmt.Sprintf("(%s) and %s", expr, versionCond)
 		}
-		defer stmt.Close()
 
-		var result sql.Result
-		z.Info(s)
-		z.Info(fmt.Sprintf("%v", f.Values))
-		result, err = stmt.Exec(f.Values...)
+		s := fmt.Sprintf("UPDATE %s SET %s WHERE %s", tblName, sets, expr)
+		if audit != nil {
+			err = audit.captureBefore(f, req)
+			if err != nil {
+				return
+			}
+			s = s + " RETURNING " + audit.returning()
+		}
+		var stmt *sqlx.Stmt
+		var release func()
+		stmt, release, err = acquireStmt(s)
 		if err != nil {
-			z.Error(err.Error())
 			return
 		}
+		defer release()
+		stmt = audit.bind(stmt)
+
+		zr.Info(s)
+		zr.Info(fmt.Sprintf("%v", f.Values))
 		var d int64
-		if d, err = result.RowsAffected(); err != nil {
-			z.Error(err.Error())
-			return
+		if audit != nil {
+			d, err = audit.query(stmt, f.Values, false)
+			if err != nil {
+				return
+			}
+		} else {
+			var result sql.Result
+			result, err = stmt.ExecContext(f.dbCtx(), f.Values...)
+			if err != nil {
+				zr.Error(err.Error())
+				return
+			}
+			if d, err = result.RowsAffected(); err != nil {
+				zr.Error(err.Error())
+				return
+			}
 		}
 
 		f.QryResult = d
 		if d > 0 {
-			z.Info("update success")
+			zr.Info("update success")
+		}
+		if d == 0 && req.Version != nil {
+			err = conflictError(f, req, tblName, objT)
 		}
 
 	case "DELETE":
+		if sd := softDeleteOf(objT); sd != nil {
+			err = f.softDelete(req, sd, tblName, action, operatorID(ctx), audit)
+			return
+		}
+
 		var expr string
 		expr, err = f.CreateFilter(req)
 		if err != nil {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -360,56 +462,72 @@ func DML(f *Filter, req *ReqProto) (err error) {
 		}
 
 		s := fmt.Sprintf("DELETE FROM %s WHERE %s", tblName, expr)
-		z.Info(s)
-		z.Info(fmt.Sprintf("%v", f.Values))
-		var stmt *sql.Stmt
-		stmt, err = sqlxDB.Prepare(s)
-		if err != nil {
-			z.Error(err.Error())
-			return
+		if audit != nil {
+			s = s + " RETURNING " + audit.returning()
 		}
-		defer stmt.Close()
-
-		var result sql.Result
-		result, err = stmt.Exec(f.Values...)
+		zr.Info(s)
+		zr.Info(fmt.Sprintf("%v", f.Values))
+		var stmt *sqlx.Stmt
+		var release func()
+		stmt, release, err = acquireStmt(s)
 		if err != nil {
-			z.Error(err.Error())
 			return
 		}
+		defer release()
+		stmt = audit.bind(stmt)
+
 		var d int64
-		if d, err = result.RowsAffected(); err != nil {
-			z.Error(err.Error())
-			return
+		if audit != nil {
+			d, err = audit.query(stmt, f.Values, true)
+			if err != nil {
+				return
+			}
+		} else {
+			var result sql.Result
+			result, err = stmt.ExecContext(f.dbCtx(), f.Values...)
+			if err != nil {
+				zr.Error(err.Error())
+				return
+			}
+			if d, err = result.RowsAffected(); err != nil {
+				zr.Error(err.Error())
+				return
+			}
 		}
 
 		f.QryResult = d
 		if d > 0 {
-			z.Info("delete success")
+			zr.Info("delete success")
 			return
 		}
 
 	case "SELECT":
+		if isAggregate(req) {
+			err = aggregateSelect(f, req, tblName)
+			return
+		}
 		if len(req.Sets) == 0 {
 			err = fmt.Errorf("empty select sets  on " + objT.Name())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
-		var pageExpr string
-		if req.PageSize != 0 {
-			pageExpr = fmt.Sprintf("LIMIT %d OFFSET %d", req.PageSize, req.Page*req.PageSize)
-			z.Info(pageExpr)
+		keysetMode := req.Cursor != nil
+		if keysetMode && req.PageSize <= 0 {
+			err = fmt.Errorf("pageSize is required by cursor pagination on " + tblName)
+			zr.Error(err.Error())
+			return
 		}
 
 		var pkList []string
 		pkList, err = f.getPrimaryKeys(true)
 		if err != nil {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
 		if len(pkList) == 0 && strings.ToLower(tblName[:2]) != "v_" {
 			err = fmt.Errorf("missing primary key on " + tblName)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -424,13 +542,13 @@ func DML(f *Filter, req *ReqProto) (err error) {
 				columnName, found := f.mapKey(key)
 				if !found {
 					err = fmt.Errorf("unknown " + key + " on " + tblName)
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 				value = strings.ToUpper(value)
 				if value != "ASC" && value != "DESC" {
 					err = fmt.Errorf("unknown " + value + " order type with " + key + " on " + tblName)
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 				orderByList = append(orderByList, columnName+" "+value)
@@ -440,6 +558,22 @@ func DML(f *Filter, req *ReqProto) (err error) {
 			orderBy = strings.Join(orderByList, ",")
 		}
 
+		var keyset []keysetColumn
+		var keysetVals []interface{}
+		if keysetMode {
+			if len(pkList) == 0 {
+				err = fmt.Errorf("cursor pagination requires primary key on " + tblName)
+				zr.Error(err.Error())
+				return
+			}
+			keyset = keysetColumns(orderByList, pkList, objT)
+			orderBy = keysetOrderBy(keyset)
+			keysetVals, err = decodeCursor(*req.Cursor, keyset)
+			if err != nil {
+				return
+			}
+		}
+
 		var expr string
 		expr, err = f.CreateFilter(req)
 		if err != nil {
@@ -455,19 +589,48 @@ func DML(f *Filter, req *ReqProto) (err error) {
 			columnName, found := f.mapKey(fieldName)
 			if !found {
 				err = fmt.Errorf("unknown " + fieldName + " on " + tblName)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			if jsonOPr {
 				if strings.Contains(k, "->>") {
 					err = fmt.Errorf("%s cause the result can't be marshal to json, please use '->' replace '->>'", k)
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 				columnName = strings.ReplaceAll(k, fieldName, columnName) + " as " + columnName
 			}
 			columns = append(columns, columnName)
 		}
+		var expand *expandJoin
+		if len(req.Expand) > 0 {
+			expand, err = f.expandRelations(req, tblName)
+			if err != nil {
+				return
+			}
+		}
+
+		// keyset columns are needed to create the next cursor,
+		//  foreign key columns are needed to join the expanded relations
+		var required []string
+		for _, v := range keyset {
+			required = append(required, v.name)
+		}
+		if expand != nil {
+			required = append(required, expand.fkColumns...)
+		}
+		for _, v := range required {
+			selected := false
+			for _, c := range columns {
+				if strings.EqualFold(c, v) {
+					selected = true
+					break
+				}
+			}
+			if !selected {
+				columns = append(columns, v)
+			}
+		}
 		sets := strings.Join(columns, ",")
 		// ---------
 		// get row count
@@ -478,71 +641,134 @@ func DML(f *Filter, req *ReqProto) (err error) {
 				//f.whereValues = append(f.whereValues, f.authWhereValues[i])
 			}
 		}
-		s := fmt.Sprintf("SELECT count(*) as row_count FROM %s WHERE %s", tblName, expr)
-		z.Info(s)
+		if sd := softDeleteOf(objT); sd != nil && !req.IncludeDeleted {
+			cond, v := sd.excludeDeleted(len(f.Values))
+			expr = fmt.Sprintf("(%s) and %s", expr, cond)
+			f.Values = append(f.Values, v)
+		}
+
+		var s string
 		var stmt *sqlx.Stmt
+		// keyset pagination is used on large table, skip the expensive count(*)
+		if !keysetMode {
+			s = fmt.Sprintf("SELECT count(*) as row_count FROM %s WHERE %s", tblName, expr)
+			zr.Info(s)
 
-		stmt, err = sqlxDB.Preparex(s)
-		if err != nil {
-			z.Error(err.Error())
-			return
+			var release func()
+			stmt, release, err = acquireStmt(s)
+			if err != nil {
+				return
+			}
+			defer release()
+
+			row := stmt.QueryRowxContext(f.dbCtx(), f.Values...)
+			err = row.Scan(&f.RowCount)
+			if err != nil {
+				zr.Error(err.Error())
+				return
+			}
 		}
-		defer stmt.Close()
 
-		row := stmt.QueryRowx(f.Values...)
-		err = row.Scan(&f.RowCount)
-		if err != nil {
-			z.Error(err.Error())
-			return
+		if len(keysetVals) > 0 {
+			keysetCond, args := keysetExpr(keyset, keysetVals, len(f.Values))
+			expr = fmt.Sprintf("(%s) and (%s)", expr, keysetCond)
+			f.Values = append(f.Values, args...)
 		}
 
 		// ---------
+		// limit and offset are bound as parameters to reuse the statement between pages
+		var pageExpr string
+		values := f.Values
+		if keysetMode {
+			// one more row to find out whether there is a next page
+			pageExpr = fmt.Sprintf("LIMIT $%d", len(values)+1)
+			values = append(values, req.PageSize+1)
+		} else if req.PageSize != 0 {
+			pageExpr = fmt.Sprintf("LIMIT $%d OFFSET $%d", len(values)+1, len(values)+2)
+			values = append(values, req.PageSize, req.Page*req.PageSize)
+		}
+
 		s = fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s %s", sets, tblName, expr, orderBy, pageExpr)
-		z.Info(s)
-		z.Info(fmt.Sprintf("%v", f.Values))
-		stmt, err = sqlxDB.Preparex(s)
+		if expand != nil {
+			s, values, err = expand.selectSQL(sets, tblName, expr, orderBy, pageExpr, values)
+			if err != nil {
+				return
+			}
+		}
+		zr.Info(s)
+		zr.Info(fmt.Sprintf("%v", values))
+		var release func()
+		stmt, release, err = acquireStmt(s)
 		if err != nil {
-			z.Error(err.Error())
 			return
 		}
-		defer stmt.Close()
+		defer release()
 		var rows *sqlx.Rows
-		rows, err = stmt.Queryx(f.Values...)
+		rows, err = stmt.QueryxContext(f.dbCtx(), values...)
 		if err != nil {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		defer rows.Close()
 
 		var buf []byte
 		var qryResults []string
+		var lastRow interface{}
 		for rows.Next() {
+			if keysetMode && int64(len(qryResults)) == req.PageSize {
+				f.NextCursor, err = encodeCursorOf(lastRow, keyset)
+				if err != nil {
+					return
+				}
+				break
+			}
 			pValue := reflect.New(objT)
 			if !pValue.CanInterface() {
 				err = fmt.Errorf("pValue can't interface() while it should")
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			p := pValue.Interface()
-			err = rows.StructScan(p)
+			var expanded map[string]json.RawMessage
+			if expand != nil {
+				expanded, err = expand.scan(rows, p)
+			} else {
+				err = rows.StructScan(p)
+			}
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			buf, err = MarshalJSON(p)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
+			if expand != nil {
+				buf, err = mergeExpanded(buf, expanded)
+				if err != nil {
+					return
+				}
+			}
 			var qryValue map[string]interface{}
 			err = json.Unmarshal(buf, &qryValue)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			f.Result = append(f.Result, p)
 			qryResults = append(qryResults, string(buf))
+			lastRow = p
+		}
+
+		err = rows.Err()
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+		if keysetMode {
+			f.RowCount = int64(len(qryResults))
 		}
 
 		if len(qryResults) > 0 {
@@ -551,9 +777,19 @@ func DML(f *Filter, req *ReqProto) (err error) {
 		}
 		f.QryResult = "[]"
 
+	case "RESTORE":
+		sd := softDeleteOf(objT)
+		if sd == nil {
+			err = fmt.Errorf("%s hasn't soft delete column to restore", tblName)
+			zr.Error(err.Error())
+			return
+		}
+		err = f.softDelete(req, sd, tblName, action, operatorID(ctx), audit)
+		return
+
 	default:
 		err = fmt.Errorf("unsupported action " + action + " on " + objT.Name())
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	return
@@ -15,7 +15,6 @@ import (
 	"net/url"
 	"os"
 	"strings"
-	"sync"
 
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
@@ -117,7 +116,7 @@ type fileOwnDesc struct {
 	FileOID null.Int `json:"fileOID,omitempty"`
 
 	//是否保留原物理文件
-	//于函数deleteFileFromTableField(*fileOwnDesc)使用,为true时将清除字段信息,但保留物理文件和file表中信息
+	//于函数deleteFileFromTableField(ctx, *fileOwnDesc)使用,为true时将清除字段信息,但保留物理文件和file表中信息
 	reservedFile bool
 }
 
@@ -172,11 +171,16 @@ var maxUploadFileSize = int64(2 * 1024 * 1024)
 
 */
 func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists bool, err error) {
+	zr := LoggerOf(ctx)
+	var span *Span
+	ctx, span = StartSpan(ctx, "fileDescUpdate")
+	defer func() { span.End(err) }()
+
 	q := GetCtxValue(ctx)
 
 	if q.SysUser == nil || !q.SysUser.ID.Valid || q.SysUser.ID.Int64 <= 0 {
 		err = fmt.Errorf("用户身份已过期,请重新登录")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -189,7 +193,7 @@ func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists b
 		!f.MD5.Valid || f.MD5.String == "" ||
 		!f.Size.Valid || f.Size.Int64 == 0 {
 		err = fmt.Errorf("invalid fileOwnDesc:%+v", f)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -200,7 +204,7 @@ func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists b
 	var stmt *sqlx.Stmt
 	stmt, err = sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -217,7 +221,7 @@ func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists b
 		err = nil
 	}
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -226,7 +230,7 @@ func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists b
 		where belongto_path=$1`
 	stmt, err = sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -246,16 +250,16 @@ func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists b
 		err = nil
 	}
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if pathExists && (!digest.Valid || digest.String == "") {
 		err = fmt.Errorf("digest is empty with belongtoPath=%s", belongToPath)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if fdExists && pathExists {
-		z.Info(fmt.Sprintf("用户重复上传同一文件:%s", f.Name.String))
+		zr.Info(fmt.Sprintf("用户重复上传同一文件:%s", f.Name.String))
 		f.FileID = fileID
 		return
 	}
@@ -271,7 +275,7 @@ func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists b
 		//var stmt *sql.Stmt
 		stmt, err = sqlxDB.Preparex(s)
 		if err != nil {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		defer func() { _ = stmt.Close() }()
@@ -280,12 +284,12 @@ func fileDescUpdate(ctx context.Context, f *fileOwnDesc) (fdExists, pathExists b
 		var id int64
 		err = r.Scan(&id)
 		if err != nil && err != sql.ErrNoRows {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
 		if id > 0 {
-			z.Info(fmt.Sprintf("insert successfully with id = %d", id))
+			zr.Info(fmt.Sprintf("insert successfully with id = %d", id))
 		}
 		f.FileID = null.IntFrom(id)
 	}
@@ -310,7 +314,8 @@ func getTableField(f *fileOwnDesc) (tableField string, err error) {
 	return
 }
 
-func updateTableField(f *fileOwnDesc) (filesField string, err error) {
+func updateTableField(ctx context.Context, f *fileOwnDesc) (filesField string, err error) {
+	zr := LoggerOf(ctx)
 	errMsg := ""
 	switch {
 	case f == nil:
@@ -329,7 +334,7 @@ func updateTableField(f *fileOwnDesc) (filesField string, err error) {
 
 	if errMsg != "" {
 		err = fmt.Errorf("invalid %s", errMsg)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -342,14 +347,14 @@ func updateTableField(f *fileOwnDesc) (filesField string, err error) {
 	if len(desc) != 2 {
 		err = fmt.Errorf("invalid value for key: %s in ownerItemToTable",
 			f.OwnerType.String+"."+f.Item.String)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	s := fmt.Sprintf(`select %s from %s where id=$1`, desc[1], desc[0])
 	var stmt *sqlx.Stmt
 	stmt, err = sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -360,11 +365,11 @@ func updateTableField(f *fileOwnDesc) (filesField string, err error) {
 	if err == sql.ErrNoRows {
 		err = fmt.Errorf("不存在%s.%s.%d", f.OwnerType.String,
 			f.Item.String, f.LinkID.Int64)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -377,7 +382,7 @@ func updateTableField(f *fileOwnDesc) (filesField string, err error) {
 	var files []fileDesc
 	err = json.Unmarshal([]byte(jsonStr), &files)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	fileNum := len(files)
@@ -428,18 +433,18 @@ func updateTableField(f *fileOwnDesc) (filesField string, err error) {
 	var buf []byte
 	buf, err = json.Marshal(&files)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
 	s = fmt.Sprintf(`update %s set %s=$1 where id=$2 returning %s`,
 		desc[0], desc[1], desc[1])
 
-	z.Info(fmt.Sprintf("%s %s %d", s, string(buf), f.LinkID.Int64))
+	zr.Info(fmt.Sprintf("%s %s %d", s, string(buf), f.LinkID.Int64))
 
 	stmt, err = sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -447,7 +452,7 @@ func updateTableField(f *fileOwnDesc) (filesField string, err error) {
 	var savedFilesDesc null.String
 	err = stmt.QueryRow(string(buf), f.LinkID.Int64).Scan(&savedFilesDesc)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -472,13 +477,14 @@ func updateTableField(f *fileOwnDesc) (filesField string, err error) {
 
 	删除后，将重新调整SN，以使SN保持连续
 */
-func deleteFileFromTableField(f *fileOwnDesc) (err error) {
+func deleteFileFromTableField(ctx context.Context, f *fileOwnDesc) (err error) {
+	zr := LoggerOf(ctx)
 	if f == nil ||
 		!f.OwnerType.Valid || f.OwnerType.String == "" ||
 		!f.Item.Valid || f.Item.String == "" ||
 		!f.LinkID.Valid || f.LinkID.Int64 == 0 || !f.SN.Valid {
 		err = fmt.Errorf("call deleteFileFromTableField with invalid f")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	var tableField string
@@ -490,14 +496,14 @@ func deleteFileFromTableField(f *fileOwnDesc) (err error) {
 	if len(desc) != 2 {
 		err = fmt.Errorf("invalid value for key: %s in ownerItemToTable",
 			f.OwnerType.String+"."+f.Item.String)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	s := fmt.Sprintf(`select %s from %s where id=$1`, desc[1], desc[0])
 	var stmt *sqlx.Stmt
 	stmt, err = sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -508,11 +514,11 @@ func deleteFileFromTableField(f *fileOwnDesc) (err error) {
 	if err == sql.ErrNoRows {
 		err = fmt.Errorf("不存在%s.%s.%d", f.OwnerType.String,
 			f.Item.String, f.LinkID.Int64)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -523,13 +529,13 @@ func deleteFileFromTableField(f *fileOwnDesc) (err error) {
 	var files []fileDesc
 	err = json.Unmarshal([]byte(jsonStr), &files)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
 	if len(files) <= 0 {
 		err = fmt.Errorf("没有文件可以删除")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -563,7 +569,7 @@ func deleteFileFromTableField(f *fileOwnDesc) (err error) {
 
 	if len(filesToDel) <= 0 {
 		err = fmt.Errorf("没有文件可以删除")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -574,37 +580,37 @@ func deleteFileFromTableField(f *fileOwnDesc) (err error) {
 	var buf []byte
 	buf, err = json.Marshal(&files)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	s = fmt.Sprintf(`update %s set %s=$1 where id=$2`, desc[0], desc[1])
 	var stmtX *sql.Stmt
 	stmtX, err = sqlxDB.Prepare(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmtX.Close() }()
 	var result sql.Result
 	result, err = stmtX.Exec(string(buf), f.LinkID.Int64)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	var d int64
 	if d, err = result.RowsAffected(); err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if d <= 0 {
 		err = fmt.Errorf("对%s/%s/%d/%s更新失败", f.OwnerType.String, f.Item.String, f.LinkID.Int64, f.Name.String)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
 	if !f.reservedFile {
 		for _, e := range filesToDel {
-			err = deleteFileByID(e.FileID.Int64)
+			err = deleteFileByID(ctx, e.FileID.Int64)
 			if err != nil {
 				return
 			}
@@ -614,11 +620,32 @@ func deleteFileFromTableField(f *fileOwnDesc) (err error) {
 	return
 }
 
-func deleteFileByID(fileID int64) (err error) {
+func deleteFileByID(ctx context.Context, fileID int64) (err error) {
+	zr := LoggerOf(ctx)
 	if fileID <= 0 {
 		err = fmt.Errorf("call deleteFileByID with zero fileID")
 		return
 	}
+
+	// the rows referencing the file are counted with the file locked
+	var fileDigest null.String
+	err = sqlxDB.QueryRow(`select digest from t_file where id=$1`, fileID).Scan(&fileDigest)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("inexistent file with id=%d", fileID)
+		zr.Error(err.Error())
+		return
+	}
+	if err != nil {
+		zr.Error(err.Error())
+		return
+	}
+	var unlock func()
+	unlock, err = LockKey(ctx, FileLockKey(fileDigest.String))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
 	s := `select digest,path,count(id) as row_count
 		from t_file
 			where digest=(select digest from t_file where id=$1)
@@ -627,7 +654,7 @@ func deleteFileByID(fileID int64) (err error) {
 	var stmt *sqlx.Stmt
 	stmt, err = sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -640,23 +667,23 @@ func deleteFileByID(fileID int64) (err error) {
 	err = row.Scan(&digest, &path, &rowCount)
 	if err == sql.ErrNoRows {
 		err = fmt.Errorf("inexistent file with id=%d", fileID)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if !digest.Valid || digest.String == "" {
 		err = fmt.Errorf("invalid file digest with fileID=%d", fileID)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
 	s = `delete from t_file where id=$1`
 	stmt, err = sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -664,17 +691,17 @@ func deleteFileByID(fileID int64) (err error) {
 	var result sql.Result
 	result, err = stmt.Exec(fileID)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	var d int64
 	if d, err = result.RowsAffected(); err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if d != 1 {
 		err = fmt.Errorf("failed to delte fileInfo(id=%d)", fileID)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -688,7 +715,7 @@ func deleteFileByID(fileID int64) (err error) {
 
 	if !path.Valid || path.String == "" {
 		err = fmt.Errorf("file.id: %d is empty , delete failed", fileID)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -697,24 +724,30 @@ func deleteFileByID(fileID int64) (err error) {
 	_, err = os.Stat(fn)
 	if os.IsNotExist(err) {
 		err = fmt.Errorf("%s inexistence, delete failed", fn)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	err = os.Remove(fn)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 	}
 	return
 }
 
 func fileView(ctx context.Context, view string) {
+	zr := LoggerOf(ctx)
+	var span *Span
+	ctx, span = StartSpan(ctx, "fileView")
+	span.SetAttr("file.view", view)
+
 	q := GetCtxValue(ctx)
-	z.Info("---->" + FncName())
+	defer func() { span.End(q.Err) }()
+	zr.Info("---->" + FncName())
 	q.Stop = true
 
 	if view == "" || len(view) != 32 {
 		q.Err = fmt.Errorf("call fileView with empty/invalid idx")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -722,7 +755,7 @@ func fileView(ctx context.Context, view string) {
 	var stmt *sqlx.Stmt
 	stmt, q.Err = sqlxDB.Preparex(s)
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -734,19 +767,19 @@ func fileView(ctx context.Context, view string) {
 
 	if q.Err == sql.ErrNoRows {
 		q.Err = fmt.Errorf("文件%s不存在", view)
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		return
 	}
 
 	if !path.Valid || path.String == "" || !fileName.Valid || fileName.String == "" {
 		q.Err = fmt.Errorf("查询时与'%s'相关的path、fileName无效", view)
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -756,7 +789,7 @@ func fileView(ctx context.Context, view string) {
 	if os.IsNotExist(q.Err) {
 		if fileOID.Int64 <= 0 {
 			q.Err = fmt.Errorf("文件'%s'不存在", fn)
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -764,7 +797,7 @@ func fileView(ctx context.Context, view string) {
 		var tx pgx.Tx
 		tx, q.Err = pgxConn.Begin(ctx)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -777,7 +810,7 @@ func fileView(ctx context.Context, view string) {
 		dbFile, q.Err = lo.Open(ctx, uint32(fileOID.Int64),
 			pgx.LargeObjectModeRead|pgx.LargeObjectModeWrite)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			_ = tx.Rollback(ctx)
 			return
@@ -787,7 +820,7 @@ func fileView(ctx context.Context, view string) {
 		var fd *os.File
 		fd, q.Err = os.OpenFile(fn, os.O_RDWR|os.O_CREATE, 0664)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -796,13 +829,13 @@ func fileView(ctx context.Context, view string) {
 		var ubiety int64
 		ubiety, q.Err = io.Copy(fd, dbFile)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		if ubiety <= 0 {
 			q.Err = fmt.Errorf("file(digest:%s)零长度文件拷贝", view)
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -967,16 +1000,10 @@ func fileView(ctx context.Context, view string) {
 	1) q.Msg.Data中包含该linkID对应files列的所有的文件信息
 	2) 数据中 "new":true, 表示刚刚成功上传的文件
 */
-var fileDoor sync.Mutex
-
 func qFile(ctx context.Context) {
+	zr := LoggerOf(ctx)
 	q := GetCtxValue(ctx)
-	z.Info("---->" + FncName())
-
-	fileDoor.Lock()
-	defer func() {
-		fileDoor.Unlock()
-	}()
+	zr.Info("---->" + FncName())
 
 	q.Stop = true
 
@@ -990,15 +1017,15 @@ func qFile(ctx context.Context) {
 	qry := q.R.URL.Query().Get("q")
 	if qry == "" {
 		q.Err = fmt.Errorf(`要提供文件信息，要不然不让你做啥哦`)
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
-	z.Info(qry)
+	zr.Info(qry)
 	var req ReqProto
 	q.Err = json.Unmarshal([]byte(qry), &req)
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -1011,14 +1038,14 @@ func qFile(ctx context.Context) {
 			"ownerType":"rptClaims",
 			"linkID":12
 		}`)
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 	var f fileOwnDesc
 	q.Err = json.Unmarshal(req.Data, &f)
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -1033,22 +1060,31 @@ func qFile(ctx context.Context) {
 			"ownerType": 'rptClaims',
 			linkID: 20223,
 		}`)
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 
 	reqAction := strings.ToLower(req.Action)
 
+	// the files of a row are updated one by one
+	var unlock func()
+	unlock, q.Err = LockKey(ctx, RowLockKey(f.OwnerType.String, f.LinkID.Int64))
+	if q.Err != nil {
+		q.RespErr()
+		return
+	}
+	defer unlock()
+
 	switch method {
 	case "delete":
 		if reqAction != "delete" {
 			q.Err = fmt.Errorf("please specify delete as action")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
-		q.Err = deleteFileFromTableField(&f)
+		q.Err = deleteFileFromTableField(ctx, &f)
 		if q.Err != nil {
 			q.RespErr()
 			return
@@ -1060,7 +1096,7 @@ func qFile(ctx context.Context) {
 	case "post":
 		if reqAction != "insert" {
 			q.Err = fmt.Errorf("please specify insert as action")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1133,15 +1169,20 @@ var multiFilesUpload bool
 */
 
 func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err error) {
+	zr := LoggerOf(ctx)
+	var span *Span
+	ctx, span = StartSpan(ctx, "saveFiles")
+	defer func() { span.End(err) }()
+
 	q := GetCtxValue(ctx)
 	if fd == nil {
 		err = fmt.Errorf("f is nil")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	err = q.R.ParseMultipartForm(1024 * 1024 * 32)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	formData := q.R.MultipartForm
@@ -1155,12 +1196,21 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 	var tx pgx.Tx
 	tx, err = pgxConn.Begin(ctx)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
 	defer func() { _ = tx.Rollback(ctx) }()
 
+	// the stored file of a digest is locked till it's referenced by t_file,
+	//  one at a time to avoid deadlock with the other uploads
+	var unlockFile func()
+	defer func() {
+		if unlockFile != nil {
+			unlockFile()
+		}
+	}()
+
 	delta := fileSN
 	var filesMD5 []string
 	for i := range files {
@@ -1169,12 +1219,12 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		srcFileInfo := files[i]
 		if srcFileInfo.Filename == "" {
 			err = fmt.Errorf("第%d个文件的名称为空", i)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		if srcFileInfo.Size == 0 {
 			err = fmt.Errorf("第%d个文件(%s)的长度为零", i, srcFileInfo.Filename)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1183,7 +1233,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 				srcFileInfo.Filename,
 				float64(srcFileInfo.Size)/(1024*1024),
 				float64(maxUploadFileSize)/(1024*1024))
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1192,7 +1242,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		if err != nil {
 			err = fmt.Errorf("第%d个文件(%s)打开时出错: %s",
 				i, srcFileInfo.Filename, err.Error())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		defer func() { _ = src.Close() }()
@@ -1202,7 +1252,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		if err != nil {
 			err = fmt.Errorf("第%d个文件(%s)摘要时出错: %s",
 				i, srcFileInfo.Filename, err.Error())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1213,6 +1263,14 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		fd.SN = null.IntFrom(fileSN)
 		filesMD5 = append(filesMD5, fd.MD5.String)
 
+		if unlockFile != nil {
+			unlockFile()
+		}
+		unlockFile, err = LockKey(ctx, FileLockKey(fd.MD5.String))
+		if err != nil {
+			return
+		}
+
 		s := `select exists(select 1 from t_file where digest=$1)`
 		r := sqlxDB.QueryRow(s, fd.MD5)
 		var exists bool
@@ -1220,7 +1278,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		if err != nil {
 			err = fmt.Errorf("查询第%d个文件(%s)(MD5: %s)时出错: %s",
 				i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1232,7 +1290,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 			if err != nil {
 				err = fmt.Errorf("后端打开第%d个文件(%s)(MD5: %s)时出错: %s",
 					i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			defer func() { _ = dst.Close() }()
@@ -1242,13 +1300,13 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 			if err != nil {
 				err = fmt.Errorf("倒带第%d个文件(%s)(MD5: %s)时出错: %s",
 					i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			if ubiety != 0 {
 				err = fmt.Errorf("倒带第%d个文件(%s)(MD5: %s)时出错: 没倒到头",
 					i, srcFileInfo.Filename, fd.MD5.String)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
@@ -1256,14 +1314,14 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 			if err != nil {
 				err = fmt.Errorf("后端保存第%d个文件(%s)(MD5: %s)时出错: %s",
 					i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			if ubiety != srcFileInfo.Size {
 				err = fmt.Errorf("写第%d个文件(%s)(MD5: %s)时出错: 没有写完整",
 					i, srcFileInfo.Filename, fd.MD5.String)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
@@ -1273,14 +1331,14 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 				if err != nil {
 					err = fmt.Errorf("倒带第%d个文件(%s)(MD5: %s)时出错: %s",
 						i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 
 				if ubiety != 0 {
 					err = fmt.Errorf("倒带第%d个文件(%s)(MD5: %s)时出错: 没倒到头",
 						i, srcFileInfo.Filename, fd.MD5.String)
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 
@@ -1292,7 +1350,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 				if err != nil {
 					err = fmt.Errorf("后端保存第%d个文件(%s)(MD5: %s)时出错: %s",
 						i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 
@@ -1301,7 +1359,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 				if err != nil {
 					err = fmt.Errorf("后端保存第%d个文件(%s)(MD5: %s)时出错: %s",
 						i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 				defer func() { _ = dbFile.Close() }()
@@ -1310,14 +1368,14 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 				if err != nil {
 					err = fmt.Errorf("后端保存第%d个文件(%s)(MD5: %s)时出错: %s",
 						i, srcFileInfo.Filename, fd.MD5.String, err.Error())
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 
 				if ubiety != srcFileInfo.Size {
 					err = fmt.Errorf("写第%d个文件(%s)(MD5: %s)时出错: 没有写完整",
 						i, srcFileInfo.Filename, fd.MD5.String)
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 				fd.FileOID = null.IntFrom(int64(oid))
@@ -1335,7 +1393,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 			continue
 		}
 
-		filesField, err = updateTableField(fd)
+		filesField, err = updateTableField(ctx, fd)
 		if err != nil {
 			return
 		}
@@ -1343,7 +1401,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1358,7 +1416,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		if len(desc) != 2 {
 			err = fmt.Errorf("invalid value for key: %s in ownerItemToTable",
 				fd.OwnerType.String+"."+fd.Item.String)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		s := fmt.Sprintf(`select %s from %s where id=$1`, desc[1], desc[0])
@@ -1366,7 +1424,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		var r null.String
 		err = pgxConn.QueryRow(ctx, s, fd.LinkID.Int64).Scan(&r)
 		if err != nil {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1374,7 +1432,7 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 		if filesField == "" {
 			err = fmt.Errorf("上传后文件集竟然为空, ownerType: %s,item: %s, linkID: %d",
 				fd.OwnerType.String, fd.Item.String, fd.LinkID.Int64)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 	}
@@ -1392,25 +1450,25 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.new", i), true)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.linkID", i), fd.LinkID.Int64)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.ownerType", i), fd.OwnerType.String)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.item", i), fd.Item.String)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
@@ -1421,16 +1479,17 @@ func saveFiles(ctx context.Context, fd *fileOwnDesc) (filesField string, err err
 	return
 }
 
-func saveFileBytes(buff []byte, f *fileOwnDesc) (err error) {
-	z.Info("---->" + FncName())
+func saveFileBytes(ctx context.Context, buff []byte, f *fileOwnDesc) (err error) {
+	zr := LoggerOf(ctx)
+	zr.Info("---->" + FncName())
 	if len(buff) == 0 {
 		err = fmt.Errorf("参数buff长度为空")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if f == nil {
 		err = fmt.Errorf("参数f(文件信息)为空")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1438,12 +1497,12 @@ func saveFileBytes(buff []byte, f *fileOwnDesc) (err error) {
 	var written int
 	written, err = hash.Write(buff)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if written != len(buff) {
 		err = fmt.Errorf("short written")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1456,7 +1515,7 @@ func saveFileBytes(buff []byte, f *fileOwnDesc) (err error) {
 	var exists bool
 	err = r.Scan(&exists)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if exists {
@@ -1467,23 +1526,46 @@ func saveFileBytes(buff []byte, f *fileOwnDesc) (err error) {
 	var dst *os.File
 	dst, err = os.OpenFile(fn, os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = dst.Close() }()
 	written, err = dst.Write(buff)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if written != len(buff) {
 		err = fmt.Errorf("short written")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	return
 }
 
+/*storeFileBytes save buff as the file of f and insert it into t_file like fileDescUpdate,
+with the file of the same content locked */
+func storeFileBytes(ctx context.Context, buff []byte, f *fileOwnDesc) (fdExists, pathExists bool, err error) {
+	var digest string
+	digest, err = getFileMD5(buff, nil, "")
+	if err != nil {
+		return
+	}
+
+	var unlock func()
+	unlock, err = LockKey(ctx, FileLockKey(digest))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = saveFileBytes(ctx, buff, f)
+	if err != nil {
+		return
+	}
+	return fileDescUpdate(ctx, f)
+}
+
 type fileToZip struct {
 	FilePath string //文件路径（不支持文件夹）
 	Header   string //文件头部信息，即在zip文档内的（路径+）文件名称，留空则使用默认文件名
@@ -1552,7 +1634,8 @@ func filesToZipBuffer(src []fileToZip) (buf *bytes.Buffer, err error) {
 }
 
 //if fdExists && pathExists,调用此函数获取fileID
-func getIDIfRepeatUpload(f *fileOwnDesc) (err error) {
+func getIDIfRepeatUpload(ctx context.Context, f *fileOwnDesc) (err error) {
+	zr := LoggerOf(ctx)
 	if f == nil ||
 		!f.OwnerType.Valid || f.OwnerType.String == "" ||
 		!f.Item.Valid || f.Item.String == "" ||
@@ -1562,7 +1645,7 @@ func getIDIfRepeatUpload(f *fileOwnDesc) (err error) {
 		!f.MD5.Valid || f.MD5.String == "" ||
 		!f.Size.Valid || f.Size.Int64 == 0 {
 		err = fmt.Errorf("invalid fileOwnDesc")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	digest := f.MD5
@@ -1571,7 +1654,7 @@ func getIDIfRepeatUpload(f *fileOwnDesc) (err error) {
 	s := `select id from t_file where digest= $1 and belongto_path = $2`
 	stmt, err := sqlxDB.Preparex(s)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = stmt.Close() }()
@@ -1581,17 +1664,17 @@ func getIDIfRepeatUpload(f *fileOwnDesc) (err error) {
 	err = row.Scan(&id)
 	if err == sql.ErrNoRows {
 		err = fmt.Errorf("不存在的文件{digest:%s,belongToPath:%s},却调用了查询重复文件接口", digest.String, belongToPath)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if !id.Valid || id.Int64 == 0 {
 		err = fmt.Errorf("查询重复文件接口,却未获取文件id")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	f.FileID = id
@@ -1713,6 +1796,13 @@ func getFileMD5(buf []byte, src io.Reader, fn string) (md5Sum string, err error)
 
 func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 	fd *fileOwnDesc) (filesField string, err error) {
+	zr := LoggerOf(ctx)
+
+	var span *Span
+	ctx, span = StartSpan(ctx, "saveFile")
+	span.SetAttr("file.name", fileInfo.Filename)
+	span.SetAttr("file.size", fileInfo.Size)
+	defer func() { span.End(err) }()
 
 	fileSN := int64(10000)
 	if fd.SN.Valid {
@@ -1722,7 +1812,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 	var tx pgx.Tx
 	tx, err = pgxConn.Begin(ctx)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1732,12 +1822,12 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 
 	if fileInfo.Filename == "" {
 		err = fmt.Errorf("文件的名称为空")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	if fileInfo.Size == 0 {
 		err = fmt.Errorf("文件(%s)的长度为零", fileInfo.Filename)
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1746,7 +1836,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 			fileInfo.Filename,
 			float64(fileInfo.Size)/(1024*1024),
 			float64(maxUploadFileSize)/(1024*1024))
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1755,7 +1845,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 	if err != nil {
 		err = fmt.Errorf("文件(%s)打开时出错: %s",
 			fileInfo.Filename, err.Error())
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	defer func() { _ = src.Close() }()
@@ -1765,7 +1855,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 	if err != nil {
 		err = fmt.Errorf("生成文件(%s)摘要时出错: %s",
 			fileInfo.Filename, err.Error())
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1776,6 +1866,13 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 	fd.SN = null.IntFrom(fileSN)
 	filesMD5 = append(filesMD5, fd.MD5.String)
 
+	var unlock func()
+	unlock, err = LockKey(ctx, FileLockKey(fd.MD5.String))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
 	s := `select exists(select 1 from t_file where digest=$1)`
 	r := sqlxDB.QueryRow(s, fd.MD5)
 	var exists bool
@@ -1783,7 +1880,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 	if err != nil {
 		err = fmt.Errorf("文件(%s)(MD5: %s)时出错: %s",
 			fileInfo.Filename, fd.MD5.String, err.Error())
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1795,7 +1892,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 		if err != nil {
 			err = fmt.Errorf("后端打开文件(%s)(MD5: %s)时出错: %s",
 				fileInfo.Filename, fd.MD5.String, err.Error())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		defer func() { _ = dst.Close() }()
@@ -1805,13 +1902,13 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 		if err != nil {
 			err = fmt.Errorf("倒带文件(%s)(MD5: %s)时出错: %s",
 				fileInfo.Filename, fd.MD5.String, err.Error())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		if ubiety != 0 {
 			err = fmt.Errorf("倒带文件(%s)(MD5: %s)时出错: 没倒到头",
 				fileInfo.Filename, fd.MD5.String)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1819,14 +1916,14 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 		if err != nil {
 			err = fmt.Errorf("后端保存文件(%s)(MD5: %s)时出错: %s",
 				fileInfo.Filename, fd.MD5.String, err.Error())
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
 		if ubiety != fileInfo.Size {
 			err = fmt.Errorf("写文件(%s)(MD5: %s)时出错: 没有写完整",
 				fileInfo.Filename, fd.MD5.String)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1836,14 +1933,14 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 			if err != nil {
 				err = fmt.Errorf("倒带文件(%s)(MD5: %s)时出错: %s",
 					fileInfo.Filename, fd.MD5.String, err.Error())
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			if ubiety != 0 {
 				err = fmt.Errorf("倒带文件(%s)(MD5: %s)时出错: 没倒到头",
 					fileInfo.Filename, fd.MD5.String)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
@@ -1855,7 +1952,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 			if err != nil {
 				err = fmt.Errorf("后端保存文件(%s)(MD5: %s)时出错: %s",
 					fileInfo.Filename, fd.MD5.String, err.Error())
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
@@ -1864,7 +1961,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 			if err != nil {
 				err = fmt.Errorf("后端保存文件(%s)(MD5: %s)时出错: %s",
 					fileInfo.Filename, fd.MD5.String, err.Error())
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			defer func() { _ = dbFile.Close() }()
@@ -1873,14 +1970,14 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 			if err != nil {
 				err = fmt.Errorf("后端保存文件(%s)(MD5: %s)时出错: %s",
 					fileInfo.Filename, fd.MD5.String, err.Error())
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			if ubiety != fileInfo.Size {
 				err = fmt.Errorf("写文件(%s)(MD5: %s)时出错: 没有写完整",
 					fileInfo.Filename, fd.MD5.String)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			fd.FileOID = null.IntFrom(int64(oid))
@@ -1894,14 +1991,14 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 		return
 	}
 
-	filesField, err = updateTableField(fd)
+	filesField, err = updateTableField(ctx, fd)
 	if err != nil {
 		return
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
@@ -1916,7 +2013,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 		if len(desc) != 2 {
 			err = fmt.Errorf("invalid value for key: %s in ownerItemToTable",
 				fd.OwnerType.String+"."+fd.Item.String)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 		s := fmt.Sprintf(`select %s from %s where id=$1`, desc[1], desc[0])
@@ -1924,7 +2021,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 		var r null.String
 		err = pgxConn.QueryRow(ctx, s, fd.LinkID.Int64).Scan(&r)
 		if err != nil {
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 
@@ -1932,7 +2029,7 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 		if filesField == "" {
 			err = fmt.Errorf("上传后文件集竟然为空, ownerType: %s,item: %s, linkID: %d",
 				fd.OwnerType.String, fd.Item.String, fd.LinkID.Int64)
-			z.Error(err.Error())
+			zr.Error(err.Error())
 			return
 		}
 	}
@@ -1950,25 +2047,25 @@ func saveFile(ctx context.Context, fileInfo *multipart.FileHeader,
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.new", i), true)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.linkID", i), fd.LinkID.Int64)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.ownerType", i), fd.OwnerType.String)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			filesField, err = sjson.Set(filesField, fmt.Sprintf("%d.item", i), fd.Item.String)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			break
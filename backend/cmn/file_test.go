@@ -0,0 +1,209 @@
+package cmn
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"w2w.io/null"
+)
+
+//fileTable t_file in memory, serve the statements of fileDescUpdate, saveFileBytes and deleteFileByID
+type fileTable struct {
+	sync.Mutex
+	seq  int64
+	rows []fileRow
+}
+
+type fileRow struct {
+	id           int64
+	path         string
+	digest       string
+	belongToPath string
+}
+
+//query each statement reads or writes t_file in a separate step, the concurrent calls interleave
+func (t *fileTable) query(q string, args []driver.Value) (*fakeRows, error) {
+	time.Sleep(2 * time.Millisecond)
+
+	t.Lock()
+	defer t.Unlock()
+
+	r := &fakeRows{}
+	count := func(digest string) (n int64, path string) {
+		for _, v := range t.rows {
+			if v.digest == digest {
+				n, path = n+1, v.path
+			}
+		}
+		return
+	}
+	byID := func(id int64) *fileRow {
+		for i := range t.rows {
+			if t.rows[i].id == id {
+				return &t.rows[i]
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(q, "select count(id) as row_count from t_file where digest=$1"):
+		if n, _ := count(args[0].(string)); n > 0 {
+			r.values = append(r.values, []driver.Value{n})
+		}
+
+	case strings.HasPrefix(q, "select digest,id from t_file where belongto_path=$1"):
+		for _, v := range t.rows {
+			if v.belongToPath == args[0].(string) {
+				r.values = append(r.values, []driver.Value{v.digest, v.id})
+				break
+			}
+		}
+
+	case strings.HasPrefix(q, "insert into t_file"):
+		t.seq++
+		t.rows = append(t.rows, fileRow{
+			id:           t.seq,
+			path:         args[0].(string),
+			digest:       args[2].(string),
+			belongToPath: args[3].(string),
+		})
+		r.values = append(r.values, []driver.Value{t.seq})
+
+	case strings.HasPrefix(q, "select exists(select 1 from t_file where digest=$1)"):
+		n, _ := count(args[0].(string))
+		r.values = append(r.values, []driver.Value{n > 0})
+
+	case strings.HasPrefix(q, "select digest from t_file where id=$1"):
+		if v := byID(args[0].(int64)); v != nil {
+			r.values = append(r.values, []driver.Value{v.digest})
+		}
+
+	case strings.HasPrefix(q, "select digest,path,count(id) as row_count"):
+		if v := byID(args[0].(int64)); v != nil {
+			n, path := count(v.digest)
+			r.values = append(r.values, []driver.Value{v.digest, path, n})
+		}
+
+	case strings.HasPrefix(q, "delete from t_file where id=$1"):
+		for i, v := range t.rows {
+			if v.id == args[0].(int64) {
+				t.rows = append(t.rows[:i], t.rows[i+1:]...)
+				r.values = append(r.values, nil)
+				break
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unexpected statement: %s", q)
+	}
+	return r, nil
+}
+
+//setupFileTable replace sqlxDB, the file store and the locker for the test
+func setupFileTable(t *testing.T) (tbl *fileTable, ctx context.Context) {
+	tbl = &fileTable{}
+
+	path, l := fileStorePath, locker()
+	t.Cleanup(func() {
+		fileStorePath = path
+		SetLocker(l)
+	})
+
+	openFakeDB(t, tbl.query)
+	fileStorePath = t.TempDir() + "/"
+	SetLocker(NewMemoryLocker())
+
+	q := &ServiceCtx{SysUser: &TUser{ID: null.IntFrom(1)}}
+	ctx = context.WithValue(context.Background(), QNearKey, q)
+	return
+}
+
+func newFileOwnDesc(linkID int64) *fileOwnDesc {
+	return &fileOwnDesc{
+		SN:        null.IntFrom(0),
+		OwnerType: null.StringFrom("insuranceTypes"),
+		Item:      null.StringFrom("files"),
+		LinkID:    null.IntFrom(linkID),
+		Name:      null.StringFrom("list.xlsx"),
+	}
+}
+
+func TestStoreFileBytesConcurrently(t *testing.T) {
+	tbl, ctx := setupFileTable(t)
+	buff := []byte("the same content")
+
+	// the same content uploaded to the same row twice, and to another row
+	links := []int64{1, 1, 2}
+	var wg sync.WaitGroup
+	errs := make([]error, len(links))
+	for i, id := range links {
+		wg.Add(1)
+		go func(i int, id int64) {
+			defer wg.Done()
+			_, _, errs[i] = storeFileBytes(ctx, buff, newFileOwnDesc(id))
+		}(i, id)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("upload %d: %v", i, err)
+		}
+	}
+	if len(tbl.rows) != 2 {
+		t.Fatalf("t_file should have a row for each of the 2 rows, got %+v", tbl.rows)
+	}
+	if tbl.rows[0].belongToPath == tbl.rows[1].belongToPath {
+		t.Fatalf("duplicate t_file rows: %+v", tbl.rows)
+	}
+	if _, err := os.Stat(fileStorePath + tbl.rows[0].digest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreFileBytesWhileDeleting(t *testing.T) {
+	tbl, ctx := setupFileTable(t)
+	buff := []byte("referenced by one row, then another")
+
+	for i := 0; i < 20; i++ {
+		tbl.rows = nil
+		_ = os.RemoveAll(fileStorePath)
+		_ = os.Mkdir(fileStorePath, 0755)
+
+		f := newFileOwnDesc(1)
+		if _, _, err := storeFileBytes(ctx, buff, f); err != nil {
+			t.Fatal(err)
+		}
+
+		// the only reference removed while the same content is uploaded to another row
+		var wg sync.WaitGroup
+		var delErr, upErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			delErr = deleteFileByID(ctx, f.FileID.Int64)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _, upErr = storeFileBytes(ctx, buff, newFileOwnDesc(2))
+		}()
+		wg.Wait()
+
+		if delErr != nil || upErr != nil {
+			t.Fatalf("delete: %v, upload: %v", delErr, upErr)
+		}
+		if len(tbl.rows) != 1 {
+			t.Fatalf("t_file should have the row of the upload only, got %+v", tbl.rows)
+		}
+		if _, err := os.Stat(fileStorePath + tbl.rows[0].digest); err != nil {
+			t.Fatalf("the file referenced by t_file is removed: %v", err)
+		}
+	}
+}
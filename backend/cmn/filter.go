@@ -1,9 +1,11 @@
 package cmn
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/tidwall/gjson"
@@ -124,6 +126,9 @@ type Filter struct {
 
 	RowCount int64
 
+	// keyset 分页时下一页的 cursor, 空表示已无下一页
+	NextCursor string
+
 	// 授权表达式
 	AuthExpr string
 
@@ -141,6 +146,20 @@ type Filter struct {
 
 	// 生成授权表达式, true: 生成授权表达式，false: 生成数据处理表达式
 	AuthProc bool
+
+	// 生成 having 表达式时聚合列别名(大写)对应的聚合表达式
+	aggregates map[string]string
+
+	// ctx of DML, canceling it aborts the running queries
+	ctx context.Context
+}
+
+//dbCtx context of the queries issued by DML
+func (r *Filter) dbCtx() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
 }
 
 var isOperandList = map[string]bool{
@@ -231,6 +250,7 @@ const connectPreviousBy = "connectBy"
 
 //mapKey map json key to db on fieldName and json tag
 func (r *Filter) mapKey(key string) (dbColumnName string, found bool) {
+	zr := LoggerOf(r.ctx)
 	if key == "" {
 		return "", false
 	}
@@ -238,53 +258,23 @@ func (r *Filter) mapKey(key string) (dbColumnName string, found bool) {
 
 	p := reflect.ValueOf(r.TableMap)
 	if p.IsNil() {
-		z.Error("tableDefineStructPtr is nil")
+		zr.Error("tableDefineStructPtr is nil")
 		return "", false
 	}
 
 	t := reflect.TypeOf(p.Elem().Interface())
 
 	if t.Kind() != reflect.Struct {
-		z.Error(t.Name() + " is not struct")
+		zr.Error(t.Name() + " is not struct")
 		return "", false
 	}
 
-	var f reflect.StructField
-	for i := 0; i < t.NumField(); i++ {
-		f = t.Field(i)
-		if strings.ToUpper(f.Name) == key {
-			found = true
-			dbColumnName = f.Name
-			break
-		}
-
-		s, ok := f.Tag.Lookup("json")
-		if !ok {
-			continue
-		}
-		if s == "" {
-			continue
-		}
-		n := strings.Split(s, ",")[0]
-		if strings.ToUpper(n) == key {
-			found = true
-			dbColumnName = n
-			break
-		}
-	}
-	if !found {
-		return
-	}
-
-	s, ok := f.Tag.Lookup("db")
-	if !ok || s == "" {
+	// the mapping is built once for every struct, see plan-cache.go
+	c, ok := columnMapOf(t)[key]
+	if !ok {
 		return
 	}
-	s = strings.Split(s, ",")[0]
-	if s == "" {
-		found = false
-	}
-	dbColumnName = s
+	dbColumnName, found = c.column, c.found
 	return
 }
 
@@ -323,6 +313,7 @@ func (r *Filter) CreateFilter(req *ReqProto) (expr string, err error) {
 }
 
 func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
+	zr := LoggerOf(r.ctx)
 	exprObj := reflect.ValueOf(conditions)
 	switch exprObj.Kind() {
 	case reflect.Invalid:
@@ -368,7 +359,7 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 			}
 			if expr != "" && q != "" && len(q) >= 6 && q[:2] != "OR" && q[:3] != "AND" {
 				err = fmt.Errorf(q + ` missing "connectBy":"OR|AND"`)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			expr = expr + " " + q
@@ -384,19 +375,27 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 		e, ok := a.(map[string]interface{})
 		if !ok {
 			errMsg := "invalid expression node"
-			z.Error(errMsg)
+			zr.Error(errMsg)
 			err = fmt.Errorf(errMsg)
 			return
 		}
 
+		// visit keys in sorted order to get the same SQL for the same condition shape
+		var keys []string
+		for k := range e {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
 		//{"email":{"ILIKE":"%@gzhu.edu.cn"},"connectBy":"AND"}
-		for dbField, v := range e {
+		for _, dbField := range keys {
+			v := e[dbField]
 			//"connectBy":"AND"
 			if strings.EqualFold(dbField, connectPreviousBy) {
 				s, ok := v.(string)
 				if !ok {
 					err = fmt.Errorf("invalid expression connector")
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 				connector = strings.ToUpper(s)
@@ -406,14 +405,17 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 			k, jsonOpr := getColumnName(dbField)
 			if k == "" {
 				err = fmt.Errorf("invalid key: %s", dbField)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
-			dbColumnName, found := r.mapKey(k)
+			dbColumnName, found := r.aggregates[strings.ToUpper(k)]
+			if !found {
+				dbColumnName, found = r.mapKey(k)
+			}
 			if !found {
 				err = fmt.Errorf("invalid key:" + k)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
@@ -424,24 +426,30 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 			//"email":{"ILIKE":"%@gzhu.edu.cn"}
 			if reflect.ValueOf(v).Kind() != reflect.Map {
 				err = fmt.Errorf("invalid expression value for key: " + k)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			x, ok := v.(map[string]interface{})
 			if !ok {
 				err = fmt.Errorf("invalid expression value for key: " + k)
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 
 			//"email":{"ILIKE": "%@gzhu.edu.cn"}
 			//         operator  operand
-			for operator, operand := range x {
+			var operators []string
+			for k := range x {
+				operators = append(operators, k)
+			}
+			sort.Strings(operators)
+			for _, operator := range operators {
+				operand := x[operator]
 				dstOpr, ok := mapOpr(operator)
 				if !ok {
 					err = fmt.Errorf("invalid opr: " + operator + " for key " + k)
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 
@@ -474,13 +482,13 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 								return
 							}
 							expr = fmt.Sprintf("(%s) IS %s", expr, isOperand)
-							z.Info(expr)
+							zr.Info(expr)
 						}
 					case reflect.String:
 						d, ok := operand.(string)
 						if !ok || d == "" {
 							err = fmt.Errorf("empty value for key " + k + " with operator " + operator)
-							z.Error(err.Error())
+							zr.Error(err.Error())
 							return
 						}
 
@@ -501,11 +509,11 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 								return
 							}
 							expr = fmt.Sprintf("(%s) IS %s", expr, isOperand)
-							z.Info(expr)
+							zr.Info(expr)
 						}
 					default:
 						err = fmt.Errorf("unsupported json data type: " + reflect.TypeOf(operand).Kind().String())
-						z.Error(err.Error())
+						zr.Error(err.Error())
 						return
 					}
 
@@ -534,7 +542,7 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 							return
 						}
 						expr = fmt.Sprintf("(%s) IS %s", expr, isOperand)
-						z.Info(expr)
+						zr.Info(expr)
 					}
 
 				case "IN", "BETWEEN", "NOT_BETWEEN",
@@ -542,14 +550,14 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 
 					if reflect.TypeOf(operand).Kind() != reflect.Slice {
 						err = fmt.Errorf("invalid " + operator + " opr value for key: " + k)
-						z.Error(err.Error())
+						zr.Error(err.Error())
 						return
 					}
 					var valueList string
 					dv := reflect.ValueOf(operand)
 					if dv.Len() == 0 {
 						err = fmt.Errorf("empty value list for operator '" + operator + "' for key: " + k)
-						z.Error(err.Error())
+						zr.Error(err.Error())
 						return
 					}
 
@@ -575,7 +583,7 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 						values := strings.Split(valueList, ",")
 						if len(values) != 2 {
 							err = fmt.Errorf("value's number should be TWO for key " + k + " with OPR: " + operator)
-							z.Error(err.Error())
+							zr.Error(err.Error())
 							return
 						}
 						expr = fmt.Sprintf("%s %s %v AND %v", dbColumnName, dstOpr, values[0], values[1])
@@ -588,7 +596,7 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 							return
 						}
 						expr = fmt.Sprintf("(%s) IS %s", expr, isOperand)
-						z.Info(expr)
+						zr.Info(expr)
 					}
 
 				case "?|", "?&":
@@ -598,7 +606,7 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 					if values, ok = operand.([]interface{}); !ok {
 						err = fmt.Errorf("%s: %v value should be []interface{} with %s, while it's not",
 							k, operand, operator)
-						z.Error(err.Error())
+						zr.Error(err.Error())
 						return
 					}
 
@@ -608,7 +616,7 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 						if s, ok = v.(string); !ok {
 							err = fmt.Errorf("%s: %v value should be []interface{} with %s, while it's not",
 								k, v, operator)
-							z.Error(err.Error())
+							zr.Error(err.Error())
 							return
 						}
 						stringValues = append(stringValues, s)
@@ -633,7 +641,7 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 							return
 						}
 						expr = fmt.Sprintf("(%s) IS %s", expr, isOperand)
-						z.Info(expr)
+						zr.Info(expr)
 					}
 
 				case "vars", "silent", "EXPR_IS":
@@ -669,11 +677,11 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 							return
 						}
 						expr = fmt.Sprintf("(%s) IS %s", expr, isOperand)
-						z.Info(expr)
+						zr.Info(expr)
 					}
 				default:
 					err = fmt.Errorf("unsupported opr: " + operator)
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 			}
@@ -685,29 +693,30 @@ func (r *Filter) MakeFilter(conditions interface{}) (expr string, err error) {
 	case reflect.Struct:
 		err = fmt.Errorf("invalid filter expression: " +
 			objType.Name() + ", it should be slice or map")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 
 	default:
 		err = fmt.Errorf("invalid filter expression: " +
 			objType.Kind().String() + ", it should be slice or map")
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 	return
 }
 
 func (r *Filter) getPrimaryKeys(includeAllKey bool) (primaryKeys []string, err error) {
+	zr := LoggerOf(r.ctx)
 	p := reflect.ValueOf(r.TableMap)
 	if p.IsNil() {
-		z.Error("tableDefineStructPtr is nil")
+		zr.Error("tableDefineStructPtr is nil")
 		return
 	}
 
 	t := reflect.TypeOf(p.Elem().Interface())
 
 	if t.Kind() != reflect.Struct {
-		z.Error(t.Name() + " is not struct")
+		zr.Error(t.Name() + " is not struct")
 		return
 	}
 
@@ -266,8 +266,9 @@ type AutoFillParam struct {
 
 // TODO:删除该接口，前端判断显隐
 func insuranceTypesList(ctx context.Context) {
+	zr := LoggerOf(ctx)
 	q := GetCtxValue(ctx)
-	z.Info("---->" + FncName())
+	zr.Info("---->" + FncName())
 	q.Stop = true
 
 	switch strings.ToLower(q.R.Method) {
@@ -275,7 +276,7 @@ func insuranceTypesList(ctx context.Context) {
 		id := q.R.URL.Query().Get("id")
 		if id == "" {
 			q.Err = fmt.Errorf("撤消报错申请必须提供报错申请编号")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -285,7 +286,7 @@ func insuranceTypesList(ctx context.Context) {
 		pid, q.Err = strconv.ParseInt(id, 10, 64)
 		if pid < 20000 {
 			q.Err = fmt.Errorf("无效编号: %d", pid)
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -294,21 +295,21 @@ func insuranceTypesList(ctx context.Context) {
 		var r sql.Result
 		r, q.Err = sqlxDB.Exec(s, pid)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		var d int64
 		d, q.Err = r.RowsAffected()
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		s = fmt.Sprintf(`{"RowAffected":%d}`, d)
 
-		z.Info(s)
+		zr.Info(s)
 		q.Msg.Data = []byte(s)
 		q.Resp()
 		return
@@ -324,29 +325,29 @@ func insuranceTypesList(ctx context.Context) {
 		qry := q.R.URL.Query().Get("q")
 		if qry == "" || qry == "undefined" || qry == "null" || qry == `""` {
 			q.Err = fmt.Errorf("the param 'q' is empty")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
-		z.Info(qry)
+		zr.Info(qry)
 		var req ReqProto
 		q.Err = json.Unmarshal([]byte(qry), &req)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		if strings.ToLower(req.Action) != "select" {
 			q.Err = fmt.Errorf("please specify select as query action")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		if len(req.Data) == 0 {
 			q.Err = fmt.Errorf("不指定data，你想干啥子哦？")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -354,7 +355,7 @@ func insuranceTypesList(ctx context.Context) {
 		var data getInsuranceOption
 		q.Err = json.Unmarshal(req.Data, &data)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -376,7 +377,7 @@ func insuranceTypesList(ctx context.Context) {
 			}
 			if showInfos == nil {
 				q.Err = fmt.Errorf("险种数据读取获取失败")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -391,7 +392,7 @@ func insuranceTypesList(ctx context.Context) {
 			//	q.RespErr()
 			//	return
 			//}
-			//z.Info(fmt.Sprintf("authType: %s, authData: %s", authType, authData))
+			//zr.Info(fmt.Sprintf("authType: %s, authData: %s", authType, authData))
 
 			for _, v := range getInsuranceList() {
 				if v.DefineLevel.Int64 == 2 {
@@ -400,7 +401,7 @@ func insuranceTypesList(ctx context.Context) {
 			}
 			if showInfos == nil {
 				q.Err = fmt.Errorf("险种数据读取获取失败")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -413,11 +414,11 @@ func insuranceTypesList(ctx context.Context) {
 			//var authType, authData string
 			//authType, authData, _, q.Err = createAuthFilter(ctx, "ID")
 			//if q.Err != nil {
-			//	z.Error(q.Err.Error())
+			//	zr.Error(q.Err.Error())
 			//	q.RespErr()
 			//	return
 			//}
-			//z.Info(fmt.Sprintf("authType: %s, authData: %s", authType, authData))
+			//zr.Info(fmt.Sprintf("authType: %s, authData: %s", authType, authData))
 
 			for _, v := range getInsuranceList() {
 				if v.LayoutLevel.Int64 < 8 {
@@ -426,14 +427,14 @@ func insuranceTypesList(ctx context.Context) {
 			}
 			if showInfos == nil {
 				q.Err = fmt.Errorf("险种数据读取获取失败")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			break
 		default:
 			q.Err = fmt.Errorf("没有传入指定的reqType")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -442,7 +443,7 @@ func insuranceTypesList(ctx context.Context) {
 		var buf []byte
 		buf, q.Err = json.Marshal(&showInfos)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -455,9 +456,10 @@ func insuranceTypesList(ctx context.Context) {
 }
 
 func insuranceTypes(ctx context.Context) {
+	zr := LoggerOf(ctx)
 	q := GetCtxValue(ctx)
 
-	z.Info("---->" + FncName())
+	zr.Info("---->" + FncName())
 	q.Stop = true
 
 	//var authType, authData string
@@ -466,14 +468,14 @@ func insuranceTypes(ctx context.Context) {
 	//	q.RespErr()
 	//	return
 	//}
-	//z.Info(fmt.Sprintf("authType: %s, authData: %s", authType, authData))
+	//zr.Info(fmt.Sprintf("authType: %s, authData: %s", authType, authData))
 
 	switch strings.ToLower(q.R.Method) {
 	case "delete":
 		idSet := q.R.URL.Query().Get("id")
 		if idSet == "" {
 			q.Err = fmt.Errorf("撤消报错申请必须提供报错申请编号")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -484,7 +486,7 @@ func insuranceTypes(ctx context.Context) {
 			typeID, q.Err = strconv.ParseInt(v, 10, 64)
 			if typeID <= 15000 {
 				q.Err = fmt.Errorf("无效编号: %d", typeID)
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -496,18 +498,18 @@ func insuranceTypes(ctx context.Context) {
 		}
 		format = format[:len(format)-1]
 		s := fmt.Sprintf(`delete from t_insurance_types where id in (%s)`, format)
-		z.Info(s)
+		zr.Info(s)
 		var r sql.Result
 		r, q.Err = sqlxDB.Exec(s, values...)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		var d int64
 		d, q.Err = r.RowsAffected()
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -520,21 +522,21 @@ func insuranceTypes(ctx context.Context) {
 		qry := q.R.URL.Query().Get("q")
 		if qry == "" {
 			q.Err = fmt.Errorf("the param 'q' is empty")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		var req ReqProto
 		q.Err = json.Unmarshal([]byte(qry), &req)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		if strings.ToLower(req.Action) != "select" {
 			q.Err = fmt.Errorf("please specify select as insurance query action")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -542,7 +544,7 @@ func insuranceTypes(ctx context.Context) {
 		if urlParam := q.R.URL.Query().Get("rule"); urlParam == "true" {
 			var s TVInsuranceType
 			s.TableMap = &s
-			q.Err = DML(&s.Filter, &req)
+			q.Err = DML(ctx, &s.Filter, &req)
 			if q.Err != nil {
 				q.RespErr()
 				return
@@ -550,11 +552,12 @@ func insuranceTypes(ctx context.Context) {
 			v, ok := s.QryResult.(string)
 			if !ok {
 				q.Err = fmt.Errorf("s.qryResult should be string, but it isn't")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			q.Msg.RowCount = s.RowCount
+			q.Msg.NextCursor = s.NextCursor
 			q.Msg.Data = types.JSONText(v)
 			q.Resp()
 			return
@@ -563,7 +566,7 @@ func insuranceTypes(ctx context.Context) {
 		// var s TInsuranceTypes
 		var s TInsuranceTypes
 		s.TableMap = &s
-		q.Err = DML(&s.Filter, &req)
+		q.Err = DML(ctx, &s.Filter, &req)
 		if q.Err != nil {
 			q.RespErr()
 			return
@@ -572,7 +575,7 @@ func insuranceTypes(ctx context.Context) {
 		v, ok := s.QryResult.(string)
 		if !ok {
 			q.Err = fmt.Errorf("s.qryResult should be string, but it isn't")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -581,7 +584,7 @@ func insuranceTypes(ctx context.Context) {
 		jsonText := types.JSONText(v)
 		q.Err = json.Unmarshal(jsonText, &insuranceSets)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -599,11 +602,12 @@ func insuranceTypes(ctx context.Context) {
 		}
 		jsonText, q.Err = json.Marshal(insuranceSets)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		q.Msg.RowCount = s.RowCount
+		q.Msg.NextCursor = s.NextCursor
 		q.Msg.Data = jsonText
 		q.Resp()
 		return
@@ -611,7 +615,7 @@ func insuranceTypes(ctx context.Context) {
 	case "post":
 		if !q.IsAdmin {
 			q.Err = fmt.Errorf("非管理员,不可修改险种信息")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -624,7 +628,7 @@ func insuranceTypes(ctx context.Context) {
 		var insuranceTypeID int64
 		insuranceTypeID, q.Err = strconv.ParseInt(typeID, 10, 64)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -635,30 +639,30 @@ func insuranceTypes(ctx context.Context) {
 		fd, fileHeader, q.Err = q.R.FormFile("listTpl")
 		if q.Err == http.ErrMissingFile {
 			q.Err = fmt.Errorf("没有上传'listTpl'内容")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		defer fd.Close()
 		if fileHeader.Filename == "" {
 			q.Err = fmt.Errorf("文件名不能为空")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		var buff []byte
 		buff, q.Err = ioutil.ReadAll(fd)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
-		z.Info("上传了文件" + fileHeader.Filename)
+		zr.Info("上传了文件" + fileHeader.Filename)
 		fDesc.SN = null.IntFrom(0)
 		fDesc.Name = null.StringFrom(fileHeader.Filename)
 		fDesc.Label = null.StringFrom(labelListTpl)
@@ -666,21 +670,15 @@ func insuranceTypes(ctx context.Context) {
 		fDesc.LinkID = null.IntFrom(insuranceTypeID)
 		fDesc.Item = null.StringFrom("files")
 		fDesc.reservedFile = true
-		q.Err = saveFileBytes(buff, fDesc)
-		if q.Err != nil {
-			z.Error(q.Err.Error())
-			q.RespErr()
-			return
-		}
 		var fdExists, pathExists bool
-		fdExists, pathExists, q.Err = fileDescUpdate(ctx, fDesc)
+		fdExists, pathExists, q.Err = storeFileBytes(ctx, buff, fDesc)
 		if q.Err != nil {
 			q.RespErr()
 			return
 		}
 
 		if fdExists && pathExists {
-			q.Err = getIDIfRepeatUpload(fDesc)
+			q.Err = getIDIfRepeatUpload(ctx, fDesc)
 			if q.Err != nil {
 				q.RespErr()
 				return
@@ -690,7 +688,7 @@ func insuranceTypes(ctx context.Context) {
 		var f *excelize.File
 		f, q.Err = excelize.OpenFile(fileStorePath + fDesc.MD5.String)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -700,7 +698,7 @@ func insuranceTypes(ctx context.Context) {
 			return
 		}
 		//--删除原文件位置
-		q.Err = deleteFileFromTableField(fDesc)
+		q.Err = deleteFileFromTableField(ctx, fDesc)
 		if q.Err != nil && q.Err.Error() == "没有文件可以删除" {
 			q.Err = nil
 		}
@@ -710,9 +708,9 @@ func insuranceTypes(ctx context.Context) {
 		}
 
 		var filesField string
-		filesField, q.Err = updateTableField(fDesc)
+		filesField, q.Err = updateTableField(ctx, fDesc)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -721,7 +719,7 @@ func insuranceTypes(ctx context.Context) {
 		var stmt *sqlx.Stmt
 		stmt, q.Err = sqlxDB.Preparex(s)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -729,20 +727,20 @@ func insuranceTypes(ctx context.Context) {
 		var result sql.Result
 		result, q.Err = stmt.Exec(fileStorePath+fDesc.MD5.String, insuranceTypeID)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		var d int64
 		if d, q.Err = result.RowsAffected(); q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		if d <= 0 {
 			q.Err = fmt.Errorf("清单路径没有修改成功")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -755,14 +753,14 @@ func insuranceTypes(ctx context.Context) {
 
 		if !q.IsAdmin {
 			q.Err = fmt.Errorf("非管理员,不可修改险种信息")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		var buf []byte
 		buf, q.Err = ioutil.ReadAll(q.R.Body)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -770,28 +768,28 @@ func insuranceTypes(ctx context.Context) {
 
 		if len(buf) == 0 {
 			q.Err = fmt.Errorf("Call /api/order by post with empty body")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
-		z.Info(string(buf))
+		zr.Info(string(buf))
 		var req ReqProto
 		q.Err = json.Unmarshal(buf, &req)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		if strings.ToLower(req.Action) != "update" {
 			q.Err = fmt.Errorf("req.Action is not update")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		if len(req.Data) == 0 {
 			q.Err = fmt.Errorf("不指定data，你想干啥子哦？")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -801,14 +799,14 @@ func insuranceTypes(ctx context.Context) {
 
 		q.Err = json.Unmarshal([]byte(req.Data), &i)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		if !i.ID.Valid || i.ID.Int64 == 0 {
 			q.Err = fmt.Errorf("你需要指定要修改哪个险种")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -819,7 +817,7 @@ func insuranceTypes(ctx context.Context) {
 		fields := insuranceSetting[i.ID.Int64]
 		if fields == nil {
 			q.Err = fmt.Errorf("Unknown types of insurance")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -855,7 +853,7 @@ func insuranceTypes(ctx context.Context) {
 			checkFunc := funcToCheckSetting[updateField]
 			if checkFunc == nil {
 				q.Err = fmt.Errorf("缺少对%s字段的检验函数", updateField)
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -879,14 +877,14 @@ func insuranceTypes(ctx context.Context) {
 
 		req.Data, q.Err = MarshalJSON(i)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		i.TableMap = &i
 
-		q.Err = DML(&i.Filter, &req)
+		q.Err = DML(ctx, &i.Filter, &req)
 		if q.Err != nil {
 			q.RespErr()
 			return
@@ -895,7 +893,7 @@ func insuranceTypes(ctx context.Context) {
 		q.Err = refreshInsuranceTypes()
 		if q.Err != nil {
 			q.Err = fmt.Errorf("数据库更新成功了,但后端保险参数刷新失败。请立刻联系数据库管理员,不要擅自操作!!!错误信息:%s", q.Err.Error())
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -903,7 +901,7 @@ func insuranceTypes(ctx context.Context) {
 		q.Err = refreshBaseParam("保险参数")
 		if q.Err != nil {
 			q.Err = fmt.Errorf("数据库更新成功了,但保险参数刷新失败。请立刻联系数据库管理员,不要擅自操作!!!错误信息:%s", q.Err.Error())
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1749,12 +1747,13 @@ func (i *insurancesData) copyMap() map[int64]*TInsuranceTypes {
 }
 
 func addPlan(ctx context.Context) {
+	zr := LoggerOf(ctx)
 	q := GetCtxValue(ctx)
-	z.Info("---->" + FncName())
+	zr.Info("---->" + FncName())
 	q.Stop = true
 	if !q.IsAdmin {
 		q.Err = fmt.Errorf("非管理员,不可添加方案信息")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -1765,14 +1764,14 @@ func addPlan(ctx context.Context) {
 	buf = []byte(str)
 	if len(buf) == 0 {
 		q.Err = fmt.Errorf("call api by post with empty body")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 	var req ReqProto
 	q.Err = json.Unmarshal(buf, &req)
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -1787,7 +1786,7 @@ func addPlan(ctx context.Context) {
 		}
 		q.Msg.Data, q.Err = json.Marshal(d)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1800,14 +1799,14 @@ func addPlan(ctx context.Context) {
 
 	if gjson.Get(string(req.Data), "ContactQrCode").IsObject() {
 		q.Err = fmt.Errorf("ContactQrCode只能是string不能是json对象")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 
 	q.Err = json.Unmarshal(req.Data, &pro)
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -1823,7 +1822,7 @@ func addPlan(ctx context.Context) {
 			orgSet += strconv.FormatInt(o, 10) + "),("
 		}
 		orgSet = orgSet[:len(orgSet)-2]
-		z.Info(orgSet)
+		zr.Info(orgSet)
 		s := fmt.Sprintf(`
 		with org_set(org_id) as (values %s)
 		SELECT org_id, s.name AS org_name, (
@@ -1834,11 +1833,11 @@ func addPlan(ctx context.Context) {
 		FROM org_set AS set 
 		LEFT JOIN t_school s on org_id = s.id
 		`, orgSet)
-		z.Info(fmt.Sprintf(strings.ReplaceAll(s, "$1", "%d"), i.RefID.Int64))
+		zr.Info(fmt.Sprintf(strings.ReplaceAll(s, "$1", "%d"), i.RefID.Int64))
 		var stmt *sqlx.Stmt
 		stmt, q.Err = sqlxDB.Preparex(s)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1846,7 +1845,7 @@ func addPlan(ctx context.Context) {
 		var rows *sqlx.Rows
 		rows, q.Err = stmt.Queryx(i.RefID.Int64)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1856,7 +1855,7 @@ func addPlan(ctx context.Context) {
 			var r ruleAddCheck
 			q.Err = rows.StructScan(&r)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -1866,7 +1865,7 @@ func addPlan(ctx context.Context) {
 			//check org_id exists
 			if v.OrgID.Int64 != 0 && (!v.OrgName.Valid || v.OrgName.String == "") {
 				q.Err = fmt.Errorf("机构 %d 不存在", v.OrgID.Int64)
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -1874,25 +1873,25 @@ func addPlan(ctx context.Context) {
 				//
 				req.Action = "update"
 				i.ID = v.PlanID
-				z.Info(fmt.Sprintf("校验第一个机构重复,改为update操作-->> plan_id:%d", v.PlanID.Int64))
+				zr.Info(fmt.Sprintf("校验第一个机构重复,改为update操作-->> plan_id:%d", v.PlanID.Int64))
 			}
 		}
 		if i.OrgID.Valid && i.OrgID.Int64 != pro.Batch[0] {
 			q.Err = fmt.Errorf("批量设置时请将data.OrgID指定为Bacth[0]")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		} else if !i.OrgID.Valid {
 			i.OrgID = null.IntFrom(pro.Batch[0])
 		}
 	}
-	z.Info(string(req.Data))
+	zr.Info(string(req.Data))
 
 	var id int64
 	if strings.ToLower(req.Action) == "update" {
 		if !i.ID.Valid || i.ID.Int64 == 0 {
 			q.Err = fmt.Errorf("please specify ID when update")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1904,7 +1903,7 @@ func addPlan(ctx context.Context) {
 		}
 		i, q.Err = GetTInsuranceTypesByPk(sqlxDB, i.ID)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1913,14 +1912,14 @@ func addPlan(ctx context.Context) {
 
 	if !i.ParentID.Valid {
 		q.Err = fmt.Errorf("please specify ParentID")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 
 	if !i.DataType.Valid || i.DataType.String == "" || i.DataType.String == "0" {
 		q.Err = fmt.Errorf("please specify DataType")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -1934,14 +1933,14 @@ func addPlan(ctx context.Context) {
 	case i.DataType.String == "6" || (i.DataType.String == "4" && i.ParentID.Int64 == 10040):
 		if !i.PayChannel.Valid || i.PayChannel.String == "" {
 			q.Err = fmt.Errorf("please specify PayChannel")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		if !i.PayType.Valid {
 			q.Err = fmt.Errorf("please specify PayType")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -1952,13 +1951,13 @@ func addPlan(ctx context.Context) {
 		case "线下支付":
 			if !i.PayName.Valid || i.PayName.String == "" {
 				q.Err = fmt.Errorf("please specify PayName")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			//if !i.ContactQrCode.Valid || i.ContactQrCode.String == "" {
 			//	q.Err = fmt.Errorf("please specify ContactQrCode")
-			//	z.Error(q.Err.Error())
+			//	zr.Error(q.Err.Error())
 			//	q.RespErr()
 			//	return
 			//}
@@ -1969,20 +1968,20 @@ func addPlan(ctx context.Context) {
 		case "公对公转账":
 			if !i.PayName.Valid || i.PayName.String == "" {
 				q.Err = fmt.Errorf("please specify PayName")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			if len(i.ReceiptAccount) < 2 {
 				q.Err = fmt.Errorf("please specify ReceiptAccount")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			var receipts []ReceiptAccount
 			q.Err = json.Unmarshal(i.ReceiptAccount, &receipts)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -1990,32 +1989,32 @@ func addPlan(ctx context.Context) {
 
 				if receipt.Bank == "" {
 					q.Err = fmt.Errorf("[对公账号设置]对公帐号设置的开户行为空")
-					z.Error(q.Err.Error())
+					zr.Error(q.Err.Error())
 					q.RespErr()
 					return
 				}
 				if receipt.BankNum == "" {
 					q.Err = fmt.Errorf("[对公账号设置]对公帐号设置的行号为空")
-					z.Error(q.Err.Error())
+					zr.Error(q.Err.Error())
 					q.RespErr()
 					return
 				}
 				if receipt.AccountName == "" {
 					q.Err = fmt.Errorf("[对公账号设置]对公帐号设置的户名为空")
-					z.Error(q.Err.Error())
+					zr.Error(q.Err.Error())
 					q.RespErr()
 					return
 				}
 				if receipt.Account == "" {
 					q.Err = fmt.Errorf("[对公账号设置]对公帐号设置的开户行的账号为空")
-					z.Error(q.Err.Error())
+					zr.Error(q.Err.Error())
 					q.RespErr()
 					return
 				}
 			}
 		default:
 			q.Err = fmt.Errorf("未知 PayType :%s", i.PayType.String)
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -2025,20 +2024,20 @@ func addPlan(ctx context.Context) {
 
 			if !i.InsuredInMonth.Valid || i.InsuredInMonth.Int64 == 0 {
 				q.Err = fmt.Errorf("please specify InsuredInMonth")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			if !i.Price.Valid || i.Price.Float64 == 0 {
 				q.Err = fmt.Errorf("please specify Price")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 
 			if i.AllowStart.Valid != i.AllowEnd.Valid {
 				q.Err = fmt.Errorf("please specify AllowStart/AllowEnd at the same time")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -2047,20 +2046,20 @@ func addPlan(ctx context.Context) {
 		case 10022, 10024, 10026, 10028, 10030:
 			if i.InsuredStartTime.Valid || i.InsuredEndTime.Valid {
 				q.Err = fmt.Errorf("don't specify InsuredStartTime/InsuredEndTime when setting price-plan")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 		default:
 			q.Err = fmt.Errorf("未知的险种id： %d", i.ParentID.Int64)
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		if !i.Insurer.Valid || i.Insurer.String == "" {
 			q.Err = fmt.Errorf("please specify Insurer")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -2075,52 +2074,52 @@ func addPlan(ctx context.Context) {
 			var base *TInsuranceTypes
 			base, q.Err = GetTInsuranceTypesByPk(sqlxDB, i.RefID)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			if base == nil {
 				q.Err = fmt.Errorf("ref_id:%d 不存在", i.RefID.Int64)
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			if base.Status.String != "0" {
 				q.Err = fmt.Errorf("保险方案%d为禁用状态", i.RefID.Int64)
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			if base.RefID.Valid {
 				q.Err = fmt.Errorf("ref_id:%d是投保规则,不是方案", i.RefID.Int64)
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 
 			buf, q.Err = json.Marshal(base)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 
 			q.Err = json.Unmarshal(buf, &rule)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			q.Err = json.Unmarshal(req.Data, &rule)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 		} else {
 			q.Err = sqlxDB.QueryRowx(insuranceTypeQuery+` where id = $1`, i.ID.Int64).StructScan(&rule)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -2128,7 +2127,7 @@ func addPlan(ctx context.Context) {
 		//开始时间/结束时间
 		if !i.AllowStart.Valid || !i.AllowEnd.Valid {
 			q.Err = fmt.Errorf("please specify AllowStart/AllowEnd when setting region-rules")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
@@ -2137,19 +2136,19 @@ func addPlan(ctx context.Context) {
 			var org *TSchool
 			org, q.Err = GetTSchoolByPk(sqlxDB, i.OrgID)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			if org == nil {
 				q.Err = fmt.Errorf("org_id:%d 不存在", i.OrgID.Int64)
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			// if org.Status.String != "0" {
 			// 	q.Err = fmt.Errorf("机构 %d 处于黑名单", i.OrgID.Int64)
-			// 	z.Error(q.Err.Error())
+			// 	zr.Error(q.Err.Error())
 			// 	q.RespErr()
 			// 	return
 			// }
@@ -2159,7 +2158,7 @@ func addPlan(ctx context.Context) {
 			//投保年限
 			if !i.MaxInsureInYear.Valid || i.MaxInsureInYear.Int64 == 0 {
 				q.Err = fmt.Errorf("please specify MaxInsureInYear")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -2169,13 +2168,13 @@ func addPlan(ctx context.Context) {
 
 			valid, q.Err = validateInsurePlan(&rule)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			if !valid {
 				q.Err = fmt.Errorf("校验失败")
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -2201,11 +2200,11 @@ func addPlan(ctx context.Context) {
 		i.Status = null.StringFrom("0")
 	} else if !inSlice(i.Status.String, []string{"0", "4"}) {
 		q.Err = fmt.Errorf("status超出值域{'0','4'}")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
-	q.Err = DML(&i.Filter, &req)
+	q.Err = DML(ctx, &i.Filter, &req)
 
 	if q.Err != nil {
 		if strings.Contains(q.Err.Error(), `duplicate key value violates unique constraint "idx_policy_plan"`) {
@@ -2227,7 +2226,7 @@ func addPlan(ctx context.Context) {
 	_, ok := i.QryResult.(int64)
 	if !ok {
 		q.Err = fmt.Errorf("_, ok = i.filter.qryResult.(int64) should be ok while it's not")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -2236,7 +2235,7 @@ func addPlan(ctx context.Context) {
 		id, ok = i.QryResult.(int64)
 		if !ok {
 			q.Err = fmt.Errorf("_, ok = i.qryResult.(int64) should be ok while it's not")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
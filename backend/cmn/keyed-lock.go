@@ -0,0 +1,284 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/spf13/viper"
+)
+
+/*keyed lock, serialize the operations on the same resource only
+
+	UserLockKey(userID):          同一用户的请求, SerializationReq 为 true 时由 reqProc 使用
+	AddrLockKey(r):               同一地址的请求, 用于未登录的用户
+	RowLockKey(table, id):        同一行数据, 例如 qFile 上传/删除同一行的文件
+	FileLockKey(digest):          同一文件, 文件以摘要保存并由 t_file 中摘要相同的行共用,
+	                              保存文件/写入 t_file/按引用数删除文件时使用, 在 RowLockKey 之后获取
+
+	webServe.lock.backend: memory(缺省) 仅在本进程内互斥, redis 在多个实例间互斥
+	webServe.lock.timeout: 等待锁的最长秒数, 缺省 30
+	webServe.lock.ttl:     redis 锁的租期秒数, 持有期间自动续期, 缺省 30 */
+
+// defaults of webServe.lock
+const (
+	defaultLockTimeout = 30 * time.Second
+	defaultLockTTL     = 30 * time.Second
+)
+
+//ErrLockTimeout returned by LockKey while the lock isn't acquired before timeout
+var ErrLockTimeout = errors.New("wait for lock timeout")
+
+//Locker lock manager of keys
+type Locker interface {
+	//Lock block until key is locked or ctx is done, unlock must be called to release it,
+	//  calling unlock more than once is harmless
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+var keyedLocker struct {
+	sync.Mutex
+	locker Locker
+}
+
+//SetLocker replace the lock manager
+func SetLocker(l Locker) {
+	keyedLocker.Lock()
+	defer keyedLocker.Unlock()
+	keyedLocker.locker = l
+}
+
+func locker() Locker {
+	keyedLocker.Lock()
+	defer keyedLocker.Unlock()
+	if keyedLocker.locker == nil {
+		if strings.EqualFold(viper.GetString("webServe.lock.backend"), "redis") {
+			keyedLocker.locker = NewRedisLocker()
+		} else {
+			keyedLocker.locker = NewMemoryLocker()
+		}
+	}
+	return keyedLocker.locker
+}
+
+//UserLockKey key of the requests of a user
+func UserLockKey(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+//RowLockKey key of a row of table
+func RowLockKey(table string, id int64) string {
+	return fmt.Sprintf("row:%s:%d", strings.ToLower(table), id)
+}
+
+//FileLockKey key of the stored file of digest(t_file.digest)
+func FileLockKey(digest string) string {
+	return "file:" + digest
+}
+
+//AddrLockKey key of the requests from the address of r
+func AddrLockKey(r *http.Request) string {
+	return "addr:" + peerAddr(r)
+}
+
+/*LockKey lock key by the configured lock manager, wait webServe.lock.timeout at most
+if ctx has no deadline, for example
+	unlock, err := cmn.LockKey(ctx, cmn.RowLockKey("t_order", id))
+	if err != nil {
+		return
+	}
+	defer unlock() */
+func LockKey(ctx context.Context, key string) (unlock func(), err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := defaultLockTimeout
+		if viper.IsSet("webServe.lock.timeout") {
+			timeout = time.Duration(viper.GetInt("webServe.lock.timeout")) * time.Second
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	unlock, err = locker().Lock(ctx, key)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%s: %w", key, ErrLockTimeout)
+	}
+	if err != nil {
+		LoggerOf(ctx).Error(err.Error())
+	}
+	return
+}
+
+//---------------------------------------------------------------------------------
+//memoryLocker lock in the process
+
+type memoryLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+type memoryLocker struct {
+	mutex sync.Mutex
+	locks map[string]*memoryLock
+}
+
+//NewMemoryLocker return Locker in the process
+func NewMemoryLocker() Locker {
+	return &memoryLocker{locks: make(map[string]*memoryLock)}
+}
+
+func (t *memoryLocker) Lock(ctx context.Context, key string) (unlock func(), err error) {
+	t.mutex.Lock()
+	l, ok := t.locks[key]
+	if !ok {
+		l = &memoryLock{ch: make(chan struct{}, 1)}
+		t.locks[key] = l
+	}
+	l.refs++
+	t.mutex.Unlock()
+
+	select {
+	case l.ch <- struct{}{}:
+	case <-ctx.Done():
+		t.release(key, l)
+		err = ctx.Err()
+		return
+	}
+
+	var once sync.Once
+	unlock = func() {
+		once.Do(func() {
+			<-l.ch
+			t.release(key, l)
+		})
+	}
+	return
+}
+
+//release drop the lock of key while nobody holds or waits for it
+func (t *memoryLocker) release(key string, l *memoryLock) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(t.locks, key)
+	}
+}
+
+//---------------------------------------------------------------------------------
+//redisLocker lock across instances, the key is locked in the process first
+
+//redisLockKey prefix of the lock keys in redis
+const redisLockKey = "keyedLock:"
+
+//unlockScript delete the lock if it's still held by the token
+var unlockScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+//renewScript extend the lease if it's still held by the token
+var renewScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+type redisLocker struct {
+	local Locker
+}
+
+//NewRedisLocker return Locker shared by the instances through redis
+func NewRedisLocker() Locker {
+	return &redisLocker{local: NewMemoryLocker()}
+}
+
+func lockTTL() time.Duration {
+	if viper.IsSet("webServe.lock.ttl") {
+		if d := time.Duration(viper.GetInt("webServe.lock.ttl")) * time.Second; d > 0 {
+			return d
+		}
+	}
+	return defaultLockTTL
+}
+
+func (t *redisLocker) Lock(ctx context.Context, key string) (unlock func(), err error) {
+	if redisPool == nil {
+		err = errors.New("please connect to redis")
+		return
+	}
+
+	var unlockLocal func()
+	unlockLocal, err = t.local.Lock(ctx, key)
+	if err != nil {
+		return
+	}
+
+	token := randomHex(16)
+	ttl := lockTTL()
+	wait := 10 * time.Millisecond
+	for {
+		var reply interface{}
+		c := redisPool.Get()
+		reply, err = c.Do("SET", redisLockKey+key, token, "NX", "PX", ttl.Milliseconds())
+		_ = c.Close()
+		if err != nil {
+			unlockLocal()
+			return
+		}
+		if reply != nil {
+			break
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			unlockLocal()
+			err = ctx.Err()
+			return
+		}
+		if wait < 200*time.Millisecond {
+			wait *= 2
+		}
+	}
+
+	// renew the lease until unlocked
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c := redisPool.Get()
+				_, _ = renewScript.Do(c, redisLockKey+key, token, ttl.Milliseconds())
+				_ = c.Close()
+			}
+		}
+	}()
+
+	var once sync.Once
+	unlock = func() {
+		once.Do(func() {
+			close(done)
+			c := redisPool.Get()
+			if _, err := unlockScript.Do(c, redisLockKey+key, token); err != nil {
+				z.Error(err.Error())
+			}
+			_ = c.Close()
+			unlockLocal()
+		})
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//TestMemoryLockerExclusive the holders of the same key never overlap, different keys don't wait
+func TestMemoryLockerExclusive(t *testing.T) {
+	l := NewMemoryLocker().(*memoryLocker)
+	ctx := context.Background()
+
+	var holders [2]int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		k := i % 2
+		key := []string{"user:1", "user:2"}[k]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := l.Lock(ctx, key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			if n := atomic.AddInt32(&holders[k], 1); n != 1 {
+				t.Errorf("%d holders of %s", n, key)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders[k], -1)
+		}()
+	}
+	wg.Wait()
+
+	// the locks are dropped when nobody holds or waits for them
+	if n := len(l.locks); n != 0 {
+		t.Fatalf("%d locks left", n)
+	}
+}
+
+func TestMemoryLockerTimeout(t *testing.T) {
+	l := NewMemoryLocker().(*memoryLocker)
+	unlock, err := l.Lock(context.Background(), "row:t_order:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = l.Lock(ctx, "row:t_order:1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// unlock more than once is harmless
+	unlock()
+	unlock()
+	unlock, err = l.Lock(context.Background(), "row:t_order:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if n := len(l.locks); n != 0 {
+		t.Fatalf("%d locks left", n)
+	}
+}
+
+func TestLockKeyTimeout(t *testing.T) {
+	keyedLocker.Lock()
+	saved := keyedLocker.locker
+	keyedLocker.Unlock()
+	SetLocker(NewMemoryLocker())
+	defer SetLocker(saved)
+
+	unlock, err := LockKey(context.Background(), UserLockKey(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = LockKey(ctx, UserLockKey(7)); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("err = %v, want %v", err, ErrLockTimeout)
+	}
+}
@@ -0,0 +1,237 @@
+package cmn
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+)
+
+/*bbolt log sink, zLogger.bblot.enable 为 true 时 LogItemStack 同时写入本地 bbolt,
+数据库不可用时仍可以 QueryBBoltLog 查询日志
+
+	zLogger.bblot.file:          缺省为日志目录下的 log.db
+	zLogger.bblot.retentionDays: 保留的天数, 缺省 7
+
+	每天一个 bucket, 名称为 2006-01-02, key 为 8 字节的 UnixNano + 4 字节序号, value 为日志行(LogItem JSON) */
+
+// defaults of zLogger.bblot
+const (
+	defaultBBoltLogFile      = "log.db"
+	defaultBBoltLogRetention = 7
+	bboltLogDayLayout        = "2006-01-02"
+	bboltLogOpenTimeout      = 100 * time.Millisecond
+)
+
+var bboltLog struct {
+	sync.Mutex
+	db *bolt.DB
+
+	seq        uint32
+	prunedDay  string
+	openFailed time.Time
+}
+
+func bboltLogFile() string {
+	if fn := viper.GetString("zLogger.bblot.file"); fn != "" {
+		return fn
+	}
+	return filepath.Join(filepath.Dir(dstLogFile), defaultBBoltLogFile)
+}
+
+func bboltLogRetention() int {
+	if viper.IsSet("zLogger.bblot.retentionDays") {
+		if n := viper.GetInt("zLogger.bblot.retentionDays"); n > 0 {
+			return n
+		}
+	}
+	return defaultBBoltLogRetention
+}
+
+/*openBBoltLog open the log store with bboltLog locked. The file is locked by one process only,
+the new process of graceful restart retries until the old one closed it */
+func openBBoltLog() (db *bolt.DB, err error) {
+	if bboltLog.db != nil {
+		return bboltLog.db, nil
+	}
+	if time.Since(bboltLog.openFailed) < time.Second {
+		err = fmt.Errorf("open bbolt log store failed recently")
+		return
+	}
+
+	fn := bboltLogFile()
+	db, err = bolt.Open(fn, 0666, &bolt.Options{Timeout: bboltLogOpenTimeout})
+	if err != nil {
+		bboltLog.openFailed = time.Now()
+		err = fmt.Errorf("open %s failed by %s", fn, err.Error())
+		return
+	}
+	bboltLog.db = db
+	return
+}
+
+//closeBBoltLog called by UtilCleanup after the log flushed
+func closeBBoltLog() {
+	bboltLog.Lock()
+	defer bboltLog.Unlock()
+	if bboltLog.db == nil {
+		return
+	}
+	if err := bboltLog.db.Close(); err != nil {
+		log.Print(err.Error())
+	}
+	bboltLog.db = nil
+}
+
+//bboltLogKey key of the log item written at t, seq keeps the items of the same nanosecond
+func bboltLogKey(t time.Time, seq uint32) []byte {
+	k := make([]byte, 12)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint32(k[8:], seq)
+	return k
+}
+
+//flashToBBolt write the stacked log lines into the bucket of their day
+func flashToBBolt(v *LogItemStack) {
+	bboltLog.Lock()
+	defer bboltLog.Unlock()
+
+	// not by z, the error is logged again into the stack otherwise
+	db, err := openBBoltLog()
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, d := range v.buf {
+			var i LogItem
+			if err := json.Unmarshal(d, &i); err != nil {
+				log.Print(err.Error())
+				continue
+			}
+			t, err := time.Parse(zLoggerTimeLayout, i.CreateTime)
+			if err != nil {
+				t = time.Now()
+			}
+
+			b, err := tx.CreateBucketIfNotExists([]byte(t.Format(bboltLogDayLayout)))
+			if err != nil {
+				return err
+			}
+			bboltLog.seq++
+			if err = b.Put(bboltLogKey(t, bboltLog.seq), d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+
+	pruneBBoltLog(db)
+}
+
+//pruneBBoltLog delete the buckets older than zLogger.bblot.retentionDays, once a day
+func pruneBBoltLog(db *bolt.DB) {
+	today := time.Now().Format(bboltLogDayLayout)
+	if bboltLog.prunedDay == today {
+		return
+	}
+
+	oldest := time.Now().AddDate(0, 0, -bboltLogRetention()+1).Format(bboltLogDayLayout)
+	err := db.Update(func(tx *bolt.Tx) error {
+		var expired [][]byte
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			// the day layout is sortable as string
+			if string(name) < oldest {
+				expired = append(expired, append([]byte(nil), name...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range expired {
+			if err = tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+	bboltLog.prunedDay = today
+}
+
+//QueryBBoltLog query the log items from the bbolt log store in time order
+func QueryBBoltLog(c LogQuery) (items []LogItem, err error) {
+	if !isBBoltEnabled {
+		err = fmt.Errorf("bbolt log store is disabled, set zLogger.bblot.enable to enable it")
+		z.Error(err.Error())
+		return
+	}
+	if err = c.prepare(false); err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	bboltLog.Lock()
+	db, err := openBBoltLog()
+	bboltLog.Unlock()
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	beginDay := c.Begin.Format(bboltLogDayLayout)
+	endDay := c.End.Format(bboltLogDayLayout)
+	beginKey := bboltLogKey(c.Begin, 0)
+	endKey := bboltLogKey(c.End, 0)
+	skipped := 0
+	err = db.View(func(tx *bolt.Tx) error {
+		tc := tx.Cursor()
+		name, _ := tc.Seek([]byte(beginDay))
+		for ; name != nil && string(name) <= endDay; name, _ = tc.Next() {
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+
+			bc := b.Cursor()
+			for k, v := bc.Seek(beginKey); k != nil && string(k) < string(endKey); k, v = bc.Next() {
+				var i LogItem
+				if err := json.Unmarshal(v, &i); err != nil {
+					continue
+				}
+				if !c.match(&i) {
+					continue
+				}
+				if skipped < c.Offset {
+					skipped++
+					continue
+				}
+				i.Original = string(v)
+				items = append(items, i)
+				if len(items) >= c.Limit {
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
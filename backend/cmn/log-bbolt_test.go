@@ -0,0 +1,158 @@
+package cmn
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTestBBoltLog enable the bbolt log store in a temporary directory until the test finished
+func openTestBBoltLog(t *testing.T, retentionDays int) {
+	closeBBoltLog()
+	enabled := isBBoltEnabled
+	isBBoltEnabled = true
+	viper.Set("zLogger.bblot.file", filepath.Join(t.TempDir(), "log.db"))
+	viper.Set("zLogger.bblot.retentionDays", retentionDays)
+	bboltLog.prunedDay = ""
+	bboltLog.openFailed = time.Time{}
+
+	t.Cleanup(func() {
+		closeBBoltLog()
+		isBBoltEnabled = enabled
+		viper.Set("zLogger.bblot.file", "")
+		viper.Set("zLogger.bblot.retentionDays", defaultBBoltLogRetention)
+		bboltLog.prunedDay = ""
+	})
+}
+
+// flashBBoltItems write the log items into the bbolt log store
+func flashBBoltItems(t *testing.T, items ...LogItem) {
+	v := &LogItemStack{}
+	for _, i := range items {
+		buf, err := json.Marshal(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.buf = append(v.buf, buf)
+	}
+	flashToBBolt(v)
+}
+
+// bboltLogBuckets the day buckets of the bbolt log store and their item count
+func bboltLogBuckets(t *testing.T) map[string]int {
+	buckets := make(map[string]int)
+	bboltLog.Lock()
+	defer bboltLog.Unlock()
+	err := bboltLog.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets[string(name)] = b.Stats().KeyN
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buckets
+}
+
+func logItemAt(t time.Time, level, msg string) LogItem {
+	return LogItem{CreateTime: t.Format(zLoggerTimeLayout), Level: level, Caller: "cmn/dml.go:1", Message: msg}
+}
+
+func TestBBoltLogKey(t *testing.T) {
+	now := time.Now()
+	keys := [][]byte{
+		bboltLogKey(now.Add(-time.Hour), 9),
+		bboltLogKey(now, 1),
+		bboltLogKey(now, 2),
+		bboltLogKey(now.Add(time.Nanosecond), 0),
+	}
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			t.Fatalf("key %d isn't after key %d", i, i-1)
+		}
+	}
+}
+
+// TestBBoltLogRetention the items are written into the buckets of their days, the expired days are dropped
+func TestBBoltLogRetention(t *testing.T) {
+	openTestBBoltLog(t, 3)
+
+	now := time.Now()
+	day := func(n int) string { return now.AddDate(0, 0, n).Format(bboltLogDayLayout) }
+	flashBBoltItems(t,
+		logItemAt(now, "info", "today"),
+		logItemAt(now, "warn", "today again"),
+		logItemAt(now.AddDate(0, 0, -2), "info", "2 days ago"),
+		logItemAt(now.AddDate(0, 0, -3), "info", "3 days ago"),
+		logItemAt(now.AddDate(0, 0, -10), "info", "10 days ago"))
+
+	want := map[string]int{day(0): 2, day(-2): 1}
+	if got := bboltLogBuckets(t); !reflect.DeepEqual(got, want) {
+		t.Fatalf("buckets %v, want %v", got, want)
+	}
+
+	// pruned once a day
+	flashBBoltItems(t, logItemAt(now.AddDate(0, 0, -5), "info", "5 days ago"))
+	want[day(-5)] = 1
+	if got := bboltLogBuckets(t); !reflect.DeepEqual(got, want) {
+		t.Fatalf("buckets %v, want %v", got, want)
+	}
+}
+
+func TestQueryBBoltLog(t *testing.T) {
+	openTestBBoltLog(t, 7)
+
+	now := time.Now().Truncate(time.Millisecond)
+	yesterday := now.AddDate(0, 0, -1)
+	flashBBoltItems(t,
+		logItemAt(now.Add(-time.Minute), "error", "c"),
+		logItemAt(yesterday, "info", "a"),
+		logItemAt(now.Add(-2*time.Minute), "info", "b"),
+		logItemAt(now, "warn", "d"),
+		LogItem{CreateTime: now.Add(-3 * time.Minute).Format(zLoggerTimeLayout), Level: "info", Message: "e", RequestID: "req-1"})
+
+	messages := func(c LogQuery) string {
+		items, err := QueryBBoltLog(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s string
+		for _, i := range items {
+			s += i.Message
+			if i.Original == "" {
+				t.Fatalf("%s without the original line", i.Message)
+			}
+		}
+		return s
+	}
+
+	for _, c := range []struct {
+		name string
+		c    LogQuery
+		want string
+	}{
+		{"across days", LogQuery{Begin: yesterday.Add(-time.Hour)}, "aebcd"},
+		{"today", LogQuery{Begin: now.Add(-time.Hour)}, "ebcd"},
+		{"end exclusive", LogQuery{Begin: yesterday, End: now.Add(-time.Minute)}, "aeb"},
+		{"level", LogQuery{Begin: yesterday, Level: "warn"}, "cd"},
+		{"request id", LogQuery{Begin: yesterday, RequestID: "req-1"}, "e"},
+		{"offset and limit", LogQuery{Begin: yesterday, Offset: 1, Limit: 2}, "eb"},
+		{"before all", LogQuery{Begin: yesterday.AddDate(0, 0, -3), End: yesterday.AddDate(0, 0, -2)}, ""},
+	} {
+		if got := messages(c.c); got != c.want {
+			t.Fatalf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	isBBoltEnabled = false
+	if _, err := QueryBBoltLog(LogQuery{Begin: yesterday}); err == nil {
+		t.Fatal("query the disabled bbolt log store should fail")
+	}
+}
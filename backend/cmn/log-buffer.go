@@ -0,0 +1,457 @@
+package cmn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+/*bounded buffer of DbLoggerAdaptor
+
+	日志行写入有界环形缓冲, 由独立的 goroutine 定时(或缓冲超过一半时)成批写入 postgresql/bbolt,
+	日志调用不再等待数据库:
+		zLogger.buffer.size:         缓冲的日志条数, 缺省 20000
+		zLogger.buffer.policy:       缓冲满时 dropOldest(缺省): 丢弃最早的; block: 等待 blockTimeout 毫秒(缺省 1000)后丢弃最早的
+		zLogger.buffer.interval:     写入间隔毫秒, 缺省 15000
+		zLogger.buffer.retries:      写入 postgresql 失败后的重试次数, 间隔 1s, 2s, 4s..., 缺省 3
+		zLogger.buffer.spillFile:    重试仍失败时写入的文件, 缺省为日志目录下的 log-spill.json;
+		                             之后按 1s, 2s... 至多 1min 的间隔探测, 恢复后重放该文件
+		zLogger.buffer.spillMaxSize: 该文件的最大 MB, 超过后丢弃, 缺省 100
+
+	写入 goroutine 不使用 z, 否则 block 时与日志调用相互等待; LogBufferStats 返回各计数 */
+
+// defaults of zLogger.buffer
+const (
+	defaultLogBufferSize   = 20000
+	defaultLogBlockTimeout = 1000  // millisecond
+	defaultLogSyncInterval = 15000 // millisecond
+	defaultLogRetries      = 3
+	defaultLogSpillFile    = "log-spill.json"
+	defaultLogSpillMaxSize = 100 // MB
+
+	logPolicyDropOldest = "dropOldest"
+	logPolicyBlock      = "block"
+
+	logRetryBackoff    = time.Second
+	logMaxProbeBackoff = time.Minute
+
+	//logSyncWait Sync waits for the flush at most
+	logSyncWait = 10 * time.Second
+)
+
+//LogBufferStat counters of the buffer of DbLoggerAdaptor
+type LogBufferStat struct {
+	//Buffered log items in the buffer
+	Buffered int64 `json:"buffered"`
+
+	//Dropped log items dropped as the buffer or spill file is full
+	Dropped int64 `json:"dropped"`
+
+	//Blocked log calls waited for the buffer by block policy
+	Blocked int64 `json:"blocked"`
+
+	//Delayed log items written to postgresql after retried or replayed
+	Delayed int64 `json:"delayed"`
+
+	//Spilled log items written to the spill file
+	Spilled int64 `json:"spilled"`
+
+	//FlushFailures failed writes to postgresql
+	FlushFailures int64 `json:"flushFailures"`
+}
+
+var logBufferStat LogBufferStat
+
+//LogBufferStats return the counters of the buffer of DbLoggerAdaptor
+func LogBufferStats() (stat LogBufferStat) {
+	stat.Buffered = atomic.LoadInt64(&logBufferStat.Buffered)
+	stat.Dropped = atomic.LoadInt64(&logBufferStat.Dropped)
+	stat.Blocked = atomic.LoadInt64(&logBufferStat.Blocked)
+	stat.Delayed = atomic.LoadInt64(&logBufferStat.Delayed)
+	stat.Spilled = atomic.LoadInt64(&logBufferStat.Spilled)
+	stat.FlushFailures = atomic.LoadInt64(&logBufferStat.FlushFailures)
+	return
+}
+
+//logBuffer ring buffer of the log lines, flushed by run
+type logBuffer struct {
+	sync.Mutex
+	notFull *sync.Cond
+
+	items      [][]byte
+	head, n    int
+	blockWait  time.Duration // 0 for dropOldest
+	interval   time.Duration
+	retries    int
+	spillFile  string
+	spillLimit int64
+
+	//kick flush before interval, flushReq flush and close the chan when done,
+	//stopReq flush and close the chan then run returns
+	kick     chan struct{}
+	flushReq chan chan struct{}
+	stopReq  chan chan struct{}
+	stopped  bool // the items pushed after stopped are dropped
+
+	//owned by run
+	dbDown    bool
+	probeWait time.Duration
+	nextProbe time.Time
+}
+
+//newLogBuffer the buffer with the settings of zLogger.buffer, the flush goroutine started
+func newLogBuffer() *logBuffer {
+	size := viperIntOr("zLogger.buffer.size", defaultLogBufferSize)
+	if size <= 0 {
+		size = defaultLogBufferSize
+	}
+
+	b := &logBuffer{
+		items:      make([][]byte, size),
+		interval:   time.Duration(viperIntOr("zLogger.buffer.interval", defaultLogSyncInterval)) * time.Millisecond,
+		retries:    viperIntOr("zLogger.buffer.retries", defaultLogRetries),
+		spillFile:  viper.GetString("zLogger.buffer.spillFile"),
+		spillLimit: int64(viperIntOr("zLogger.buffer.spillMaxSize", defaultLogSpillMaxSize)) * 1024 * 1024,
+		kick:       make(chan struct{}, 1),
+		flushReq:   make(chan chan struct{}),
+		stopReq:    make(chan chan struct{}),
+	}
+	b.notFull = sync.NewCond(&b.Mutex)
+	if b.interval <= 0 {
+		b.interval = defaultLogSyncInterval * time.Millisecond
+	}
+	if b.spillFile == "" {
+		b.spillFile = filepath.Join(filepath.Dir(dstLogFile), defaultLogSpillFile)
+	}
+
+	switch policy := viper.GetString("zLogger.buffer.policy"); policy {
+	case "", logPolicyDropOldest:
+	case logPolicyBlock:
+		b.blockWait = time.Duration(viperIntOr("zLogger.buffer.blockTimeout", defaultLogBlockTimeout)) * time.Millisecond
+	default:
+		log.Printf("unknown zLogger.buffer.policy %s, %s is used", policy, logPolicyDropOldest)
+	}
+
+	go b.run()
+	return b
+}
+
+//push d into the buffer, the oldest is dropped if it's full
+func (b *logBuffer) push(d []byte) {
+	data := make([]byte, len(d))
+	copy(data, d)
+
+	b.Lock()
+	defer b.Unlock()
+	if b.stopped {
+		return
+	}
+
+	size := len(b.items)
+	if b.n == size && b.blockWait > 0 {
+		atomic.AddInt64(&logBufferStat.Blocked, 1)
+		deadline := time.Now().Add(b.blockWait)
+		t := time.AfterFunc(b.blockWait, func() {
+			b.Lock()
+			b.notFull.Broadcast()
+			b.Unlock()
+		})
+		for b.n == size && time.Now().Before(deadline) {
+			b.notFull.Wait()
+		}
+		t.Stop()
+	}
+
+	if b.n == size {
+		b.items[b.head] = nil
+		b.head = (b.head + 1) % size
+		b.n--
+		atomic.AddInt64(&logBufferStat.Dropped, 1)
+	}
+	b.items[(b.head+b.n)%size] = data
+	b.n++
+	atomic.StoreInt64(&logBufferStat.Buffered, int64(b.n))
+
+	if b.n >= size/2 {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//take the oldest max items out of the buffer
+func (b *logBuffer) take(max int) (items [][]byte) {
+	b.Lock()
+	defer b.Unlock()
+
+	size := len(b.items)
+	for ; b.n > 0 && len(items) < max; b.n-- {
+		items = append(items, b.items[b.head])
+		b.items[b.head] = nil
+		b.head = (b.head + 1) % size
+	}
+	atomic.StoreInt64(&logBufferStat.Buffered, int64(b.n))
+	b.notFull.Broadcast()
+	return
+}
+
+//flush the buffer and wait for it done, at most logSyncWait
+func (b *logBuffer) flush() {
+	done := make(chan struct{})
+	select {
+	case b.flushReq <- done:
+	case <-time.After(logSyncWait):
+		log.Print("log buffer is busy, flush skipped")
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(logSyncWait):
+		log.Print("log buffer flush timeout")
+	}
+}
+
+/*stop flush the buffer and end run, at most logSyncWait, the items pushed later are dropped.
+The sinks aren't used by the buffer after it returned true, then they can be closed */
+func (b *logBuffer) stop() (stopped bool) {
+	b.Lock()
+	b.stopped = true
+	b.notFull.Broadcast()
+	b.Unlock()
+
+	done := make(chan struct{})
+	select {
+	case b.stopReq <- done:
+	case <-time.After(logSyncWait):
+		log.Print("log buffer is busy, stop skipped")
+		return
+	}
+
+	select {
+	case <-done:
+		stopped = true
+	case <-time.After(logSyncWait):
+		log.Print("log buffer stop timeout")
+	}
+	return
+}
+
+func (b *logBuffer) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		var done chan struct{}
+		stopping := false
+		select {
+		case <-ticker.C:
+		case <-b.kick:
+		case done = <-b.flushReq:
+		case done = <-b.stopReq:
+			stopping = true
+		}
+
+		for {
+			items := b.take(len(b.items))
+			if len(items) == 0 {
+				break
+			}
+			b.flushBatch(&LogItemStack{buf: items}, done != nil)
+		}
+
+		if done != nil {
+			close(done)
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+//flushBatch write v to bbolt and postgresql, retry or spill on failure, force for no retry
+func (b *logBuffer) flushBatch(v *LogItemStack, force bool) {
+	if isBBoltEnabled {
+		flashToBBolt(v)
+	}
+	if !isPostgresqlEnabled {
+		return
+	}
+
+	if b.dbDown && !force && time.Now().Before(b.nextProbe) {
+		b.spill(v)
+		return
+	}
+
+	err := flashToPostgreSQL(v)
+	for i := 0; err != nil && !b.dbDown && !force && i < b.retries; i++ {
+		time.Sleep(logRetryBackoff << uint(i))
+		if err = flashToPostgreSQL(v); err == nil {
+			atomic.AddInt64(&logBufferStat.Delayed, int64(len(v.buf)))
+		}
+	}
+
+	if err == nil {
+		if b.dbDown {
+			log.Print("postgresql log sink recovered")
+			b.dbDown, b.probeWait = false, 0
+		}
+		b.replaySpill()
+		return
+	}
+
+	// down, probe later with backoff
+	b.spill(v)
+	switch {
+	case b.probeWait == 0:
+		b.probeWait = logRetryBackoff
+	case b.probeWait*2 > logMaxProbeBackoff:
+		b.probeWait = logMaxProbeBackoff
+	default:
+		b.probeWait *= 2
+	}
+	if !b.dbDown {
+		log.Print("postgresql log sink is unavailable, spill to " + b.spillFile)
+	}
+	b.dbDown, b.nextProbe = true, time.Now().Add(b.probeWait)
+}
+
+//spill append v to the spill file, dropped if it's beyond spillLimit
+func (b *logBuffer) spill(v *LogItemStack) {
+	n := int64(len(v.buf))
+	if fi, err := os.Stat(b.spillFile); err == nil && fi.Size() >= b.spillLimit {
+		atomic.AddInt64(&logBufferStat.Dropped, n)
+		return
+	}
+
+	f, err := os.OpenFile(b.spillFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		log.Print(err.Error())
+		atomic.AddInt64(&logBufferStat.Dropped, n)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	w := bufio.NewWriter(f)
+	for _, d := range v.buf {
+		_, _ = w.Write(bytes.TrimRight(d, "\r\n"))
+		_ = w.WriteByte('\n')
+	}
+	if err = w.Flush(); err != nil {
+		log.Print(err.Error())
+		atomic.AddInt64(&logBufferStat.Dropped, n)
+		return
+	}
+	atomic.AddInt64(&logBufferStat.Spilled, n)
+}
+
+//replaySpill write the spill file to postgresql, the lines not written are kept in it
+func (b *logBuffer) replaySpill() {
+	f, err := os.Open(b.spillFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Print(err.Error())
+		}
+		return
+	}
+
+	var (
+		offset int64 // the lines before are written
+		batch  [][]byte
+		size   int64
+	)
+	write := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := flashToPostgreSQL(&LogItemStack{buf: batch}); err != nil {
+			return err
+		}
+		atomic.AddInt64(&logBufferStat.Delayed, int64(len(batch)))
+		offset += size
+		batch, size = nil, 0
+		return nil
+	}
+
+	br := bufio.NewReader(f)
+	for {
+		line, e := br.ReadBytes('\n')
+		if len(line) > 0 {
+			size += int64(len(line))
+			if d := bytes.TrimRight(line, "\r\n"); len(d) > 0 {
+				batch = append(batch, d)
+			}
+		}
+		if len(batch) >= len(b.items) || (e != nil && len(batch) > 0) {
+			if err = write(); err != nil {
+				break
+			}
+		}
+		if e != nil {
+			if e != io.EOF {
+				err = e
+			}
+			break
+		}
+	}
+	_ = f.Close()
+
+	if err == nil {
+		if err = os.Remove(b.spillFile); err != nil {
+			log.Print(err.Error())
+		}
+		return
+	}
+
+	log.Print("replay " + b.spillFile + " failed by " + err.Error())
+	if offset > 0 {
+		if err = truncateHead(b.spillFile, offset); err != nil {
+			log.Print(err.Error())
+		}
+	}
+}
+
+//truncateHead remove the first n bytes of the file name
+func truncateHead(name string, n int64) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	if _, err = src.Seek(n, io.SeekStart); err != nil {
+		return
+	}
+
+	tmp := name + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(dst, src)
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+	_ = src.Close()
+	if err = os.Rename(tmp, name); err != nil {
+		err = fmt.Errorf("replace %s failed by %s", name, err.Error())
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package cmn
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestLogBuffer the buffer of size items spilling to a temporary file, the flush goroutine isn't started
+func newTestLogBuffer(t *testing.T, size int) *logBuffer {
+	b := &logBuffer{
+		items:      make([][]byte, size),
+		interval:   time.Hour,
+		spillFile:  filepath.Join(t.TempDir(), defaultLogSpillFile),
+		spillLimit: 1024 * 1024,
+		kick:       make(chan struct{}, 1),
+		flushReq:   make(chan chan struct{}),
+		stopReq:    make(chan chan struct{}),
+	}
+	b.notFull = sync.NewCond(&b.Mutex)
+	return b
+}
+
+// TestLogBufferStop the pending items are flushed by stop, the later ones are dropped
+func TestLogBufferStop(t *testing.T) {
+	saved := isPostgresqlEnabled
+	isPostgresqlEnabled = true
+	defer func() { isPostgresqlEnabled = saved }()
+
+	b := newTestLogBuffer(t, 8)
+	go b.run()
+
+	// postgresql isn't connected, the items are spilled
+	for _, s := range []string{`{"M":"a"}`, `{"M":"b"}`} {
+		b.push([]byte(s))
+	}
+	if !b.stop() {
+		t.Fatal("the log buffer should be stopped")
+	}
+
+	b.push([]byte(`{"M":"c"}`))
+	if b.n != 0 {
+		t.Fatalf("%d items buffered after stopped", b.n)
+	}
+
+	buf, err := os.ReadFile(b.spillFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"M\":\"a\"}\n{\"M\":\"b\"}\n"; !bytes.Equal(buf, []byte(want)) {
+		t.Fatalf("spilled %q, want %q", buf, want)
+	}
+}
+
+// itemsOf the items as strings
+func itemsOf(items [][]byte) (list []string) {
+	for _, v := range items {
+		list = append(list, string(v))
+	}
+	return
+}
+
+func TestLogBufferDropOldest(t *testing.T) {
+	b := newTestLogBuffer(t, 3)
+	dropped := atomic.LoadInt64(&logBufferStat.Dropped)
+
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		b.push([]byte(s))
+	}
+	if d := atomic.LoadInt64(&logBufferStat.Dropped) - dropped; d != 2 {
+		t.Fatalf("dropped %d, want 2", d)
+	}
+	if got := itemsOf(b.take(2)); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Fatalf("take = %v", got)
+	}
+
+	// wrap around the ring
+	b.push([]byte("f"))
+	b.push([]byte("g"))
+	if got := itemsOf(b.take(10)); !reflect.DeepEqual(got, []string{"e", "f", "g"}) {
+		t.Fatalf("take = %v", got)
+	}
+	if len(b.take(10)) != 0 {
+		t.Fatal("the buffer should be empty")
+	}
+
+	// the kick is sent once the buffer is half full
+	select {
+	case <-b.kick:
+	default:
+		t.Fatal("flush should be kicked")
+	}
+}
+
+// TestLogBufferBlock push waits for the room at most blockWait, then drops the oldest
+func TestLogBufferBlock(t *testing.T) {
+	b := newTestLogBuffer(t, 1)
+	b.blockWait = 20 * time.Millisecond
+
+	b.push([]byte("a"))
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		b.take(1)
+	}()
+	b.push([]byte("b"))
+	if got := itemsOf(b.take(1)); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("take = %v", got)
+	}
+
+	dropped := atomic.LoadInt64(&logBufferStat.Dropped)
+	b.push([]byte("c"))
+	start := time.Now()
+	b.push([]byte("d"))
+	if time.Since(start) < b.blockWait {
+		t.Fatal("push should wait for blockWait")
+	}
+	if d := atomic.LoadInt64(&logBufferStat.Dropped) - dropped; d != 1 {
+		t.Fatalf("dropped %d, want 1", d)
+	}
+	if got := itemsOf(b.take(1)); !reflect.DeepEqual(got, []string{"d"}) {
+		t.Fatalf("take = %v", got)
+	}
+}
+
+// TestLogBufferSpill the spill file is kept while postgresql is unavailable, and is limited to spillLimit
+func TestLogBufferSpill(t *testing.T) {
+	b := newTestLogBuffer(t, 8)
+	b.spill(&LogItemStack{buf: [][]byte{[]byte("{\"M\":\"a\"}\n"), []byte("{\"M\":\"b\"}")}})
+
+	// pgxConn is nil, the replay fails and nothing is removed
+	b.replaySpill()
+	buf, err := os.ReadFile(b.spillFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"M\":\"a\"}\n{\"M\":\"b\"}\n"; string(buf) != want {
+		t.Fatalf("spill file %q, want %q", buf, want)
+	}
+
+	b.spillLimit = int64(len(buf))
+	dropped := atomic.LoadInt64(&logBufferStat.Dropped)
+	b.spill(&LogItemStack{buf: [][]byte{[]byte("{\"M\":\"c\"}")}})
+	if d := atomic.LoadInt64(&logBufferStat.Dropped) - dropped; d != 1 {
+		t.Fatalf("dropped %d beyond spillLimit, want 1", d)
+	}
+}
+
+func TestTruncateHead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log-spill.json")
+	lines := "line1\nline2\nline3\n"
+	if err := os.WriteFile(name, []byte(lines), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := truncateHead(name, int64(strings.Index(lines, "line2"))); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "line2\nline3\n" {
+		t.Fatalf("truncated to %q", buf)
+	}
+	if _, err = os.Stat(name + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("the temporary file should be renamed")
+	}
+}
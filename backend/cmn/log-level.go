@@ -0,0 +1,299 @@
+package cmn
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*runtime log level
+
+	SetLogLevel:       全局级别, 启动时取 zLogger.zLogLevel
+	SetCallerLogLevel: caller 前缀(例如 cmn/insurance.go, cmn/)的级别, ttl 到期后自动失效,
+	                   匹配多个时取最长的前缀; 可以低于或高于全局级别
+	SetLogSampling:    每 tick 内级别及消息相同的日志, 前 first 条全部输出, 之后每 thereafter 条输出一条,
+	                   first 为 0 时不采样; 启动时取 zLogger.sampling.tick(毫秒)/first/thereafter, 缺省 1000/100/100
+	请求的日志:        RequestLogger(id, true) 抑制, 见 trace.go
+
+	zap 在 Check 之后才取得 caller, 因此日志级别的 Enabled 按全局级别及所有 caller 级别中最低的判断,
+	caller 级别在 callerLevelCore.Write 中过滤 */
+
+// defaults of zLogger.sampling
+const (
+	defaultSamplingTick       = 1000 // millisecond
+	defaultSamplingFirst      = 100
+	defaultSamplingThereafter = 100
+)
+
+//CallerLogLevel level of the log lines whose caller starts with Caller
+type CallerLogLevel struct {
+	Caller string        `json:"caller"`
+	Level  zapcore.Level `json:"level"`
+	Expire int64         `json:"expire"` // in millisecond
+}
+
+var logLevels struct {
+	sync.RWMutex
+	base    zapcore.Level
+	callers []CallerLogLevel // the longest caller first
+}
+
+//minLogLevel the lowest of the global level and the caller levels, checked on each log call
+var minLogLevel = int32(zapcore.InfoLevel)
+
+//callerLevelCount count of the caller levels, the caller isn't checked if it's zero
+var callerLevelCount int32
+
+//updateMinLogLevel with logLevels locked
+func updateMinLogLevel() {
+	l := logLevels.base
+	for _, v := range logLevels.callers {
+		if v.Level < l {
+			l = v.Level
+		}
+	}
+	atomic.StoreInt32(&minLogLevel, int32(l))
+	atomic.StoreInt32(&callerLevelCount, int32(len(logLevels.callers)))
+}
+
+//SetLogLevel set runtime log level
+func SetLogLevel(runtimeLevel int8) {
+	logLevels.Lock()
+	defer logLevels.Unlock()
+	logLevels.base = zapcore.Level(runtimeLevel)
+	updateMinLogLevel()
+}
+
+//GetLogLevel the global log level
+func GetLogLevel() zapcore.Level {
+	logLevels.RLock()
+	defer logLevels.RUnlock()
+	return logLevels.base
+}
+
+//SetCallerLogLevel set level of the log lines whose caller starts with caller for ttl
+func SetCallerLogLevel(caller string, level zapcore.Level, ttl time.Duration) (err error) {
+	caller = strings.TrimSpace(caller)
+	if caller == "" {
+		err = fmt.Errorf("caller should be like cmn/insurance.go or cmn/")
+		z.Error(err.Error())
+		return
+	}
+	if level < zapcore.DebugLevel || level > zapcore.FatalLevel {
+		err = fmt.Errorf("invalid level %d", level)
+		z.Error(err.Error())
+		return
+	}
+	if ttl <= 0 {
+		err = fmt.Errorf("ttl of caller log level should be positive")
+		z.Error(err.Error())
+		return
+	}
+
+	v := CallerLogLevel{Caller: caller, Level: level, Expire: GetNowInMS() + ttl.Milliseconds()}
+	logLevels.Lock()
+	callers := []CallerLogLevel{v}
+	for _, c := range logLevels.callers {
+		if c.Caller != caller {
+			callers = append(callers, c)
+		}
+	}
+	sort.SliceStable(callers, func(i, j int) bool {
+		return len(callers[i].Caller) > len(callers[j].Caller)
+	})
+	logLevels.callers = callers
+	updateMinLogLevel()
+	logLevels.Unlock()
+
+	time.AfterFunc(ttl, expireCallerLogLevels)
+	z.Warn(fmt.Sprintf("log level of %s set to %s for %s", caller, level, ttl))
+	return
+}
+
+//RemoveCallerLogLevel remove the level of caller set by SetCallerLogLevel
+func RemoveCallerLogLevel(caller string) (removed bool) {
+	logLevels.Lock()
+	var callers []CallerLogLevel
+	for _, c := range logLevels.callers {
+		if c.Caller == caller {
+			removed = true
+			continue
+		}
+		callers = append(callers, c)
+	}
+	logLevels.callers = callers
+	updateMinLogLevel()
+	logLevels.Unlock()
+	return
+}
+
+//CallerLogLevels the caller levels not expired, the longest caller first
+func CallerLogLevels() (list []CallerLogLevel) {
+	logLevels.RLock()
+	defer logLevels.RUnlock()
+	return append(list, logLevels.callers...)
+}
+
+func expireCallerLogLevels() {
+	now := GetNowInMS()
+
+	logLevels.Lock()
+	var callers, expired []CallerLogLevel
+	for _, c := range logLevels.callers {
+		if c.Expire > now {
+			callers = append(callers, c)
+			continue
+		}
+		expired = append(expired, c)
+	}
+	logLevels.callers = callers
+	updateMinLogLevel()
+	logLevels.Unlock()
+
+	for _, c := range expired {
+		z.Warn(fmt.Sprintf("log level %s of %s expired", c.Level, c.Caller))
+	}
+}
+
+//callerLevelEnabled whether e is enabled by the level of its caller, or the global level
+func callerLevelEnabled(e zapcore.Entry) bool {
+	if atomic.LoadInt32(&callerLevelCount) == 0 {
+		return true
+	}
+
+	caller := e.Caller.TrimmedPath()
+	logLevels.RLock()
+	defer logLevels.RUnlock()
+	for _, v := range logLevels.callers {
+		if strings.HasPrefix(caller, v.Caller) {
+			return e.Level >= v.Level
+		}
+	}
+	return e.Level >= logLevels.base
+}
+
+//callerLevelCore drop the log lines disabled by the level of their caller
+type callerLevelCore struct {
+	zapcore.Core
+}
+
+func (c *callerLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &callerLevelCore{c.Core.With(fields)}
+}
+
+func (c *callerLevelCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *callerLevelCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	// the caller is known since now
+	if !callerLevelEnabled(e) {
+		return nil
+	}
+	return c.Core.Write(e, fields)
+}
+
+//---------------------------------------------------------------------------------
+// sampling
+
+//LogSampling settings of the log sampler
+type LogSampling struct {
+	Tick       int64 `json:"tick" schema:"minimum=1"` // in millisecond
+	First      int   `json:"first" schema:"minimum=0"`
+	Thereafter int   `json:"thereafter" schema:"minimum=0"`
+}
+
+var logSampling struct {
+	sync.Mutex
+	LogSampling
+	base zapcore.Core
+
+	//core the sampler of base, or base if not sampled
+	core atomic.Value
+}
+
+//samplingCore delegate to the sampler replaced by SetLogSampling,
+//  the cores derived by With keep the sampler at that time
+type samplingCore struct {
+	zapcore.Core
+}
+
+type sampledCore struct {
+	zapcore.Core
+}
+
+func (c *samplingCore) current() zapcore.Core {
+	return logSampling.core.Load().(sampledCore).Core
+}
+
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	return c.current().With(fields)
+}
+
+func (c *samplingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.current().Check(e, ce)
+}
+
+//newSamplingCore wrap core with the sampler of zLogger.sampling
+func newSamplingCore(core zapcore.Core) zapcore.Core {
+	s := LogSampling{
+		Tick:       int64(viperIntOr("zLogger.sampling.tick", defaultSamplingTick)),
+		First:      viperIntOr("zLogger.sampling.first", defaultSamplingFirst),
+		Thereafter: viperIntOr("zLogger.sampling.thereafter", defaultSamplingThereafter),
+	}
+
+	logSampling.Lock()
+	logSampling.base = core
+	logSampling.Unlock()
+
+	if err := SetLogSampling(s); err != nil {
+		log.Print(err.Error())
+		_ = SetLogSampling(LogSampling{
+			Tick:       defaultSamplingTick,
+			First:      defaultSamplingFirst,
+			Thereafter: defaultSamplingThereafter,
+		})
+	}
+	return &samplingCore{core}
+}
+
+//SetLogSampling replace the log sampler, s.First 0 for no sampling
+func SetLogSampling(s LogSampling) (err error) {
+	if s.First < 0 || s.Thereafter < 0 || (s.First > 0 && s.Tick <= 0) {
+		err = fmt.Errorf("invalid log sampling, tick: %d, first: %d, thereafter: %d",
+			s.Tick, s.First, s.Thereafter)
+		return
+	}
+
+	logSampling.Lock()
+	defer logSampling.Unlock()
+	if logSampling.base == nil {
+		err = fmt.Errorf("logger isn't initialized")
+		return
+	}
+
+	core := logSampling.base
+	if s.First > 0 {
+		core = zapcore.NewSamplerWithOptions(core,
+			time.Duration(s.Tick)*time.Millisecond, s.First, s.Thereafter)
+	}
+	logSampling.core.Store(sampledCore{core})
+	logSampling.LogSampling = s
+	return
+}
+
+//GetLogSampling the settings of the log sampler
+func GetLogSampling() LogSampling {
+	logSampling.Lock()
+	defer logSampling.Unlock()
+	return logSampling.LogSampling
+}
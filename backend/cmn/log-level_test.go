@@ -0,0 +1,172 @@
+package cmn
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// keepLogLevels restore the global and caller levels after the test
+func keepLogLevels(t *testing.T) {
+	logLevels.Lock()
+	base, callers := logLevels.base, logLevels.callers
+	logLevels.Unlock()
+	t.Cleanup(func() {
+		logLevels.Lock()
+		logLevels.base, logLevels.callers = base, callers
+		updateMinLogLevel()
+		logLevels.Unlock()
+	})
+}
+
+func entryOf(caller string, level zapcore.Level) zapcore.Entry {
+	return zapcore.Entry{Level: level, Caller: zapcore.EntryCaller{Defined: true, File: "/src/w2w.io/" + caller, Line: 1}}
+}
+
+func TestCallerLogLevel(t *testing.T) {
+	keepLogLevels(t)
+	SetLogLevel(int8(zapcore.InfoLevel))
+
+	if err := SetCallerLogLevel(" ", zapcore.DebugLevel, time.Hour); err == nil {
+		t.Fatal("empty caller should be refused")
+	}
+	if err := SetCallerLogLevel("cmn/", zapcore.Level(9), time.Hour); err == nil {
+		t.Fatal("invalid level should be refused")
+	}
+	if err := SetCallerLogLevel("cmn/", zapcore.DebugLevel, 0); err == nil {
+		t.Fatal("zero ttl should be refused")
+	}
+
+	if err := SetCallerLogLevel("cmn/", zapcore.ErrorLevel, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCallerLogLevel("cmn/dml.go", zapcore.DebugLevel, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if list := CallerLogLevels(); len(list) != 2 || list[0].Caller != "cmn/dml.go" {
+		t.Fatalf("the longest caller should be the first: %v", list)
+	}
+	if l := zapcore.Level(atomic.LoadInt32(&minLogLevel)); l != zapcore.DebugLevel {
+		t.Fatalf("min level %s, want debug", l)
+	}
+
+	for _, c := range []struct {
+		caller  string
+		level   zapcore.Level
+		enabled bool
+	}{
+		{"cmn/dml.go", zapcore.DebugLevel, true},
+		{"cmn/file.go", zapcore.WarnLevel, false},
+		{"cmn/file.go", zapcore.ErrorLevel, true},
+		{"service/web-serve.go", zapcore.DebugLevel, false},
+		{"service/web-serve.go", zapcore.InfoLevel, true},
+	} {
+		if got := callerLevelEnabled(entryOf(c.caller, c.level)); got != c.enabled {
+			t.Fatalf("%s of %s enabled %v, want %v", c.level, c.caller, got, c.enabled)
+		}
+	}
+
+	// the level of cmn/dml.go expires, cmn/ is applied to it then
+	deadline := time.Now().Add(2 * time.Second)
+	for len(CallerLogLevels()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("caller level isn't expired: %v", CallerLogLevels())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if callerLevelEnabled(entryOf("cmn/dml.go", zapcore.InfoLevel)) {
+		t.Fatal("info of cmn/dml.go should be disabled by cmn/ after expired")
+	}
+	if l := zapcore.Level(atomic.LoadInt32(&minLogLevel)); l != zapcore.InfoLevel {
+		t.Fatalf("min level %s, want info after expired", l)
+	}
+
+	if !RemoveCallerLogLevel("cmn/") || RemoveCallerLogLevel("cmn/") {
+		t.Fatal("cmn/ should be removed once")
+	}
+	if atomic.LoadInt32(&callerLevelCount) != 0 {
+		t.Fatal("caller level count should be zero")
+	}
+}
+
+// TestCallerLevelCore the log lines are filtered by the level of the caller
+func TestCallerLevelCore(t *testing.T) {
+	keepLogLevels(t)
+	SetLogLevel(int8(zapcore.InfoLevel))
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := zap.New(&callerLevelCore{core}, zap.AddCaller())
+
+	if err := SetCallerLogLevel("cmn/log-level_test.go", zapcore.ErrorLevel, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	l.Warn("dropped")
+	l.Error("kept")
+	if logs.Len() != 1 || logs.All()[0].Message != "kept" {
+		t.Fatalf("logged %v", logs.All())
+	}
+}
+
+// keepLogSampling restore the log sampler after the test, base is sampled by the test
+func keepLogSampling(t *testing.T, base zapcore.Core) {
+	logSampling.Lock()
+	saved, savedBase, savedCore := logSampling.LogSampling, logSampling.base, logSampling.core.Load()
+	logSampling.base = base
+	logSampling.Unlock()
+	t.Cleanup(func() {
+		logSampling.Lock()
+		logSampling.LogSampling, logSampling.base = saved, savedBase
+		if savedCore != nil {
+			logSampling.core.Store(savedCore)
+		}
+		logSampling.Unlock()
+	})
+}
+
+func TestLogSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	keepLogSampling(t, core)
+
+	for _, s := range []LogSampling{{Tick: 1000, First: -1}, {Tick: 1000, First: 1, Thereafter: -1}, {Tick: 0, First: 1}} {
+		if err := SetLogSampling(s); err == nil {
+			t.Fatalf("%+v should be refused", s)
+		}
+	}
+
+	if err := SetLogSampling(LogSampling{Tick: 60000, First: 2, Thereafter: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if s := GetLogSampling(); s.First != 2 || s.Thereafter != 3 {
+		t.Fatalf("sampling %+v", s)
+	}
+
+	l := zap.New(&samplingCore{core})
+	derived := l.With(zap.String("k", "v"))
+	repeat := func(l *zap.Logger, msg string) int {
+		n := logs.Len()
+		for i := 0; i < 10; i++ {
+			l.Info(msg)
+		}
+		return logs.Len() - n
+	}
+
+	// the first 2, then every third: 2, 5, 8
+	if n := repeat(l, "sampled"); n != 4 {
+		t.Fatalf("%d lines logged, want 4", n)
+	}
+
+	// the sampler is replaced for the logger, the derived one keeps the old sampler
+	if err := SetLogSampling(LogSampling{Tick: 60000}); err != nil {
+		t.Fatal(err)
+	}
+	if n := repeat(l, "unsampled"); n != 10 {
+		t.Fatalf("%d lines logged without sampling, want 10", n)
+	}
+	if n := repeat(derived, "derived"); n != 4 {
+		t.Fatalf("%d lines logged by the derived logger, want 4", n)
+	}
+}
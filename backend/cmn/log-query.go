@@ -0,0 +1,420 @@
+package cmn
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*log query
+
+	QueryFileLog:  日志文件及其轮转后的文件(含 .gz)
+	QueryDBLog:    t_log(flashToPostgreSQL 写入)
+	QueryBBoltLog: bbolt log sink
+	TailLog:       订阅之后写入日志文件的日志, 订阅者处理不及时则丢弃 */
+
+//LogQuery condition of the log queries, the zero value field isn't used
+type LogQuery struct {
+	//Begin, End time range of the log items, End is exclusive and default now
+	Begin time.Time `json:"begin"`
+	End   time.Time `json:"end"`
+
+	//Level minimum level, e.g. warn for warn/error/dpanic/panic/fatal
+	Level string `json:"level"`
+
+	//Caller part of the caller, e.g. cmn/insurance.go or cmn/insurance.go:1766
+	Caller string `json:"caller"`
+
+	//Message part of the message, case insensitive
+	Message string `json:"message"`
+
+	//RequestID the request id(X-Request-ID) of the log items
+	RequestID string `json:"requestID"`
+
+	//Offset the matched items skipped, Limit the items returned at most, default 1000
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+
+	minLevel *zapcore.Level
+}
+
+//defaultLogQueryLimit default of LogQuery.Limit
+const defaultLogQueryLimit = 1000
+
+//prepare check the condition and fill the defaults
+func (c *LogQuery) prepare(tail bool) (err error) {
+	if c.Level != "" {
+		var l zapcore.Level
+		if err = l.UnmarshalText([]byte(c.Level)); err != nil {
+			return
+		}
+		c.minLevel = &l
+	}
+	c.Message = strings.ToLower(c.Message)
+	if tail {
+		return
+	}
+
+	if c.Limit <= 0 {
+		c.Limit = defaultLogQueryLimit
+	}
+	if c.Offset < 0 {
+		c.Offset = 0
+	}
+	if c.End.IsZero() {
+		c.End = time.Now().Add(time.Second)
+	}
+	if !c.Begin.Before(c.End) {
+		err = fmt.Errorf("begin should be before end")
+	}
+	return
+}
+
+//match whether item i conforms to the condition except the time range
+func (c *LogQuery) match(i *LogItem) bool {
+	if c.minLevel != nil {
+		var l zapcore.Level
+		if err := l.UnmarshalText([]byte(i.Level)); err != nil || l < *c.minLevel {
+			return false
+		}
+	}
+	if c.Caller != "" && !strings.Contains(i.Caller, c.Caller) {
+		return false
+	}
+	if c.Message != "" && !strings.Contains(strings.ToLower(i.Message), c.Message) {
+		return false
+	}
+	if c.RequestID != "" && i.RequestID != c.RequestID {
+		return false
+	}
+	return true
+}
+
+//levelsFrom the levels not less than l, as t_log.grade
+func levelsFrom(l zapcore.Level) (levels []string) {
+	for ; l <= zapcore.FatalLevel; l++ {
+		levels = append(levels, l.String())
+	}
+	return
+}
+
+//------------------------------------------------------------------------------
+// log file
+
+//logFileSpan log file and the time range its items in
+type logFileSpan struct {
+	name  string
+	begin time.Time // exclusive, zero for unknown
+	end   time.Time // inclusive, zero for the file being written
+}
+
+//logFilesIn the log files may have items in [begin, end), the earliest first
+func logFilesIn(begin, end time.Time) (files []logFileSpan, err error) {
+	if zLogFile == nil {
+		err = fmt.Errorf("log file isn't opened")
+		return
+	}
+
+	list, err := zLogFile.listBackups()
+	if err != nil {
+		return
+	}
+
+	// listBackups is the latest first, the backup rotated at t has the items before t
+	var prev time.Time
+	for i := len(list) - 1; i >= 0; i-- {
+		v := list[i]
+		if !v.t.Before(begin) && prev.Before(end) {
+			files = append(files, logFileSpan{name: v.name, begin: prev, end: v.t})
+		}
+		prev = v.t
+	}
+	if prev.Before(end) {
+		files = append(files, logFileSpan{name: zLogFile.name, begin: prev})
+	}
+	return
+}
+
+//scanLogFile call fn on each line of the log file name till fn return false
+func scanLogFile(name string, fn func(line []byte) bool) (err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(f)
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		r = gz
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, e := br.ReadBytes('\n')
+		// the last line may be partially written, it's dropped by json.Unmarshal
+		if len(line) > 0 && !fn(line) {
+			return
+		}
+		if e == io.EOF {
+			return
+		}
+		if e != nil {
+			err = e
+			return
+		}
+	}
+}
+
+//QueryFileLog query the log items from the log file and its backups in time order
+func QueryFileLog(c LogQuery) (items []LogItem, err error) {
+	if err = c.prepare(false); err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	files, err := logFilesIn(c.Begin, c.End)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	skipped := 0
+	for _, f := range files {
+		done := false
+		err = scanLogFile(f.name, func(line []byte) bool {
+			var i LogItem
+			if json.Unmarshal(line, &i) != nil {
+				return true
+			}
+			t, e := time.Parse(zLoggerTimeLayout, i.CreateTime)
+			if e != nil || t.Before(c.Begin) {
+				return true
+			}
+			if !t.Before(c.End) {
+				done = true
+				return false
+			}
+			if !c.match(&i) {
+				return true
+			}
+			if skipped < c.Offset {
+				skipped++
+				return true
+			}
+
+			i.Original = string(bytes.TrimRight(line, "\r\n"))
+			items = append(items, i)
+			done = len(items) >= c.Limit
+			return !done
+		})
+		if err != nil {
+			// the backup may be removed by cleanupBackups meanwhile
+			if os.IsNotExist(err) {
+				err = nil
+				continue
+			}
+			z.Error(err.Error())
+			return
+		}
+		if done {
+			break
+		}
+	}
+	return
+}
+
+//------------------------------------------------------------------------------
+// t_log
+
+//QueryDBLog query the log items from t_log in time order
+func QueryDBLog(ctx context.Context, c LogQuery) (items []LogItem, err error) {
+	if err = c.prepare(false); err != nil {
+		z.Error(err.Error())
+		return
+	}
+	if pgxConn == nil {
+		err = fmt.Errorf("postgresql isn't connected")
+		z.Error(err.Error())
+		return
+	}
+
+	withRequestID, err := hasLogRequestID(ctx)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	if !withRequestID && c.RequestID != "" {
+		err = fmt.Errorf("t_log.request_id doesn't exist, can't query t_log by request id")
+		z.Error(err.Error())
+		return
+	}
+
+	requestIDColumn := "''"
+	if withRequestID {
+		requestIDColumn = "coalesce(request_id,'')"
+	}
+	s := `select coalesce(grade,''), coalesce(msg,''), coalesce(caller,''), coalesce(stacktrace,''), create_time,
+		` + requestIDColumn + ` from t_log where create_time >= $1 and create_time < $2`
+	args := []interface{}{c.Begin.UnixNano() / 1e6, c.End.UnixNano() / 1e6}
+	if c.minLevel != nil {
+		args = append(args, levelsFrom(*c.minLevel))
+		s = s + fmt.Sprintf(" and grade = any($%d)", len(args))
+	}
+	if c.Caller != "" {
+		args = append(args, c.Caller)
+		s = s + fmt.Sprintf(" and strpos(caller, $%d) > 0", len(args))
+	}
+	if c.Message != "" {
+		args = append(args, c.Message)
+		s = s + fmt.Sprintf(" and strpos(lower(msg), $%d) > 0", len(args))
+	}
+	if c.RequestID != "" {
+		args = append(args, c.RequestID)
+		s = s + fmt.Sprintf(" and request_id = $%d", len(args))
+	}
+	args = append(args, c.Limit, c.Offset)
+	s = s + fmt.Sprintf(" order by create_time, id limit $%d offset $%d", len(args)-1, len(args))
+
+	rows, err := pgxConn.Query(ctx, s, args...)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i LogItem
+		var ms int64
+		if err = rows.Scan(&i.Level, &i.Message, &i.Caller, &i.Stacktrace, &ms, &i.RequestID); err != nil {
+			z.Error(err.Error())
+			return
+		}
+		i.CreateTime = time.Unix(0, ms*1e6).Format(zLoggerTimeLayout)
+		items = append(items, i)
+	}
+	if err = rows.Err(); err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
+
+//------------------------------------------------------------------------------
+// live tail
+
+//logTailBuffer lines buffered for each subscriber, the later ones are dropped if it's full
+const logTailBuffer = 256
+
+type logTail struct {
+	lines chan []byte
+}
+
+var logTails struct {
+	sync.Mutex
+	n int32 // count of subscribers, checked without lock on each write
+	m map[*logTail]struct{}
+}
+
+//publishLog send the line written to the log file to the subscribers
+func publishLog(line []byte) {
+	if atomic.LoadInt32(&logTails.n) == 0 {
+		return
+	}
+
+	d := append([]byte(nil), line...)
+	logTails.Lock()
+	for t := range logTails.m {
+		select {
+		case t.lines <- d:
+		default:
+		}
+	}
+	logTails.Unlock()
+}
+
+/*TailLog subscribe the log items conforming to c written from now on, the time range, Offset
+and Limit of c are ignored. items is closed after stop called or the app shutdown */
+func TailLog(c LogQuery) (items <-chan LogItem, stop func(), err error) {
+	if err = c.prepare(true); err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	t := &logTail{lines: make(chan []byte, logTailBuffer)}
+	logTails.Lock()
+	if logTails.m == nil {
+		logTails.m = make(map[*logTail]struct{})
+	}
+	logTails.m[t] = struct{}{}
+	atomic.AddInt32(&logTails.n, 1)
+	logTails.Unlock()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			removeLogTail(t)
+		})
+	}
+
+	out := make(chan LogItem, logTailBuffer)
+	go func() {
+		defer close(out)
+		for line := range t.lines {
+			var i LogItem
+			if json.Unmarshal(line, &i) != nil || !c.match(&i) {
+				continue
+			}
+			i.Original = string(bytes.TrimRight(line, "\r\n"))
+			select {
+			case out <- i:
+			default:
+				log.Print("log tail is too slow, item dropped")
+			}
+		}
+	}()
+	items = out
+	return
+}
+
+func removeLogTail(t *logTail) {
+	logTails.Lock()
+	defer logTails.Unlock()
+	if _, ok := logTails.m[t]; !ok {
+		return
+	}
+	delete(logTails.m, t)
+	atomic.AddInt32(&logTails.n, -1)
+	close(t.lines)
+}
+
+//closeLogTails stop all the subscribers, called by Shutdown before the web server drained
+func closeLogTails() {
+	logTails.Lock()
+	defer logTails.Unlock()
+	for t := range logTails.m {
+		delete(logTails.m, t)
+		close(t.lines)
+	}
+	atomic.StoreInt32(&logTails.n, 0)
+}
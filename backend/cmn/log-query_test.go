@@ -0,0 +1,140 @@
+package cmn
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogQueryMatch(t *testing.T) {
+	item := &LogItem{Level: "warn", Caller: "cmn/insurance.go:1766", Message: "Insurance Timeout", RequestID: "req-1"}
+	cases := []struct {
+		name string
+		c    LogQuery
+		want bool
+	}{
+		{"no condition", LogQuery{}, true},
+		{"level below", LogQuery{Level: "info"}, true},
+		{"level equal", LogQuery{Level: "warn"}, true},
+		{"level above", LogQuery{Level: "error"}, false},
+		{"caller", LogQuery{Caller: "cmn/insurance.go"}, true},
+		{"another caller", LogQuery{Caller: "cmn/dml.go"}, false},
+		{"message case insensitive", LogQuery{Message: "TIMEOUT"}, true},
+		{"another message", LogQuery{Message: "refused"}, false},
+		{"request id", LogQuery{RequestID: "req-1"}, true},
+		{"another request id", LogQuery{RequestID: "req-2"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.c.prepare(true); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.c.match(item); got != c.want {
+				t.Fatalf("match = %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	c := LogQuery{Level: "verbose"}
+	if err := c.prepare(true); err == nil {
+		t.Fatal("unknown level should be rejected")
+	}
+	c = LogQuery{Begin: time.Now()}
+	if err := c.prepare(false); err != nil || c.Limit != defaultLogQueryLimit {
+		t.Fatalf("err = %v, limit = %d", err, c.Limit)
+	}
+	c = LogQuery{Begin: time.Now(), End: time.Now().Add(-time.Second)}
+	if err := c.prepare(false); err == nil {
+		t.Fatal("begin after end should be rejected")
+	}
+}
+
+func TestLevelsFrom(t *testing.T) {
+	var c LogQuery
+	c.Level = "error"
+	if err := c.prepare(true); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"error", "dpanic", "panic", "fatal"}
+	if got := levelsFrom(*c.minLevel); !reflect.DeepEqual(got, want) {
+		t.Fatalf("levelsFrom = %v, want %v", got, want)
+	}
+}
+
+// writeLogLines write the log items to name, one JSON line each
+func writeLogLines(t *testing.T, name string, items ...LogItem) {
+	var b strings.Builder
+	for _, i := range items {
+		buf, err := json.Marshal(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(buf)
+		b.WriteByte('\n')
+	}
+	// the malformed line is skipped
+	b.WriteString("{\"T\":\n")
+	if err := os.WriteFile(name, []byte(b.String()), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestQueryFileLog the items are queried from the compressed backup and the current file in time order
+func TestQueryFileLog(t *testing.T) {
+	saved := zLogFile
+	defer func() { zLogFile = saved }()
+	zLogFile = &rotatingFile{name: filepath.Join(t.TempDir(), "log.json")}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	at := func(minutes int) string {
+		return base.Add(time.Duration(minutes) * time.Minute).Format(zLoggerTimeLayout)
+	}
+
+	backup := zLogFile.backupName(base.Add(10 * time.Minute))
+	writeLogLines(t, backup,
+		LogItem{CreateTime: at(1), Level: "info", Message: "a"},
+		LogItem{CreateTime: at(2), Level: "error", Message: "b", RequestID: "req-1"},
+	)
+	if err := gzipFile(backup); err != nil {
+		t.Fatal(err)
+	}
+	writeLogLines(t, zLogFile.name,
+		LogItem{CreateTime: at(11), Level: "warn", Message: "c", RequestID: "req-1"},
+		LogItem{CreateTime: at(12), Level: "info", Message: "d"},
+	)
+
+	cases := []struct {
+		name string
+		c    LogQuery
+		want string
+	}{
+		{"all", LogQuery{Begin: base}, "abcd"},
+		{"time range", LogQuery{Begin: base.Add(2 * time.Minute), End: base.Add(12 * time.Minute)}, "bc"},
+		{"level", LogQuery{Begin: base, Level: "warn"}, "bc"},
+		{"request id", LogQuery{Begin: base, RequestID: "req-1"}, "bc"},
+		{"page", LogQuery{Begin: base, Offset: 1, Limit: 2}, "bc"},
+		{"after the last", LogQuery{Begin: base.Add(13 * time.Minute)}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			items, err := QueryFileLog(c.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			for _, i := range items {
+				got += i.Message
+				if i.Original == "" {
+					t.Fatalf("the original line of %s is missing", i.Message)
+				}
+			}
+			if got != c.want {
+				t.Fatalf("messages = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package cmn
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+/*rotation of the JSON log file
+
+	zLogger.file.maxSize:     日志文件的最大 MB, 超过后轮转, 缺省 100, 0 为不按大小轮转
+	zLogger.file.rotateDaily: 每天第一行日志写入前轮转, 缺省 true
+	zLogger.file.compress:    轮转后的文件以 gzip 压缩, 缺省 true
+	zLogger.file.maxAge:      轮转后的文件保留的天数, 缺省 30, 0 为不限
+	zLogger.file.maxBackups:  轮转后的文件保留的个数, 缺省 10, 0 为不限
+
+	轮转后的文件名为 log.txt-2006-01-02T15-04-05.000.json(.gz), 轮转在写锁内完成, 不会丢失日志;
+	收到 SIGHUP 时重新打开日志文件, 供外部的 logrotate 使用(create 方式, 不要用 copytruncate) */
+
+// defaults of zLogger.file
+const (
+	defaultLogMaxSize    = 100 // MB
+	defaultLogMaxAge     = 30  // day
+	defaultLogMaxBackups = 10
+
+	logBackupTimeLayout = "2006-01-02T15-04-05.000"
+	logDayLayout        = "2006-01-02"
+
+	// the log file isn't rotated again in it after the rotation failed
+	logRotateRetryInterval = time.Minute
+)
+
+//renameLogFile rename the log file to the backup, replaced in test
+var renameLogFile = os.Rename
+
+//rotatingFile zapcore.WriteSyncer of the log file, safe for concurrent use
+type rotatingFile struct {
+	sync.Mutex
+
+	name string
+	fd   *os.File
+	size int64
+	day  string // the day the file opened
+
+	// the last rotation failed at
+	rotateFailedAt time.Time
+
+	maxSize     int64
+	rotateDaily bool
+	compress    bool
+	maxAge      time.Duration
+	maxBackups  int
+
+	//cleanup wake the goroutine compressing and removing the backups
+	cleanup chan struct{}
+}
+
+func viperIntOr(key string, def int) int {
+	if viper.IsSet(key) {
+		return viper.GetInt(key)
+	}
+	return def
+}
+
+func viperBoolOr(key string, def bool) bool {
+	if viper.IsSet(key) {
+		return viper.GetBool(key)
+	}
+	return def
+}
+
+//newRotatingFile open the log file name with the settings of zLogger.file
+func newRotatingFile(name string) (r *rotatingFile, err error) {
+	r = &rotatingFile{
+		name:        name,
+		maxSize:     int64(viperIntOr("zLogger.file.maxSize", defaultLogMaxSize)) * 1024 * 1024,
+		rotateDaily: viperBoolOr("zLogger.file.rotateDaily", true),
+		compress:    viperBoolOr("zLogger.file.compress", true),
+		maxAge:      time.Duration(viperIntOr("zLogger.file.maxAge", defaultLogMaxAge)) * 24 * time.Hour,
+		maxBackups:  viperIntOr("zLogger.file.maxBackups", defaultLogMaxBackups),
+		cleanup:     make(chan struct{}, 1),
+	}
+
+	if err = r.open(); err != nil {
+		return
+	}
+
+	// the file left by the last run is of the earlier day
+	if r.rotateDaily && r.size > 0 {
+		if fi, e := r.fd.Stat(); e == nil && fi.ModTime().Format(logDayLayout) != r.day {
+			r.rotate()
+		}
+	}
+
+	go r.cleanupBackups()
+	r.triggerCleanup()
+	return
+}
+
+//open the log file for appending
+func (r *rotatingFile) open() (err error) {
+	fd, err := os.OpenFile(r.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		err = fmt.Errorf("open %s failed by %s", r.name, err.Error())
+		return
+	}
+
+	var size int64
+	if fi, e := fd.Stat(); e == nil {
+		size = fi.Size()
+	}
+	r.fd, r.size, r.day = fd, size, time.Now().Format(logDayLayout)
+	return
+}
+
+//Write p to the log file, rotate it before if needed
+func (r *rotatingFile) Write(p []byte) (n int, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.fd == nil {
+		// reopen failed before
+		if err = r.open(); err != nil {
+			return
+		}
+	}
+
+	if r.shouldRotate(len(p)) {
+		r.rotate()
+		if r.fd == nil {
+			err = fmt.Errorf("%s isn't opened after rotation", r.name)
+			return
+		}
+	}
+
+	n, err = r.fd.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		publishLog(p)
+	}
+	return
+}
+
+//Sync commit the log file to disk
+func (r *rotatingFile) Sync() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.fd == nil {
+		return nil
+	}
+	return r.fd.Sync()
+}
+
+func (r *rotatingFile) shouldRotate(n int) bool {
+	if !r.rotateFailedAt.IsZero() && time.Since(r.rotateFailedAt) < logRotateRetryInterval {
+		return false
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.rotateDaily && r.size > 0 && time.Now().Format(logDayLayout) != r.day
+}
+
+//backupName name of the file rotated at t, e.g. logs/log.txt-2022-05-01T00-00-00.000.json
+func (r *rotatingFile) backupName(t time.Time) string {
+	dir, base := filepath.Split(r.name)
+	ext := filepath.Ext(base)
+	return filepath.Join(dir, strings.TrimSuffix(base, ext)+"-"+t.Format(logBackupTimeLayout)+ext)
+}
+
+/*rotate rename the log file to the backup and open a new one, with r locked.
+the log is written to the current file, or the reopened one, if the rename failed,
+and it isn't rotated again in logRotateRetryInterval */
+func (r *rotatingFile) rotate() {
+	if err := r.fd.Close(); err != nil {
+		log.Print(err.Error())
+	}
+	r.fd = nil
+
+	if err := renameLogFile(r.name, r.backupName(time.Now())); err != nil {
+		log.Print(err.Error())
+		r.rotateFailedAt = time.Now()
+	} else {
+		r.rotateFailedAt = time.Time{}
+	}
+
+	if err := r.open(); err != nil {
+		log.Print(err.Error())
+		return
+	}
+	r.triggerCleanup()
+}
+
+//reopen the log file renamed by logrotate
+func (r *rotatingFile) reopen() {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.fd != nil {
+		if err := r.fd.Close(); err != nil {
+			log.Print(err.Error())
+		}
+		r.fd = nil
+	}
+	if err := r.open(); err != nil {
+		log.Print(err.Error())
+	}
+}
+
+//watchLogReopen reopen the log file on SIGHUP
+func watchLogReopen(r *rotatingFile) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			r.reopen()
+			z.Info("log file reopened by SIGHUP")
+		}
+	}()
+}
+
+func (r *rotatingFile) triggerCleanup() {
+	select {
+	case r.cleanup <- struct{}{}:
+	default:
+	}
+}
+
+//logBackup rotated log file
+type logBackup struct {
+	name string
+	t    time.Time
+}
+
+//listBackups the rotated files of r, the latest first
+func (r *rotatingFile) listBackups() (list []logBackup, err error) {
+	dir, base := filepath.Split(r.name)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() || !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		ts := strings.TrimPrefix(n, prefix)
+		switch {
+		case strings.HasSuffix(ts, ext+".gz"):
+			ts = strings.TrimSuffix(ts, ext+".gz")
+		case strings.HasSuffix(ts, ext):
+			ts = strings.TrimSuffix(ts, ext)
+		default:
+			continue
+		}
+		t, e := time.ParseInLocation(logBackupTimeLayout, ts, time.Local)
+		if e != nil {
+			continue
+		}
+		list = append(list, logBackup{name: filepath.Join(dir, n), t: t})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].t.After(list[j].t)
+	})
+	return
+}
+
+//cleanupBackups compress the rotated files and remove the ones beyond maxAge/maxBackups
+func (r *rotatingFile) cleanupBackups() {
+	for range r.cleanup {
+		list, err := r.listBackups()
+		if err != nil {
+			log.Print(err.Error())
+			continue
+		}
+
+		for i, v := range list {
+			if (r.maxBackups > 0 && i >= r.maxBackups) ||
+				(r.maxAge > 0 && time.Since(v.t) > r.maxAge) {
+				if err = os.Remove(v.name); err != nil {
+					log.Print(err.Error())
+				}
+				continue
+			}
+
+			if r.compress && !strings.HasSuffix(v.name, ".gz") {
+				if err = gzipFile(v.name); err != nil {
+					log.Print(err.Error())
+				}
+			}
+		}
+	}
+}
+
+//gzipFile compress name to name.gz then remove it
+func gzipFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+
+	if err = os.Rename(tmp, name+".gz"); err != nil {
+		return
+	}
+	_ = src.Close()
+	return os.Remove(name)
+}
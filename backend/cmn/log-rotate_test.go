@@ -0,0 +1,177 @@
+package cmn
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShouldRotate(t *testing.T) {
+	today := time.Now().Format(logDayLayout)
+	cases := []struct {
+		name string
+		r    *rotatingFile
+		n    int
+		want bool
+	}{
+		{"below max size", &rotatingFile{maxSize: 100, size: 50, day: today}, 50, false},
+		{"beyond max size", &rotatingFile{maxSize: 100, size: 50, day: today}, 51, true},
+		{"empty file never rotated", &rotatingFile{maxSize: 100, day: today}, 200, false},
+		{"no max size", &rotatingFile{size: 1 << 30, day: today}, 1, false},
+		{"another day", &rotatingFile{rotateDaily: true, size: 1, day: "2022-05-01"}, 1, true},
+		{"another day not daily", &rotatingFile{size: 1, day: "2022-05-01"}, 1, false},
+		{"empty file of another day", &rotatingFile{rotateDaily: true, day: "2022-05-01"}, 1, false},
+	}
+	for _, c := range cases {
+		if got := c.r.shouldRotate(c.n); got != c.want {
+			t.Errorf("%s: shouldRotate = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestListBackups(t *testing.T) {
+	dir := t.TempDir()
+	r := &rotatingFile{name: filepath.Join(dir, "log.json")}
+
+	files := []string{
+		"log.json",
+		"log-2022-05-01T00-00-00.000.json",
+		"log-2022-05-03T00-00-00.000.json.gz",
+		"log-2022-05-02T10-00-00.000.json",
+		"log-invalid.json",
+		"log-2022-05-04T00-00-00.000.txt",
+		"other-2022-05-05T00-00-00.000.json",
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := r.listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range list {
+		names = append(names, filepath.Base(v.name))
+	}
+	want := []string{
+		"log-2022-05-03T00-00-00.000.json.gz",
+		"log-2022-05-02T10-00-00.000.json",
+		"log-2022-05-01T00-00-00.000.json",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("backups = %v, want %v", names, want)
+	}
+}
+
+// TestRotatingFile the file is rotated by size, the backups beyond maxBackups are removed and the others compressed
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	r := &rotatingFile{
+		name:       filepath.Join(dir, "log.json"),
+		maxSize:    16,
+		compress:   true,
+		maxBackups: 1,
+		cleanup:    make(chan struct{}, 1),
+	}
+	if err := r.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.fd.Close() }()
+
+	// an older backup left by the last run
+	old := r.backupName(time.Now().Add(-time.Hour))
+	if err := os.WriteFile(old, []byte("old\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"0123456789\n", "abcdefghij\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf, _ := os.ReadFile(r.name); string(buf) != "abcdefghij\n" {
+		t.Fatalf("the current file is %q", buf)
+	}
+
+	// one pass of the cleanup
+	close(r.cleanup)
+	r.cleanupBackups()
+
+	list, err := r.listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || filepath.Ext(list[0].name) != ".gz" {
+		t.Fatalf("backups = %v, want the compressed latest one", list)
+	}
+
+	f, err := os.Open(list[0].name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := io.ReadAll(gz); string(buf) != "0123456789\n" {
+		t.Fatalf("the backup is %q", buf)
+	}
+}
+
+// TestRotateBackoff the failed rotation isn't retried on each write
+func TestRotateBackoff(t *testing.T) {
+	dir := t.TempDir()
+	r := &rotatingFile{
+		name:    filepath.Join(dir, "log.json"),
+		maxSize: 16,
+		cleanup: make(chan struct{}, 1),
+	}
+	if err := r.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.fd.Close() }()
+
+	renames := 0
+	renameLogFile = func(string, string) error {
+		renames++
+		return errors.New("rename failed")
+	}
+	defer func() { renameLogFile = os.Rename }()
+
+	for _, s := range []string{"0123456789\n", "abcdefghij\n", "ABCDEFGHIJ\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if renames != 1 {
+		t.Fatalf("renamed %d times, want 1", renames)
+	}
+	if buf, _ := os.ReadFile(r.name); string(buf) != "0123456789\nabcdefghij\nABCDEFGHIJ\n" {
+		t.Fatalf("the log is %q", buf)
+	}
+
+	// rotated again after logRotateRetryInterval
+	renameLogFile = os.Rename
+	r.rotateFailedAt = time.Now().Add(-logRotateRetryInterval)
+	if _, err := r.Write([]byte("0123456789\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !r.rotateFailedAt.IsZero() {
+		t.Fatal("the failure should be reset by the successful rotation")
+	}
+	if buf, _ := os.ReadFile(r.name); string(buf) != "0123456789\n" {
+		t.Fatalf("the current file is %q", buf)
+	}
+	if list, err := r.listBackups(); err != nil || len(list) != 1 {
+		t.Fatalf("backups = %v, %v, want 1", list, err)
+	}
+}
@@ -0,0 +1,148 @@
+package cmn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestMain(m *testing.M) {
+	// the package scope logger is used everywhere
+	GetLogger()
+	os.Exit(m.Run())
+}
+
+// fakeDB the dbms of the tests, each statement is answered by query with the
+// white spaces of the statement collapsed, the prepared/closed statements and
+// the committed/rolled back transactions are counted
+type fakeDB struct {
+	sync.Mutex
+	query func(query string, args []driver.Value) (*fakeRows, error)
+
+	prepared   map[string]int
+	closed     map[string]int
+	commits    int
+	rollbacks  int
+	statements []string
+}
+
+// openFakeDB replace sqlxDB with a fakeDB answering the statements by query until the test finished,
+// the cached statements prepared on the replaced db are dropped
+func openFakeDB(t *testing.T, query func(query string, args []driver.Value) (*fakeRows, error)) *fakeDB {
+	d := &fakeDB{query: query, prepared: map[string]int{}, closed: map[string]int{}}
+	db := sqlxDB
+	t.Cleanup(func() {
+		ResetPlanCache()
+		sqlxDB = db
+	})
+	ResetPlanCache()
+	sqlxDB = sqlx.NewDb(sql.OpenDB(d), "postgres")
+	return d
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return nil }
+
+// count the value of query in m, m is one of d.prepared and d.closed
+func (d *fakeDB) count(m map[string]int, query string) int {
+	d.Lock()
+	defer d.Unlock()
+	return m[query]
+}
+
+type fakeConn struct {
+	d *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	c.d.Lock()
+	c.d.prepared[query]++
+	c.d.Unlock()
+	return &fakeStmt{c.d, query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return &fakeTx{c.d}, nil }
+
+type fakeTx struct {
+	d *fakeDB
+}
+
+func (x *fakeTx) Commit() error {
+	x.d.Lock()
+	x.d.commits++
+	x.d.Unlock()
+	return nil
+}
+func (x *fakeTx) Rollback() error {
+	x.d.Lock()
+	x.d.rollbacks++
+	x.d.Unlock()
+	return nil
+}
+
+type fakeStmt struct {
+	d     *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	s.d.Lock()
+	s.d.closed[s.query]++
+	s.d.Unlock()
+	return nil
+}
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.Query(args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows.(*fakeRows).values)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.Lock()
+	s.d.statements = append(s.d.statements, s.query)
+	s.d.Unlock()
+	rows, err := s.d.query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// fakeRows the result of a statement, columns may be omitted if there are values
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	i       int
+}
+
+func (r *fakeRows) Columns() []string {
+	if r.columns != nil {
+		return r.columns
+	}
+	if len(r.values) == 0 || r.values[0] == nil {
+		return []string{"c"}
+	}
+	return make([]string, len(r.values[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.i])
+	r.i++
+	return nil
+}
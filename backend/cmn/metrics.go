@@ -0,0 +1,258 @@
+package cmn
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*metrics in Prometheus text exposition format, served by serve/metrics
+
+	w2w_http_requests_total{api,status}            请求数, api 为 ServeEndPoint.Name, status 为 ReplyProto.Status
+	w2w_http_request_duration_seconds{api}         请求耗时直方图
+	w2w_running_sessions                           处理中的请求数
+	w2w_db_connections{pool,state}                 连接池 idle/in_use/open 连接数
+	w2w_db_connections_leaked_total{pool,api}      请求结束时未归还的连接数
+	w2w_http_compressed_bytes_total{encoding,stage} 压缩前(in)/后(out)的字节数
+	w2w_http_compression_ratio{encoding}           out/in
+	w2w_dml_*                                      PlanCacheStats
+	w2w_log_*                                      LogBufferStats */
+
+//metricsNamespace prefix of metric names
+const metricsNamespace = "w2w_"
+
+//durationBuckets upper bounds of the request duration histogram in second
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//histogram cumulative in exposition, counts here are not
+type histogram struct {
+	counts []int64 // len(durationBuckets)+1, the last is +Inf
+	sum    float64
+	count  int64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(durationBuckets)+1)
+	}
+	i := sort.SearchFloat64s(durationBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+type labelPair struct {
+	a string
+	b string
+}
+
+var metrics struct {
+	sync.Mutex
+
+	requests  map[labelPair]int64 // {api, status}
+	durations map[string]*histogram
+	leaked    map[labelPair]int64 // {pool, api}
+
+	// {encoding, in|out}
+	compressed map[labelPair]int64
+}
+
+//ObserveRequest record a request of api finished with status in d
+func ObserveRequest(api string, status int, d time.Duration) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	if metrics.requests == nil {
+		metrics.requests = make(map[labelPair]int64)
+		metrics.durations = make(map[string]*histogram)
+	}
+	metrics.requests[labelPair{api, strconv.Itoa(status)}]++
+
+	h, ok := metrics.durations[api]
+	if !ok {
+		h = &histogram{}
+		metrics.durations[api] = h
+	}
+	h.observe(d.Seconds())
+}
+
+//ObserveLeak record n connections of pool leaked by api
+func ObserveLeak(pool, api string, n int64) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	if metrics.leaked == nil {
+		metrics.leaked = make(map[labelPair]int64)
+	}
+	metrics.leaked[labelPair{pool, api}] += n
+}
+
+//ObserveCompression record a response of in bytes compressed to out bytes by encoding
+func ObserveCompression(encoding string, in, out int64) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	if metrics.compressed == nil {
+		metrics.compressed = make(map[labelPair]int64)
+	}
+	metrics.compressed[labelPair{encoding, "in"}] += in
+	metrics.compressed[labelPair{encoding, "out"}] += out
+}
+
+//metricsWriter write metrics in exposition format, the first error is kept
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (m *metricsWriter) printf(format string, a ...interface{}) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = fmt.Fprintf(m.w, format, a...)
+}
+
+//head write HELP and TYPE of name
+func (m *metricsWriter) head(name, typ, help string) {
+	m.printf("# HELP %s%s %s\n# TYPE %s%s %s\n", metricsNamespace, name, help, metricsNamespace, name, typ)
+}
+
+//sample write a sample of name, labels are name/value pairs
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	var a []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		a = append(a, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabel(labels[i+1])))
+	}
+	s := ""
+	if len(a) > 0 {
+		s = "{" + strings.Join(a, ",") + "}"
+	}
+	m.printf("%s%s%s %s\n", metricsNamespace, name, s, formatSample(value))
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatSample(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedPairs(m map[labelPair]int64) []labelPair {
+	keys := make([]labelPair, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].a != keys[j].a {
+			return keys[i].a < keys[j].a
+		}
+		return keys[i].b < keys[j].b
+	})
+	return keys
+}
+
+//WriteMetrics write all metrics to w in Prometheus text exposition format
+func WriteMetrics(w io.Writer) error {
+	m := &metricsWriter{w: w}
+
+	metrics.Lock()
+	m.head("http_requests_total", "counter", "Requests by api and reply status.")
+	for _, k := range sortedPairs(metrics.requests) {
+		m.sample("http_requests_total", float64(metrics.requests[k]), "api", k.a, "status", k.b)
+	}
+
+	m.head("http_request_duration_seconds", "histogram", "Request duration by api.")
+	var apis []string
+	for k := range metrics.durations {
+		apis = append(apis, k)
+	}
+	sort.Strings(apis)
+	for _, api := range apis {
+		h := metrics.durations[api]
+		var n int64
+		for i, v := range durationBuckets {
+			n += h.counts[i]
+			m.sample("http_request_duration_seconds_bucket", float64(n), "api", api, "le", formatSample(v))
+		}
+		m.sample("http_request_duration_seconds_bucket", float64(h.count), "api", api, "le", "+Inf")
+		m.sample("http_request_duration_seconds_sum", h.sum, "api", api)
+		m.sample("http_request_duration_seconds_count", float64(h.count), "api", api)
+	}
+
+	m.head("db_connections_leaked_total", "counter", "Connections not released at the end of request.")
+	for _, k := range sortedPairs(metrics.leaked) {
+		m.sample("db_connections_leaked_total", float64(metrics.leaked[k]), "pool", k.a, "api", k.b)
+	}
+
+	m.head("http_compressed_bytes_total", "counter", "Response bytes before(in) and after(out) compression.")
+	for _, k := range sortedPairs(metrics.compressed) {
+		m.sample("http_compressed_bytes_total", float64(metrics.compressed[k]), "encoding", k.a, "stage", k.b)
+	}
+	m.head("http_compression_ratio", "gauge", "Compressed bytes divided by uncompressed bytes.")
+	for _, k := range sortedPairs(metrics.compressed) {
+		if k.b != "in" || metrics.compressed[k] == 0 {
+			continue
+		}
+		out := metrics.compressed[labelPair{k.a, "out"}]
+		m.sample("http_compression_ratio", float64(out)/float64(metrics.compressed[k]), "encoding", k.a)
+	}
+	metrics.Unlock()
+
+	m.head("running_sessions", "gauge", "Requests being processed.")
+	m.sample("running_sessions", float64(RunningSessionCount()))
+
+	m.head("db_connections", "gauge", "Connections of the pool by state.")
+	if pgxConn != nil {
+		s := pgxConn.Stat()
+		m.sample("db_connections", float64(s.IdleConns()), "pool", "pgx", "state", "idle")
+		m.sample("db_connections", float64(s.AcquiredConns()), "pool", "pgx", "state", "in_use")
+		m.sample("db_connections", float64(s.TotalConns()), "pool", "pgx", "state", "open")
+	}
+	if sqlxDB != nil {
+		s := sqlxDB.Stats()
+		m.sample("db_connections", float64(s.Idle), "pool", "sqlx", "state", "idle")
+		m.sample("db_connections", float64(s.InUse), "pool", "sqlx", "state", "in_use")
+		m.sample("db_connections", float64(s.OpenConnections), "pool", "sqlx", "state", "open")
+	}
+
+	p := PlanCacheStats()
+	m.head("dml_stmt_cache_hits_total", "counter", "Prepared statement cache hits of DML.")
+	m.sample("dml_stmt_cache_hits_total", float64(p.StmtHits))
+	m.head("dml_stmt_cache_misses_total", "counter", "Prepared statement cache misses of DML.")
+	m.sample("dml_stmt_cache_misses_total", float64(p.StmtMisses))
+	m.head("dml_stmt_cache_evictions_total", "counter", "Prepared statement cache evictions of DML.")
+	m.sample("dml_stmt_cache_evictions_total", float64(p.StmtEvictions))
+	m.head("dml_stmt_cache_size", "gauge", "Prepared statements in the cache of DML.")
+	m.sample("dml_stmt_cache_size", float64(p.StmtSize))
+
+	l := LogBufferStats()
+	m.head("log_buffered_items", "gauge", "Log items in the buffer of the database log sink.")
+	m.sample("log_buffered_items", float64(l.Buffered))
+	m.head("log_items_total", "counter", "Log items of the database log sink by outcome.")
+	m.sample("log_items_total", float64(l.Dropped), "outcome", "dropped")
+	m.sample("log_items_total", float64(l.Delayed), "outcome", "delayed")
+	m.sample("log_items_total", float64(l.Spilled), "outcome", "spilled")
+	m.head("log_blocked_calls_total", "counter", "Log calls waited for the full buffer by block policy.")
+	m.sample("log_blocked_calls_total", float64(l.Blocked))
+	m.head("log_flush_failures_total", "counter", "Failed writes of the log to postgresql.")
+	m.sample("log_flush_failures_total", float64(l.FlushFailures))
+
+	if m.err != nil {
+		z.Error(m.err.Error())
+	}
+	return m.err
+}
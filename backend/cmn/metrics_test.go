@@ -0,0 +1,74 @@
+package cmn
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rMetricSample = regexp.MustCompile(`^(w2w_[a-z_]+?)(_bucket|_sum|_count)?(\{[a-z_]+="(?:[^"\\]|\\.)*"(?:,[a-z_]+="(?:[^"\\]|\\.)*")*\})? \S+$`)
+
+func TestWriteMetrics(t *testing.T) {
+	ObserveRequest("metrics-test", 0, 30*time.Millisecond)
+	ObserveRequest("metrics-test", 0, 30*time.Millisecond)
+	ObserveRequest("metrics-test", -1, 2*time.Second)
+	ObserveRequest(`metrics"test`, 0, time.Millisecond)
+	ObserveLeak("pgx", "metrics-test", 2)
+	ObserveCompression("metrics-gzip", 1000, 250)
+
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`w2w_http_requests_total{api="metrics-test",status="0"} 2`,
+		`w2w_http_requests_total{api="metrics-test",status="-1"} 1`,
+		`w2w_http_request_duration_seconds_bucket{api="metrics-test",le="0.025"} 0`,
+		`w2w_http_request_duration_seconds_bucket{api="metrics-test",le="0.05"} 2`,
+		`w2w_http_request_duration_seconds_bucket{api="metrics-test",le="2.5"} 3`,
+		`w2w_http_request_duration_seconds_bucket{api="metrics-test",le="+Inf"} 3`,
+		`w2w_http_request_duration_seconds_count{api="metrics-test"} 3`,
+		`w2w_http_requests_total{api="metrics\"test",status="0"} 1`,
+		`w2w_db_connections_leaked_total{pool="pgx",api="metrics-test"} 2`,
+		`w2w_http_compressed_bytes_total{encoding="metrics-gzip",stage="in"} 1000`,
+		`w2w_http_compressed_bytes_total{encoding="metrics-gzip",stage="out"} 250`,
+		`w2w_http_compression_ratio{encoding="metrics-gzip"} 0.25`,
+		`# TYPE w2w_running_sessions gauge`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %s", want)
+		}
+	}
+
+	// each sample follows the HELP and TYPE of its family
+	declared := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			f := strings.Fields(line)
+			declared[f[2]] = f[3]
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		m := rMetricSample.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("malformed sample %q", line)
+			continue
+		}
+		name := m[1]
+		if _, ok := declared[name]; !ok {
+			name = m[1] + m[2]
+		}
+		if _, ok := declared[name]; !ok {
+			t.Errorf("sample %q before its TYPE", line)
+		}
+	}
+	if declared["w2w_http_request_duration_seconds"] != "histogram" {
+		t.Errorf("request duration type %q, want histogram", declared["w2w_http_request_duration_seconds"])
+	}
+}
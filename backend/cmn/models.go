@@ -49,6 +49,11 @@ func (r *TAccountOprLog) GetTableName() string {
 	return tableName
 }
 
+//register TAccountOprLog for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TAccountOprLog{} })
+}
+
 // Create inserts the TAccountOprLog to the database.
 func (r *TAccountOprLog) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -134,6 +139,11 @@ func (r *TAge) GetTableName() string {
 	return tableName
 }
 
+//register TAge for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TAge{} })
+}
+
 // Create inserts the TAge to the database.
 func (r *TAge) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -211,6 +221,11 @@ func (r *TAPI) GetTableName() string {
 	return tableName
 }
 
+//register TAPI for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TAPI{} })
+}
+
 // Create inserts the TAPI to the database.
 func (r *TAPI) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -280,6 +295,11 @@ func (r *TBlacklist) GetTableName() string {
 	return tableName
 }
 
+//register TBlacklist for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TBlacklist{} })
+}
+
 // Create inserts the TBlacklist to the database.
 func (r *TBlacklist) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -337,6 +357,11 @@ func (r *TDegree) GetTableName() string {
 	return tableName
 }
 
+//register TDegree for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TDegree{} })
+}
+
 // Create inserts the TDegree to the database.
 func (r *TDegree) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -408,6 +433,11 @@ func (r *TDomain) GetTableName() string {
 	return tableName
 }
 
+//register TDomain for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TDomain{} })
+}
+
 // Create inserts the TDomain to the database.
 func (r *TDomain) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -496,6 +526,11 @@ func (r *TDomainAPI) GetTableName() string {
 	return tableName
 }
 
+//register TDomainAPI for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TDomainAPI{} })
+}
+
 // Create inserts the TDomainAPI to the database.
 func (r *TDomainAPI) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -559,6 +594,11 @@ func (r *TExpertise) GetTableName() string {
 	return tableName
 }
 
+//register TExpertise for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TExpertise{} })
+}
+
 // Create inserts the TExpertise to the database.
 func (r *TExpertise) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -635,6 +675,11 @@ func (r *TExternalDomainConf) GetTableName() string {
 	return tableName
 }
 
+//register TExternalDomainConf for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TExternalDomainConf{} })
+}
+
 // Create inserts the TExternalDomainConf to the database.
 func (r *TExternalDomainConf) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -706,6 +751,11 @@ func (r *TExternalDomainUser) GetTableName() string {
 	return tableName
 }
 
+//register TExternalDomainUser for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TExternalDomainUser{} })
+}
+
 // Create inserts the TExternalDomainUser to the database.
 func (r *TExternalDomainUser) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -787,6 +837,11 @@ func (r *TFile) GetTableName() string {
 	return tableName
 }
 
+//register TFile for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TFile{} })
+}
+
 // Create inserts the TFile to the database.
 func (r *TFile) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -870,6 +925,11 @@ func (r *TImportData) GetTableName() string {
 	return tableName
 }
 
+//register TImportData for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TImportData{} })
+}
+
 // Create inserts the TImportData to the database.
 func (r *TImportData) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -994,7 +1054,7 @@ type TInsurancePolicy struct {
 	DomainID         null.Int       `json:"DomainID,omitempty" db:"domain_id,false,bigint"`                             /* domain_id 数据属主 */
 	Addi             types.JSONText `json:"Addi,omitempty" db:"addi,false,jsonb"`                                       /* addi 附加数据 */
 	Remark           null.String    `json:"Remark,omitempty" db:"remark,false,character varying"`                       /* remark 备注 */
-	Status           null.String    `json:"Status,omitempty" db:"status,false,character varying"`                       /* status 一期，0：受理中，2：在保，4：过保, 6: 作废。二期，00: 正常, 04: 重新录单, 08: 撤消, 12: 续保, 16: 已重新录单, 20: 退保, 24: 拒保 */
+	Status           null.String    `json:"Status,omitempty" db:"status,false,character varying" softDelete:"99,0 一期，0：受理中，2：在保，4：过保, 6: 作废。二期，00: 正常, 04: 重新录单, 08: 撤消, 12: 续保, 16: 已重新录单, 20: 退保, 24: 拒保"` /* status softDelete:99,0 一期，0：受理中，2：在保，4：过保, 6: 作废。二期，00: 正常, 04: 重新录单, 08: 撤消, 12: 续保, 16: 已重新录单, 20: 退保, 24: 拒保 */
 	Filter                          // build DML where clause
 }
 
@@ -1110,6 +1170,11 @@ func (r *TInsurancePolicy) GetTableName() string {
 	return tableName
 }
 
+//register TInsurancePolicy for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TInsurancePolicy{} })
+}
+
 // Create inserts the TInsurancePolicy to the database.
 func (r *TInsurancePolicy) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -1291,6 +1356,11 @@ func (r *TInsuranceTypes) GetTableName() string {
 	return tableName
 }
 
+//register TInsuranceTypes for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TInsuranceTypes{} })
+}
+
 // Create inserts the TInsuranceTypes to the database.
 func (r *TInsuranceTypes) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -1374,6 +1444,11 @@ func (r *TInsureAttach) GetTableName() string {
 	return tableName
 }
 
+//register TInsureAttach for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TInsureAttach{} })
+}
+
 // Create inserts the TInsureAttach to the database.
 func (r *TInsureAttach) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -1501,6 +1576,11 @@ func (r *TInsuredDetail) GetTableName() string {
 	return tableName
 }
 
+//register TInsuredDetail for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TInsuredDetail{} })
+}
+
 // Create inserts the TInsuredDetail to the database.
 func (r *TInsuredDetail) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -1578,6 +1658,11 @@ func (r *TInsuredTerms) GetTableName() string {
 	return tableName
 }
 
+//register TInsuredTerms for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TInsuredTerms{} })
+}
+
 // Create inserts the TInsuredTerms to the database.
 func (r *TInsuredTerms) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -1642,6 +1727,11 @@ func (r *TJudge) GetTableName() string {
 	return tableName
 }
 
+//register TJudge for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TJudge{} })
+}
+
 // Create inserts the TJudge to the database.
 func (r *TJudge) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -1678,6 +1768,7 @@ type TLog struct {
 	DomainID      null.Int    `json:"DomainID,omitempty" db:"domain_id,false,bigint"`                       /* domain_id 数据隶属 */
 	Creator       null.Int    `json:"Creator,omitempty" db:"creator,false,bigint"`                          /* creator 本数据创建者 */
 	CreateTime    null.Int    `json:"CreateTime,omitempty" db:"create_time,false,bigint"`                   /* create_time 生成时间 */
+	RequestID     null.String `json:"RequestID,omitempty" db:"request_id,false,character varying"`          /* request_id 请求编号 */
 	Filter                    // build DML where clause
 }
 
@@ -1694,6 +1785,7 @@ var TLogFields = []string{
 	"DomainID",
 	"Creator",
 	"CreateTime",
+	"RequestID",
 }
 
 //Fields return all fields of struct.
@@ -1711,11 +1803,16 @@ func (r *TLog) GetTableName() string {
 	return tableName
 }
 
+//register TLog for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TLog{} })
+}
+
 // Create inserts the TLog to the database.
 func (r *TLog) Create(db Queryer) error {
 	err := db.QueryRow(
-		`INSERT INTO t_log (grade, msg, caller, stacktrace, namespace, login_user_name, login_user_id, domain_id, creator, create_time) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
-		&r.Grade, &r.Msg, &r.Caller, &r.Stacktrace, &r.Namespace, &r.LoginUserName, &r.LoginUserID, &r.DomainID, &r.Creator, &r.CreateTime).Scan(&r.ID)
+		`INSERT INTO t_log (grade, msg, caller, stacktrace, namespace, login_user_name, login_user_id, domain_id, creator, create_time, request_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+		&r.Grade, &r.Msg, &r.Caller, &r.Stacktrace, &r.Namespace, &r.LoginUserName, &r.LoginUserID, &r.DomainID, &r.Creator, &r.CreateTime, &r.RequestID).Scan(&r.ID)
 	if err != nil {
 		return errors.Wrap(err, "failed to insert t_log")
 	}
@@ -1726,8 +1823,8 @@ func (r *TLog) Create(db Queryer) error {
 func GetTLogByPk(db Queryer, pk0 null.Int) (*TLog, error) {
 	var r TLog
 	err := db.QueryRow(
-		`SELECT id, grade, msg, caller, stacktrace, namespace, login_user_name, login_user_id, domain_id, creator, create_time FROM t_log WHERE id = $1`,
-		pk0).Scan(&r.ID, &r.Grade, &r.Msg, &r.Caller, &r.Stacktrace, &r.Namespace, &r.LoginUserName, &r.LoginUserID, &r.DomainID, &r.Creator, &r.CreateTime)
+		`SELECT id, grade, msg, caller, stacktrace, namespace, login_user_name, login_user_id, domain_id, creator, create_time, request_id FROM t_log WHERE id = $1`,
+		pk0).Scan(&r.ID, &r.Grade, &r.Msg, &r.Caller, &r.Stacktrace, &r.Namespace, &r.LoginUserName, &r.LoginUserID, &r.DomainID, &r.Creator, &r.CreateTime, &r.RequestID)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to select t_log")
 	}
@@ -1922,6 +2019,11 @@ func (r *TMistakeCorrect) GetTableName() string {
 	return tableName
 }
 
+//register TMistakeCorrect for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TMistakeCorrect{} })
+}
+
 // Create inserts the TMistakeCorrect to the database.
 func (r *TMistakeCorrect) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2025,6 +2127,11 @@ func (r *TMsg) GetTableName() string {
 	return tableName
 }
 
+//register TMsg for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TMsg{} })
+}
+
 // Create inserts the TMsg to the database.
 func (r *TMsg) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2114,6 +2221,11 @@ func (r *TNegotiatedPrice) GetTableName() string {
 	return tableName
 }
 
+//register TNegotiatedPrice for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TNegotiatedPrice{} })
+}
+
 // Create inserts the TNegotiatedPrice to the database.
 func (r *TNegotiatedPrice) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2268,19 +2380,19 @@ type TOrder struct {
 	InvTitle           null.String `json:"InvTitle,omitempty" db:"inv_title,false,character varying"`            /* inv_title 发票抬头修改状态, 16: 申请改发票抬头, 20: 已上传新发票, 24: 已下载新发票 */
 	Traits             null.String `json:"Traits,omitempty" db:"traits,false,character varying"`                 /* traits 特殊订单，标志为字符串数组，值域为: {"allowIntraday","ignoreAmountLimit","ignorePayDeadline","ignoreOrderDeadline","ignoreAgeLimit"},
 	allowIntraday:当天起保,ignoreAmountLimit:允许小于三人投保,ignorePayDeadline: 允许超时支付,ignoreOrderDeadline：允许超过截止时间投保,ignoreAgeLimit：允许超龄投保 */
-	Files       types.JSONText `json:"Files,omitempty" db:"files,false,jsonb"`                          /* files 附加文件 */
-	InvStatus   null.String    `json:"InvStatus,omitempty" db:"inv_status,false,character varying"`     /* inv_status 发票状态, 00: 未生成发票, 04: 发票已上传, 08: 发票已下载, 12: 发票已快递 */
-	OrderStatus null.String    `json:"OrderStatus,omitempty" db:"order_status,false,character varying"` /* order_status 订单状态, 00: 草稿, 04: 用户投保, 08: 申请议价, 12: 拒保, 16: 可支付, 18: 开始支付, 20: 已支付, 24: 退保, 28: 作废 */
-	UpdStatus   null.String    `json:"UpdStatus,omitempty" db:"upd_status,false,character varying"`     /* upd_status 订单更正状态, 00: 未更正, 02: 用户撤消申请, 04: 用户申请更正, 08: 接受更正,16: 更新订单, 20: 生成批改申请书, 24: 用户已下载申请书, 28: 用户已上传盖章批改申请书, 36: 管理员上传批改单, 40: 用户已下载批改单, 44: 批改单已快递给用户, 48: 申请被拒绝 */
-	Creator     null.Int       `json:"Creator,omitempty" db:"creator,false,bigint"`                     /* creator 创建者用户ID */
-	CreateTime  null.Int       `json:"CreateTime,omitempty" db:"create_time,false,bigint"`              /* create_time 创建时间 */
-	Regenerator null.Int       `json:"Regenerator,omitempty" db:"regenerator,false,bigint"`             /* regenerator 更新者 */
-	UpdateTime  null.Int       `json:"UpdateTime,omitempty" db:"update_time,false,bigint"`              /* update_time 更新时间 */
-	Updator     null.Int       `json:"Updator,omitempty" db:"updator,false,bigint"`                     /* updator 更新者 */
-	DomainID    null.Int       `json:"DomainID,omitempty" db:"domain_id,false,bigint"`                  /* domain_id 数据属主 */
-	Addi        types.JSONText `json:"Addi,omitempty" db:"addi,false,jsonb"`                            /* addi 附加数据 */
-	Remark      null.String    `json:"Remark,omitempty" db:"remark,false,character varying"`            /* remark 备注 */
-	Status      null.String    `json:"Status,omitempty" db:"status,false,character varying"`            /* status 0: 未支付, 2: 已支付，4: 已生成保单, 6: 已作废 */
+	Files       types.JSONText `json:"Files,omitempty" db:"files,false,jsonb"`                                 /* files 附加文件 */
+	InvStatus   null.String    `json:"InvStatus,omitempty" db:"inv_status,false,character varying"`            /* inv_status 发票状态, 00: 未生成发票, 04: 发票已上传, 08: 发票已下载, 12: 发票已快递 */
+	OrderStatus null.String    `json:"OrderStatus,omitempty" db:"order_status,false,character varying"`        /* order_status 订单状态, 00: 草稿, 04: 用户投保, 08: 申请议价, 12: 拒保, 16: 可支付, 18: 开始支付, 20: 已支付, 24: 退保, 28: 作废 */
+	UpdStatus   null.String    `json:"UpdStatus,omitempty" db:"upd_status,false,character varying"`            /* upd_status 订单更正状态, 00: 未更正, 02: 用户撤消申请, 04: 用户申请更正, 08: 接受更正,16: 更新订单, 20: 生成批改申请书, 24: 用户已下载申请书, 28: 用户已上传盖章批改申请书, 36: 管理员上传批改单, 40: 用户已下载批改单, 44: 批改单已快递给用户, 48: 申请被拒绝 */
+	Creator     null.Int       `json:"Creator,omitempty" db:"creator,false,bigint"`                            /* creator 创建者用户ID */
+	CreateTime  null.Int       `json:"CreateTime,omitempty" db:"create_time,false,bigint"`                     /* create_time 创建时间 */
+	Regenerator null.Int       `json:"Regenerator,omitempty" db:"regenerator,false,bigint"`                    /* regenerator 更新者 */
+	UpdateTime  null.Int       `json:"UpdateTime,omitempty" db:"update_time,false,bigint"`                     /* update_time 更新时间 */
+	Updator     null.Int       `json:"Updator,omitempty" db:"updator,false,bigint"`                            /* updator 更新者 */
+	DomainID    null.Int       `json:"DomainID,omitempty" db:"domain_id,false,bigint"`                         /* domain_id 数据属主 */
+	Addi        types.JSONText `json:"Addi,omitempty" db:"addi,false,jsonb"`                                   /* addi 附加数据 */
+	Remark      null.String    `json:"Remark,omitempty" db:"remark,false,character varying"`                   /* remark 备注 */
+	Status      null.String    `json:"Status,omitempty" db:"status,false,character varying" softDelete:"99,0 0: 未支付, 2: 已支付，4: 已生成保单, 6: 已作废"` /* status softDelete:99,0 0: 未支付, 2: 已支付，4: 已生成保单, 6: 已作废 */
 	Filter                     // build DML where clause
 }
 
@@ -2432,6 +2544,11 @@ func (r *TOrder) GetTableName() string {
 	return tableName
 }
 
+//register TOrder for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TOrder{} })
+}
+
 // Create inserts the TOrder to the database.
 func (r *TOrder) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2512,6 +2629,11 @@ func (r *TParam) GetTableName() string {
 	return tableName
 }
 
+//register TParam for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TParam{} })
+}
+
 // Create inserts the TParam to the database.
 func (r *TParam) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2591,6 +2713,11 @@ func (r *TPayAccount) GetTableName() string {
 	return tableName
 }
 
+//register TPayAccount for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TPayAccount{} })
+}
+
 // Create inserts the TPayAccount to the database.
 func (r *TPayAccount) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2664,6 +2791,11 @@ func (r *TPayment) GetTableName() string {
 	return tableName
 }
 
+//register TPayment for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TPayment{} })
+}
+
 // Create inserts the TPayment to the database.
 func (r *TPayment) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2756,6 +2888,11 @@ func (r *TPrice) GetTableName() string {
 	return tableName
 }
 
+//register TPrice for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TPrice{} })
+}
+
 // Create inserts the TPrice to the database.
 func (r *TPrice) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2830,6 +2967,11 @@ func (r *TPrj) GetTableName() string {
 	return tableName
 }
 
+//register TPrj for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TPrj{} })
+}
+
 // Create inserts the TPrj to the database.
 func (r *TPrj) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2889,6 +3031,11 @@ func (r *TProof) GetTableName() string {
 	return tableName
 }
 
+//register TProof for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TProof{} })
+}
+
 // Create inserts the TProof to the database.
 func (r *TProof) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -2948,6 +3095,11 @@ func (r *TProve) GetTableName() string {
 	return tableName
 }
 
+//register TProve for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TProve{} })
+}
+
 // Create inserts the TProve to the database.
 func (r *TProve) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3003,6 +3155,11 @@ func (r *TQualification) GetTableName() string {
 	return tableName
 }
 
+//register TQualification for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TQualification{} })
+}
+
 // Create inserts the TQualification to the database.
 func (r *TQualification) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3074,6 +3231,11 @@ func (r *TRegion) GetTableName() string {
 	return tableName
 }
 
+//register TRegion for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TRegion{} })
+}
+
 // Create inserts the TRegion to the database.
 func (r *TRegion) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3160,6 +3322,11 @@ func (r *TRelation) GetTableName() string {
 	return tableName
 }
 
+//register TRelation for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TRelation{} })
+}
+
 // Create inserts the TRelation to the database.
 func (r *TRelation) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3246,6 +3413,11 @@ func (r *TRelationHistory) GetTableName() string {
 	return tableName
 }
 
+//register TRelationHistory for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TRelationHistory{} })
+}
+
 // Create inserts the TRelationHistory to the database.
 func (r *TRelationHistory) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -3436,6 +3608,11 @@ func (r *TReportClaims) GetTableName() string {
 	return tableName
 }
 
+//register TReportClaims for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TReportClaims{} })
+}
+
 // Create inserts the TReportClaims to the database.
 func (r *TReportClaims) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3519,6 +3696,11 @@ func (r *TResource) GetTableName() string {
 	return tableName
 }
 
+//register TResource for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TResource{} })
+}
+
 // Create inserts the TResource to the database.
 func (r *TResource) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3576,6 +3758,11 @@ func (r *TScanTdc) GetTableName() string {
 	return tableName
 }
 
+//register TScanTdc for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TScanTdc{} })
+}
+
 // Create inserts the TScanTdc to the database.
 func (r *TScanTdc) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3711,6 +3898,11 @@ func (r *TSchool) GetTableName() string {
 	return tableName
 }
 
+//register TSchool for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TSchool{} })
+}
+
 // Create inserts the TSchool to the database.
 func (r *TSchool) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3802,6 +3994,11 @@ func (r *TSpecialOrder) GetTableName() string {
 	return tableName
 }
 
+//register TSpecialOrder for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TSpecialOrder{} })
+}
+
 // Create inserts the TSpecialOrder to the database.
 func (r *TSpecialOrder) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3874,6 +4071,11 @@ func (r *TSysVer) GetTableName() string {
 	return tableName
 }
 
+//register TSysVer for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TSysVer{} })
+}
+
 // Create inserts the TSysVer to the database.
 func (r *TSysVer) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -3951,6 +4153,11 @@ func (r *TTdc) GetTableName() string {
 	return tableName
 }
 
+//register TTdc for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TTdc{} })
+}
+
 // Create inserts the TTdc to the database.
 func (r *TTdc) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -4021,6 +4228,11 @@ func (r *TUndertaker) GetTableName() string {
 	return tableName
 }
 
+//register TUndertaker for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TUndertaker{} })
+}
+
 // Create inserts the TUndertaker to the database.
 func (r *TUndertaker) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -4166,6 +4378,11 @@ func (r *TUser) GetTableName() string {
 	return tableName
 }
 
+//register TUser for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TUser{} })
+}
+
 // Create inserts the TUser to the database.
 func (r *TUser) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -4219,6 +4436,11 @@ func (r *TUserDegree) GetTableName() string {
 	return tableName
 }
 
+//register TUserDegree for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TUserDegree{} })
+}
+
 // Create inserts the TUserDegree to the database.
 func (r *TUserDegree) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -4309,6 +4531,11 @@ func (r *TUserDomain) GetTableName() string {
 	return tableName
 }
 
+//register TUserDomain for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TUserDomain{} })
+}
+
 // Create inserts the TUserDomain to the database.
 func (r *TUserDomain) Create(db Queryer) error {
 	err := db.QueryRow(
@@ -4396,6 +4623,11 @@ func (r *TVAa) GetTableName() string {
 	return tableName
 }
 
+//register TVAa for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVAa{} })
+}
+
 // Create inserts the TVAa to the database.
 func (r *TVAa) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -4463,6 +4695,11 @@ func (r *TVAPIDomain) GetTableName() string {
 	return tableName
 }
 
+//register TVAPIDomain for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVAPIDomain{} })
+}
+
 // Create inserts the TVAPIDomain to the database.
 func (r *TVAPIDomain) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -4540,6 +4777,11 @@ func (r *TVAuthenticate) GetTableName() string {
 	return tableName
 }
 
+//register TVAuthenticate for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVAuthenticate{} })
+}
+
 // Create inserts the TVAuthenticate to the database.
 func (r *TVAuthenticate) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -4623,6 +4865,11 @@ func (r *TVDomainAPI) GetTableName() string {
 	return tableName
 }
 
+//register TVDomainAPI for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVDomainAPI{} })
+}
+
 // Create inserts the TVDomainAPI to the database.
 func (r *TVDomainAPI) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -4682,6 +4929,11 @@ func (r *TVDomainUser) GetTableName() string {
 	return tableName
 }
 
+//register TVDomainUser for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVDomainUser{} })
+}
+
 // Create inserts the TVDomainUser to the database.
 func (r *TVDomainUser) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -4899,6 +5151,11 @@ func (r *TVInsurancePolicy) GetTableName() string {
 	return tableName
 }
 
+//register TVInsurancePolicy for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVInsurancePolicy{} })
+}
+
 // Create inserts the TVInsurancePolicy to the database.
 func (r *TVInsurancePolicy) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -5198,6 +5455,11 @@ func (r *TVInsurancePolicy2) GetTableName() string {
 	return tableName
 }
 
+//register TVInsurancePolicy2 for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVInsurancePolicy2{} })
+}
+
 // Create inserts the TVInsurancePolicy2 to the database.
 func (r *TVInsurancePolicy2) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -5371,6 +5633,11 @@ func (r *TVInsuranceType) GetTableName() string {
 	return tableName
 }
 
+//register TVInsuranceType for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVInsuranceType{} })
+}
+
 // Create inserts the TVInsuranceType to the database.
 func (r *TVInsuranceType) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -5454,6 +5721,11 @@ func (r *TVInsureAttach) GetTableName() string {
 	return tableName
 }
 
+//register TVInsureAttach for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVInsureAttach{} })
+}
+
 // Create inserts the TVInsureAttach to the database.
 func (r *TVInsureAttach) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -5521,6 +5793,11 @@ func (r *TVInsuredSchool) GetTableName() string {
 	return tableName
 }
 
+//register TVInsuredSchool for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVInsuredSchool{} })
+}
+
 // Create inserts the TVInsuredSchool to the database.
 func (r *TVInsuredSchool) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -5578,6 +5855,11 @@ func (r *TVInsurer) GetTableName() string {
 	return tableName
 }
 
+//register TVInsurer for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVInsurer{} })
+}
+
 // Create inserts the TVInsurer to the database.
 func (r *TVInsurer) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -5641,6 +5923,11 @@ func (r *TVManagerSchool) GetTableName() string {
 	return tableName
 }
 
+//register TVManagerSchool for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVManagerSchool{} })
+}
+
 // Create inserts the TVManagerSchool to the database.
 func (r *TVManagerSchool) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -5762,6 +6049,11 @@ func (r *TVMistakeCorrect) GetTableName() string {
 	return tableName
 }
 
+//register TVMistakeCorrect for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVMistakeCorrect{} })
+}
+
 // Create inserts the TVMistakeCorrect to the database.
 func (r *TVMistakeCorrect) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -6139,6 +6431,11 @@ func (r *TVMistakeCorrect2) GetTableName() string {
 	return tableName
 }
 
+//register TVMistakeCorrect2 for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVMistakeCorrect2{} })
+}
+
 // Create inserts the TVMistakeCorrect2 to the database.
 func (r *TVMistakeCorrect2) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -6386,6 +6683,11 @@ func (r *TVMistakeCorrectShow) GetTableName() string {
 	return tableName
 }
 
+//register TVMistakeCorrectShow for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVMistakeCorrectShow{} })
+}
+
 // Create inserts the TVMistakeCorrectShow to the database.
 func (r *TVMistakeCorrectShow) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -6551,6 +6853,11 @@ func (r *TVOrder) GetTableName() string {
 	return tableName
 }
 
+//register TVOrder for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVOrder{} })
+}
+
 // Create inserts the TVOrder to the database.
 func (r *TVOrder) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -6978,6 +7285,11 @@ func (r *TVOrder2) GetTableName() string {
 	return tableName
 }
 
+//register TVOrder2 for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVOrder2{} })
+}
+
 // Create inserts the TVOrder2 to the database.
 func (r *TVOrder2) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7039,6 +7351,11 @@ func (r *TVOrderSum) GetTableName() string {
 	return tableName
 }
 
+//register TVOrderSum for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVOrderSum{} })
+}
+
 // Create inserts the TVOrderSum to the database.
 func (r *TVOrderSum) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7102,6 +7419,11 @@ func (r *TVParam) GetTableName() string {
 	return tableName
 }
 
+//register TVParam for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVParam{} })
+}
+
 // Create inserts the TVParam to the database.
 func (r *TVParam) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7183,6 +7505,11 @@ func (r *TVPayment) GetTableName() string {
 	return tableName
 }
 
+//register TVPayment for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVPayment{} })
+}
+
 // Create inserts the TVPayment to the database.
 func (r *TVPayment) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7238,6 +7565,11 @@ func (r *TVRegion) GetTableName() string {
 	return tableName
 }
 
+//register TVRegion for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVRegion{} })
+}
+
 // Create inserts the TVRegion to the database.
 func (r *TVRegion) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7473,6 +7805,11 @@ func (r *TVReportClaims) GetTableName() string {
 	return tableName
 }
 
+//register TVReportClaims for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVReportClaims{} })
+}
+
 // Create inserts the TVReportClaims to the database.
 func (r *TVReportClaims) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7564,6 +7901,11 @@ func (r *TVUserDomain) GetTableName() string {
 	return tableName
 }
 
+//register TVUserDomain for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVUserDomain{} })
+}
+
 // Create inserts the TVUserDomain to the database.
 func (r *TVUserDomain) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7665,6 +8007,11 @@ func (r *TVUserDomainAPI) GetTableName() string {
 	return tableName
 }
 
+//register TVUserDomainAPI for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVUserDomainAPI{} })
+}
+
 // Create inserts the TVUserDomainAPI to the database.
 func (r *TVUserDomainAPI) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7730,6 +8077,11 @@ func (r *TVXkbSchoolLayout) GetTableName() string {
 	return tableName
 }
 
+//register TVXkbSchoolLayout for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVXkbSchoolLayout{} })
+}
+
 // Create inserts the TVXkbSchoolLayout to the database.
 func (r *TVXkbSchoolLayout) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7859,6 +8211,11 @@ func (r *TVXkbUser) GetTableName() string {
 	return tableName
 }
 
+//register TVXkbUser for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TVXkbUser{} })
+}
+
 // Create inserts the TVXkbUser to the database.
 func (r *TVXkbUser) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -7968,6 +8325,11 @@ func (r *TWxUser) GetTableName() string {
 	return tableName
 }
 
+//register TWxUser for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TWxUser{} })
+}
+
 // Create inserts the TWxUser to the database.
 func (r *TWxUser) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -8043,6 +8405,11 @@ func (r *TXkbUser) GetTableName() string {
 	return tableName
 }
 
+//register TXkbUser for the relation expanding of DML
+func init() {
+	registerTableMap(func() interface{} { return &TXkbUser{} })
+}
+
 // Create inserts the TXkbUser to the database.
 func (r *TXkbUser) Create(db Queryer) error {
 	_, err := db.Exec(
@@ -157,12 +157,13 @@ func (p *TParam) sonNameToStringSlice() (s []string) {
 // var rParamURI = regexp.MustCompile(paramURI)
 
 func param(ctx context.Context) {
+	zr := LoggerOf(ctx)
 	q := GetCtxValue(ctx)
 	// if (len(q.R.URL.Path)+12) < paramURILen ||
 	// 	!rParamURI.MatchString(q.R.URL.Path) {
 	// 	return
 	// }
-	z.Info("---->" + FncName())
+	zr.Info("---->" + FncName())
 	q.Stop = true
 	switch strings.ToLower(q.R.Method) {
 	case "delete":
@@ -172,7 +173,7 @@ func param(ctx context.Context) {
 			s := `select name from t_pay_account`
 			r, err := sqlxDB.Queryx(s)
 			if err != nil {
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				return
 			}
 			defer r.Close()
@@ -181,7 +182,7 @@ func param(ctx context.Context) {
 				var c string
 				err = r.Scan(&c)
 				if err != nil {
-					z.Error(err.Error())
+					zr.Error(err.Error())
 					return
 				}
 				channels = append(channels, c)
@@ -189,7 +190,7 @@ func param(ctx context.Context) {
 
 			q.Msg.Data, q.Err = json.Marshal(channels)
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
@@ -205,23 +206,23 @@ func param(ctx context.Context) {
 		if qry == "refresh" {
 			//------保险数据重新获取
 
-			z.Warn("开始刷新系统参数,将对系统参数进行加锁,刷新结束前不允许读取")
+			zr.Warn("开始刷新系统参数,将对系统参数进行加锁,刷新结束前不允许读取")
 
 			//---险种数据刷新
 			q.Err = refreshInsuranceTypes()
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
 			//---参数刷新
 			q.Err = refreshBaseParam("all")
 			if q.Err != nil {
-				z.Error(q.Err.Error())
+				zr.Error(q.Err.Error())
 				q.RespErr()
 				return
 			}
-			z.Info("系统参数刷新结束")
+			zr.Info("系统参数刷新结束")
 			q.Msg.Data = getCacheParam()
 			q.Resp()
 			return
@@ -230,35 +231,36 @@ func param(ctx context.Context) {
 		var req ReqProto
 		q.Err = json.Unmarshal([]byte(qry), &req)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		if strings.ToLower(req.Action) != "select" {
 			q.Err = fmt.Errorf("please specify select as school query action")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 
 		var s TParam
 		s.TableMap = &s
-		q.Err = DML(&s.Filter, &req)
+		q.Err = DML(ctx, &s.Filter, &req)
 		if q.Err != nil {
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
 		v, ok := s.QryResult.(string)
 		if !ok {
 			q.Err = fmt.Errorf("s.qryResult should be string, but it isn't")
-			z.Error(q.Err.Error())
+			zr.Error(q.Err.Error())
 			q.RespErr()
 			return
 		}
-		z.Info(v)
+		zr.Info(v)
 		q.Msg.RowCount = s.RowCount
+		q.Msg.NextCursor = s.NextCursor
 		q.Msg.Data = types.JSONText(v)
 		q.Resp()
 	case "post":
@@ -269,7 +271,7 @@ func param(ctx context.Context) {
 
 func baseParam(ctx context.Context) {
 	q := GetCtxValue(ctx)
-	z.Info("---->" + FncName())
+	LoggerOf(ctx).Info("---->" + FncName())
 	q.Msg.Data = getCacheParam()
 	q.Resp()
 }
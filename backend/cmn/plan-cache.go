@@ -0,0 +1,223 @@
+package cmn
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+/*plan cache of DML
+
+	column mapping: json/field name to db column of every TableMap struct is built once,
+		Filter.mapKey doesn't reflect over the struct on every request
+	prepared statement: keyed by the SQL text, all values of the condition are bound as
+		$n parameters and MakeFilter visits keys in sorted order, so the SQL text is the
+		normalized (table, condition skeleton) and is reused by requests with the same shape
+
+	PlanCacheStats return the hit/miss counters */
+
+//defaultStmtCacheSize default of dbms.stmtCacheSize
+const defaultStmtCacheSize = 256
+
+//PlanCacheStat hit/miss counters of the plan cache
+type PlanCacheStat struct {
+	StmtHits      int64 `json:"stmtHits"`
+	StmtMisses    int64 `json:"stmtMisses"`
+	StmtEvictions int64 `json:"stmtEvictions"`
+	StmtSize      int   `json:"stmtSize"`
+
+	ColumnMapHits   int64 `json:"columnMapHits"`
+	ColumnMapMisses int64 `json:"columnMapMisses"`
+}
+
+//columnMapping result of mapKey
+type columnMapping struct {
+	column string
+	found  bool
+}
+
+var columnMaps sync.Map // reflect.Type -> map[string]columnMapping
+
+var columnMapHits, columnMapMisses int64
+
+/*columnMapOf return the column mapping of struct t, the key is upper case field name or json name,
+the first field matched wins as mapKey used to do */
+func columnMapOf(t reflect.Type) map[string]columnMapping {
+	if v, ok := columnMaps.Load(t); ok {
+		atomic.AddInt64(&columnMapHits, 1)
+		return v.(map[string]columnMapping)
+	}
+	atomic.AddInt64(&columnMapMisses, 1)
+
+	m := make(map[string]columnMapping)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		var names []string
+		names = append(names, f.Name)
+		if s, ok := f.Tag.Lookup("json"); ok && s != "" {
+			names = append(names, strings.Split(s, ",")[0])
+		}
+
+		for _, n := range names {
+			key := strings.ToUpper(n)
+			if n == "" {
+				continue
+			}
+			if _, ok := m[key]; ok {
+				continue
+			}
+
+			c := columnMapping{column: n, found: true}
+			if s, ok := f.Tag.Lookup("db"); ok && s != "" {
+				c.column = strings.Split(s, ",")[0]
+				c.found = c.column != ""
+			}
+			m[key] = c
+		}
+	}
+
+	v, _ := columnMaps.LoadOrStore(t, m)
+	return v.(map[string]columnMapping)
+}
+
+//cachedStmt prepared statement in the cache, refs is the count of users
+type cachedStmt struct {
+	sql     string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+var stmtCache struct {
+	sync.Mutex
+	lru   *list.List // front is the most recently used
+	bySQL map[string]*list.Element
+
+	hits, misses, evictions int64
+}
+
+func stmtCacheSize() int {
+	n := viper.GetInt("dbms.stmtCacheSize")
+	if n <= 0 {
+		n = defaultStmtCacheSize
+	}
+	return n
+}
+
+/*acquireStmt return the prepared statement of s from the cache, prepare it on miss,
+release must be called after the statement is used, for example
+	stmt, release, err := acquireStmt(s)
+	if err != nil {
+		return
+	}
+	defer release() */
+func acquireStmt(s string) (stmt *sqlx.Stmt, release func(), err error) {
+	if sqlxDB == nil {
+		err = fmt.Errorf("please connect to dbms")
+		z.Error(err.Error())
+		return
+	}
+
+	stmtCache.Lock()
+	if stmtCache.lru == nil {
+		stmtCache.lru = list.New()
+		stmtCache.bySQL = make(map[string]*list.Element)
+	}
+	if e, ok := stmtCache.bySQL[s]; ok {
+		c := e.Value.(*cachedStmt)
+		c.refs++
+		stmtCache.lru.MoveToFront(e)
+		stmtCache.hits++
+		stmtCache.Unlock()
+		return c.stmt, func() { releaseStmt(c) }, nil
+	}
+	stmtCache.misses++
+	stmtCache.Unlock()
+
+	// prepare outside the lock, it's a round trip to the dbms
+	stmt, err = sqlxDB.Preparex(s)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	stmtCache.Lock()
+	defer stmtCache.Unlock()
+	if e, ok := stmtCache.bySQL[s]; ok {
+		// prepared by others at the same time
+		_ = stmt.Close()
+		c := e.Value.(*cachedStmt)
+		c.refs++
+		stmtCache.lru.MoveToFront(e)
+		return c.stmt, func() { releaseStmt(c) }, nil
+	}
+
+	c := &cachedStmt{sql: s, stmt: stmt, refs: 1}
+	stmtCache.bySQL[s] = stmtCache.lru.PushFront(c)
+	for stmtCache.lru.Len() > stmtCacheSize() {
+		e := stmtCache.lru.Back()
+		evictStmt(e)
+	}
+	return stmt, func() { releaseStmt(c) }, nil
+}
+
+//evictStmt remove e from the cache, the statement is closed after its last user released it
+func evictStmt(e *list.Element) {
+	c := e.Value.(*cachedStmt)
+	stmtCache.lru.Remove(e)
+	delete(stmtCache.bySQL, c.sql)
+	stmtCache.evictions++
+	c.evicted = true
+	if c.refs == 0 {
+		_ = c.stmt.Close()
+	}
+}
+
+func releaseStmt(c *cachedStmt) {
+	stmtCache.Lock()
+	defer stmtCache.Unlock()
+	c.refs--
+	if c.evicted && c.refs == 0 {
+		_ = c.stmt.Close()
+	}
+}
+
+//ResetPlanCache close all cached statements, should be called after the schema changed
+func ResetPlanCache() {
+	columnMaps.Range(func(k, v interface{}) bool {
+		columnMaps.Delete(k)
+		return true
+	})
+
+	stmtCache.Lock()
+	defer stmtCache.Unlock()
+	if stmtCache.lru == nil {
+		return
+	}
+	for stmtCache.lru.Len() > 0 {
+		evictStmt(stmtCache.lru.Back())
+	}
+}
+
+//PlanCacheStats return the hit/miss counters of the plan cache
+func PlanCacheStats() (stat PlanCacheStat) {
+	stmtCache.Lock()
+	stat.StmtHits = stmtCache.hits
+	stat.StmtMisses = stmtCache.misses
+	stat.StmtEvictions = stmtCache.evictions
+	if stmtCache.lru != nil {
+		stat.StmtSize = stmtCache.lru.Len()
+	}
+	stmtCache.Unlock()
+
+	stat.ColumnMapHits = atomic.LoadInt64(&columnMapHits)
+	stat.ColumnMapMisses = atomic.LoadInt64(&columnMapMisses)
+	return
+}
@@ -0,0 +1,105 @@
+package cmn
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"w2w.io/null"
+)
+
+func TestColumnMapOf(t *testing.T) {
+	type row struct {
+		ID      null.Int    `json:"ID,omitempty" db:"id,true,integer"`
+		OrgName null.String `json:"orgName" db:"org_name,false,character varying"`
+		Remark  string
+		Skipped string `db:""`
+		Filter
+	}
+	typ := reflect.TypeOf(row{})
+
+	before := PlanCacheStats()
+	m := columnMapOf(typ)
+	if m2 := columnMapOf(typ); reflect.ValueOf(m2).Pointer() != reflect.ValueOf(m).Pointer() {
+		t.Fatal("the column map should be cached")
+	}
+	after := PlanCacheStats()
+	if after.ColumnMapMisses-before.ColumnMapMisses != 1 || after.ColumnMapHits-before.ColumnMapHits != 1 {
+		t.Fatalf("hits/misses %d/%d, want 1/1", after.ColumnMapHits-before.ColumnMapHits,
+			after.ColumnMapMisses-before.ColumnMapMisses)
+	}
+
+	cases := map[string]columnMapping{
+		"ID":      {"id", true},
+		"ORGNAME": {"org_name", true}, // field name and json name are the same in upper case
+		"REMARK":  {"Remark", true},
+		"SKIPPED": {"Skipped", true},
+	}
+	for key, want := range cases {
+		if got := m[key]; got != want {
+			t.Errorf("%s: %+v, want %+v", key, got, want)
+		}
+	}
+	if _, ok := m["NOSUCHFIELD"]; ok {
+		t.Error("unknown key should not be mapped")
+	}
+}
+
+func TestStmtCacheEviction(t *testing.T) {
+	counter := openFakeDB(t, func(string, []driver.Value) (*fakeRows, error) { return &fakeRows{}, nil })
+	viper.Set("dbms.stmtCacheSize", 2)
+	ResetPlanCache()
+	defer func() {
+		ResetPlanCache()
+		viper.Set("dbms.stmtCacheSize", defaultStmtCacheSize)
+	}()
+
+	before := PlanCacheStats()
+	acquire := func(s string) func() {
+		_, release, err := acquireStmt(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return release
+	}
+
+	// s1 is held while it's evicted by s3
+	release1 := acquire("select 1")
+	acquire("select 2")()
+	acquire("select 2")()
+	acquire("select 3")()
+
+	if n := counter.count(counter.prepared, "select 2"); n != 1 {
+		t.Fatalf("select 2 prepared %d times, want 1", n)
+	}
+	if n := counter.count(counter.closed, "select 1"); n != 0 {
+		t.Fatal("the evicted statement is closed while it's used")
+	}
+	release1()
+	if n := counter.count(counter.closed, "select 1"); n != 1 {
+		t.Fatal("the evicted statement should be closed after released")
+	}
+
+	after := PlanCacheStats()
+	if d := after.StmtHits - before.StmtHits; d != 1 {
+		t.Errorf("hits %d, want 1", d)
+	}
+	if d := after.StmtMisses - before.StmtMisses; d != 3 {
+		t.Errorf("misses %d, want 3", d)
+	}
+	if d := after.StmtEvictions - before.StmtEvictions; d != 1 {
+		t.Errorf("evictions %d, want 1", d)
+	}
+	if after.StmtSize != 2 {
+		t.Errorf("size %d, want 2", after.StmtSize)
+	}
+
+	// the cached statements are closed by reset
+	ResetPlanCache()
+	for _, s := range []string{"select 2", "select 3"} {
+		if n := counter.count(counter.closed, s); n != 1 {
+			t.Errorf("%s closed %d times after reset, want 1", s, n)
+		}
+	}
+}
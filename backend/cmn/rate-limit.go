@@ -0,0 +1,710 @@
+package cmn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/spf13/viper"
+)
+
+/*rate limit and blacklist of ServeEndPoint
+
+	ServeEndPoint.RateLimit 声明接口的令牌桶, 按 ip/user/phone 分别计数, 未登录时 user 按 ip 计数
+	被拒绝的次数在 ViolationWindow 内达到 Violations 时, 请求者被写入 t_blacklist,
+		type 为 rate-limit:ip, rate-limit:user, rate-limit:phone, content 为 ip/用户编号/手机号,
+		BlacklistTTL 后失效, 失效时间(毫秒)在 addi.expire 中
+	黑名单中的请求者在认证之前被拒绝
+	请求者的 ip 为 RemoteAddr, 仅当 RemoteAddr 是可信代理时才取 X-Forwarded-For/X-Real-Ip 中的地址
+
+	webServe.rateLimit.backend:      redis(缺省) 在多个实例间共享计数, memory 仅在本进程内计数
+	webServe.rateLimit.blacklistTTL: BlacklistTTL 的缺省值, 秒, 缺省 86400
+	webServe.trustedProxies:         可信代理的 ip 或 cidr 列表, 例如 ["127.0.0.1", "10.0.0.0/8"] */
+
+// 限流状态码
+const (
+	//CRateLimited 请求过于频繁
+	CRateLimited = -42901
+
+	//CBlacklisted 请求者在黑名单中
+	CBlacklisted = -40301
+)
+
+// RateLimit.By
+const (
+	CRateLimitByIP    = "ip"
+	CRateLimitByUser  = "user"
+	CRateLimitByPhone = "phone"
+)
+
+//blacklistTypePrefix prefix of t_blacklist.type written by rate limit
+const blacklistTypePrefix = "rate-limit:"
+
+//defaultBlacklistTTL default of webServe.rateLimit.blacklistTTL
+const defaultBlacklistTTL = 24 * time.Hour
+
+//RateLimit token bucket of a ServeEndPoint
+type RateLimit struct {
+	//By key of the bucket, ip, user or phone
+	By string `json:"by,omitempty"`
+
+	//Rate tokens put into the bucket per second
+	Rate float64 `json:"rate,omitempty"`
+
+	//Burst capacity of the bucket
+	Burst int `json:"burst,omitempty"`
+
+	//Violations the requester is blacklisted after rejected Violations times in ViolationWindow, 0: never
+	Violations      int           `json:"violations,omitempty"`
+	ViolationWindow time.Duration `json:"violation_window,omitempty"`
+
+	//BlacklistTTL the requester is removed from the blacklist after it, default webServe.rateLimit.blacklistTTL
+	BlacklistTTL time.Duration `json:"blacklist_ttl,omitempty"`
+
+	//PhoneParam the query parameter of phone number while By is phone, default "phone"
+	PhoneParam string `json:"phone_param,omitempty"`
+}
+
+//LimiterBackend state of the token buckets and the blacklist
+type LimiterBackend interface {
+	//Take take a token from the bucket of key, return false if the bucket is empty
+	Take(key string, rate float64, burst int) (bool, error)
+
+	//Violate count the rejection of key in window, return the count in window
+	Violate(key string, window time.Duration) (int64, error)
+
+	//Blacklisted report whether any of members is in the blacklist and not expired
+	Blacklisted(members ...string) (bool, error)
+
+	//AddBlacklist add member to the blacklist until expire
+	AddBlacklist(member string, expire time.Time) error
+
+	//ResetBlacklist replace the blacklist with members and their expire time
+	ResetBlacklist(members map[string]time.Time) error
+}
+
+var limiter struct {
+	sync.Mutex
+	backend LimiterBackend
+}
+
+//SetLimiterBackend replace the backend of rate limit, e.g. NewMemoryLimiter() in test
+func SetLimiterBackend(b LimiterBackend) {
+	limiter.Lock()
+	defer limiter.Unlock()
+	limiter.backend = b
+}
+
+func limiterBackend() LimiterBackend {
+	limiter.Lock()
+	defer limiter.Unlock()
+	if limiter.backend == nil {
+		if strings.EqualFold(viper.GetString("webServe.rateLimit.backend"), "memory") {
+			limiter.backend = NewMemoryLimiter()
+		} else {
+			limiter.backend = &redisLimiter{}
+		}
+	}
+	return limiter.backend
+}
+
+//check validate v while the ServeEndPoint is added
+func (v *RateLimit) check() (err error) {
+	switch {
+	case v.By != CRateLimitByIP && v.By != CRateLimitByUser && v.By != CRateLimitByPhone:
+		err = fmt.Errorf("rateLimit.by should be one of ip, user, phone, not %s", v.By)
+	case v.Rate <= 0:
+		err = fmt.Errorf("rateLimit.rate should be larger than 0")
+	case v.Burst <= 0:
+		err = fmt.Errorf("rateLimit.burst should be larger than 0")
+	case v.Violations > 0 && v.ViolationWindow <= 0:
+		err = fmt.Errorf("rateLimit.violationWindow should be larger than 0 while violations is set")
+	}
+	if v.PhoneParam == "" {
+		v.PhoneParam = "phone"
+	}
+	if v.BlacklistTTL <= 0 {
+		v.BlacklistTTL = blacklistTTL()
+	}
+	return
+}
+
+func blacklistTTL() time.Duration {
+	if n := viper.GetInt("webServe.rateLimit.blacklistTTL"); n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return defaultBlacklistTTL
+}
+
+//keyOf return the key of the requester, by:value, e.g. ip:10.0.0.1
+func (v *RateLimit) keyOf(q *ServiceCtx) (by string, value string) {
+	switch v.By {
+	case CRateLimitByUser:
+		if q.SysUser != nil && q.SysUser.ID.Valid {
+			return CRateLimitByUser, fmt.Sprintf("%d", q.SysUser.ID.Int64)
+		}
+
+	case CRateLimitByPhone:
+		if s := strings.TrimSpace(q.R.URL.Query().Get(v.PhoneParam)); s != "" {
+			return CRateLimitByPhone, s
+		}
+	}
+	return CRateLimitByIP, peerAddr(q.R)
+}
+
+/*RejectBlacklisted reject the requester in the blacklist by ip or phone before authentication,
+q.Err is set if rejected */
+func RejectBlacklisted(ctx context.Context) {
+	q := GetCtxValue(ctx)
+	if q.R == nil {
+		return
+	}
+
+	members := []string{CRateLimitByIP + ":" + peerAddr(q.R)}
+	if q.Ep != nil && q.Ep.RateLimit != nil && q.Ep.RateLimit.By == CRateLimitByPhone {
+		if s := strings.TrimSpace(q.R.URL.Query().Get(q.Ep.RateLimit.PhoneParam)); s != "" {
+			members = append(members, CRateLimitByPhone+":"+s)
+		}
+	}
+	rejectBlacklisted(q, members)
+}
+
+//rejectBlacklisted set q.Err and reply CBlacklisted if any of members is in the blacklist
+func rejectBlacklisted(q *ServiceCtx, members []string) {
+	found, err := limiterBackend().Blacklisted(members...)
+	if err != nil {
+		// the service should be available while the backend fails
+		return
+	}
+	if !found {
+		return
+	}
+
+	q.Attacker = true
+	q.Err = fmt.Errorf("%s: access denied", q.R.URL.Path)
+	z.Warn(fmt.Sprintf("%s, %v in blacklist", q.Err.Error(), members))
+	q.Msg.Status = CBlacklisted
+	q.RespErr()
+}
+
+/*Throttle take a token from the bucket of q.Ep.RateLimit after authentication,
+q.Err is set if the requester is blacklisted or the bucket is empty */
+func Throttle(ctx context.Context) {
+	q := GetCtxValue(ctx)
+	if q.R == nil {
+		return
+	}
+
+	if q.SysUser != nil && q.SysUser.ID.Valid {
+		rejectBlacklisted(q, []string{fmt.Sprintf("%s:%d", CRateLimitByUser, q.SysUser.ID.Int64)})
+		if q.Err != nil {
+			return
+		}
+	}
+
+	if q.Ep == nil || q.Ep.RateLimit == nil {
+		return
+	}
+	v := q.Ep.RateLimit
+	by, value := v.keyOf(q)
+	key := fmt.Sprintf("%s:%s:%s", q.Ep.Path, by, value)
+
+	b := limiterBackend()
+	ok, err := b.Take(key, v.Rate, v.Burst)
+	if err != nil || ok {
+		return
+	}
+
+	q.Err = fmt.Errorf("%s: too many requests, please try again later", q.R.URL.Path)
+	LoggerOf(ctx).Warn(fmt.Sprintf("%s by %s %s", q.Err.Error(), by, value))
+
+	if v.Violations > 0 {
+		n, err := b.Violate(key, v.ViolationWindow)
+		// only the one reached the threshold writes the blacklist
+		if err == nil && n == int64(v.Violations) {
+			q.Attacker = true
+			_ = addBlacklist(q, by, value, n)
+		}
+	}
+
+	if q.W != nil {
+		q.W.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(1/v.Rate))))
+	}
+	q.Msg.Status = CRateLimited
+	q.RespErr()
+}
+
+//addBlacklist write the requester into t_blacklist and the blacklist of the backend
+func addBlacklist(q *ServiceCtx, by, value string, violations int64) (err error) {
+	if sqlxDB == nil {
+		err = fmt.Errorf("please connect to dbms")
+		z.Error(err.Error())
+		return
+	}
+
+	expire := time.Now().Add(q.Ep.RateLimit.BlacklistTTL)
+	var addi []byte
+	addi, err = json.Marshal(map[string]interface{}{
+		"api":        q.Ep.Path,
+		"violations": violations,
+		"window":     q.Ep.RateLimit.ViolationWindow.String(),
+		"expire":     expire.UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	s := `insert into t_blacklist(type, content, create_time, addi, status)
+		values ($1, $2, $3, $4, '0')`
+	_, err = sqlxDB.Exec(s, blacklistTypePrefix+by, value, GetNowInMS(), string(addi))
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	err = limiterBackend().AddBlacklist(by+":"+value, expire)
+	if err != nil {
+		return
+	}
+	z.Warn(fmt.Sprintf("%s %s blacklisted till %s by %d violations of %s",
+		by, value, expire.Format(time.RFC3339), violations, q.Ep.Path))
+	return
+}
+
+/*LoadBlacklist load the blacklist written by rate limit from t_blacklist into the backend,
+the rows without addi.expire expire after webServe.rateLimit.blacklistTTL since create_time */
+func LoadBlacklist() {
+	if sqlxDB == nil {
+		err := "sqlxDB is nil"
+		z.Error(err)
+		panic(err)
+	}
+
+	s := `select type, content, expire from (
+			select type, content, coalesce((addi->>'expire')::bigint,
+				coalesce(create_time, 0) + $2) as expire
+			from t_blacklist
+			where type like $1 and coalesce(status, '0') = '0') t
+		where expire > $3`
+	rows, err := sqlxDB.Queryx(s, blacklistTypePrefix+"%",
+		blacklistTTL().Milliseconds(), GetNowInMS())
+	if err != nil {
+		z.Error(err.Error())
+		panic(err.Error())
+	}
+	defer rows.Close()
+
+	members := make(map[string]time.Time)
+	for rows.Next() {
+		var t, content string
+		var expire int64
+		err = rows.Scan(&t, &content, &expire)
+		if err != nil {
+			z.Error(err.Error())
+			panic(err.Error())
+		}
+		members[strings.TrimPrefix(t, blacklistTypePrefix)+":"+content] =
+			time.Unix(0, expire*int64(time.Millisecond))
+	}
+
+	err = limiterBackend().ResetBlacklist(members)
+	if err != nil {
+		return
+	}
+	z.Info(fmt.Sprintf("%d requesters in blacklist", len(members)))
+}
+
+//---------------------------------------------------------------------------------
+//redisLimiter LimiterBackend shared by all instances
+
+// redis keys of rate limit
+const (
+	rateLimitBucketKey    = "rateLimit:bucket:"
+	rateLimitViolationKey = "rateLimit:violation:"
+	// sorted set of the members scored by the expire time in millisecond
+	rateLimitBlacklistKey = "rateLimit:blacklist:expire"
+)
+
+//takeScript token bucket in hash {tokens, ts}, ts is in millisecond
+var takeScript = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1])
+local ts = tonumber(b[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return allowed`)
+
+//violateScript counter expired after ARGV[1] millisecond since the first violation
+var violateScript = redis.NewScript(1, `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n`)
+
+type redisLimiter struct{}
+
+func (t *redisLimiter) conn() (c redis.Conn, err error) {
+	if redisPool == nil {
+		err = errors.New("please connect to redis")
+		z.Error(err.Error())
+		return
+	}
+	c = redisPool.Get()
+	return
+}
+
+func (t *redisLimiter) Take(key string, rate float64, burst int) (ok bool, err error) {
+	var c redis.Conn
+	if c, err = t.conn(); err != nil {
+		return
+	}
+	defer c.Close()
+
+	var n int64
+	n, err = redis.Int64(takeScript.Do(c, rateLimitBucketKey+key, rate, burst, GetNowInMS()))
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	ok = n == 1
+	return
+}
+
+func (t *redisLimiter) Violate(key string, window time.Duration) (n int64, err error) {
+	var c redis.Conn
+	if c, err = t.conn(); err != nil {
+		return
+	}
+	defer c.Close()
+
+	n, err = redis.Int64(violateScript.Do(c, rateLimitViolationKey+key, window.Milliseconds()))
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
+
+func (t *redisLimiter) Blacklisted(members ...string) (found bool, err error) {
+	var c redis.Conn
+	if c, err = t.conn(); err != nil {
+		return
+	}
+	defer c.Close()
+
+	now := GetNowInMS()
+	for _, v := range members {
+		var expire int64
+		expire, err = redis.Int64(c.Do("ZSCORE", rateLimitBlacklistKey, v))
+		if err == redis.ErrNil {
+			err = nil
+			continue
+		}
+		if err != nil {
+			z.Error(err.Error())
+			return
+		}
+		if expire > now {
+			found = true
+			return
+		}
+	}
+	return
+}
+
+func (t *redisLimiter) AddBlacklist(member string, expire time.Time) (err error) {
+	var c redis.Conn
+	if c, err = t.conn(); err != nil {
+		return
+	}
+	defer c.Close()
+
+	// the expired members are removed meanwhile
+	_ = c.Send("MULTI")
+	_ = c.Send("ZREMRANGEBYSCORE", rateLimitBlacklistKey, "-inf", GetNowInMS())
+	_ = c.Send("ZADD", rateLimitBlacklistKey, expire.UnixNano()/int64(time.Millisecond), member)
+	_, err = c.Do("EXEC")
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
+
+func (t *redisLimiter) ResetBlacklist(members map[string]time.Time) (err error) {
+	var c redis.Conn
+	if c, err = t.conn(); err != nil {
+		return
+	}
+	defer c.Close()
+
+	_ = c.Send("MULTI")
+	_ = c.Send("DEL", rateLimitBlacklistKey)
+	if len(members) > 0 {
+		args := redis.Args{}.Add(rateLimitBlacklistKey)
+		for k, v := range members {
+			args = args.Add(v.UnixNano()/int64(time.Millisecond), k)
+		}
+		_ = c.Send("ZADD", args...)
+	}
+	_, err = c.Do("EXEC")
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
+
+//---------------------------------------------------------------------------------
+//memoryLimiter LimiterBackend in the process, for single instance and test
+
+//memoryLimiterSweep sweep the idle buckets while there are more buckets than it
+const memoryLimiterSweep = 10000
+
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+
+	// the bucket is full after it
+	full time.Time
+}
+
+type memoryViolation struct {
+	n      int64
+	expire time.Time
+}
+
+type memoryLimiter struct {
+	sync.Mutex
+	buckets    map[string]*memoryBucket
+	violations map[string]*memoryViolation
+	blacklist  map[string]time.Time // member: expire
+
+	//now the clock, replaced in test
+	now func() time.Time
+}
+
+//NewMemoryLimiter return LimiterBackend keeping the state in the process
+func NewMemoryLimiter() LimiterBackend {
+	return &memoryLimiter{
+		buckets:    make(map[string]*memoryBucket),
+		violations: make(map[string]*memoryViolation),
+		blacklist:  make(map[string]time.Time),
+		now:        time.Now,
+	}
+}
+
+func (t *memoryLimiter) Take(key string, rate float64, burst int) (bool, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+	if len(t.buckets) > memoryLimiterSweep {
+		for k, v := range t.buckets {
+			if now.After(v.full) {
+				delete(t.buckets, k)
+			}
+		}
+	}
+
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(burst), ts: now}
+		t.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.ts).Seconds()*rate)
+	b.ts = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+	return allowed, nil
+}
+
+func (t *memoryLimiter) Violate(key string, window time.Duration) (int64, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+	if len(t.violations) > memoryLimiterSweep {
+		for k, v := range t.violations {
+			if now.After(v.expire) {
+				delete(t.violations, k)
+			}
+		}
+	}
+
+	v, ok := t.violations[key]
+	if !ok || now.After(v.expire) {
+		v = &memoryViolation{expire: now.Add(window)}
+		t.violations[key] = v
+	}
+	v.n++
+	return v.n, nil
+}
+
+func (t *memoryLimiter) Blacklisted(members ...string) (bool, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+	for _, v := range members {
+		expire, ok := t.blacklist[v]
+		if !ok {
+			continue
+		}
+		if now.Before(expire) {
+			return true, nil
+		}
+		delete(t.blacklist, v)
+	}
+	return false, nil
+}
+
+func (t *memoryLimiter) AddBlacklist(member string, expire time.Time) error {
+	t.Lock()
+	defer t.Unlock()
+
+	t.blacklist[member] = expire
+	return nil
+}
+
+func (t *memoryLimiter) ResetBlacklist(members map[string]time.Time) error {
+	t.Lock()
+	defer t.Unlock()
+
+	t.blacklist = make(map[string]time.Time)
+	for k, v := range members {
+		t.blacklist[k] = v
+	}
+	return nil
+}
+
+//---------------------------------------------------------------------------------
+//address of the requester
+
+var trustedProxies struct {
+	sync.Mutex
+	loaded bool
+	nets   []*net.IPNet
+}
+
+//SetTrustedProxies replace the trusted proxies, ip or cidr, default webServe.trustedProxies
+func SetTrustedProxies(list []string) (err error) {
+	var nets []*net.IPNet
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		var n *net.IPNet
+		_, n, err = net.ParseCIDR(v)
+		if err != nil {
+			err = fmt.Errorf("invalid trusted proxy %s: %s", v, err.Error())
+			z.Error(err.Error())
+			return
+		}
+		nets = append(nets, n)
+	}
+
+	trustedProxies.Lock()
+	defer trustedProxies.Unlock()
+	trustedProxies.nets, trustedProxies.loaded = nets, true
+	return
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	trustedProxies.Lock()
+	loaded := trustedProxies.loaded
+	trustedProxies.Unlock()
+	if !loaded {
+		if err := SetTrustedProxies(viper.GetStringSlice("webServe.trustedProxies")); err != nil {
+			_ = SetTrustedProxies(nil)
+		}
+	}
+
+	trustedProxies.Lock()
+	defer trustedProxies.Unlock()
+	for _, n := range trustedProxies.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/*peerAddr the ip of the requester, X-Forwarded-For and X-Real-Ip are used only if RemoteAddr
+is a trusted proxy, then the rightmost address in X-Forwarded-For not a trusted proxy is the
+requester, the client can't spoof it since each trusted proxy appends its peer */
+func peerAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !isTrustedProxy(ip) {
+		return host
+	}
+
+	addresses := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(addresses[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+//PeerAddr the ip of the requester, the forwarding headers are used only if they're set by a trusted proxy
+func PeerAddr(r *http.Request) string {
+	return peerAddr(r)
+}
+
+/*ForwardedByUntrustedProxy report whether r carries the forwarding headers but RemoteAddr isn't
+a trusted proxy, the requester of r is unknown then, it may be anyone behind the proxy */
+func ForwardedByUntrustedProxy(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") == "" && r.Header.Get("X-Real-Ip") == "" && r.Header.Get("Forwarded") == "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || !isTrustedProxy(ip)
+}
@@ -0,0 +1,186 @@
+package cmn
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+//newTestLimiter memoryLimiter with the clock moved by the returned advance
+func newTestLimiter() (t *memoryLimiter, advance func(d time.Duration)) {
+	now := time.Unix(1650000000, 0)
+	t = NewMemoryLimiter().(*memoryLimiter)
+	t.now = func() time.Time { return now }
+	advance = func(d time.Duration) { now = now.Add(d) }
+	return
+}
+
+func TestMemoryLimiterTake(t *testing.T) {
+	type step struct {
+		after time.Duration // the clock advanced before take
+		want  bool
+	}
+	cases := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{"burst then empty", 1, 3, []step{{0, true}, {0, true}, {0, true}, {0, false}}},
+		{"refill one token per second", 1, 2, []step{
+			{0, true}, {0, true}, {0, false},
+			{time.Second, true}, {0, false},
+			{500 * time.Millisecond, false}, {500 * time.Millisecond, true},
+		}},
+		{"refill up to burst only", 10, 2, []step{
+			{0, true}, {0, true}, {0, false},
+			{time.Hour, true}, {0, true}, {0, false},
+		}},
+		{"rate below one per second", 0.5, 1, []step{
+			{0, true}, {time.Second, false}, {time.Second, true},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l, advance := newTestLimiter()
+			for i, s := range c.steps {
+				advance(s.after)
+				got, err := l.Take("api:ip:10.0.0.1", c.rate, c.burst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != s.want {
+					t.Fatalf("step %d: take = %v, want %v", i, got, s.want)
+				}
+			}
+
+			// the buckets are separated by key
+			if ok, _ := l.Take("api:ip:10.0.0.2", c.rate, c.burst); !ok {
+				t.Fatal("the bucket of another key should be full")
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterViolate(t *testing.T) {
+	l, advance := newTestLimiter()
+	cases := []struct {
+		after time.Duration
+		want  int64
+	}{
+		{0, 1},
+		{time.Second, 2},
+		{time.Second, 3},
+		{time.Minute, 1}, // the window is over
+		{0, 2},
+	}
+	for i, c := range cases {
+		advance(c.after)
+		n, err := l.Violate("api:ip:10.0.0.1", 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != c.want {
+			t.Fatalf("step %d: violations = %d, want %d", i, n, c.want)
+		}
+	}
+}
+
+func TestMemoryLimiterBlacklist(t *testing.T) {
+	l, advance := newTestLimiter()
+	start := l.now()
+
+	if err := l.AddBlacklist("ip:10.0.0.1", start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AddBlacklist("phone:13800000000", start.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		after   time.Duration
+		members []string
+		want    bool
+	}{
+		{0, []string{"ip:10.0.0.1"}, true},
+		{0, []string{"ip:10.0.0.2"}, false},
+		{0, []string{"ip:10.0.0.2", "phone:13800000000"}, true},
+		{59 * time.Minute, []string{"ip:10.0.0.1"}, true},
+		{time.Minute, []string{"ip:10.0.0.1"}, false}, // expired
+		{0, []string{"phone:13800000000"}, true},
+		{time.Hour, []string{"phone:13800000000"}, false},
+	}
+	for i, c := range cases {
+		advance(c.after)
+		got, err := l.Blacklisted(c.members...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Fatalf("step %d: blacklisted(%v) = %v, want %v", i, c.members, got, c.want)
+		}
+	}
+
+	// reset replaces the members and their expire time
+	now := l.now()
+	err := l.ResetBlacklist(map[string]time.Time{
+		"user:1": now.Add(time.Minute),
+		"user:2": now.Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for member, want := range map[string]bool{"user:1": true, "user:2": false, "ip:10.0.0.1": false} {
+		if got, _ := l.Blacklisted(member); got != want {
+			t.Fatalf("blacklisted(%s) = %v, want %v after reset", member, got, want)
+		}
+	}
+}
+
+func TestPeerAddr(t *testing.T) {
+	if err := SetTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		trustedProxies.Lock()
+		trustedProxies.loaded, trustedProxies.nets = false, nil
+		trustedProxies.Unlock()
+	}()
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"direct", "203.0.113.5:4321", "", "", "203.0.113.5"},
+		{"untrusted peer spoofing", "203.0.113.5:4321", "198.51.100.7", "198.51.100.8", "203.0.113.5"},
+		{"trusted proxy", "127.0.0.1:4321", "198.51.100.7", "", "198.51.100.7"},
+		{"client prepends a fake address", "127.0.0.1:4321", "1.2.3.4, 198.51.100.7", "", "198.51.100.7"},
+		{"chain of trusted proxies", "127.0.0.1:4321", "198.51.100.7, 10.1.2.3", "", "198.51.100.7"},
+		{"real ip of trusted proxy", "10.0.0.2:80", "", "198.51.100.9", "198.51.100.9"},
+		{"trusted proxy without header", "10.0.0.2:80", "", "", "10.0.0.2"},
+		{"ipv6 peer", "[2001:db8::1]:443", "198.51.100.7", "", "2001:db8::1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/api/login", nil)
+			r.RemoteAddr = c.remoteAddr
+			if c.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", c.forwarded)
+			}
+			if c.realIP != "" {
+				r.Header.Set("X-Real-Ip", c.realIP)
+			}
+			if got := peerAddr(r); got != c.want {
+				t.Fatalf("peerAddr = %s, want %s", got, c.want)
+			}
+		})
+	}
+
+	if err := SetTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatal("invalid trusted proxy should be rejected")
+	}
+}
@@ -0,0 +1,278 @@
+package cmn
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Relation foreign key relation from Table.Column to RefTable.RefColumn
+type Relation struct {
+	//Name, expand name used by ReqProto.Expand, default to the json name of Column
+	//  without the ID suffix, for example Org for org_id, CreatorRef for creator
+	Name string
+
+	Table  string
+	Column string
+
+	RefTable  string
+	RefColumn string
+}
+
+//SensitiveColumns table.column never returned by ReqProto.Expand nor recorded by the audit trail
+var SensitiveColumns = map[string]bool{
+	"t_user.user_token":             true,
+	"t_external_domain_conf.tokens": true,
+}
+
+//tableMaps factory of TableMap struct by table name, registered by the generated models
+var tableMaps = make(map[string]func() interface{})
+
+/*registerTableMap called by init of the generated models with the relations of the table, see tmpl/struct.tmpl,
+the relations are added at the first call of TableRelations, when the referenced tables have been registered */
+func registerTableMap(fn func() interface{}, list ...Relation) {
+	p, ok := fn().(interface{ GetTableName() string })
+	if !ok {
+		z.Error(fmt.Sprintf("%T is not a TableMap", fn()))
+		return
+	}
+	tblName := p.GetTableName()
+	tableMaps[tblName] = fn
+
+	for _, r := range list {
+		r.Table = tblName
+		relations.generated = append(relations.generated, r)
+	}
+}
+
+/*refRelation the relation of column declared by the column comment marker ref:table.column, for example
+	comment on column t_order.creator is 'ref:t_user.id 创建者';
+the text after the first white space is ignored, the referenced column is id if it's omitted, the view
+t_v_xxx is referenced as v_xxx, the name returned by it's GetTableName */
+func refRelation(column, ref string) (r Relation) {
+	r.Column = column
+	if f := strings.Fields(ref); len(f) > 0 {
+		ref = f[0]
+	}
+	r.RefTable, r.RefColumn = ref, "id"
+	if i := strings.LastIndex(ref, "."); i >= 0 {
+		r.RefTable, r.RefColumn = ref[:i], ref[i+1:]
+	}
+	return
+}
+
+var relations struct {
+	sync.RWMutex
+	byTable map[string][]*Relation
+
+	// relations of the generated models, added once
+	generated    []Relation
+	addGenerated sync.Once
+}
+
+//dbColumnOf return the struct field of t with db column name
+func dbColumnOf(t reflect.Type, column string) (f reflect.StructField, found bool) {
+	for i := 0; i < t.NumField(); i++ {
+		s, ok := t.Field(i).Tag.Lookup("db")
+		if !ok || s == "" {
+			continue
+		}
+		if strings.EqualFold(strings.Split(s, ",")[0], column) {
+			return t.Field(i), true
+		}
+	}
+	return
+}
+
+//jsonName return the json name of the field
+func jsonName(f reflect.StructField) string {
+	s, ok := f.Tag.Lookup("json")
+	if !ok || s == "" || strings.Split(s, ",")[0] == "" {
+		return f.Name
+	}
+	return strings.Split(s, ",")[0]
+}
+
+//tableMapType return the struct type of the table
+func tableMapType(tblName string) (t reflect.Type, found bool) {
+	fn, found := tableMaps[tblName]
+	if !found {
+		return
+	}
+	t = reflect.TypeOf(fn()).Elem()
+	return
+}
+
+//AddRelation declare relation that isn't generated from the column comments, it has priority over the generated ones
+func AddRelation(r Relation) (err error) {
+	t, ok := tableMapType(r.Table)
+	if !ok {
+		err = fmt.Errorf("unknown table %s of relation", r.Table)
+		z.Error(err.Error())
+		return
+	}
+	f, ok := dbColumnOf(t, r.Column)
+	if !ok {
+		err = fmt.Errorf("unknown column %s on %s", r.Column, r.Table)
+		z.Error(err.Error())
+		return
+	}
+
+	refT, ok := tableMapType(r.RefTable)
+	if !ok {
+		err = fmt.Errorf("unknown table %s of relation", r.RefTable)
+		z.Error(err.Error())
+		return
+	}
+	if _, ok = dbColumnOf(refT, r.RefColumn); !ok {
+		err = fmt.Errorf("unknown column %s on %s", r.RefColumn, r.RefTable)
+		z.Error(err.Error())
+		return
+	}
+
+	if r.Name == "" {
+		n := jsonName(f)
+		r.Name = strings.TrimSuffix(n, "ID")
+		if r.Name == n || r.Name == "" {
+			r.Name = n + "Ref"
+		}
+	}
+
+	// the expanded object is placed beside the fields of the row
+	for i := 0; i < t.NumField(); i++ {
+		if strings.EqualFold(jsonName(t.Field(i)), r.Name) {
+			err = fmt.Errorf("relation name %s conflicts with field on %s", r.Name, r.Table)
+			z.Error(err.Error())
+			return
+		}
+	}
+
+	relations.Lock()
+	defer relations.Unlock()
+	if relations.byTable == nil {
+		relations.byTable = make(map[string][]*Relation)
+	}
+	for _, v := range relations.byTable[r.Table] {
+		if strings.EqualFold(v.Name, r.Name) {
+			err = fmt.Errorf("duplicated relation %s on %s", r.Name, r.Table)
+			z.Error(err.Error())
+			return
+		}
+	}
+	relations.byTable[r.Table] = append(relations.byTable[r.Table], &r)
+	return
+}
+
+/*LoadRelations add the single column foreign key constraints of current schema as relations,
+the relations should be generated from the column comments, see refRelation, it's for the database
+without the comments, and should be called after connected to the dbms */
+func LoadRelations() (err error) {
+	if sqlxDB == nil {
+		err = fmt.Errorf("please connect to dbms")
+		z.Error(err.Error())
+		return
+	}
+
+	s := `select cl.relname as table_name, a.attname as column_name,
+			rcl.relname as ref_table, ra.attname as ref_column
+		from pg_constraint c
+			join pg_class cl on cl.oid = c.conrelid
+			join pg_namespace n on n.oid = cl.relnamespace
+			join pg_class rcl on rcl.oid = c.confrelid
+			join pg_attribute a on a.attrelid = c.conrelid and a.attnum = c.conkey[1]
+			join pg_attribute ra on ra.attrelid = c.confrelid and ra.attnum = c.confkey[1]
+		where c.contype = 'f' and array_length(c.conkey, 1) = 1
+			and n.nspname = current_schema()
+		order by cl.relname, a.attname`
+
+	// the relations of the generated models have priority
+	addGeneratedRelations()
+
+	var list []struct {
+		TableName string `db:"table_name"`
+		Column    string `db:"column_name"`
+		RefTable  string `db:"ref_table"`
+		RefColumn string `db:"ref_column"`
+	}
+	err = sqlxDB.Select(&list, s)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	for _, v := range list {
+		if _, ok := tableMaps[v.TableName]; !ok {
+			continue
+		}
+		if _, ok := tableMaps[v.RefTable]; !ok {
+			continue
+		}
+		// relation declared by AddRelation has priority
+		if findRelationByColumn(v.TableName, v.Column) != nil {
+			continue
+		}
+		_ = AddRelation(Relation{Table: v.TableName, Column: v.Column,
+			RefTable: v.RefTable, RefColumn: v.RefColumn})
+	}
+	return
+}
+
+func findRelationByColumn(tblName, column string) *Relation {
+	relations.RLock()
+	defer relations.RUnlock()
+	for _, v := range relations.byTable[tblName] {
+		if strings.EqualFold(v.Column, column) {
+			return v
+		}
+	}
+	return nil
+}
+
+//addGeneratedRelations add the relations of the generated models, the ones declared by AddRelation have priority
+func addGeneratedRelations() {
+	relations.addGenerated.Do(func() {
+		for _, r := range relations.generated {
+			if findRelationByColumn(r.Table, r.Column) != nil {
+				continue
+			}
+			_ = AddRelation(r)
+		}
+	})
+}
+
+//TableRelations return relations of the table, the ones of the generated models are added at the first call
+func TableRelations(tblName string) (list []Relation) {
+	addGeneratedRelations()
+
+	relations.RLock()
+	defer relations.RUnlock()
+	for _, v := range relations.byTable[tblName] {
+		list = append(list, *v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return
+}
+
+//findRelation find relation of the table by name or the json name of its column
+func findRelation(tblName, name string) (r *Relation, found bool) {
+	list := TableRelations(tblName)
+	for i := range list {
+		if strings.EqualFold(list[i].Name, name) {
+			return &list[i], true
+		}
+	}
+
+	t, ok := tableMapType(tblName)
+	if !ok {
+		return
+	}
+	for i := range list {
+		f, _ := dbColumnOf(t, list[i].Column)
+		if strings.EqualFold(jsonName(f), name) {
+			return &list[i], true
+		}
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package cmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+/*route constraints of ServeEndPoint
+
+	Methods:   允许的请求方法, 例如 []string{"GET", "POST"}, 空表示不限制;
+	           其它方法由路由直接以 HTTP 405 及 Allow 头回复, 不会调用 Fn
+	Path:      可包含命名参数, 例如 /api/order/{id} 或 /api/order/{id:[0-9]+},
+	           参数值在 ServiceCtx.PathParams 中, 例如 q.PathParams["id"] */
+
+//CMethodNotAllowed the request method isn't in ServeEndPoint.Methods
+const CMethodNotAllowed = -40501
+
+//rPathParam named parameter in path, {name} or {name:pattern}
+var rPathParam = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(?::([^{}]+))?\}`)
+
+//pathRegexp convert the path with named parameters to regular expression
+func pathRegexp(path string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range rPathParam.FindAllStringSubmatchIndex(path, -1) {
+		b.WriteString(regexp.QuoteMeta(path[last:m[0]]))
+		pattern := `[^/]+`
+		if m[4] >= 0 {
+			pattern = path[m[4]:m[5]]
+		}
+		fmt.Fprintf(&b, `(?P<%s>%s)`, path[m[2]:m[3]], pattern)
+		last = m[1]
+	}
+	b.WriteString(regexp.QuoteMeta(path[last:]))
+	return b.String()
+}
+
+//normalizeMethods upper case the methods, error on the unknown one
+func normalizeMethods(methods []string) (err error) {
+	for i, v := range methods {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		switch v {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		default:
+			err = fmt.Errorf("unknown method: %s", methods[i])
+			return
+		}
+		methods[i] = v
+	}
+	return
+}
+
+//MethodNotAllowed reply HTTP 405 with Allow header, used by router for the request method out of methods
+func MethodNotAllowed(methods []string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		msg := &ReplyProto{
+			Status: CMethodNotAllowed,
+			Msg:    fmt.Sprintf("method %s isn't allowed on %s, allow: %s", r.Method, r.URL.Path, allow),
+			API:    r.URL.Path,
+			Method: r.Method,
+		}
+		z.Warn(msg.Msg)
+
+		buf, err := json.Marshal(msg)
+		if err != nil {
+			z.Error(err.Error())
+			return
+		}
+		w.Header().Set("Allow", allow)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write(buf)
+	}
+}
@@ -0,0 +1,79 @@
+package cmn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestPathRegexp(t *testing.T) {
+	cases := []struct {
+		path    string
+		url     string
+		matched bool
+		params  map[string]string
+	}{
+		{"/api/order", "/api/order", true, map[string]string{}},
+		{"/api/order.json", "/api/orderXjson", false, nil},
+		{"/api/order/{id}", "/api/order/12", true, map[string]string{"id": "12"}},
+		{"/api/order/{id}", "/api/order/12/items", false, nil},
+		{"/api/order/{id:[0-9]+}", "/api/order/abc", false, nil},
+		{"/api/order/{id:[0-9]+}/item/{sn}", "/api/order/12/item/a-1", true,
+			map[string]string{"id": "12", "sn": "a-1"}},
+	}
+	for _, c := range cases {
+		r := regexp.MustCompile("^" + pathRegexp(c.path) + "$")
+		m := r.FindStringSubmatch(c.url)
+		if (m != nil) != c.matched {
+			t.Errorf("%s on %s: matched = %v, want %v", c.url, c.path, m != nil, c.matched)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+		params := map[string]string{}
+		for i, name := range r.SubexpNames() {
+			if name != "" {
+				params[name] = m[i]
+			}
+		}
+		if !reflect.DeepEqual(params, c.params) {
+			t.Errorf("%s on %s: params = %v, want %v", c.url, c.path, params, c.params)
+		}
+	}
+}
+
+func TestNormalizeMethods(t *testing.T) {
+	methods := []string{"get", " Post ", "DELETE"}
+	if err := normalizeMethods(methods); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"GET", "POST", "DELETE"}; !reflect.DeepEqual(methods, want) {
+		t.Fatalf("methods = %v, want %v", methods, want)
+	}
+	if err := normalizeMethods([]string{"GET", "FETCH"}); err == nil {
+		t.Fatal("unknown method should be rejected")
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	MethodNotAllowed([]string{"GET", "POST"})(w, httptest.NewRequest(http.MethodDelete, "/api/order/1", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("code = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, POST" {
+		t.Fatalf("Allow = %s", allow)
+	}
+	var msg ReplyProto
+	if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Status != CMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", msg.Status, CMethodNotAllowed)
+	}
+}
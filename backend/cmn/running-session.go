@@ -0,0 +1,148 @@
+package cmn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*running sessions, the /api requests being processed
+
+	reqProc 以 TrackSession 登记请求并得到由 http.Request.Context 派生的可取消 ctx, 客户端断开时同样被取消,
+		认证后以 SetSessionUser 记录用户;
+	CancelSession 取消 ctx, 使用该 ctx 的 DML/LockKey 等随即返回 context.Canceled,
+	进行中的数据库查询由驱动中止, 事务回滚 */
+
+//RunningSession a request being processed
+type RunningSession struct {
+	ID         int64  `json:"id"`
+	Api        string `json:"api"`
+	Method     string `json:"method"`
+	BeginTime  int64  `json:"beginTime"` // in millisecond
+	RemoteAddr string `json:"remoteAddr"`
+	RequestID  string `json:"requestID,omitempty"`
+
+	UserID   int64  `json:"userID,omitempty"`
+	UserName string `json:"userName,omitempty"`
+
+	//Duration in millisecond till now, filled by ListRunningSessions
+	Duration int64 `json:"duration"`
+
+	//Canceled CancelSession has been called on it
+	Canceled bool `json:"canceled,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+type sessionKey struct{}
+
+var runningSessions struct {
+	sync.Mutex
+	seq int64
+	m   map[int64]*RunningSession
+}
+
+//TrackSession register r as a running session, return the cancelable ctx and done to unregister it
+func TrackSession(ctx context.Context, r *http.Request, requestID string) (_ context.Context, done func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	runningSessions.Lock()
+	if runningSessions.m == nil {
+		runningSessions.m = make(map[int64]*RunningSession)
+	}
+	runningSessions.seq++
+	s := &RunningSession{
+		ID:         runningSessions.seq,
+		Api:        r.URL.Path,
+		Method:     r.Method,
+		BeginTime:  GetNowInMS(),
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  requestID,
+		cancel:     cancel,
+	}
+	runningSessions.m[s.ID] = s
+	runningSessions.Unlock()
+
+	done = func() {
+		runningSessions.Lock()
+		delete(runningSessions.m, s.ID)
+		runningSessions.Unlock()
+		cancel()
+	}
+	return context.WithValue(ctx, sessionKey{}, s.ID), done
+}
+
+//SetSessionUser record the authenticated user of the session in ctx
+func SetSessionUser(ctx context.Context) {
+	id, ok := ctx.Value(sessionKey{}).(int64)
+	if !ok {
+		return
+	}
+	q := serviceCtxOf(ctx)
+	if q == nil || q.SysUser == nil || !q.SysUser.ID.Valid {
+		return
+	}
+
+	runningSessions.Lock()
+	defer runningSessions.Unlock()
+	if s, ok := runningSessions.m[id]; ok {
+		s.UserID = q.SysUser.ID.Int64
+		s.UserName = q.SysUser.Account.String
+	}
+}
+
+//RunningSessionCount count of the running sessions
+func RunningSessionCount() int {
+	runningSessions.Lock()
+	defer runningSessions.Unlock()
+	return len(runningSessions.m)
+}
+
+//ListRunningSessions the sessions running longer than minDuration, the longest first
+func ListRunningSessions(minDuration time.Duration) (list []RunningSession) {
+	now := GetNowInMS()
+
+	runningSessions.Lock()
+	for _, v := range runningSessions.m {
+		s := *v
+		s.Duration = now - s.BeginTime
+		if s.Duration < minDuration.Milliseconds() {
+			continue
+		}
+		s.cancel = nil
+		list = append(list, s)
+	}
+	runningSessions.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].BeginTime != list[j].BeginTime {
+			return list[i].BeginTime < list[j].BeginTime
+		}
+		return list[i].ID < list[j].ID
+	})
+	return
+}
+
+//CancelSession cancel the context of the running session id
+func CancelSession(id int64) (err error) {
+	runningSessions.Lock()
+	s, ok := runningSessions.m[id]
+	if ok {
+		s.Canceled = true
+	}
+	runningSessions.Unlock()
+
+	if !ok {
+		err = fmt.Errorf("running session %d not found", id)
+		z.Warn(err.Error())
+		return
+	}
+
+	z.Warn(fmt.Sprintf("cancel running session %d: %s %s from %s, user %d",
+		s.ID, s.Method, s.Api, s.RemoteAddr, s.UserID))
+	s.cancel()
+	return
+}
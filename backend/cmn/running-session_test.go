@@ -0,0 +1,73 @@
+package cmn
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"w2w.io/null"
+)
+
+func TestTrackSession(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/order", nil)
+	parent, disconnect := context.WithCancel(context.Background())
+	defer disconnect()
+
+	ctx, done := TrackSession(parent, r, "req-1")
+	q := &ServiceCtx{SysUser: &TUser{ID: null.IntFrom(7), Account: null.StringFrom("alice")}}
+	SetSessionUser(context.WithValue(ctx, QNearKey, q))
+
+	var s *RunningSession
+	for _, v := range ListRunningSessions(0) {
+		if v.RequestID == "req-1" {
+			s = &v
+		}
+	}
+	if s == nil {
+		t.Fatal("the session isn't listed")
+	}
+	if s.Api != "/api/order" || s.Method != "POST" || s.UserID != 7 || s.UserName != "alice" {
+		t.Fatalf("session %+v", s)
+	}
+	if len(ListRunningSessions(time.Hour)) != 0 {
+		t.Fatal("the session running shorter than minDuration is listed")
+	}
+
+	if err := CancelSession(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("ctx isn't canceled by CancelSession")
+	}
+	for _, v := range ListRunningSessions(0) {
+		if v.ID == s.ID && !v.Canceled {
+			t.Fatal("the session should be marked canceled")
+		}
+	}
+
+	n := RunningSessionCount()
+	done()
+	if RunningSessionCount() != n-1 {
+		t.Fatal("the session isn't unregistered by done")
+	}
+	if err := CancelSession(s.ID); err == nil {
+		t.Fatal("cancel the finished session should fail")
+	}
+}
+
+// TestTrackSessionDisconnect the session is canceled with the parent ctx, the request of the disconnected client
+func TestTrackSessionDisconnect(t *testing.T) {
+	parent, disconnect := context.WithCancel(context.Background())
+	ctx, done := TrackSession(parent, httptest.NewRequest("GET", "/api/report", nil), "req-2")
+	defer done()
+
+	disconnect()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx isn't canceled with its parent")
+	}
+}
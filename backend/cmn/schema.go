@@ -0,0 +1,729 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx/types"
+	"w2w.io/null"
+)
+
+/*request schema, validate ReqProto.Data of POST/PUT/PATCH before calling ServeEndPoint.Fn
+
+	ServeEndPoint.Schema:     JSON Schema of ReqProto.Data
+	ServeEndPoint.SchemaType: 未指定 Schema 时由该结构的 json/schema tag 生成, 例如
+		type planReq struct {
+			Name  string      `json:"Name" schema:"required,minLength=1,maxLength=64"`
+			Phone null.String `json:"Phone,omitempty" schema:"format=mobile"`
+			Age   int64       `json:"Age" schema:"minimum=0,maximum=120"`
+			Kind  string      `json:"Kind" schema:"enum=a|b|c"`
+		}
+
+	请求为 application/json 时整个 body 为 ReqProto, 至多 webServe.maxJSONBody MB(缺省 10), 否则取表单/URL 参数 q;
+	不符合时应答 status 为 CInvalidRequest, data 为 [{"field":"Contact[0].Phone","msg":"..."}]
+
+	支持的关键字: type, properties, required, additionalProperties, items, enum,
+	minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern,
+	minItems, maxItems, format(date-time, date, email, mobile) */
+
+//CInvalidRequest the request data violates ServeEndPoint.Schema
+const CInvalidRequest = -40001
+
+//defaultMaxJSONBody default of webServe.maxJSONBody, in MB
+const defaultMaxJSONBody = 10
+
+//FieldError a field violating the schema, replied in ReplyProto.Data as a list
+type FieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"msg"`
+}
+
+type jsonSchema struct {
+	Type                 interface{}            `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Format    string `json:"format,omitempty"`
+
+	MinItems *int `json:"minItems,omitempty"`
+	MaxItems *int `json:"maxItems,omitempty"`
+
+	// compiled by prepare
+	types        []string
+	pattern      *regexp.Regexp
+	additional   *jsonSchema
+	noAdditional bool
+}
+
+var schemaFormats = map[string]*regexp.Regexp{
+	"email":  regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`),
+	"mobile": regexp.MustCompile(`^1[3-9][0-9]{9}$`),
+}
+
+//compileSchema parse JSON Schema
+func compileSchema(buf []byte) (s *jsonSchema, err error) {
+	s = &jsonSchema{}
+	err = json.Unmarshal(buf, s)
+	if err != nil {
+		err = fmt.Errorf("invalid schema: %s", err.Error())
+		return
+	}
+	err = s.prepare()
+	return
+}
+
+func (s *jsonSchema) prepare() (err error) {
+	switch t := s.Type.(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				err = fmt.Errorf("invalid schema type: %v", s.Type)
+				return
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		err = fmt.Errorf("invalid schema type: %v", s.Type)
+		return
+	}
+	for _, v := range s.types {
+		switch v {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			err = fmt.Errorf("unknown schema type: %s", v)
+			return
+		}
+	}
+
+	if s.Pattern != "" {
+		s.pattern, err = regexp.Compile(s.Pattern)
+		if err != nil {
+			return
+		}
+	}
+
+	switch a := strings.TrimSpace(string(s.AdditionalProperties)); {
+	case a == "" || a == "true":
+	case a == "false":
+		s.noAdditional = true
+	default:
+		s.additional = &jsonSchema{}
+		if err = json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+			return
+		}
+		if err = s.additional.prepare(); err != nil {
+			return
+		}
+	}
+
+	for _, v := range s.Properties {
+		if err = v.prepare(); err != nil {
+			return
+		}
+	}
+	if s.Items != nil {
+		err = s.Items.prepare()
+	}
+	return
+}
+
+//jsonType type name of v decoded with UseNumber, integer for the whole number
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func joinField(base, name string) string {
+	if base == "" {
+		return name
+	}
+	return base + "." + name
+}
+
+//validate append the violations of v to errs, field is the path of v
+func (s *jsonSchema) validate(field string, v interface{}, errs *[]FieldError) {
+	fail := func(format string, a ...interface{}) {
+		f := field
+		if f == "" {
+			f = "data"
+		}
+		*errs = append(*errs, FieldError{Field: f, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	t := jsonType(v)
+	if len(s.types) > 0 {
+		matched := false
+		for _, k := range s.types {
+			if k == t || (k == "number" && t == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(s.types, " or "), t)
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		buf, _ := json.Marshal(v)
+		found := false
+		for _, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			if bytes.Equal(buf, b) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b, _ := json.Marshal(s.Enum)
+			fail("should be one of %s", string(b))
+		}
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("should be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("should be <= %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+			fail("should be > %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+			fail("should be < %v", *s.ExclusiveMaximum)
+		}
+
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			if *s.MinLength == 1 {
+				fail("should not be empty")
+			} else {
+				fail("length should be >= %d", *s.MinLength)
+			}
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("length should be <= %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("should match %s", s.Pattern)
+		}
+		if !validFormat(s.Format, v) {
+			fail("should be %s", s.Format)
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("should have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("should have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, e := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", field, i), e, errs)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, k := range s.Required {
+			if _, ok := v[k]; !ok {
+				*errs = append(*errs, FieldError{Field: joinField(field, k), Msg: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				p.validate(joinField(field, k), v[k], errs)
+				continue
+			}
+			if s.noAdditional {
+				*errs = append(*errs, FieldError{Field: joinField(field, k), Msg: "is not allowed"})
+				continue
+			}
+			if s.additional != nil {
+				s.additional.validate(joinField(field, k), v[k], errs)
+			}
+		}
+	}
+}
+
+//validFormat unknown format is ignored
+func validFormat(format, v string) bool {
+	switch format {
+	case "":
+		return true
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil
+	}
+	if r, ok := schemaFormats[format]; ok {
+		return r.MatchString(v)
+	}
+	return true
+}
+
+//Validate validate the JSON document buf against the schema
+func (s *jsonSchema) Validate(buf []byte) (errs []FieldError, err error) {
+	var v interface{}
+	if len(bytes.TrimSpace(buf)) > 0 {
+		d := json.NewDecoder(bytes.NewReader(buf))
+		d.UseNumber()
+		if err = d.Decode(&v); err != nil {
+			return
+		}
+	}
+	s.validate("", v, &errs)
+	return
+}
+
+//---------------------------------------------------------------------------------
+// schema generated from struct
+
+//hasType whether name is in the Type of the generated schema
+func (s *jsonSchema) hasType(name string) bool {
+	switch t := s.Type.(type) {
+	case string:
+		return t == name
+	case []string:
+		for _, v := range t {
+			if v == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	typeNullString = reflect.TypeOf(null.String{})
+	typeNullInt    = reflect.TypeOf(null.Int{})
+	typeNullFloat  = reflect.TypeOf(null.Float{})
+	typeNullBool   = reflect.TypeOf(null.Bool{})
+	typeNullTime   = reflect.TypeOf(null.Time{})
+	typeQNearTime  = reflect.TypeOf(null.QNearTime{})
+	typeTime       = reflect.TypeOf(time.Time{})
+	typeJSONText   = reflect.TypeOf(types.JSONText{})
+	typeRawMessage = reflect.TypeOf(json.RawMessage{})
+)
+
+/*SchemaOf JSON Schema of the struct v(or pointer to struct) by its json and schema tags,
+schema tag is comma separated: required, minLength=n, maxLength=n, minimum=n, maximum=n,
+pattern=re, enum=a|b|c, format=name, minItems=n, maxItems=n */
+func SchemaOf(v interface{}) (buf json.RawMessage, err error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		err = fmt.Errorf("SchemaOf requires struct, got %T", v)
+		z.Error(err.Error())
+		return
+	}
+
+	var s *jsonSchema
+	s, err = schemaOfType(t, map[reflect.Type]bool{})
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	buf, err = json.Marshal(s)
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
+
+func schemaOfType(t reflect.Type, seen map[reflect.Type]bool) (s *jsonSchema, err error) {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	s = &jsonSchema{}
+	typ := func(names ...string) {
+		if nullable {
+			names = append(names, "null")
+		}
+		if len(names) == 1 {
+			s.Type = names[0]
+			return
+		}
+		s.Type = names
+	}
+
+	switch t {
+	case typeNullString:
+		s.Type = []string{"string", "null"}
+		return
+	case typeNullInt:
+		// null.Int accepts number string too
+		s.Type = []string{"integer", "string", "null"}
+		s.Pattern = `^-?[0-9]+$`
+		return
+	case typeNullFloat:
+		s.Type = []string{"number", "string", "null"}
+		return
+	case typeNullBool:
+		s.Type = []string{"boolean", "null"}
+		return
+	case typeNullTime, typeQNearTime:
+		s.Type = []string{"string", "null"}
+		s.Format = "date-time"
+		return
+	case typeTime:
+		typ("string")
+		s.Format = "date-time"
+		return
+	case typeJSONText, typeRawMessage:
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		typ("boolean")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		typ("integer")
+	case reflect.Float32, reflect.Float64:
+		typ("number")
+	case reflect.String:
+		typ("string")
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			typ("string")
+			break
+		}
+		typ("array")
+		s.Items, err = schemaOfType(t.Elem(), seen)
+	case reflect.Map:
+		typ("object")
+		if t.Key().Kind() == reflect.String {
+			var e *jsonSchema
+			e, err = schemaOfType(t.Elem(), seen)
+			if err == nil && e.Type != nil {
+				s.AdditionalProperties, err = json.Marshal(e)
+			}
+		}
+	case reflect.Struct:
+		typ("object")
+		if seen[t] {
+			// recursive type, leave the nested one unchecked
+			break
+		}
+		seen[t] = true
+		err = structProperties(s, t, seen)
+		delete(seen, t)
+	case reflect.Interface:
+	default:
+		err = fmt.Errorf("unsupported type %s in schema", t.String())
+	}
+	return
+}
+
+//structProperties add the fields of struct t to s.Properties, the anonymous struct is flattened
+func structProperties(s *jsonSchema, t reflect.Type, seen map[reflect.Type]bool) (err error) {
+	if s.Properties == nil {
+		s.Properties = make(map[string]*jsonSchema)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err = structProperties(s, ft, seen); err != nil {
+					return
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		var p *jsonSchema
+		p, err = schemaOfType(f.Type, seen)
+		if err != nil {
+			return
+		}
+		var required bool
+		required, err = applySchemaTag(p, f.Tag.Get("schema"))
+		if err != nil {
+			err = fmt.Errorf("%s.%s: %s", t.Name(), f.Name, err.Error())
+			return
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = p
+	}
+	return
+}
+
+//rSchemaTagKey start of an item in schema tag, the other segments belong to the previous item, e.g. pattern=^[0-9]{1,3}$
+var rSchemaTagKey = regexp.MustCompile(`^(required|[a-zA-Z]+=)`)
+
+//applySchemaTag set the keywords of schema tag to s
+func applySchemaTag(s *jsonSchema, tag string) (required bool, err error) {
+	if tag == "" {
+		return
+	}
+
+	var items []string
+	for _, v := range strings.Split(tag, ",") {
+		if len(items) > 0 && !rSchemaTagKey.MatchString(v) {
+			items[len(items)-1] += "," + v
+			continue
+		}
+		items = append(items, v)
+	}
+
+	for _, item := range items {
+		if item == "required" {
+			required = true
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			err = fmt.Errorf("invalid schema tag item: %s", item)
+			return
+		}
+
+		key, value := kv[0], kv[1]
+		switch key {
+		case "minLength", "maxLength", "minItems", "maxItems":
+			var n int
+			n, err = strconv.Atoi(value)
+			if err != nil {
+				return
+			}
+			switch key {
+			case "minLength":
+				s.MinLength = &n
+			case "maxLength":
+				s.MaxLength = &n
+			case "minItems":
+				s.MinItems = &n
+			case "maxItems":
+				s.MaxItems = &n
+			}
+
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			var f float64
+			f, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				return
+			}
+			switch key {
+			case "minimum":
+				s.Minimum = &f
+			case "maximum":
+				s.Maximum = &f
+			case "exclusiveMinimum":
+				s.ExclusiveMinimum = &f
+			case "exclusiveMaximum":
+				s.ExclusiveMaximum = &f
+			}
+
+		case "pattern":
+			if _, err = regexp.Compile(value); err != nil {
+				return
+			}
+			s.Pattern = value
+
+		case "format":
+			s.Format = value
+
+		case "enum":
+			numeric := s.hasType("integer") || s.hasType("number")
+			for _, e := range strings.Split(value, "|") {
+				var ev interface{} = e
+				if numeric {
+					if ev, err = strconv.ParseFloat(e, 64); err != nil {
+						return
+					}
+				}
+				s.Enum = append(s.Enum, ev)
+			}
+
+		default:
+			err = fmt.Errorf("unknown schema tag key: %s", key)
+			return
+		}
+	}
+	return
+}
+
+//---------------------------------------------------------------------------------
+
+//prepareSchema compile ep.Schema or the schema generated from ep.SchemaType, called by AddService
+func (ep *ServeEndPoint) prepareSchema() (err error) {
+	if len(ep.Schema) == 0 && ep.SchemaType != nil {
+		ep.Schema, err = SchemaOf(ep.SchemaType)
+		if err != nil {
+			return
+		}
+	}
+	if len(ep.Schema) == 0 {
+		return
+	}
+	ep.schema, err = compileSchema(ep.Schema)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", ep.Name, err.Error())
+	}
+	return
+}
+
+//reqBody the ReqProto of request, the body is restored for Fn, the json body is limited to webServe.maxJSONBody
+func reqBody(w http.ResponseWriter, r *http.Request) (buf []byte, err error) {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/json" {
+		buf = []byte(r.FormValue("q"))
+		return
+	}
+
+	if r.Body == nil {
+		return
+	}
+	limit := int64(viperIntOr("webServe.maxJSONBody", defaultMaxJSONBody)) * 1024 * 1024
+	if limit <= 0 {
+		limit = defaultMaxJSONBody * 1024 * 1024
+	}
+	body := r.Body
+	buf, err = io.ReadAll(http.MaxBytesReader(w, body, limit))
+	_ = body.Close()
+	if err != nil {
+		err = fmt.Errorf("read request body failed, it should be at most %d bytes: %s", limit, err.Error())
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(buf))
+	return
+}
+
+//ValidateReq validate ReqProto.Data of POST/PUT/PATCH against the schema of q.Ep, reply the field errors on failure
+func ValidateReq(ctx context.Context) {
+	zr := LoggerOf(ctx)
+	q := GetCtxValue(ctx)
+	if q.Ep == nil || q.Ep.schema == nil {
+		return
+	}
+	switch q.R.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return
+	}
+
+	var buf []byte
+	buf, q.Err = reqBody(q.W, q.R)
+	if q.Err != nil {
+		zr.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+
+	var req struct {
+		Data json.RawMessage `json:"data"`
+	}
+	var errs []FieldError
+	if len(bytes.TrimSpace(buf)) == 0 {
+		errs = append(errs, FieldError{Field: "q", Msg: "is required"})
+	} else if err := json.Unmarshal(buf, &req); err != nil {
+		errs = append(errs, FieldError{Field: "q", Msg: err.Error()})
+	} else {
+		errs, err = q.Ep.schema.Validate(req.Data)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "data", Msg: err.Error()})
+		}
+	}
+	if len(errs) == 0 {
+		return
+	}
+
+	q.Msg.Status = CInvalidRequest
+	q.Msg.Data, q.Err = json.Marshal(errs)
+	if q.Err != nil {
+		zr.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+	msg := errs[0].Field + ": " + errs[0].Msg
+	if len(errs) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(errs)-1)
+	}
+	q.Err = errors.New(msg)
+	zr.Warn(q.Err.Error())
+	q.RespErr()
+}
@@ -0,0 +1,134 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"w2w.io/null"
+)
+
+type schemaTestContact struct {
+	Name  string      `json:"Name" schema:"required,minLength=1,maxLength=8"`
+	Phone null.String `json:"Phone,omitempty" schema:"format=mobile"`
+}
+
+type schemaTestReq struct {
+	Name     string              `json:"Name" schema:"required,minLength=1,maxLength=64"`
+	Age      int64               `json:"Age" schema:"minimum=0,maximum=120"`
+	Kind     string              `json:"Kind" schema:"enum=a|b|c"`
+	Contacts []schemaTestContact `json:"Contacts,omitempty"`
+}
+
+//fieldsOf the fields of errs
+func fieldsOf(errs []FieldError) (fields []string) {
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	return
+}
+
+func TestSchemaValidate(t *testing.T) {
+	buf, err := SchemaOf(schemaTestReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := compileSchema(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		data   string
+		fields []string
+	}{
+		{"valid", `{"Name":"x","Age":3,"Kind":"a","Contacts":[{"Name":"y","Phone":"13800000000"}]}`, nil},
+		{"missing required", `{"Age":3}`, []string{"Name"}},
+		{"empty string", `{"Name":""}`, []string{"Name"}},
+		{"out of range", `{"Name":"x","Age":121}`, []string{"Age"}},
+		{"wrong type", `{"Name":"x","Age":"3"}`, []string{"Age"}},
+		{"not in enum", `{"Name":"x","Kind":"d"}`, []string{"Kind"}},
+		{"nested", `{"Name":"x","Contacts":[{"Name":"y"},{"Phone":"123"}]}`,
+			[]string{"Contacts[1].Name", "Contacts[1].Phone"}},
+		{"not an object", `[]`, []string{"data"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs, err := s.Validate([]byte(c.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fieldsOf(errs); !reflect.DeepEqual(got, c.fields) {
+				t.Fatalf("fields = %v, want %v: %v", got, c.fields, errs)
+			}
+		})
+	}
+}
+
+func TestValidateReq(t *testing.T) {
+	ep := &ServeEndPoint{Name: "test", SchemaType: schemaTestReq{}}
+	if err := ep.prepareSchema(); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set("webServe.maxJSONBody", 1)
+	defer viper.Set("webServe.maxJSONBody", defaultMaxJSONBody)
+
+	cases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		fails  bool
+	}{
+		{"valid", http.MethodPost, `{"action":"insert","data":{"Name":"x"}}`, 0, false},
+		{"invalid data", http.MethodPut, `{"action":"update","data":{"Age":-1}}`, CInvalidRequest, true},
+		{"empty body", http.MethodPost, ``, CInvalidRequest, true},
+		{"malformed", http.MethodPost, `{"data":`, CInvalidRequest, true},
+		{"not validated", http.MethodGet, `{"data":{}}`, 0, false},
+		{"too large", http.MethodPost, `{"data":{"Name":"` + strings.Repeat("x", 1024*1024) + `"}}`, -1, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(c.method, "/api/test", strings.NewReader(c.body))
+			r.Header.Set("Content-Type", "application/json")
+			q := &ServiceCtx{
+				Ep:  ep,
+				R:   r,
+				W:   httptest.NewRecorder(),
+				Msg: &ReplyProto{API: "/api/test", Method: c.method},
+			}
+			ValidateReq(context.WithValue(context.Background(), QNearKey, q))
+
+			if (q.Err != nil) != c.fails {
+				t.Fatalf("err = %v, fails %v", q.Err, c.fails)
+			}
+			if q.Msg.Status != c.status {
+				t.Fatalf("status = %d, want %d", q.Msg.Status, c.status)
+			}
+			if c.status == CInvalidRequest {
+				var errs []FieldError
+				if err := json.Unmarshal(q.Msg.Data, &errs); err != nil || len(errs) == 0 {
+					t.Fatalf("the field errors should be replied: %s", q.Msg.Data)
+				}
+			}
+			if c.fails || c.method == http.MethodGet {
+				return
+			}
+
+			// the body is restored for Fn
+			buf, _ := io.ReadAll(q.R.Body)
+			if !bytes.Equal(buf, []byte(c.body)) {
+				t.Fatalf("body = %s, want %s", buf, c.body)
+			}
+		})
+	}
+}
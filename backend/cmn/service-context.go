@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx/types"
 	"github.com/spf13/viper"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"go.uber.org/zap"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -125,6 +128,15 @@ type ServiceCtx struct {
 	RoutineID int
 	BeginTime time.Time
 
+	//RequestID X-Request-ID of the request, attached to the log lines and returned in response header
+	RequestID string
+
+	//Log the logger of the request created by RequestLogger, use Logger() or LoggerOf(ctx)
+	Log *zap.Logger
+
+	//PathParams named parameters in ServeEndPoint.Path, e.g. id of /api/order/{id}
+	PathParams map[string]string
+
 	Tag map[string]interface{}
 
 	//用户访问系统所使用的角色
@@ -134,9 +146,17 @@ type ServiceCtx struct {
 	ReqFnType int
 }
 
+//Logger the logger of the request, z if it isn't set
+func (v *ServiceCtx) Logger() *zap.Logger {
+	if v.Log != nil {
+		return v.Log
+	}
+	return z
+}
+
 func (v *ServiceCtx) RespErr() {
 	if v.Responded {
-		z.Error("responded")
+		v.Logger().Error("responded")
 		return
 	}
 
@@ -158,6 +178,12 @@ func (v *ServiceCtx) RespErr() {
 		}
 	}
 
+	var conflict *ConflictError
+	if errors.As(v.Err, &conflict) {
+		v.Msg.Status = CDMLConflict
+		v.Msg.Data = types.JSONText(conflict.Current)
+	}
+
 	v.Msg.Msg = v.Err.Error()
 	if v.Msg.Status >= 0 {
 		v.Msg.Status = -1
@@ -171,7 +197,7 @@ func (v *ServiceCtx) RespErr() {
 
 	buf, err := json.Marshal(v.Msg)
 	if err != nil {
-		z.Error(err.Error())
+		v.Logger().Error(err.Error())
 		_, _ = fmt.Fprintf(v.W, err.Error())
 		return
 	}
@@ -181,10 +207,11 @@ func (v *ServiceCtx) RespErr() {
 		trial := fmt.Sprintf(`{"trial":%s}`, string(v.Msg.Data))
 		t := make(map[string]interface{})
 
-		v.Err = json.Unmarshal([]byte(trial), &t)
-		if v.Err != nil {
-			z.Error(trial)
-			z.Error(v.Err.Error())
+		// v.Err is kept for the caller checking it after RespErr
+		if err = json.Unmarshal([]byte(trial), &t); err != nil {
+			v.Err = err
+			v.Logger().Error(trial)
+			v.Logger().Error(v.Err.Error())
 			v.RespErr()
 			return
 		}
@@ -197,7 +224,7 @@ func (v *ServiceCtx) RespErr() {
 
 func (v *ServiceCtx) Resp() {
 	if v.Responded {
-		z.Error("responded")
+		v.Logger().Error("responded")
 		return
 	}
 
@@ -218,7 +245,7 @@ func (v *ServiceCtx) Resp() {
 
 	buf, err := json.Marshal(v.Msg)
 	if err != nil {
-		z.Error(err.Error())
+		v.Logger().Error(err.Error())
 		_, _ = fmt.Fprintf(v.W, err.Error())
 		return
 	}
@@ -231,8 +258,8 @@ func (v *ServiceCtx) Resp() {
 		v.Err = json.Unmarshal([]byte(trial), &t)
 		if v.Err != nil {
 			v.Msg.Data = nil
-			z.Error(trial)
-			z.Error(v.Err.Error())
+			v.Logger().Error(trial)
+			v.Logger().Error(v.Err.Error())
 			v.RespErr()
 			return
 		}
@@ -271,15 +298,16 @@ func GetCtxValue(ctx context.Context) (q *ServiceCtx) {
 }
 
 func CleanSession(ctx context.Context) {
+	zr := LoggerOf(ctx)
 	q := GetCtxValue(ctx)
 	userID, _ := q.Session.Values["ID"].(int64)
 	if userID <= 0 {
 		q.Err = fmt.Errorf("invalid session")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		return
 	}
 	defer func() {
-		z.Warn(fmt.Sprintf("%d 's session has been cleaned", userID))
+		zr.Warn(fmt.Sprintf("%d 's session has been cleaned", userID))
 	}()
 
 	q.Session.Options.MaxAge = -1
@@ -289,13 +317,13 @@ func CleanSession(ctx context.Context) {
 
 	q.Err = q.Session.Save(q.R, q.W)
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		return
 	}
 
 	q.Err = CleanCacheByUserID(userID)
 	if q.Err != nil {
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 	}
 	if strings.ToLower(q.R.URL.Query().Get("erase")) == "true" {
 		q.Err = EraseUser(userID)
@@ -487,7 +515,7 @@ func AddService(ep *ServeEndPoint) (err error) {
 		}
 
 		if ep.PathPattern == "" {
-			ep.PathPattern = fmt.Sprintf(`(?i)^%s(/.*)?$`, ep.Path)
+			ep.PathPattern = fmt.Sprintf(`(?i)^%s(/.*)?$`, pathRegexp(ep.Path))
 		}
 		ep.PathMatcher = regexp.MustCompile(ep.PathPattern)
 
@@ -500,6 +528,13 @@ func AddService(ep *ServeEndPoint) (err error) {
 			if ep.Fn == nil {
 				ep.Fn = WebFS
 			}
+
+			if ep.AssetPattern != "" {
+				ep.assetMatcher, err = regexp.Compile(ep.AssetPattern)
+				if err != nil {
+					break
+				}
+			}
 		} else {
 			if ep.Fn == nil {
 				err = errors.New("must specify fn when ep.isFileServe equal false")
@@ -526,6 +561,20 @@ func AddService(ep *ServeEndPoint) (err error) {
 		if ep.AccessControlLevel == "" {
 			ep.AccessControlLevel = "0"
 		}
+
+		if err = normalizeMethods(ep.Methods); err != nil {
+			break
+		}
+
+		if ep.RateLimit != nil {
+			if err = ep.RateLimit.check(); err != nil {
+				break
+			}
+		}
+
+		if err = ep.prepareSchema(); err != nil {
+			break
+		}
 		_, ok := Services[ep.Path]
 		if ok {
 			err = errors.New(fmt.Sprintf("%s[%s] already exists", ep.Path, ep.Name))
@@ -602,28 +651,29 @@ var rWebFilePattern = regexp.MustCompile(webFilePattern)
 2 if we can not find the target and the q.Ep.PageRoute is true then return the guessed index.html,
 3 else return 404 not found */
 func WebFS(ctx context.Context) {
+	zr := LoggerOf(ctx)
 	q := GetCtxValue(ctx)
 	q.Responded = true
 	q.Stop = true
-	z.Info("---->" + FncName())
+	zr.Info("---->" + FncName())
 
 	if q.Ep == nil {
 		q.Err = fmt.Errorf("call jsFS with nil q.Ep")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 
 	if q.Ep.DocRoot == "" {
 		q.Err = fmt.Errorf("call jsFS with empty q.Ep.docRoot")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
 
 	if len(q.R.URL.Path) < len(q.Ep.Path) {
 		q.Err = fmt.Errorf("len(q.R.URL.Path) < len(q.Ep.path), it shouldn't happen")
-		z.Error(q.Err.Error())
+		zr.Error(q.Err.Error())
 		q.RespErr()
 		return
 	}
@@ -652,7 +702,7 @@ func WebFS(ctx context.Context) {
 
 	fileInfo, err := os.Stat(targetFileName)
 	if os.IsNotExist(err) {
-		z.Warn("InExistence: " + targetFileName)
+		zr.Warn("InExistence: " + targetFileName)
 
 		if rWebFilePattern.Match([]byte(f)) || !q.Ep.PageRoute {
 			// missing the request specific file or non page route app.
@@ -673,7 +723,7 @@ func WebFS(ctx context.Context) {
 
 			if err != nil {
 				q.Err = err
-				z.Error(err.Error())
+				zr.Error(err.Error())
 				q.Responded = false
 				q.RespErr()
 				return
@@ -697,5 +747,77 @@ func WebFS(ctx context.Context) {
 		}
 	}
 
+	if fi, err := os.Stat(targetFileName); err == nil {
+		setCacheControl(q.W, q.Ep, targetFileName, fi)
+		if servePrecompressed(q.W, q.R, targetFileName, fi) {
+			return
+		}
+		setETag(q.W, targetFileName, fi)
+	}
 	http.ServeFile(q.W, q.R, targetFileName)
 }
+
+//EncodingNegotiator implemented by the compressing ResponseWriter of service,
+// return the best of offers accepted by the client, "" if none
+type EncodingNegotiator interface {
+	NegotiateEncoding(offers ...string) string
+}
+
+//precompressed siblings of the static file, e.g. app.js.br, in preference order
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"zstd", ".zst"},
+	{"gzip", ".gz"},
+}
+
+/*servePrecompressed serve the sibling of name compressed by the encoding accepted by the
+client, the sibling older than name is ignored, return false if nothing is served */
+func servePrecompressed(w http.ResponseWriter, r *http.Request, name string, fi os.FileInfo) bool {
+	n, ok := w.(EncodingNegotiator)
+	if !ok || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	// the compressed content can't be sniffed
+	ct := mime.TypeByExtension(filepath.Ext(name))
+	if ct == "" {
+		return false
+	}
+
+	var offers []string
+	siblings := make(map[string]string)
+	for _, v := range precompressed {
+		s, err := os.Stat(name + v.ext)
+		if err != nil || !s.Mode().IsRegular() || s.ModTime().Before(fi.ModTime()) {
+			continue
+		}
+		offers = append(offers, v.encoding)
+		siblings[v.encoding] = name + v.ext
+	}
+	encoding := n.NegotiateEncoding(offers...)
+	if encoding == "" {
+		return false
+	}
+
+	sibling := siblings[encoding]
+	f, err := os.Open(sibling)
+	if err != nil {
+		z.Error(err.Error())
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Encoding", encoding)
+	if s, err := f.Stat(); err == nil {
+		// the ETag of the compressed representation
+		setETag(w, sibling, s)
+	}
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+	return true
+}
@@ -2,6 +2,7 @@ package cmn
 
 import (
 	"context"
+	"encoding/json"
 	"regexp"
 )
 
@@ -9,9 +10,12 @@ import (
 type ServeEndPoint struct {
 	Developer *ModuleAuthor `json:"developer"`
 
-	//Path required, the service url must be unique
+	//Path required, the service url must be unique, may contain named parameters like /api/order/{id}
 	Path string `json:"path,omitempty"`
 
+	//Methods allowed request methods, empty for any, the others are replied with HTTP 405
+	Methods []string `json:"methods,omitempty"`
+
 	//Fn process function
 	Fn func(context.Context) `json:"fn,omitempty"`
 
@@ -34,6 +38,18 @@ type ServeEndPoint struct {
 	//DocRoot static html file service root directory
 	DocRoot string `json:"doc_root,omitempty"`
 
+	//CacheControl of the files in DocRoot, default is no-cache, index.html is never cached
+	CacheControl string `json:"cache_control,omitempty"`
+
+	//AssetCacheControl of the hashed assets in DocRoot, e.g. app.3f2a9c1d.js,
+	// default is public, max-age=31536000, immutable
+	AssetCacheControl string `json:"asset_cache_control,omitempty"`
+
+	//AssetPattern regexp of the hashed asset file name, see cmn/web-cache.go for default
+	AssetPattern string `json:"asset_pattern,omitempty"`
+
+	assetMatcher *regexp.Regexp
+
 	//PageRoute 是否支持前端页面路由，即angular/vue/svelte等的前端路由,如果
 	//  支持: 如果请求的路径未发现则返回路径及上级路径包含的index.html,
 	// 			例如，请求的是 /a/b/c/d,如果没有发现d或d/index.html，则
@@ -63,4 +79,19 @@ type ServeEndPoint struct {
 
 	//该功能默认属于的域(业务域/子系统/客户)
 	DefaultDomain int64 `json:"default_domain,omitempty"`
+
+	//Streaming long-lived response, e.g. server-sent events, not serialized with
+	//  the other requests of the same user when SerializationReq is true
+	Streaming bool `json:"streaming,omitempty"`
+
+	//RateLimit 令牌桶限流, nil 表示不限流
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+
+	//Schema JSON Schema of ReqProto.Data, checked by reqProc before calling Fn, see cmn/schema.go
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	//SchemaType generate Schema from the tags of the struct if Schema is empty, e.g. TInsuranceTypes{}
+	SchemaType interface{} `json:"-"`
+
+	schema *jsonSchema
 }
@@ -0,0 +1,81 @@
+package cmn
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+/*graceful shutdown
+
+	cmd.Cleanup 收到 SIGTERM/SIGINT 等信号(或调用 Terminate)后调用 Shutdown:
+		0. 结束 TailLog 的订阅
+		1. 按注册的逆序调用 OnShutdown 注册的函数, 例如 WebServe 停止接受新连接并等待处理中的请求结束
+		2. 输出缓存的 span, 将 DbLoggerAdaptor 中缓存的日志写入 postgresql/bbolt
+		3. UtilCleanup 关闭 boltdb, sqlx, redis, pgx
+
+	webServe.shutdownTimeout: 等待处理中请求结束的最长秒数, 缺省 30 */
+
+//defaultShutdownTimeout default of webServe.shutdownTimeout
+const defaultShutdownTimeout = 30 * time.Second
+
+var shutdownHooks struct {
+	sync.Mutex
+	fn []func(ctx context.Context)
+}
+
+var shutdownOnce sync.Once
+
+//OnShutdown register fn called by Shutdown, fn should return before ctx is done
+func OnShutdown(fn func(ctx context.Context)) {
+	if fn == nil {
+		return
+	}
+
+	shutdownHooks.Lock()
+	defer shutdownHooks.Unlock()
+	shutdownHooks.fn = append(shutdownHooks.fn, fn)
+}
+
+func shutdownTimeout() time.Duration {
+	if !viper.IsSet("webServe.shutdownTimeout") {
+		return defaultShutdownTimeout
+	}
+	d := time.Duration(viper.GetInt("webServe.shutdownTimeout")) * time.Second
+	if d <= 0 {
+		d = defaultShutdownTimeout
+	}
+	return d
+}
+
+//Shutdown stop the services registered by OnShutdown, flush the log then close the connection pools,
+//  only the first call takes effect
+func Shutdown() {
+	shutdownOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+
+		shutdownHooks.Lock()
+		hooks := make([]func(ctx context.Context), len(shutdownHooks.fn))
+		copy(hooks, shutdownHooks.fn)
+		shutdownHooks.Unlock()
+
+		// the live tails never end by themselves
+		closeLogTails()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i](ctx)
+		}
+
+		flushTrace(ctx)
+
+		// the log is flushed to postgresql before pgxConn closed
+		if z != nil {
+			_ = z.Sync()
+		}
+
+		UtilCleanup()
+	})
+}
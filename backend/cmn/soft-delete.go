@@ -0,0 +1,184 @@
+package cmn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+/*soft delete of DML, driven by the softDelete tag generated by tmpl/struct.tmpl
+
+	`db:"deleted,false,boolean" softDelete:"true"`:           deleted = true 表示已删除
+	`db:"status,false,character varying" softDelete:"99,0"`: status = '99' 表示已删除,
+		删除前的 status 保存在 addi->'softDeleted' 中用于恢复, 没有 addi 列时恢复为 '0'
+
+	deleted 列生成 softDelete:"true"; 列注释以 softDelete:删除值,恢复值 开头时生成 softDelete:"删除值,恢复值 注释",
+	tag 中空白之后的注释被忽略, 例如
+		comment on column t_order.status is 'softDelete:99,0 0: 未支付, 2: 已支付，4: 已生成保单, 6: 已作废';
+
+	DELETE:  将数据标记为已删除
+	RESTORE: 恢复已删除的数据
+	SELECT:  不返回已删除的数据, 除非 req.IncludeDeleted 为 true */
+
+//softDeleteKey key in addi saving the status before deleted
+const softDeleteKey = "softDeleted"
+
+//softDeleteMeta soft delete column of a TableMap struct
+type softDeleteMeta struct {
+	column       string
+	deletedValue interface{}
+	restoreValue interface{}
+
+	// the table has addi jsonb column to save the status before deleted
+	hasAddi bool
+}
+
+//softDeleteOf return the soft delete metadata of objT, nil if it hasn't softDelete tag
+func softDeleteOf(objT reflect.Type) *softDeleteMeta {
+	for i := 0; i < objT.NumField(); i++ {
+		f := objT.Field(i)
+		tag, ok := f.Tag.Lookup("softDelete")
+		if !ok || tag == "" {
+			continue
+		}
+		s, ok := f.Tag.Lookup("db")
+		if !ok || strings.Split(s, ",")[0] == "" {
+			continue
+		}
+
+		m := &softDeleteMeta{column: strings.Split(s, ",")[0]}
+		a := strings.Split(strings.Fields(tag)[0], ",")
+		if a[0] == "true" {
+			m.deletedValue, m.restoreValue = true, false
+			return m
+		}
+
+		m.deletedValue = a[0]
+		if len(a) > 1 {
+			m.restoreValue = a[1]
+		}
+		if c, found := dbColumnOf(objT, "addi"); found && strings.HasSuffix(c.Tag.Get("db"), ",jsonb") {
+			m.hasAddi = true
+		}
+		return m
+	}
+	return nil
+}
+
+//operatorID return the ID of the requester, nil if ctx isn't a request context
+func operatorID(ctx context.Context) interface{} {
+	q := serviceCtxOf(ctx)
+	if q == nil || q.SysUser == nil || !q.SysUser.ID.Valid {
+		return nil
+	}
+	return q.SysUser.ID.Int64
+}
+
+//excludeDeleted return condition excluding the deleted rows, the parameter is $beginPos+1
+func (m *softDeleteMeta) excludeDeleted(beginPos int) (cond string, value interface{}) {
+	return fmt.Sprintf("%s IS DISTINCT FROM $%d", m.column, beginPos+1), m.deletedValue
+}
+
+//softDeleteSQL build UPDATE that mark/unmark the rows of expr as deleted, values are appended to f.Values
+func (r *Filter) softDeleteSQL(m *softDeleteMeta, tblName, expr, action string, userID interface{}) string {
+	p := func(v interface{}) string {
+		r.Values = append(r.Values, v)
+		return fmt.Sprintf("$%d", len(r.Values))
+	}
+
+	var sets []string
+	var cond string
+	switch {
+	case action == "DELETE":
+		deleted := p(m.deletedValue)
+		sets = append(sets, fmt.Sprintf("%s=%s", m.column, deleted))
+		if m.hasAddi {
+			// the value of the column in SET is the one before updated
+			sets = append(sets, fmt.Sprintf(
+				"addi=jsonb_set(coalesce(addi,'{}'::jsonb),'{%s}',jsonb_build_object('%s',%s,'time',%s::bigint,'by',%s::bigint))",
+				softDeleteKey, m.column, m.column, p(GetNowInMS()), p(userID)))
+		}
+		cond = fmt.Sprintf("%s IS DISTINCT FROM %s", m.column, deleted)
+
+	case m.hasAddi:
+		deleted := p(m.deletedValue)
+		sets = append(sets,
+			fmt.Sprintf("%s=coalesce(addi->'%s'->>'%s',%s)", m.column, softDeleteKey, m.column, p(m.restoreValue)),
+			fmt.Sprintf("addi=addi-'%s'", softDeleteKey))
+		cond = fmt.Sprintf("%s = %s", m.column, deleted)
+
+	default:
+		cond = fmt.Sprintf("%s = %s", m.column, p(m.deletedValue))
+		sets = append(sets, fmt.Sprintf("%s=%s", m.column, p(m.restoreValue)))
+	}
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE (%s) and %s", tblName, strings.Join(sets, ","), expr, cond)
+}
+
+//softDelete execute DELETE/RESTORE on table with soft delete column, f.QryResult is the count of rows affected
+func (r *Filter) softDelete(req *ReqProto, m *softDeleteMeta, tblName, action string,
+	userID interface{}, audit *auditTrail) (err error) {
+	zr := LoggerOf(r.ctx)
+
+	var expr string
+	expr, err = r.CreateFilter(req)
+	if err != nil {
+		return
+	}
+	if expr == "" {
+		err = fmt.Errorf("%s on %s requires filter", strings.ToLower(action), tblName)
+		zr.Error(err.Error())
+		return
+	}
+	if r.AuthExpr != "" {
+		expr = fmt.Sprintf("(%s) and (%s)", expr, r.AuthExpr)
+		r.Values = append(r.Values, r.AuthWhereValues...)
+	}
+
+	s := r.softDeleteSQL(m, tblName, expr, action, userID)
+	if audit != nil {
+		err = audit.captureBefore(r, req)
+		if err != nil {
+			return
+		}
+		s = s + " RETURNING " + audit.returning()
+	}
+	zr.Info(s)
+	zr.Info(fmt.Sprintf("%v", r.Values))
+
+	var stmt *sqlx.Stmt
+	var release func()
+	stmt, release, err = acquireStmt(s)
+	if err != nil {
+		return
+	}
+	defer release()
+	stmt = audit.bind(stmt)
+
+	var d int64
+	if audit != nil {
+		d, err = audit.query(stmt, r.Values, false)
+		if err != nil {
+			return
+		}
+	} else {
+		var result sql.Result
+		result, err = stmt.ExecContext(r.dbCtx(), r.Values...)
+		if err != nil {
+			zr.Error(err.Error())
+			return
+		}
+		if d, err = result.RowsAffected(); err != nil {
+			zr.Error(err.Error())
+			return
+		}
+	}
+
+	r.QryResult = d
+	zr.Info(fmt.Sprintf("%s %d rows of %s", strings.ToLower(action), d, tblName))
+	return
+}
@@ -0,0 +1,126 @@
+package cmn
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/jmoiron/sqlx/types"
+	"w2w.io/null"
+)
+
+type tmplColumn struct {
+	Name         string
+	IsPrimaryKey bool
+	DataType     string
+}
+
+type tmplField struct {
+	Name    string
+	Type    string
+	Comment string
+	Column  tmplColumn
+}
+
+//execStructTmpl generate the model of table t_order with fields by tmpl/struct.tmpl
+func execStructTmpl(t *testing.T, fields []tmplField) string {
+	stub := func(interface{}) string { return "" }
+	funcs := template.FuncMap{}
+	for _, name := range []string{"createInsertParams", "createInsertSQL", "createInsertScan",
+		"createSelectByPkFuncParams", "createSelectByPkSQL", "createSelectByPkSQLParams", "createSelectByPkScan"} {
+		funcs[name] = stub
+	}
+	tpl, err := template.New("struct.tmpl").Funcs(funcs).ParseFiles("../tmpl/struct.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]interface{}{
+		"Struct": map[string]interface{}{
+			"Name":    "TOrder",
+			"Comment": "订单",
+			"Table":   map[string]interface{}{"Schema": "public", "Name": "t_order", "AutoGenPk": true},
+			"Fields":  fields,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+//TestStructTmplSoftDelete the softDelete tag generated by tmpl/struct.tmpl from the column name and comment
+func TestStructTmplSoftDelete(t *testing.T) {
+	fields := []tmplField{
+		{"ID", "null.Int", "编号", tmplColumn{"id", true, "bigint"}},
+		{"Status", "null.String", "softDelete:99,0 0: 未支付, 2: \"已支付\"", tmplColumn{"status", false, "character varying"}},
+		{"Deleted", "null.Bool", "是否已删除", tmplColumn{"deleted", false, "boolean"}},
+		{"Remark", "null.String", "softDelete", tmplColumn{"remark", false, "character varying"}},
+	}
+	lines := map[string]string{}
+	for _, line := range strings.Split(execStructTmpl(t, fields), "\n") {
+		for _, f := range fields {
+			if strings.HasPrefix(strings.TrimSpace(line), f.Name+" ") {
+				lines[f.Name] = line
+			}
+		}
+	}
+
+	want := map[string]string{
+		"ID":      "",
+		"Status":  `softDelete:"99,0 0: 未支付, 2: \"已支付\""`,
+		"Deleted": `softDelete:"true"`,
+		"Remark":  "",
+	}
+	for name, tag := range want {
+		line, ok := lines[name]
+		if !ok {
+			t.Fatalf("field %s isn't generated", name)
+		}
+		if tag == "" && strings.Contains(line, "softDelete:\"") {
+			t.Errorf("%s shouldn't be soft deleted: %s", name, line)
+		}
+		if tag != "" && !strings.Contains(line, tag) {
+			t.Errorf("%s should have %s: %s", name, tag, line)
+		}
+	}
+}
+
+func TestSoftDeleteOf(t *testing.T) {
+	type byStatus struct {
+		ID     null.Int       `db:"id,true,bigint"`
+		Status null.String    `db:"status,false,character varying" softDelete:"99,0 0: 未支付, 2: 已支付"`
+		Addi   types.JSONText `db:"addi,false,jsonb"`
+	}
+	type byStatusNoAddi struct {
+		Status null.String `db:"status,false,character varying" softDelete:"99"`
+	}
+	type byDeleted struct {
+		Deleted null.Bool `db:"deleted,false,boolean" softDelete:"true"`
+	}
+	type plain struct {
+		Status null.String `db:"status,false,character varying"`
+	}
+
+	cases := []struct {
+		name string
+		typ  reflect.Type
+		want *softDeleteMeta
+	}{
+		{"status with comment", reflect.TypeOf(byStatus{}), &softDeleteMeta{"status", "99", "0", true}},
+		{"status without addi", reflect.TypeOf(byStatusNoAddi{}), &softDeleteMeta{"status", "99", nil, false}},
+		{"deleted", reflect.TypeOf(byDeleted{}), &softDeleteMeta{"deleted", true, false, false}},
+		{"none", reflect.TypeOf(plain{}), nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := softDeleteOf(c.typ); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("softDeleteOf = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
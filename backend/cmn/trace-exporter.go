@@ -0,0 +1,282 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+/*span exporter, spans are batched and encoded as OTLP/JSON (ExportTraceServiceRequest)
+
+	zLogger.trace.exporter: none(缺省) 不输出
+		stdout: 每批 span 输出为 stdout 中的一行
+		file:   每批 span 追加为 zLogger.trace.file 中的一行, 缺省为日志目录下的 trace.json
+		otlp:   POST 到 OpenTelemetry collector 的 zLogger.trace.endpoint, 例如 http://127.0.0.1:4318/v1/traces */
+
+// batch of the span exporter
+const (
+	traceQueueSize     = 4096
+	traceBatchSize     = 512
+	traceFlushInterval = 5 * time.Second
+)
+
+//traceServiceName service.name of the resource
+const traceServiceName = "w2w.io"
+
+var tracer struct {
+	once sync.Once
+
+	queue  chan *Span
+	flush  chan chan struct{}
+	export func(buf []byte) error
+
+	dropped int64
+}
+
+//startTracer create the exporter by zLogger.trace, the queue is nil if no exporter configured
+func startTracer() {
+	var w io.Writer
+	switch exporter := viper.GetString("zLogger.trace.exporter"); exporter {
+	case "", "none":
+		return
+
+	case "stdout":
+		w = os.Stdout
+
+	case "file":
+		fn := viper.GetString("zLogger.trace.file")
+		if fn == "" {
+			fn = filepath.Join(filepath.Dir(dstLogFile), "trace.json")
+		}
+		fd, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			z.Error("open " + fn + " failed by " + err.Error())
+			return
+		}
+		w = fd
+
+	case "otlp":
+		endpoint := viper.GetString("zLogger.trace.endpoint")
+		if endpoint == "" {
+			z.Error("zLogger.trace.endpoint is empty while zLogger.trace.exporter is otlp")
+			return
+		}
+		client := &http.Client{Timeout: 10 * time.Second}
+		tracer.export = func(buf []byte) error {
+			resp, err := client.Post(endpoint, "application/json", bytes.NewReader(buf))
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			_, _ = io.Copy(io.Discard, resp.Body)
+			if resp.StatusCode/100 != 2 {
+				return fmt.Errorf("export spans to %s: %s", endpoint, resp.Status)
+			}
+			return nil
+		}
+
+	default:
+		z.Error(fmt.Sprintf("unknown zLogger.trace.exporter: %s", exporter))
+		return
+	}
+
+	if w != nil {
+		var mutex sync.Mutex
+		tracer.export = func(buf []byte) (err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			_, err = w.Write(append(buf, '\n'))
+			return
+		}
+	}
+
+	tracer.queue = make(chan *Span, traceQueueSize)
+	tracer.flush = make(chan chan struct{})
+	go exportLoop()
+}
+
+//exportSpan queue s for export, s is dropped if the queue is full
+func exportSpan(s *Span) {
+	tracer.once.Do(startTracer)
+	if tracer.queue == nil {
+		return
+	}
+
+	select {
+	case tracer.queue <- s:
+	default:
+		atomic.AddInt64(&tracer.dropped, 1)
+	}
+}
+
+func exportLoop() {
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		buf, err := json.Marshal(otlpRequest(batch))
+		if err == nil {
+			err = tracer.export(buf)
+		}
+		if err != nil {
+			// not by z, the log line of the exporter shouldn't be traced
+			_, _ = fmt.Fprintf(os.Stderr, "export %d spans failed: %s\n", len(batch), err.Error())
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-tracer.queue:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				send()
+			}
+
+		case <-ticker.C:
+			send()
+
+		case done := <-tracer.flush:
+			for n := len(tracer.queue); n > 0; n-- {
+				batch = append(batch, <-tracer.queue)
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+//flushTrace export the queued spans, called by Shutdown
+func flushTrace(ctx context.Context) {
+	if tracer.queue == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	select {
+	case tracer.flush <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	if n := atomic.LoadInt64(&tracer.dropped); n > 0 {
+		z.Warn(fmt.Sprintf("%d spans dropped by full queue", n))
+	}
+}
+
+//---------------------------------------------------------------------------------
+// OTLP/JSON, see opentelemetry-proto/opentelemetry/proto/collector/trace/v1
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+// status code of OTLP span
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+//otlpValue AnyValue of OTLP
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprintf("%v", v)}
+	}
+}
+
+func otlpAttributes(m map[string]interface{}) (a []otlpKeyValue) {
+	for k, v := range m {
+		a = append(a, otlpKeyValue{Key: k, Value: otlpValue(v)})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].Key < a[j].Key })
+	return
+}
+
+//otlpRequest ExportTraceServiceRequest of spans
+func otlpRequest(spans []*Span) interface{} {
+	list := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		v := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.err != "" {
+			v.Status = otlpStatus{Code: otlpStatusError, Message: s.err}
+		}
+		list = append(list, v)
+	}
+
+	resource := map[string]interface{}{
+		"service.name":    traceServiceName,
+		"service.version": buildVer,
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": otlpAttributes(resource)},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "w2w.io/cmn"},
+						"spans": list,
+					},
+				},
+			},
+		},
+	}
+}
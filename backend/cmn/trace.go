@@ -0,0 +1,179 @@
+package cmn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*request tracing
+
+	request id: 取自请求头 X-Request-ID, 没有时生成, 保存在 ServiceCtx.RequestID 并在响应头 X-Request-ID 中返回,
+		ServiceCtx.Log 是请求的 logger(RequestLogger), 输出的每一行日志都带有 "R": request id,
+		处理请求的代码及其启动的 goroutine 通过 LoggerOf(ctx) 取得, DML, 文件及参数等以 ctx 调用的函数均使用它输出日志
+	span: StartSpan/End 记录请求, DML 及文件操作的耗时, 以 OTLP/JSON 格式输出, 见 trace-exporter.go */
+
+//CRequestIDHeader header carrying the request id
+const CRequestIDHeader = "X-Request-ID"
+
+//requestIDLogKey key of the request id in log line
+const requestIDLogKey = "R"
+
+//spanKey ctx key of the current span
+const spanKey = ctxKey("Span")
+
+var rRequestID = regexp.MustCompile(`^[0-9A-Za-z._:-]{1,128}$`)
+
+//randomHex return n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//RequestIDOf return X-Request-ID of r if it is well-formed, otherwise a new one
+func RequestIDOf(r *http.Request) string {
+	if r != nil {
+		if s := r.Header.Get(CRequestIDHeader); rRequestID.MatchString(s) {
+			return s
+		}
+	}
+	return randomHex(16)
+}
+
+//---------------------------------------------------------------------------------
+// request scoped logger
+
+//RequestLogger the logger of the request adding "R": id to each log line, the muted one discards all
+func RequestLogger(id string, muted bool) *zap.Logger {
+	if muted {
+		return zap.NewNop()
+	}
+	return z.With(zap.String(requestIDLogKey, id))
+}
+
+/*LoggerOf the logger of the request in ctx, or z if ctx isn't of a request,
+the goroutines started by the request should log with it to keep the request id, for example
+	go func() { cmn.LoggerOf(ctx).Info("sms sent") }() */
+func LoggerOf(ctx context.Context) *zap.Logger {
+	if ctx != nil {
+		if q, ok := ctx.Value(QNearKey).(*ServiceCtx); ok && q != nil {
+			return q.Logger()
+		}
+	}
+	return z
+}
+
+//---------------------------------------------------------------------------------
+// span
+
+//Span timing of an operation, compatible with OpenTelemetry span
+type Span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	kind     int
+
+	start time.Time
+	end   time.Time
+
+	attrs map[string]interface{}
+	err   string
+
+	ended int32
+}
+
+// span kind of OTLP
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+)
+
+/*StartSpan start a span as the child of the span in ctx, the returned ctx carries the new span,
+End must be called when the operation finished, for example
+	ctx, span := cmn.StartSpan(ctx, "DML")
+	defer func() { span.End(err) }() */
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{
+		spanID: randomHex(8),
+		name:   name,
+		kind:   spanKindInternal,
+		start:  time.Now(),
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p, ok := ctx.Value(spanKey).(*Span); ok && p != nil {
+		s.traceID, s.parentID = p.traceID, p.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+/*StartRequestSpan start the root span of the request, the trace id is the request id
+if it is a valid OpenTelemetry trace id */
+func StartRequestSpan(ctx context.Context, q *ServiceCtx) (context.Context, *Span) {
+	ctx, s := StartSpan(ctx, q.R.Method+" "+q.R.URL.Path)
+	s.kind = spanKindServer
+	if rTraceID.MatchString(q.RequestID) {
+		s.traceID = q.RequestID
+	}
+	s.SetAttr("http.method", q.R.Method)
+	s.SetAttr("http.target", q.R.URL.Path)
+	s.SetAttr("http.request_id", q.RequestID)
+	s.SetAttr("net.peer.ip", clnAddr(q.R))
+	return ctx, s
+}
+
+var rTraceID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+//startDBSpan start the span of operation on table
+func startDBSpan(ctx context.Context, operation, table string) (context.Context, *Span) {
+	ctx, s := StartSpan(ctx, operation+" "+table)
+	s.kind = spanKindClient
+	s.SetAttr("db.system", "postgresql")
+	s.SetAttr("db.operation", operation)
+	s.SetAttr("db.sql.table", table)
+	return ctx, s
+}
+
+//SetAttr set attribute of the span
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+//End finish the span and export it, err is recorded as the span status
+func (s *Span) End(err error) {
+	if s == nil || !atomic.CompareAndSwapInt32(&s.ended, 0, 1) {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	exportSpan(s)
+}
+
+//TraceID return the trace id of the span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.traceID
+}
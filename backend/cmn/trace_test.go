@@ -0,0 +1,105 @@
+package cmn
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+//observeLogger replace z with the logger recording the log lines until restore called
+func observeLogger() (logs *observer.ObservedLogs, restore func()) {
+	core, logs := observer.New(zap.DebugLevel)
+	saved := z
+	z = zap.New(core)
+	restore = func() { z = saved }
+	return
+}
+
+func TestRequestLogger(t *testing.T) {
+	logs, restore := observeLogger()
+	defer restore()
+
+	q := &ServiceCtx{RequestID: "req-1", Log: RequestLogger("req-1", false)}
+	ctx := context.WithValue(context.Background(), QNearKey, q)
+
+	// the goroutines started by the request keep its id
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		LoggerOf(ctx).Info("in goroutine")
+	}()
+	wg.Wait()
+	LoggerOf(ctx).Info("in request")
+	LoggerOf(context.Background()).Info("not a request")
+
+	muted := &ServiceCtx{Log: RequestLogger("req-2", true)}
+	LoggerOf(context.WithValue(context.Background(), QNearKey, muted)).Error("muted")
+
+	want := map[string]string{
+		"in goroutine":  "req-1",
+		"in request":    "req-1",
+		"not a request": "",
+	}
+	entries := logs.AllUntimed()
+	if len(entries) != len(want) {
+		t.Fatalf("%d log lines, want %d", len(entries), len(want))
+	}
+	for _, e := range entries {
+		id, found := want[e.Message]
+		if !found {
+			t.Fatalf("unexpected log line %s", e.Message)
+		}
+		if got, _ := e.ContextMap()[requestIDLogKey].(string); got != id {
+			t.Errorf("%s: request id = %q, want %q", e.Message, got, id)
+		}
+	}
+}
+
+func TestDMLLogsRequestID(t *testing.T) {
+	logs, restore := observeLogger()
+	defer restore()
+
+	q := &ServiceCtx{RequestID: "req-3", Log: RequestLogger("req-3", false)}
+	ctx := context.WithValue(context.Background(), QNearKey, q)
+	if err := DML(ctx, nil, &ReqProto{Action: "select"}); err == nil {
+		t.Fatal("DML without dbms should fail")
+	}
+
+	entries := logs.AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("%d log lines, want 1", len(entries))
+	}
+	if got, _ := entries[0].ContextMap()[requestIDLogKey].(string); got != "req-3" {
+		t.Errorf("request id = %q, want req-3", got)
+	}
+}
+
+func TestRequestIDOf(t *testing.T) {
+	cases := []struct {
+		header string
+		keep   bool
+	}{
+		{"", false},
+		{"6f1c2e0c-4a0b-4a55-8b8e-1d9d2b1f3a77", true},
+		{"a b", false},
+		{string(make([]byte, 129)), false},
+	}
+	for _, c := range cases {
+		r, _ := http.NewRequest(http.MethodGet, "/api/order", nil)
+		if c.header != "" {
+			r.Header.Set(CRequestIDHeader, c.header)
+		}
+		id := RequestIDOf(r)
+		if c.keep && id != c.header {
+			t.Errorf("RequestIDOf = %s, want %s", id, c.header)
+		}
+		if !c.keep && (id == c.header || !rRequestID.MatchString(id)) {
+			t.Errorf("RequestIDOf(%q) = %q, should be generated", c.header, id)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"w2w.io/null"
@@ -32,14 +33,6 @@ var DualPathSeparator = "//"
 
 var terminateSignal chan os.Signal
 
-type RunningSession struct {
-	Api        string
-	BeginTime  int64
-	RemoteAddr string
-}
-
-var RunningSessions = make(map[int64]RunningSession)
-
 //GetTerminateSignal return terminateSignal
 func GetTerminateSignal() chan os.Signal {
 	return terminateSignal
@@ -172,12 +165,38 @@ func PqEscape(v string) string {
 	return string(dst)
 }
 
-//UtilCleanup release resource
-func UtilCleanup() {
-	if rootDB != nil {
+var rootDBClose sync.Once
+
+/*CloseRootDB close the application boltdb, only the first call takes effect. The boltdb file is locked by
+one process only, the parent process of graceful restart closes it as soon as the child started,
+rather than after the requests drained, so that the child opening it can accept at once */
+func CloseRootDB() {
+	rootDBClose.Do(func() {
+		if rootDB == nil {
+			return
+		}
 		D.Info("close boltdb")
 		_ = rootDB.Close()
 		D.Info("boltdb closed")
+	})
+}
+
+//UtilCleanup release resource
+func UtilCleanup() {
+	// the log flusher writes to bbolt and pgxConn
+	logFlusherStopped := true
+	if dbLogBuffer != nil {
+		D.Info("stop log flusher")
+		logFlusherStopped = dbLogBuffer.stop()
+		D.Info("log flusher stopped")
+	}
+
+	CloseRootDB()
+
+	if isBBoltEnabled {
+		D.Info("close bbolt log store")
+		closeBBoltLog()
+		D.Info("bbolt log store closed")
 	}
 
 	if sqlxDB != nil {
@@ -201,6 +220,12 @@ func UtilCleanup() {
 		D.Info("close pgxConn")
 		pgxConn.Close()
 		D.Info("pgxConn closed")
+
+		// the log written after closed is kept in log file only,
+		// pgxConn is kept if the flusher is still running, its writes fail on the closed pool
+		if logFlusherStopped {
+			pgxConn = nil
+		}
 	}
 }
 
@@ -237,7 +262,7 @@ func DbState(db interface{}) (dbStatus string) {
 			"pgpool":{"idle":%d,"inUse":%d,"openConnections":%d},"runningSessions":%d}`,
 			AppStartTime.Format(appStartTimeLayout),
 			s1.Idle, s1.InUse, s1.OpenConnections,
-			s2.IdleConns(), s2.AcquiredConns(), s2.TotalConns(), len(RunningSessions))
+			s2.IdleConns(), s2.AcquiredConns(), s2.TotalConns(), RunningSessionCount())
 		return
 	}
 	z.Info(dbStat)
@@ -0,0 +1,140 @@
+package cmn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*HTTP caching of WebFS
+
+	ETag:          文件内容的 sha256, 按 路径+大小+修改时间 缓存, 文件变化后重新计算;
+	               超过 etagHashMaxSize 的文件为 大小+修改时间 的弱 ETag, 避免首个请求(如 Range 下载)等待计算;
+	               If-None-Match/If-Modified-Since/Range 由 http.ServeContent 处理
+	Cache-Control: index.html 及目录始终为 no-store;
+	               文件名含哈希的资源(ServeEndPoint.AssetPattern)为 ServeEndPoint.AssetCacheControl;
+	               其它文件为 ServeEndPoint.CacheControl */
+
+// defaults of Cache-Control
+const (
+	defaultCacheControl      = "no-cache"
+	defaultAssetCacheControl = "public, max-age=31536000, immutable"
+	noStoreCacheControl      = "no-store, no-cache, must-revalidate"
+)
+
+/*defaultAssetPattern hashed asset file name of webpack/vite/rollup, e.g.
+app.3f2a9c1d.js, index-BQ8zL5xN.css, chunk.5f8e.0c1b2a3d4e.js */
+var defaultAssetPattern = regexp.MustCompile(`[.-][0-9A-Za-z_]*[0-9][0-9A-Za-z_]*\.[0-9A-Za-z]+$`)
+
+//minAssetHashLen the hash in asset file name is 8 characters at least
+const minAssetHashLen = 8
+
+//etagCacheSize the cache is reset when it grows beyond
+const etagCacheSize = 8192
+
+//etagHashMaxSize the ETag of the larger file is weak, by its size and modification time
+const etagHashMaxSize = 16 * 1024 * 1024
+
+type etagEntry struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+var etagCache struct {
+	sync.Mutex
+	m map[string]etagEntry
+}
+
+/*fileETag strong ETag of the regular file name, computed once until the file changed,
+the ETag of the file larger than etagHashMaxSize is weak, the file isn't read */
+func fileETag(name string, fi os.FileInfo) (etag string, err error) {
+	if fi.Size() > etagHashMaxSize {
+		etag = fmt.Sprintf(`W/"%x-%x"`, fi.Size(), fi.ModTime().UnixNano())
+		return
+	}
+
+	etagCache.Lock()
+	e, ok := etagCache.m[name]
+	etagCache.Unlock()
+	if ok && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+		etag = e.etag
+		return
+	}
+
+	var f *os.File
+	f, err = os.Open(name)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		z.Error(err.Error())
+		return
+	}
+	etag = fmt.Sprintf(`"%s"`, hex.EncodeToString(h.Sum(nil)[:16]))
+
+	etagCache.Lock()
+	if etagCache.m == nil || len(etagCache.m) >= etagCacheSize {
+		etagCache.m = make(map[string]etagEntry)
+	}
+	etagCache.m[name] = etagEntry{size: fi.Size(), modTime: fi.ModTime(), etag: etag}
+	etagCache.Unlock()
+	return
+}
+
+//setETag set ETag of the regular file name to w, nothing is set on error
+func setETag(w http.ResponseWriter, name string, fi os.FileInfo) {
+	if !fi.Mode().IsRegular() {
+		return
+	}
+	if etag, err := fileETag(name, fi); err == nil {
+		w.Header().Set("ETag", etag)
+	}
+}
+
+//isHashedAsset whether the base name of file is a hashed asset by ep.AssetPattern or defaultAssetPattern
+func (ep *ServeEndPoint) isHashedAsset(name string) bool {
+	base := filepath.Base(name)
+	if ep.assetMatcher != nil {
+		return ep.assetMatcher.MatchString(base)
+	}
+
+	m := defaultAssetPattern.FindString(base)
+	if m == "" {
+		return false
+	}
+	// m is like .3f2a9c1d.js, the hash is between the separator and the extension
+	hash := m[1:strings.LastIndex(m, ".")]
+	return len(hash) >= minAssetHashLen
+}
+
+//setCacheControl set Cache-Control of the file name served by ep
+func setCacheControl(w http.ResponseWriter, ep *ServeEndPoint, name string, fi os.FileInfo) {
+	v := ep.CacheControl
+	switch {
+	case fi.IsDir() || strings.EqualFold(filepath.Base(name), "index.html"):
+		v = noStoreCacheControl
+	case ep.isHashedAsset(name):
+		v = ep.AssetCacheControl
+		if v == "" {
+			v = defaultAssetCacheControl
+		}
+	case v == "":
+		v = defaultCacheControl
+	}
+	w.Header().Set("Cache-Control", v)
+}
@@ -0,0 +1,158 @@
+package cmn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsHashedAsset(t *testing.T) {
+	ep := &ServeEndPoint{}
+	cases := map[string]bool{
+		"app.3f2a9c1d.js":            true,
+		"assets/index-BQ8zL5xN.css":  true,
+		"chunk.5f8e.0c1b2a3d4e.js":   true,
+		"app.js":                     false,
+		"index.html":                 false,
+		"logo-2x.png":                false,
+		"jquery-3.6.0.min.js":        false,
+		"vendor.abcdefgh.js":         false, // no digit, it's a word
+		"/www/static/app.12345678.m": true,
+	}
+	for name, want := range cases {
+		if got := ep.isHashedAsset(name); got != want {
+			t.Errorf("isHashedAsset(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	ep.assetMatcher = regexp.MustCompile(`^v\d+-`)
+	if !ep.isHashedAsset("static/v12-app.js") || ep.isHashedAsset("app.3f2a9c1d.js") {
+		t.Error("AssetPattern should replace the default one")
+	}
+}
+
+func TestSetCacheControl(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"index.html", "app.3f2a9c1d.js", "app.js"} {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(f), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		ep   *ServeEndPoint
+		file string
+		want string
+	}{
+		{"index.html", &ServeEndPoint{CacheControl: "max-age=60"}, "index.html", noStoreCacheControl},
+		{"directory", &ServeEndPoint{}, "", noStoreCacheControl},
+		{"default asset", &ServeEndPoint{}, "app.3f2a9c1d.js", defaultAssetCacheControl},
+		{"asset", &ServeEndPoint{AssetCacheControl: "public, max-age=600"}, "app.3f2a9c1d.js", "public, max-age=600"},
+		{"default", &ServeEndPoint{}, "app.js", defaultCacheControl},
+		{"doc root", &ServeEndPoint{CacheControl: "max-age=60"}, "app.js", "max-age=60"},
+	}
+	for _, c := range cases {
+		name := filepath.Join(dir, c.file)
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		setCacheControl(w, c.ep, name, fi)
+		if got := w.Header().Get("Cache-Control"); got != c.want {
+			t.Errorf("%s: Cache-Control = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFileETag(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.js")
+	etagOf := func() string {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		etag, err := fileETag(name, fi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return etag
+	}
+
+	if err := os.WriteFile(name, []byte("console.log(1)"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	first := etagOf()
+	if strings.HasPrefix(first, "W/") || !strings.HasPrefix(first, `"`) {
+		t.Fatalf("ETag %s of the small file should be strong", first)
+	}
+	if etagOf() != first {
+		t.Fatal("ETag of the same file changed")
+	}
+
+	if err := os.WriteFile(name, []byte("console.log(2)"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(name, time.Now(), time.Now().Add(time.Second))
+	if etagOf() == first {
+		t.Fatal("ETag should change with the content")
+	}
+
+	// the large file isn't read
+	if err := os.Truncate(name, etagHashMaxSize+1); err != nil {
+		t.Fatal(err)
+	}
+	if etag := etagOf(); !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("ETag %s of the large file should be weak", etag)
+	}
+}
+
+// TestWebFSConditional the ETag is served by WebFS, validated by If-None-Match and kept on Range
+func TestWebFSConditional(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "small.txt"), []byte("0123456789"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "large.bin"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filepath.Join(dir, "large.bin"), etagHashMaxSize+100); err != nil {
+		t.Fatal(err)
+	}
+
+	ep := &ServeEndPoint{Path: "/", DocRoot: dir}
+	serve := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		q := &ServiceCtx{W: w, R: r, Ep: ep}
+		WebFS(context.WithValue(context.Background(), QNearKey, q))
+		return w
+	}
+
+	for _, path := range []string{"/small.txt", "/large.bin"} {
+		w := serve(path, nil)
+		etag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: status %d, ETag %q", path, w.Code, etag)
+		}
+
+		if w = serve(path, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+			t.Errorf("%s: status %d with If-None-Match, want 304", path, w.Code)
+		}
+
+		w = serve(path, map[string]string{"Range": "bytes=2-5"})
+		if w.Code != http.StatusPartialContent || w.Body.Len() != 4 || w.Header().Get("ETag") != etag {
+			t.Errorf("%s: status %d, %d bytes, ETag %q on Range", path, w.Code, w.Body.Len(), w.Header().Get("ETag"))
+		}
+	}
+}
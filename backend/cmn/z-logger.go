@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/viper"
@@ -25,13 +26,15 @@ var isBBoltEnabled bool
 //dstLogFile log file
 var dstLogFile string
 
+//zLogFile the writer of dstLogFile
+var zLogFile *rotatingFile
+
 //L global zap.Logger
 var z *zap.Logger
 
 const zLoggerTimeLayout = "2006-01-02 15:04:05.000-0700"
 const consoleLoggerTimeLayout = "15:04:05.000"
 
-var rLogLevel = zapcore.InfoLevel
 var stacktraceLogLevel = zapcore.ErrorLevel
 
 /*
@@ -58,11 +61,6 @@ _minLevel = DebugLevel
 _maxLevel = FatalLevel
 */
 
-//SetLogLevel set runtime log level
-func SetLogLevel(runtimeLevel int8) {
-	rLogLevel = zapcore.Level(runtimeLevel)
-}
-
 func GetLogger() *zap.Logger {
 	if z == nil {
 		InitLogger()
@@ -93,7 +91,7 @@ func InitLogger() {
 	}
 
 	logLevel := zap.LevelEnablerFunc(func(v zapcore.Level) bool {
-		return v >= rLogLevel
+		return v >= zapcore.Level(atomic.LoadInt32(&minLogLevel))
 	})
 
 	//------------------------
@@ -141,16 +139,17 @@ func InitLogger() {
 		_ = os.Mkdir(dstLogPath, os.ModePerm)
 	}
 	dstLogFile = dstLogPath + "/log.txt.json"
-	fd, err := os.OpenFile(dstLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	zLogFile, err = newRotatingFile(dstLogFile)
 	if err != nil {
-		log.Fatal("open " + dstLogFile + " failed by " + err.Error())
+		log.Fatal(err.Error())
 	}
 
 	zLoggerTimeLayout := func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 		enc.AppendString(t.Format(zLoggerTimeLayout))
 	}
 
-	fileSink := zapcore.Lock(fd)
+	// rotatingFile is locked itself
+	fileSink := zapcore.AddSync(zLogFile)
 
 	jsonEncoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
 		TimeKey:        "T",
@@ -168,10 +167,11 @@ func InitLogger() {
 
 	//----------------------------
 	//dbms logger
-	dbLogger := DbLoggerAdaptor{
-		stack: newLogItemStack(),
+	var dbSink zapcore.WriteSyncer
+	if isBBoltEnabled || isPostgresqlEnabled {
+		dbLogBuffer = newLogBuffer()
+		dbSink = zapcore.Lock(&DbLoggerAdaptor{buf: dbLogBuffer})
 	}
-	dbSink := zapcore.Lock(&dbLogger)
 
 	var dst []zapcore.Core
 
@@ -187,17 +187,16 @@ func InitLogger() {
 
 	//-------------------------
 	//
-	core := zapcore.NewTee(dst...)
+	core := &callerLevelCore{zapcore.NewTee(dst...)}
 
 	z = zap.New(core,
 		zap.AddCaller(),
 		zap.AddStacktrace(stacktraceLogLevel),
-		zap.WrapCore(func(core zapcore.Core) zapcore.Core {
-			return zapcore.NewSamplerWithOptions(core,
-				time.Second, 100, 100)
-		}),
+		zap.WrapCore(newSamplingCore),
 	)
 
+	watchLogReopen(zLogFile)
+
 	defer func() {
 		err := z.Sync()
 		if err != nil {
@@ -225,14 +224,17 @@ func InitLogger() {
 
 }
 
-//DbLoggerAdaptor adaptor for zap logger
+//DbLoggerAdaptor adaptor for zap logger, see cmn/log-buffer.go
 type DbLoggerAdaptor struct {
-	stack LogItemStack
+	buf *logBuffer
 }
 
+//dbLogBuffer the buffer of DbLoggerAdaptor, stopped by UtilCleanup before the sinks closed
+var dbLogBuffer *logBuffer
+
 //Sync flush data to persist
 func (t *DbLoggerAdaptor) Sync() error {
-	t.stack.sync(true)
+	t.buf.flush()
 	return nil
 }
 
@@ -255,6 +257,10 @@ CREATE TABLE IF NOT EXISTS t_log
 WITH (
     OIDS = TRUE
 );
+
+ALTER TABLE t_log ADD COLUMN IF NOT EXISTS request_id character varying(128);
+CREATE INDEX IF NOT EXISTS idx_t_log_request_id ON t_log (request_id);
+COMMENT ON COLUMN t_log.request_id IS '请求编号';
 */
 
 //LogItem for logging unit
@@ -266,29 +272,25 @@ type LogItem struct {
 	Message    string `json:"M,omitempty"`
 	Stacktrace string `json:"S,omitempty"`
 	Original   string `json:"O,omitempty"`
+	RequestID  string `json:"R,omitempty"`
 }
 
 //Write log data to dbms
 func (t *DbLoggerAdaptor) Write(d []byte) (n int, err error) {
 	n = len(d)
-	err = nil
-	t.stack.store(d)
-	t.stack.sync(false)
-	//fmt.Printf("total stacked %d logItems", len(t.stack.buf))
+	t.buf.push(d)
 	return
 }
 
 //Close sql.DB
 func (t *DbLoggerAdaptor) Close() error {
-	t.stack.sync(true)
+	t.buf.flush()
 	return nil
 }
 
-//LogItemStack pool the logging json data
+//LogItemStack the logging json data flushed together
 type LogItemStack struct {
-	recentSyncTime time.Time
-	buf            [][]byte
-	syncInterval   time.Duration
+	buf [][]byte
 
 	idx  int
 	data []interface{}
@@ -328,98 +330,95 @@ func (v *LogItemStack) Err() error {
 	return v.err
 }
 
-func (v *LogItemStack) store(jsonData []byte) {
-	if v.buf == nil {
-		log.Print("LogItemStack.buf is nil")
+//tLogRequestID whether t_log has the request_id column: 0 unchecked, 1 exists, 2 missing
+var tLogRequestID int32
+
+/*hasLogRequestID report whether t_log has the request_id column, it's checked once on the first call,
+and again if the check failed. The request id isn't written to t_log if the column is missing,
+run the ALTER TABLE above to add it */
+func hasLogRequestID(ctx context.Context) (exists bool, err error) {
+	switch atomic.LoadInt32(&tLogRequestID) {
+	case 1:
+		return true, nil
+	case 2:
+		return false, nil
+	}
+
+	var n int
+	s := `select count(*) from information_schema.columns
+		where table_schema = current_schema() and table_name = 't_log' and column_name = 'request_id'`
+	err = pgxConn.QueryRow(ctx, s).Scan(&n)
+	if err != nil {
 		return
 	}
-	if jsonData == nil {
-		log.Print("jsonData is nil")
+
+	exists = n > 0
+	if exists {
+		atomic.StoreInt32(&tLogRequestID, 1)
 		return
 	}
-	data := make([]byte, len(jsonData), len(jsonData))
-	copy(data, jsonData)
-	v.buf = append(v.buf, data)
+	if atomic.CompareAndSwapInt32(&tLogRequestID, 0, 2) {
+		log.Print("t_log.request_id doesn't exist, the request id isn't written to t_log")
+	}
+	return
 }
 
-func flashToPostgreSQL(v *LogItemStack) {
-	if pgxConn == nil {
-		return
+//logRows the rows of buf written to t_log and their columns, the malformed lines are skipped
+func logRows(buf [][]byte, withRequestID bool) (columns []string, rows [][]interface{}) {
+	columns = []string{"grade", "msg", "caller", "stacktrace", "create_time"}
+	if withRequestID {
+		columns = append(columns, "request_id")
 	}
-	var err error
-	var rows [][]interface{}
 
-	for k := 0; k < len(v.buf); k++ {
-		d := v.buf[k]
+	for k := 0; k < len(buf); k++ {
+		d := buf[k]
 		i := LogItem{}
-		err = json.Unmarshal(d, &i)
-		if err != nil {
-			log.Print(err.Error())
-			return
+		if e := json.Unmarshal(d, &i); e != nil {
+			log.Print(e.Error())
+			continue
 		}
 
-		var t time.Time
-		t, err = time.Parse(zLoggerTimeLayout, i.CreateTime)
-		if err != nil {
-			log.Print(err.Error())
-			return
+		t, e := time.Parse(zLoggerTimeLayout, i.CreateTime)
+		if e != nil {
+			log.Print(e.Error())
+			continue
 		}
-		rows = append(rows, []interface{}{i.Level, i.Message, i.Caller, i.Stacktrace, t.UnixNano() / 1e6})
-	}
-
-	columns := []string{"grade", "msg", "caller", "stacktrace", "create_time"}
-	_, err = pgxConn.CopyFrom(context.Background(), pgx.Identifier{"t_log"}, columns, pgx.CopyFromRows(rows))
-	if err != nil {
-		log.Print(err.Error())
-		return
+		row := []interface{}{i.Level, i.Message, i.Caller, i.Stacktrace, t.UnixNano() / 1e6}
+		if withRequestID {
+			var requestID interface{}
+			if i.RequestID != "" {
+				requestID = i.RequestID
+			}
+			row = append(row, requestID)
+		}
+		rows = append(rows, row)
 	}
+	return
 }
 
-func flashToBBolt(v *LogItemStack) {
-
-}
-
-func (v *LogItemStack) sync(force bool) {
-	if v.buf == nil || len(v.buf) <= 0 {
-		//log.Print("LogItemStack.buf is nil")
+//flashToPostgreSQL write v to t_log, the malformed lines are skipped, retried by logBuffer on error
+func flashToPostgreSQL(v *LogItemStack) (err error) {
+	if pgxConn == nil {
+		err = fmt.Errorf("postgresql isn't connected")
 		return
 	}
 
-	if len(v.buf) <= 0 {
-		//log.Print("LogItemStack.buf is empty")
+	withRequestID, err := hasLogRequestID(context.Background())
+	if err != nil {
+		atomic.AddInt64(&logBufferStat.FlushFailures, 1)
+		log.Print(err.Error())
 		return
 	}
 
-	if !force && time.Now().Sub(v.recentSyncTime) < v.syncInterval {
-		//fmt.Println("时间未到")
+	columns, rows := logRows(v.buf, withRequestID)
+	if len(rows) == 0 {
 		return
 	}
 
-	//fmt.Println("准备开始")
-
-	//begin sync
-	if isPostgresqlEnabled {
-		flashToPostgreSQL(v)
-	}
-
-	if isBBoltEnabled {
-		flashToBBolt(v)
-	}
-	//end syncc
-
-	//clear the stack
-	for k := 0; k < len(v.buf); k++ {
-		v.buf[k] = nil
-	}
-	v.buf = v.buf[:0]
-
-	v.recentSyncTime = time.Now()
-}
-
-func newLogItemStack() LogItemStack {
-	return LogItemStack{
-		buf:            make([][]byte, 0, 20000),
-		recentSyncTime: time.Now(),
-		syncInterval:   time.Second * 15,
+	_, err = pgxConn.CopyFrom(context.Background(), pgx.Identifier{"t_log"}, columns, pgx.CopyFromRows(rows))
+	if err != nil {
+		atomic.AddInt64(&logBufferStat.FlushFailures, 1)
+		log.Print(err.Error())
 	}
+	return
 }
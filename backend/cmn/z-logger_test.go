@@ -0,0 +1,57 @@
+package cmn
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// TestLogRows request_id is written only if t_log has the column, the malformed lines are skipped
+func TestLogRows(t *testing.T) {
+	buf := [][]byte{
+		[]byte(`{"T":"2024-03-01 10:00:00.000+0800","L":"INFO","M":"a","R":"req-1"}`),
+		[]byte(`not json`),
+		[]byte(`{"T":"bad time","M":"b"}`),
+		[]byte(`{"T":"2024-03-01 10:00:01.000+0800","L":"ERROR","C":"cmn/dml.go:10","M":"c"}`),
+	}
+
+	columns, rows := logRows(buf, true)
+	if want := []string{"grade", "msg", "caller", "stacktrace", "create_time", "request_id"}; !reflect.DeepEqual(columns, want) {
+		t.Fatalf("columns = %v, want %v", columns, want)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("%d rows, want 2", len(rows))
+	}
+	if rows[0][5] != "req-1" || rows[1][5] != nil {
+		t.Errorf("request ids = %v, %v, want req-1, nil", rows[0][5], rows[1][5])
+	}
+	if rows[1][0] != "ERROR" || rows[1][1] != "c" || rows[1][2] != "cmn/dml.go:10" {
+		t.Errorf("row = %v", rows[1])
+	}
+
+	columns, rows = logRows(buf, false)
+	if len(columns) != 5 || columns[4] != "create_time" {
+		t.Fatalf("columns = %v without request_id", columns)
+	}
+	for _, r := range rows {
+		if len(r) != len(columns) {
+			t.Fatalf("row %v doesn't match columns %v", r, columns)
+		}
+	}
+}
+
+// TestHasLogRequestID the result of the check is kept, the database isn't queried again
+func TestHasLogRequestID(t *testing.T) {
+	saved := atomic.LoadInt32(&tLogRequestID)
+	defer atomic.StoreInt32(&tLogRequestID, saved)
+
+	// pgxConn is nil, querying it would panic
+	for state, want := range map[int32]bool{1: true, 2: false} {
+		atomic.StoreInt32(&tLogRequestID, state)
+		exists, err := hasLogRequestID(context.Background())
+		if err != nil || exists != want {
+			t.Errorf("state %d: hasLogRequestID = %v, %v, want %v", state, exists, err, want)
+		}
+	}
+}
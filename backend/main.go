@@ -23,7 +23,7 @@ func main() {
 		syscall.SIGKILL,
 		syscall.SIGQUIT,
 		// syscall.SIGSTOP,
-		syscall.SIGHUP,
+		// syscall.SIGHUP, reopen the log file by cmn
 	)
 
 	go cmd.Cleanup(terminateSignal)
@@ -0,0 +1,161 @@
+//Package audit query the audit trail of DML changes
+package audit
+
+//annotation:audit-trail-service
+//author:{"name":"audit","tel":"18928776452","email":"XUnion@GMail.com"}
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx/types"
+	"go.uber.org/zap"
+	"w2w.io/cmn"
+)
+
+var z *zap.Logger
+
+func init() {
+	//Setup package scope variables, just like logger, db connector, configure parameters, etc.
+	cmn.PackageStarters = append(cmn.PackageStarters, func() {
+		z = cmn.GetLogger()
+		z.Info("audit trail zLogger settled")
+	})
+}
+
+func Enroll(author string) {
+	z.Info("audit.Enroll called")
+	var developer *cmn.ModuleAuthor
+	if author != "" {
+		var d cmn.ModuleAuthor
+		err := json.Unmarshal([]byte(author), &d)
+		if err != nil {
+			z.Error(err.Error())
+			return
+		}
+		developer = &d
+	}
+
+	cmn.AddService(&cmn.ServeEndPoint{
+		Fn: auditTrail,
+
+		Path:    "/api/audit-trail",
+		Name:    "auditTrail",
+		Methods: []string{"GET"},
+
+		Developer: developer,
+		WhiteList: false,
+
+		AccessControlLevel: "2",
+
+		DomainID:      int64(cmn.CDomainSys),
+		DefaultDomain: int64(cmn.CDomainSys),
+	})
+}
+
+//auditQry query condition of the audit trail, all fields are optional
+type auditQry struct {
+	//Table, db table name, for example t_order
+	Table string `json:"table"`
+
+	//RowID, primary key of the changed row
+	RowID string `json:"rowID"`
+
+	//UserID, the operator
+	UserID int64 `json:"userID"`
+
+	//Action, INSERT/UPDATE/DELETE/UPSERT
+	Action string `json:"action"`
+
+	//BeginTime/EndTime, create time of the trail in millisecond
+	BeginTime int64 `json:"beginTime"`
+	EndTime   int64 `json:"endTime"`
+
+	Page     int64 `json:"page"`
+	PageSize int64 `json:"pageSize"`
+}
+
+/*auditTrail GET /api/audit-trail?q={"table":"t_order","rowID":"1234","userID":1,"page":0,"pageSize":20}
+仅管理员角色可以查询, 结果按时间倒序 */
+func auditTrail(ctx context.Context) {
+	q := cmn.GetCtxValue(ctx)
+	z.Info("---->" + cmn.FncName())
+
+	if !q.IsAdmin {
+		q.Err = fmt.Errorf("only administrator can query the audit trail")
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+
+	var qry auditQry
+	if s := q.R.URL.Query().Get("q"); s != "" {
+		q.Err = json.Unmarshal([]byte(s), &qry)
+		if q.Err != nil {
+			z.Error(q.Err.Error())
+			q.RespErr()
+			return
+		}
+	}
+	if qry.PageSize <= 0 || qry.PageSize > 1000 {
+		qry.PageSize = 20
+	}
+
+	var filter []interface{}
+	addCond := func(key, opr string, value interface{}) {
+		cond := map[string]interface{}{key: map[string]interface{}{opr: value}}
+		if len(filter) > 0 {
+			cond["connectBy"] = "AND"
+		}
+		filter = append(filter, cond)
+	}
+	if qry.Table != "" {
+		addCond("Addi->>'table'", "EQ", qry.Table)
+	}
+	if qry.RowID != "" {
+		addCond("Addi->>'rowID'", "EQ", qry.RowID)
+	}
+	if qry.Action != "" {
+		addCond("Addi->>'action'", "EQ", strings.ToUpper(qry.Action))
+	}
+	if qry.UserID > 0 {
+		addCond("Creator", "EQ", qry.UserID)
+	}
+	if qry.BeginTime > 0 {
+		addCond("CreateTime", "GTE", qry.BeginTime)
+	}
+	if qry.EndTime > 0 {
+		addCond("CreateTime", "LT", qry.EndTime)
+	}
+
+	req := cmn.ReqProto{
+		Action:   "select",
+		OrderBy:  []map[string]string{{"CreateTime": "DESC"}, {"ID": "DESC"}},
+		Page:     qry.Page,
+		PageSize: qry.PageSize,
+	}
+	if len(filter) > 0 {
+		req.Filter = filter
+	}
+
+	var s cmn.TAccountOprLog
+	s.TableMap = &s
+	q.Err = cmn.DML(ctx, &s.Filter, &req)
+	if q.Err != nil {
+		q.RespErr()
+		return
+	}
+
+	v, ok := s.QryResult.(string)
+	if !ok {
+		q.Err = fmt.Errorf("s.QryResult should be string, but it isn't")
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+	q.Msg.RowCount = s.RowCount
+	q.Msg.Data = types.JSONText(v)
+	q.Resp()
+}
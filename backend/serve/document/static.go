@@ -48,6 +48,8 @@ func Enroll(author string) {
 
 		DocRoot: staticDocRoot,
 
+		CacheControl: viper.GetString("webServe.static.documentCacheControl"),
+
 		Developer: developer,
 		WhiteList: true,
 
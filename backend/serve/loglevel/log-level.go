@@ -0,0 +1,196 @@
+//Package loglevel view and change the log level and sampling at runtime
+package loglevel
+
+//annotation:log-level-service
+//author:{"name":"log-level","tel":"18928776452","email":"XUnion@GMail.com"}
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"w2w.io/cmn"
+)
+
+var z *zap.Logger
+
+func init() {
+	//Setup package scope variables, just like logger, db connector, configure parameters, etc.
+	cmn.PackageStarters = append(cmn.PackageStarters, func() {
+		z = cmn.GetLogger()
+		z.Info("log level zLogger settled")
+	})
+}
+
+//defaultTTL of the caller level if ttl isn't specified, in second
+const defaultTTL = 600
+
+//levelReq data of PUT /api/log-level
+type levelReq struct {
+	//Level the global level, or the level of Caller
+	Level string `json:"level,omitempty" schema:"enum=debug|info|warn|error|dpanic|panic|fatal"`
+
+	//Caller prefix of the caller, e.g. cmn/insurance.go or cmn/
+	Caller string `json:"caller,omitempty" schema:"minLength=1,maxLength=256"`
+
+	//TTL the caller level expired after, in second
+	TTL int64 `json:"ttl,omitempty" schema:"minimum=1,maximum=86400"`
+
+	Sampling *cmn.LogSampling `json:"sampling,omitempty"`
+}
+
+//levelState reply of /api/log-level
+type levelState struct {
+	Level    zapcore.Level        `json:"level"`
+	Callers  []cmn.CallerLogLevel `json:"callers"`
+	Sampling cmn.LogSampling      `json:"sampling"`
+}
+
+func Enroll(author string) {
+	z.Info("loglevel.Enroll called")
+	var developer *cmn.ModuleAuthor
+	if author != "" {
+		var d cmn.ModuleAuthor
+		err := json.Unmarshal([]byte(author), &d)
+		if err != nil {
+			z.Error(err.Error())
+			return
+		}
+		developer = &d
+	}
+
+	cmn.AddService(&cmn.ServeEndPoint{
+		Fn: logLevel,
+
+		Path:       "/api/log-level",
+		Name:       "logLevel",
+		Methods:    []string{"GET", "PUT", "DELETE"},
+		SchemaType: levelReq{},
+
+		Developer: developer,
+		WhiteList: false,
+
+		AccessControlLevel: "2",
+
+		DomainID:      int64(cmn.CDomainSys),
+		DefaultDomain: int64(cmn.CDomainSys),
+	})
+}
+
+/*logLevel
+
+	GET    /api/log-level: 当前的全局级别, caller 级别及采样设置
+	PUT    /api/log-level: data 为
+		{"level":"warn"}                                         设置全局级别
+		{"caller":"cmn/insurance.go","level":"debug","ttl":600}  设置 caller 级别, ttl 秒后失效, 缺省 600
+		{"sampling":{"tick":1000,"first":100,"thereafter":100}}  设置采样, first 为 0 时不采样
+	DELETE /api/log-level?caller=cmn/insurance.go: 删除 caller 级别
+	应答的 data 均为修改后的设置 */
+func logLevel(ctx context.Context) {
+	q := cmn.GetCtxValue(ctx)
+	z.Info("---->" + cmn.FncName())
+
+	if !q.IsAdmin {
+		q.Err = fmt.Errorf("only administrator can change the log level")
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+
+	switch q.R.Method {
+	case http.MethodPut:
+		q.Err = setLevel(q)
+
+	case http.MethodDelete:
+		caller := q.R.URL.Query().Get("caller")
+		if !cmn.RemoveCallerLogLevel(caller) {
+			q.Err = fmt.Errorf("log level of caller %s not found", caller)
+			z.Error(q.Err.Error())
+		}
+	}
+	if q.Err != nil {
+		q.RespErr()
+		return
+	}
+
+	s := levelState{
+		Level:    cmn.GetLogLevel(),
+		Callers:  cmn.CallerLogLevels(),
+		Sampling: cmn.GetLogSampling(),
+	}
+	q.Msg.Data, q.Err = json.Marshal(s)
+	if q.Err != nil {
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+	q.Resp()
+}
+
+//setLevel apply the data of PUT /api/log-level
+func setLevel(q *cmn.ServiceCtx) (err error) {
+	buf, err := ioutil.ReadAll(q.R.Body)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	defer q.R.Body.Close()
+
+	var req cmn.ReqProto
+	if err = json.Unmarshal(buf, &req); err != nil {
+		z.Error(err.Error())
+		return
+	}
+	var r levelReq
+	if err = json.Unmarshal(req.Data, &r); err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	var level zapcore.Level
+	if r.Level != "" {
+		if err = level.UnmarshalText([]byte(r.Level)); err != nil {
+			z.Error(err.Error())
+			return
+		}
+	}
+
+	switch {
+	case r.Caller != "":
+		if r.Level == "" {
+			err = fmt.Errorf("level of caller %s should be specified", r.Caller)
+			z.Error(err.Error())
+			return
+		}
+		ttl := r.TTL
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+		if err = cmn.SetCallerLogLevel(r.Caller, level, time.Duration(ttl)*time.Second); err != nil {
+			return
+		}
+
+	case r.Level != "":
+		cmn.SetLogLevel(int8(level))
+		z.Warn(fmt.Sprintf("log level set to %s by %s", level, q.R.RemoteAddr))
+	}
+
+	if r.Sampling != nil {
+		if err = cmn.SetLogSampling(*r.Sampling); err != nil {
+			z.Error(err.Error())
+			return
+		}
+		z.Warn(fmt.Sprintf("log sampling set to %+v by %s", *r.Sampling, q.R.RemoteAddr))
+	}
+
+	if r.Level == "" && r.Sampling == nil {
+		err = fmt.Errorf("level or sampling should be specified")
+		z.Error(err.Error())
+	}
+	return
+}
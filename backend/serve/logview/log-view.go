@@ -1,3 +1,4 @@
+//Package logview query and tail the log of the file, t_log and bbolt
 package logview
 
 //annotation:log-view-service
@@ -6,6 +7,12 @@ package logview
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
 	"go.uber.org/zap"
 	"w2w.io/cmn"
 )
@@ -20,6 +27,16 @@ func init() {
 	})
 }
 
+// defaults of the query
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	defaultWindow   = time.Hour
+
+	//keepAliveInterval comment line sent to keep the idle event stream from proxies timeout
+	keepAliveInterval = 15 * time.Second
+)
+
 func Enroll(author string) {
 	z.Info("logview.Enroll called")
 	var developer *cmn.ModuleAuthor
@@ -36,20 +53,242 @@ func Enroll(author string) {
 	cmn.AddService(&cmn.ServeEndPoint{
 		Fn: logView,
 
-		Path: "/log-view",
-		Name: "logViewer",
+		Path:    "/api/log-view",
+		Name:    "logViewer",
+		Methods: []string{"GET"},
 
 		Developer: developer,
-		WhiteList: true,
+		WhiteList: false,
+
+		AccessControlLevel: "2",
+
+		DomainID:      int64(cmn.CDomainSys),
+		DefaultDomain: int64(cmn.CDomainSys),
+	})
+
+	cmn.AddService(&cmn.ServeEndPoint{
+		Fn: logTail,
+
+		Path:      "/api/log-view/tail",
+		Name:      "logTail",
+		Methods:   []string{"GET"},
+		Streaming: true,
+
+		Developer: developer,
+		WhiteList: false,
+
+		AccessControlLevel: "2",
 
 		DomainID:      int64(cmn.CDomainSys),
 		DefaultDomain: int64(cmn.CDomainSys),
 	})
 }
 
+//adminOnly reply error if the user isn't administrator
+func adminOnly(q *cmn.ServiceCtx) bool {
+	if q.IsAdmin {
+		return true
+	}
+	q.Err = fmt.Errorf("only administrator can view the log")
+	z.Error(q.Err.Error())
+	q.RespErr()
+	return false
+}
+
+//msTime parse the time in millisecond of key
+func msTime(v url.Values, key string) (t time.Time, err error) {
+	s := v.Get(key)
+	if s == "" {
+		return
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		err = fmt.Errorf("%s should be time in millisecond: %s", key, err.Error())
+		return
+	}
+	t = time.Unix(0, ms*int64(time.Millisecond))
+	return
+}
+
+//intOf parse the integer of key, def if it's absent
+func intOf(v url.Values, key string, def int) (n int, err error) {
+	s := v.Get(key)
+	if s == "" {
+		n = def
+		return
+	}
+	n, err = strconv.Atoi(s)
+	if err != nil {
+		err = fmt.Errorf("%s should be integer: %s", key, err.Error())
+	}
+	return
+}
+
+//parseQuery the condition in the query string
+func parseQuery(v url.Values) (c cmn.LogQuery, err error) {
+	c = cmn.LogQuery{
+		Level:     v.Get("level"),
+		Caller:    v.Get("caller"),
+		Message:   v.Get("msg"),
+		RequestID: v.Get("requestID"),
+	}
+
+	if c.Begin, err = msTime(v, "begin"); err != nil {
+		return
+	}
+	if c.End, err = msTime(v, "end"); err != nil {
+		return
+	}
+
+	//***页码从第零页开始***
+	page, err := intOf(v, "page", 0)
+	if err != nil {
+		return
+	}
+	pageSize, err := intOf(v, "pageSize", defaultPageSize)
+	if err != nil {
+		return
+	}
+	if page < 0 || pageSize <= 0 || pageSize > maxPageSize {
+		err = fmt.Errorf("page should be >= 0 and pageSize between 1 and %d", maxPageSize)
+		return
+	}
+	c.Offset, c.Limit = page*pageSize, pageSize
+	return
+}
+
+/*logView GET /api/log-view?source=file&level=warn&begin=1650000000000&end=1650003600000
+	&caller=cmn/dml.go&msg=timeout&requestID=xxx&page=0&pageSize=100
+
+	source:    file(缺省): 日志文件及轮转后的文件; db: t_log; bbolt: bbolt log sink
+	begin/end: 毫秒, end 缺省为当前时间, begin 缺省为 end 前一小时
+	level:     最低级别, debug/info/warn/error/dpanic/panic/fatal
+	caller/msg: 包含的内容, msg 不区分大小写
+	requestID: 请求编号(X-Request-ID)
+	结果按时间顺序排列, 少于 pageSize 条时没有下一页 */
 func logView(ctx context.Context) {
 	q := cmn.GetCtxValue(ctx)
 	z.Info("---->" + cmn.FncName())
-	q.Msg.Msg = cmn.FncName()
+
+	if !adminOnly(q) {
+		return
+	}
+
+	v := q.R.URL.Query()
+	var c cmn.LogQuery
+	c, q.Err = parseQuery(v)
+	if q.Err != nil {
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+	if c.End.IsZero() {
+		c.End = time.Now().Add(time.Second)
+	}
+	if c.Begin.IsZero() {
+		c.Begin = c.End.Add(-defaultWindow)
+	}
+
+	var items []cmn.LogItem
+	switch source := v.Get("source"); source {
+	case "", "file":
+		items, q.Err = cmn.QueryFileLog(c)
+	case "db":
+		items, q.Err = cmn.QueryDBLog(ctx, c)
+	case "bbolt":
+		items, q.Err = cmn.QueryBBoltLog(c)
+	default:
+		q.Err = fmt.Errorf("unknown source %s, should be file, db or bbolt", source)
+		z.Error(q.Err.Error())
+	}
+	if q.Err != nil {
+		q.RespErr()
+		return
+	}
+
+	if items == nil {
+		items = []cmn.LogItem{}
+	}
+	q.Msg.Data, q.Err = json.Marshal(items)
+	if q.Err != nil {
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+	q.Msg.RowCount = int64(len(items))
 	q.Resp()
 }
+
+/*logTail GET /api/log-view/tail?level=error&caller=&msg=&requestID=
+	以 server-sent events 推送之后写入日志文件的日志, 每条日志为一个 data 事件, 内容为日志行,
+	例如 new EventSource('/api/log-view/tail?level=error') */
+func logTail(ctx context.Context) {
+	q := cmn.GetCtxValue(ctx)
+	z.Info("---->" + cmn.FncName())
+
+	if !adminOnly(q) {
+		return
+	}
+
+	var c cmn.LogQuery
+	c, q.Err = parseQuery(q.R.URL.Query())
+	if q.Err != nil {
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+
+	flusher, ok := q.W.(http.Flusher)
+	if !ok {
+		q.Err = fmt.Errorf("%T doesn't support streaming", q.W)
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+
+	items, stop, err := cmn.TailLog(c)
+	if err != nil {
+		q.Err = err
+		q.RespErr()
+		return
+	}
+	defer stop()
+
+	h := q.W.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Accel-Buffering", "no")
+	q.W.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(q.W, ": log tail\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			// canceled by /api/running-session
+			return
+
+		case <-q.R.Context().Done():
+			// client gone
+			return
+
+		case <-ticker.C:
+			_, err = fmt.Fprint(q.W, ": keep-alive\n\n")
+
+		case i, ok := <-items:
+			if !ok {
+				// shutdown
+				return
+			}
+			_, err = fmt.Fprintf(q.W, "data: %s\n\n", i.Original)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
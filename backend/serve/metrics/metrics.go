@@ -0,0 +1,92 @@
+//Package metrics expose the metrics of the app for Prometheus
+package metrics
+
+//annotation:metrics-service
+//author:{"name":"metrics","tel":"18928776452","email":"XUnion@GMail.com"}
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"w2w.io/cmn"
+)
+
+var z *zap.Logger
+
+func init() {
+	//Setup package scope variables, just like logger, db connector, configure parameters, etc.
+	cmn.PackageStarters = append(cmn.PackageStarters, func() {
+		z = cmn.GetLogger()
+		z.Info("metrics zLogger settled")
+	})
+}
+
+func Enroll(author string) {
+	z.Info("metrics.Enroll called")
+	var developer *cmn.ModuleAuthor
+	if author != "" {
+		var d cmn.ModuleAuthor
+		err := json.Unmarshal([]byte(author), &d)
+		if err != nil {
+			z.Error(err.Error())
+			return
+		}
+		developer = &d
+	}
+
+	cmn.AddService(&cmn.ServeEndPoint{
+		Fn: metrics,
+
+		Path:    "/api/metrics",
+		Name:    "metrics",
+		Methods: []string{"GET"},
+
+		Developer: developer,
+
+		// scraped by Prometheus without session, see allowed
+		WhiteList: true,
+
+		DomainID:      int64(cmn.CDomainSys),
+		DefaultDomain: int64(cmn.CDomainSys),
+	})
+}
+
+/*allowed the scraper should carry webServe.metrics.token in X-Metrics-Token header if it is set,
+otherwise it should be on loopback/private network.
+	behind a reverse proxy RemoteAddr is the proxy's, the scraper is resolved by webServe.trustedProxies,
+	the request forwarded by a proxy not in webServe.trustedProxies is refused.
+	the proxy should set X-Forwarded-For, or webServe.metrics.token should be set */
+func allowed(r *http.Request) bool {
+	if token := viper.GetString("webServe.metrics.token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Metrics-Token")), []byte(token)) == 1
+	}
+
+	if cmn.ForwardedByUntrustedProxy(r) {
+		return false
+	}
+	ip := net.ParseIP(cmn.PeerAddr(r))
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
+
+//metrics GET /api/metrics, reply in Prometheus text exposition format
+func metrics(ctx context.Context) {
+	q := cmn.GetCtxValue(ctx)
+	z.Info("---->" + cmn.FncName())
+
+	if !allowed(q.R) {
+		q.Err = fmt.Errorf("%s isn't allowed to scrape metrics", cmn.PeerAddr(q.R))
+		z.Warn(q.Err.Error())
+		q.RespErr()
+		return
+	}
+
+	q.Responded = true
+	q.W.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	q.Err = cmn.WriteMetrics(q.W)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/spf13/viper"
+	"w2w.io/cmn"
+)
+
+func TestAllowed(t *testing.T) {
+	if err := cmn.SetTrustedProxies([]string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cmn.SetTrustedProxies(nil) }()
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		token      string
+		header     string
+		want       bool
+	}{
+		{"local scraper", "127.0.0.1:4321", "", "", "", true},
+		{"private network scraper", "10.0.0.9:4321", "", "", "", true},
+		{"public scraper", "203.0.113.5:4321", "", "", "", false},
+		{"public scraper behind the trusted proxy", "127.0.0.1:4321", "203.0.113.5", "", "", false},
+		{"private scraper behind the trusted proxy", "127.0.0.1:4321", "10.0.0.9", "", "", true},
+		{"forwarded by an untrusted proxy", "10.0.0.2:4321", "10.0.0.9", "", "", false},
+		{"token", "203.0.113.5:4321", "", "secret", "secret", true},
+		{"wrong token", "127.0.0.1:4321", "", "secret", "guess", false},
+		{"missing token", "127.0.0.1:4321", "", "secret", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viper.Set("webServe.metrics.token", c.token)
+			defer viper.Set("webServe.metrics.token", "")
+
+			r, _ := http.NewRequest(http.MethodGet, "/api/metrics", nil)
+			r.RemoteAddr = c.remoteAddr
+			if c.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", c.forwarded)
+			}
+			if c.header != "" {
+				r.Header.Set("X-Metrics-Token", c.header)
+			}
+			if got := allowed(r); got != c.want {
+				t.Fatalf("allowed = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+//Package runningsession list and cancel the api requests being processed
+package runningsession
+
+//annotation:running-session-service
+//author:{"name":"running-session","tel":"18928776452","email":"XUnion@GMail.com"}
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"w2w.io/cmn"
+)
+
+var z *zap.Logger
+
+func init() {
+	//Setup package scope variables, just like logger, db connector, configure parameters, etc.
+	cmn.PackageStarters = append(cmn.PackageStarters, func() {
+		z = cmn.GetLogger()
+		z.Info("running session zLogger settled")
+	})
+}
+
+func Enroll(author string) {
+	z.Info("runningsession.Enroll called")
+	var developer *cmn.ModuleAuthor
+	if author != "" {
+		var d cmn.ModuleAuthor
+		err := json.Unmarshal([]byte(author), &d)
+		if err != nil {
+			z.Error(err.Error())
+			return
+		}
+		developer = &d
+	}
+
+	cmn.AddService(&cmn.ServeEndPoint{
+		Fn: list,
+
+		Path:    "/api/running-session",
+		Name:    "runningSessionList",
+		Methods: []string{"GET"},
+
+		Developer: developer,
+		WhiteList: false,
+
+		AccessControlLevel: "2",
+
+		DomainID:      int64(cmn.CDomainSys),
+		DefaultDomain: int64(cmn.CDomainSys),
+	})
+
+	cmn.AddService(&cmn.ServeEndPoint{
+		Fn: cancel,
+
+		Path:    "/api/running-session/{id:[0-9]+}",
+		Name:    "runningSessionCancel",
+		Methods: []string{"DELETE"},
+
+		Developer: developer,
+		WhiteList: false,
+
+		AccessControlLevel: "2",
+
+		DomainID:      int64(cmn.CDomainSys),
+		DefaultDomain: int64(cmn.CDomainSys),
+	})
+}
+
+//adminOnly reply error if the user isn't administrator
+func adminOnly(q *cmn.ServiceCtx) bool {
+	if q.IsAdmin {
+		return true
+	}
+	q.Err = fmt.Errorf("only administrator can manage the running sessions")
+	z.Error(q.Err.Error())
+	q.RespErr()
+	return false
+}
+
+/*list GET /api/running-session?minDuration=5000
+the requests running longer than minDuration(millisecond, default 0), the longest first */
+func list(ctx context.Context) {
+	q := cmn.GetCtxValue(ctx)
+	z.Info("---->" + cmn.FncName())
+
+	if !adminOnly(q) {
+		return
+	}
+
+	var minDuration int64
+	if s := q.R.URL.Query().Get("minDuration"); s != "" {
+		minDuration, q.Err = strconv.ParseInt(s, 10, 64)
+		if q.Err != nil {
+			z.Error(q.Err.Error())
+			q.RespErr()
+			return
+		}
+	}
+
+	sessions := cmn.ListRunningSessions(time.Duration(minDuration) * time.Millisecond)
+	q.Msg.Data, q.Err = json.Marshal(sessions)
+	if q.Err != nil {
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+	q.Msg.RowCount = int64(len(sessions))
+	q.Resp()
+}
+
+//cancel DELETE /api/running-session/{id}, cancel the context of the request, its running queries are aborted
+func cancel(ctx context.Context) {
+	q := cmn.GetCtxValue(ctx)
+	z.Info("---->" + cmn.FncName())
+
+	if !adminOnly(q) {
+		return
+	}
+
+	var id int64
+	id, q.Err = strconv.ParseInt(q.PathParams["id"], 10, 64)
+	if q.Err != nil {
+		z.Error(q.Err.Error())
+		q.RespErr()
+		return
+	}
+
+	q.Err = cmn.CancelSession(id)
+	if q.Err != nil {
+		q.RespErr()
+		return
+	}
+	q.Msg.Data = []byte(fmt.Sprintf(`{"id":%d,"canceled":true}`, id))
+	q.Resp()
+}
@@ -0,0 +1,66 @@
+package runningsession
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"w2w.io/cmn"
+)
+
+func TestMain(m *testing.M) {
+	z = cmn.GetLogger()
+	os.Exit(m.Run())
+}
+
+//serve call fn with the request of the user, return the reply
+func serve(t *testing.T, fn func(context.Context), method, path string, isAdmin bool,
+	pathParams map[string]string) (reply cmn.ReplyProto) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, nil)
+	q := &cmn.ServiceCtx{W: w, R: r, IsAdmin: isAdmin, PathParams: pathParams,
+		Msg: &cmn.ReplyProto{API: r.URL.Path, Method: r.Method}}
+	fn(context.WithValue(context.Background(), cmn.QNearKey, q))
+
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("%s: %s", err.Error(), w.Body.String())
+	}
+	return
+}
+
+func TestAdminOnly(t *testing.T) {
+	ctx, done := cmn.TrackSession(context.Background(), httptest.NewRequest("GET", "/api/slow", nil), "req-admin")
+	defer done()
+
+	var id int64
+	for _, s := range cmn.ListRunningSessions(0) {
+		if s.RequestID == "req-admin" {
+			id = s.ID
+		}
+	}
+	params := map[string]string{"id": strconv.FormatInt(id, 10)}
+
+	if r := serve(t, list, "GET", "/api/running-session", false, nil); r.Status >= 0 {
+		t.Fatalf("non-administrator listed the sessions: %+v", r)
+	}
+	if r := serve(t, cancel, "DELETE", "/api/running-session/1", false, params); r.Status >= 0 {
+		t.Fatalf("non-administrator canceled the session: %+v", r)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("the session is canceled by non-administrator")
+	}
+
+	r := serve(t, list, "GET", "/api/running-session", true, nil)
+	if r.Status != 0 || r.RowCount < 1 {
+		t.Fatalf("administrator list: %+v", r)
+	}
+	if r = serve(t, cancel, "DELETE", "/api/running-session/1", true, params); r.Status != 0 {
+		t.Fatalf("administrator cancel: %+v", r)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("the session isn't canceled by administrator")
+	}
+}
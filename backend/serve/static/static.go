@@ -49,6 +49,9 @@ func Enroll(author string) {
 
 		DocRoot: staticDocRoot,
 
+		CacheControl:      viper.GetString("webServe.static.cacheControl"),
+		AssetCacheControl: viper.GetString("webServe.static.assetCacheControl"),
+
 		Developer: developer,
 		WhiteList: true,
 
@@ -0,0 +1,111 @@
+//go:build !windows
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/viper"
+	"w2w.io/cmn"
+)
+
+/*zero-downtime restart
+
+	webServe.gracefulRestart 为 true 时, 向进程发送 SIGUSR2:
+		1. 以相同的参数启动新版本的可执行文件, 监听的 socket 作为 fd 3 传递给子进程
+		2. 子进程在同一 socket 上接受新连接
+		3. 父进程立即关闭 boltdb(cmn.CloseRootDB), 停止接受新连接, 等待处理中的请求结束后退出(cmn.Shutdown)
+	boltdb 文件只能由一个进程打开, 子进程在父进程关闭它之后才能完成启动, 因此父进程不等请求结束就关闭它,
+	处理中的请求不再能使用 boltdb */
+
+//inheritedListenerEnv set in the environment of the child process started by restart
+const inheritedListenerEnv = "W2W_INHERITED_LISTENER"
+
+//listen return the listener inherited from the parent process, or listen on ep
+func listen(ep string) (ln net.Listener, err error) {
+	if os.Getenv(inheritedListenerEnv) == "" {
+		ln, err = net.Listen("tcp", ep)
+		if err != nil {
+			z.Error(err.Error())
+		}
+		return
+	}
+	_ = os.Unsetenv(inheritedListenerEnv)
+
+	f := os.NewFile(3, "inherited listener")
+	defer f.Close()
+
+	ln, err = net.FileListener(f)
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	z.Info("serve on the listener inherited from the parent process")
+	return
+}
+
+//watchRestart restart the app on SIGUSR2 if webServe.gracefulRestart is true
+func watchRestart(ln net.Listener) {
+	if !viper.GetBool("webServe.gracefulRestart") {
+		return
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	go func() {
+		for range c {
+			if restart(ln) != nil {
+				continue
+			}
+			signal.Stop(c)
+
+			// the child waits for the boltdb, then it's accepting, stop and drain
+			cmn.CloseRootDB()
+			cmn.Terminate(0)
+			return
+		}
+	}()
+}
+
+//restart start the child process with the listener as fd 3
+func restart(ln net.Listener) (err error) {
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		err = fmt.Errorf("%T can't be passed to the child process", ln)
+		z.Error(err.Error())
+		return
+	}
+
+	var f *os.File
+	f, err = tl.File()
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+	defer f.Close()
+
+	var exe string
+	exe, err = os.Executable()
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	c := exec.Command(exe, os.Args[1:]...)
+	c.Env = append(os.Environ(), inheritedListenerEnv+"=1")
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.ExtraFiles = []*os.File{f}
+	err = c.Start()
+	if err != nil {
+		z.Error(err.Error())
+		return
+	}
+
+	z.Warn(fmt.Sprintf("restart: child process %d started, %d stop accepting", c.Process.Pid, os.Getpid()))
+	return
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"net"
+)
+
+//listen listen on ep, windows can't pass the listener to the child process
+func listen(ep string) (ln net.Listener, err error) {
+	ln, err = net.Listen("tcp", ep)
+	if err != nil {
+		z.Error(err.Error())
+	}
+	return
+}
+
+//watchRestart zero-downtime restart isn't supported on windows
+func watchRestart(_ net.Listener) {
+}
@@ -11,6 +11,10 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"w2w.io/cmn"
 )
 
 const (
@@ -19,8 +23,22 @@ const (
 	contentEncoding = "Content-Encoding"
 	contentType     = "Content-Type"
 	contentLength   = "Content-Length"
+	contentRange    = "Content-Range"
+	etag            = "ETag"
 )
 
+// content-codings produced by the handler
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+)
+
+// DefaultEncodings is the server preference of encodings when the client accepts
+// several of them with the same qvalue. zstd is fast enough for the dynamic API
+// JSON, the static bundles get brotli from their precompressed .br siblings.
+var DefaultEncodings = []string{encodingZstd, encodingBrotli, encodingGzip}
+
 type codings map[string]float64
 
 const (
@@ -36,19 +54,33 @@ const (
 	DefaultMinSize = 1400
 )
 
-// gzipWriterPools stores a sync.Pool for each compression level for reuse of
-// gzip.Writers. Use poolIndex to covert a compression level to an index into
-// gzipWriterPools.
-var gzipWriterPools [gzip.BestCompression - gzip.BestSpeed + 2]*sync.Pool
+// compressWriter is the part of gzip.Writer, brotli.Writer and zstd.Encoder used
+// by CompressResponseWriter.
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// writerPools stores a sync.Pool for each encoding and compression level for
+// reuse of compressWriters. Use poolIndex to covert a compression level to an
+// index into the pools of an encoding.
+var writerPools = map[string]*[gzip.BestCompression - gzip.BestSpeed + 2]*sync.Pool{
+	encodingGzip:   {},
+	encodingBrotli: {},
+	encodingZstd:   {},
+}
 
 func init() {
-	for i := gzip.BestSpeed; i <= gzip.BestCompression; i++ {
-		addLevelPool(i)
+	for encoding := range writerPools {
+		for i := gzip.BestSpeed; i <= gzip.BestCompression; i++ {
+			addLevelPool(encoding, i)
+		}
+		addLevelPool(encoding, gzip.DefaultCompression)
 	}
-	addLevelPool(gzip.DefaultCompression)
 }
 
-// poolIndex maps a compression level to its index into gzipWriterPools. It
+// poolIndex maps a compression level to its index into writerPools. It
 // assumes that level is a valid gzip compression level.
 func poolIndex(level int) int {
 	// gzip.DefaultCompression == -1, so we need to treat it special.
@@ -58,59 +90,111 @@ func poolIndex(level int) int {
 	return level - gzip.BestSpeed
 }
 
-func addLevelPool(level int) {
-	gzipWriterPools[poolIndex(level)] = &sync.Pool{
+// newWriterLevel creates the writer of encoding, the gzip compression level is
+// mapped to the level of brotli(0-11) and zstd(1-22) by its value.
+func newWriterLevel(encoding string, level int) compressWriter {
+	switch encoding {
+	case encodingBrotli:
+		if level == gzip.DefaultCompression {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(nil, level)
+
+	case encodingZstd:
+		l := zstd.SpeedDefault
+		if level != gzip.DefaultCompression {
+			l = zstd.EncoderLevelFromZstd(level)
+		}
+		// NewWriter only returns error on bad options, the options here are fine.
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(l), zstd.WithEncoderConcurrency(1),
+			zstd.WithLowerEncoderMem(true))
+		return w
+	}
+
+	// NewWriterLevel only returns error on a bad level, we are guaranteeing
+	// that this will be a valid level so it is okay to ignore the returned
+	// error.
+	w, _ := gzip.NewWriterLevel(nil, level)
+	return w
+}
+
+func addLevelPool(encoding string, level int) {
+	writerPools[encoding][poolIndex(level)] = &sync.Pool{
 		New: func() interface{} {
-			// NewWriterLevel only returns error on a bad level, we are guaranteeing
-			// that this will be a valid level so it is okay to ignore the returned
-			// error.
-			w, _ := gzip.NewWriterLevel(nil, level)
-			return w
+			return newWriterLevel(encoding, level)
 		},
 	}
 }
 
-// GzipResponseWriter provides an http.ResponseWriter interface, which gzips
-// bytes before writing them to the underlying response. This doesn't close the
-// writers, so don't forget to do that.
+// CompressResponseWriter provides an http.ResponseWriter interface, which
+// compresses bytes by the negotiated encoding(gzip, br or zstd) before writing
+// them to the underlying response. This doesn't close the writers, so don't
+// forget to do that.
 // It can be configured to skip response smaller than minSize.
-type GzipResponseWriter struct {
+type CompressResponseWriter struct {
 	http.ResponseWriter
-	index int // Index for gzipWriterPools.
-	gw    *gzip.Writer
+	encoding string         // Content-Encoding of the response, the key of writerPools.
+	accepted codings        // Parsed Accept-Encoding of the request, for NegotiateEncoding.
+	index    int            // Index for writerPools.
+	cw       compressWriter // The compressing writer, nil until startCompress.
 
 	code int // Saves the WriteHeader value.
 
-	minSize int    // Specifed the minimum response size to gzip. If the response length is bigger than this value, it is compressed.
+	minSize int    // Specifed the minimum response size to compress. If the response length is bigger than this value, it is compressed.
 	buf     []byte // Holds the first part of the write before reaching the minSize or the end of the write.
 	ignore  bool   // If true, then we immediately passthru writes to the underlying ResponseWriter.
 
 	contentTypes []parsedContentType // Only compress if the response is one of these content-types. All are accepted if empty.
+
+	in  int64       // Bytes written to the compressing writer, for cmn.ObserveCompression.
+	out countWriter // Bytes written by the compressing writer to the underlying response.
 }
 
-//GzipResponseWriterWithCloseNotify close
-type GzipResponseWriterWithCloseNotify struct {
-	*GzipResponseWriter
+// countWriter counts the bytes written through it.
+type countWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+//CompressResponseWriterWithCloseNotify close
+type CompressResponseWriterWithCloseNotify struct {
+	*CompressResponseWriter
 }
 
 //CloseNotify notify
-func (w GzipResponseWriterWithCloseNotify) CloseNotify() <-chan bool {
+func (w CompressResponseWriterWithCloseNotify) CloseNotify() <-chan bool {
 	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
 }
 
-// Write appends data to the gzip writer.
-func (w *GzipResponseWriter) Write(b []byte) (int, error) {
-	// GZIP responseWriter is initialized. Use the GZIP responseWriter.
-	if w.gw != nil {
-		return w.gw.Write(b)
+// NegotiateEncoding returns the best of offers accepted by the client, or ""
+// if none is acceptable. cmn.WebFS uses it to pick a precompressed sibling.
+func (w *CompressResponseWriter) NegotiateEncoding(offers ...string) string {
+	return negotiateEncoding(w.accepted, offers)
+}
+
+// verify cmn.EncodingNegotiator interface implementation
+var _ cmn.EncodingNegotiator = &CompressResponseWriter{}
+
+// Write appends data to the compressing writer.
+func (w *CompressResponseWriter) Write(b []byte) (int, error) {
+	// The compressing writer is initialized. Use it.
+	if w.cw != nil {
+		w.in += int64(len(b))
+		return w.cw.Write(b)
 	}
 
-	// If we have already decided not to use GZIP, immediately passthrough.
+	// If we have already decided not to compress, immediately passthrough.
 	if w.ignore {
 		return w.ResponseWriter.Write(b)
 	}
 
-	// Save the write into a buffer for later use in GZIP responseWriter (if content is long enough) or at close with regular responseWriter.
+	// Save the write into a buffer for later use in the compressing writer (if content is long enough) or at close with regular responseWriter.
 	// On the first write, w.buf changes from nil to a valid slice
 	w.buf = append(w.buf, b...)
 
@@ -118,9 +202,11 @@ func (w *GzipResponseWriter) Write(b []byte) (int, error) {
 		cl, _ = strconv.Atoi(w.Header().Get(contentLength))
 		ct    = w.Header().Get(contentType)
 		ce    = w.Header().Get(contentEncoding)
+		cr    = w.Header().Get(contentRange)
 	)
 	// Only continue if they didn't already choose an encoding or a known unhandled content length or type.
-	if ce == "" && (cl == 0 || cl >= w.minSize) && (ct == "" || handleContentType(w.contentTypes, ct)) {
+	// A range of the representation(206 Partial Content) can't be compressed.
+	if ce == "" && cr == "" && (cl == 0 || cl >= w.minSize) && (ct == "" || handleContentType(w.contentTypes, ct)) {
 		// If the current buffer is less than minSize and a Content-Length isn't set, then wait until we have more data.
 		if len(w.buf) < w.minSize && cl == 0 {
 			return len(b), nil
@@ -132,46 +218,53 @@ func (w *GzipResponseWriter) Write(b []byte) (int, error) {
 				ct = http.DetectContentType(w.buf)
 				w.Header().Set(contentType, ct)
 			}
-			// If the Content-Type is acceptable to GZIP, initialize the GZIP writer.
+			// If the Content-Type is acceptable to compress, initialize the compressing writer.
 			if handleContentType(w.contentTypes, ct) {
-				if err := w.startGzip(); err != nil {
+				if err := w.startCompress(); err != nil {
 					return 0, err
 				}
 				return len(b), nil
 			}
 		}
 	}
-	// If we got here, we should not GZIP this response.
+	// If we got here, we should not compress this response.
 	if err := w.startPlain(); err != nil {
 		return 0, err
 	}
 	return len(b), nil
 }
 
-// startGzip initializes a GZIP writer and writes the buffer.
-func (w *GzipResponseWriter) startGzip() error {
-	// Set the GZIP header.
-	w.Header().Set(contentEncoding, "gzip")
+// startCompress initializes the compressing writer and writes the buffer.
+func (w *CompressResponseWriter) startCompress() error {
+	// Set the Content-Encoding header.
+	w.Header().Set(contentEncoding, w.encoding)
 
-	// if the Content-Length is already set, then calls to Write on gzip
-	// will fail to set the Content-Length header since its already set
+	// if the Content-Length is already set, then calls to Write on the compressing
+	// writer will fail to set the Content-Length header since its already set
 	// See: https://github.com/golang/go/issues/14975.
 	w.Header().Del(contentLength)
 
-	// Write the header to gzip response.
+	// The strong ETag is of the uncompressed representation, the compressed one
+	// is only semantically equivalent.
+	if v := w.Header().Get(etag); strings.HasPrefix(v, `"`) {
+		w.Header().Set(etag, "W/"+v)
+	}
+
+	// Write the header to the compressed response.
 	if w.code != 0 {
 		w.ResponseWriter.WriteHeader(w.code)
 		// Ensure that no other WriteHeader's happen
 		w.code = 0
 	}
 
-	// Initialize and flush the buffer into the gzip response if there are any bytes.
+	// Initialize and flush the buffer into the compressed response if there are any bytes.
 	// If there aren't any, we shouldn't initialize it yet because on Close it will
-	// write the gzip header even if nothing was ever written.
+	// write the encoding header even if nothing was ever written.
 	if len(w.buf) > 0 {
-		// Initialize the GZIP response.
+		// Initialize the compressed response.
 		w.init()
-		n, err := w.gw.Write(w.buf)
+		w.in += int64(len(w.buf))
+		n, err := w.cw.Write(w.buf)
 
 		// This should never happen (per io.Writer docs), but if the write didn't
 		// accept the entire buffer but returned no specific error, we have no clue
@@ -184,8 +277,8 @@ func (w *GzipResponseWriter) startGzip() error {
 	return nil
 }
 
-// startPlain writes to sent bytes and buffer the underlying ResponseWriter without gzip.
-func (w *GzipResponseWriter) startPlain() error {
+// startPlain writes to sent bytes and buffer the underlying ResponseWriter without compression.
+func (w *CompressResponseWriter) startPlain() error {
 	if w.code != 0 {
 		w.ResponseWriter.WriteHeader(w.code)
 		// Ensure that no other WriteHeader's happen
@@ -207,59 +300,63 @@ func (w *GzipResponseWriter) startPlain() error {
 	return err
 }
 
-// WriteHeader just saves the response code until close or GZIP effective writes.
-func (w *GzipResponseWriter) WriteHeader(code int) {
+// WriteHeader just saves the response code until close or compressed effective writes.
+func (w *CompressResponseWriter) WriteHeader(code int) {
 	if w.code == 0 {
 		w.code = code
 	}
 }
 
-// init graps a new gzip writer from the gzipWriterPool and writes the correct
-// content encoding header.
-func (w *GzipResponseWriter) init() {
-	// Bytes written during ServeHTTP are redirected to this gzip writer
+// init graps a new compressing writer of w.encoding from writerPools.
+func (w *CompressResponseWriter) init() {
+	// Bytes written during ServeHTTP are redirected to this compressing writer
 	// before being written to the underlying response.
-	gzw := gzipWriterPools[w.index].Get().(*gzip.Writer)
-	gzw.Reset(w.ResponseWriter)
-	w.gw = gzw
+	cw := writerPools[w.encoding][w.index].Get().(compressWriter)
+	w.out = countWriter{Writer: w.ResponseWriter}
+	cw.Reset(&w.out)
+	w.cw = cw
 }
 
-// Close will close the gzip.Writer and will put it back in the gzipWriterPool.
-func (w *GzipResponseWriter) Close() error {
+// Close will close the compressing writer and will put it back in writerPools.
+func (w *CompressResponseWriter) Close() error {
 	if w.ignore {
 		return nil
 	}
 
-	if w.gw == nil {
-		// GZIP not triggered yet, write out regular response.
+	if w.cw == nil {
+		// Compression not triggered yet, write out regular response.
 		err := w.startPlain()
 		// Returns the error if any at write.
 		if err != nil {
-			err = fmt.Errorf("gziphandler: write to regular responseWriter at close gets error: %q", err.Error())
+			err = fmt.Errorf("compresshandler: write to regular responseWriter at close gets error: %q", err.Error())
 		}
 		return err
 	}
 
-	err := w.gw.Close()
-	gzipWriterPools[w.index].Put(w.gw)
-	w.gw = nil
+	err := w.cw.Close()
+	// drop the reference to the response before pooling
+	w.cw.Reset(io.Discard)
+	writerPools[w.encoding][w.index].Put(w.cw)
+	w.cw = nil
+	cmn.ObserveCompression(w.encoding, w.in, w.out.n)
 	return err
 }
 
-// Flush flushes the underlying *gzip.Writer and then the underlying
-// http.ResponseWriter if it is an http.Flusher. This makes GzipResponseWriter
+// Flush flushes the underlying compressing writer and then the underlying
+// http.ResponseWriter if it is an http.Flusher. This makes CompressResponseWriter
 // an http.Flusher.
-func (w *GzipResponseWriter) Flush() {
-	if w.gw == nil && !w.ignore {
-		// Only flush once startGzip or startPlain has been called.
-		//
-		// Flush is thus a no-op until we're certain whether a plain
-		// or gzipped response will be served.
-		return
+func (w *CompressResponseWriter) Flush() {
+	if w.cw == nil && !w.ignore {
+		// Flushed before enough data to decide, the response is streamed,
+		// e.g. server-sent events, serve it uncompressed instead of holding
+		// the data until minSize is reached.
+		if err := w.startPlain(); err != nil {
+			return
+		}
 	}
 
-	if w.gw != nil {
-		w.gw.Flush()
+	if w.cw != nil {
+		_ = w.cw.Flush()
 	}
 
 	if fw, ok := w.ResponseWriter.(http.Flusher); ok {
@@ -269,7 +366,7 @@ func (w *GzipResponseWriter) Flush() {
 
 // Hijack implements http.Hijacker. If the underlying ResponseWriter is a
 // Hijacker, its Hijack method is returned. Otherwise an error is returned.
-func (w *GzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+func (w *CompressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
 		return hj.Hijack()
 	}
@@ -277,7 +374,7 @@ func (w *GzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 }
 
 // verify Hijacker interface implementation
-var _ http.Hijacker = &GzipResponseWriter{}
+var _ http.Hijacker = &CompressResponseWriter{}
 
 // MustNewGzipLevelHandler behaves just like NewGzipLevelHandler except that in
 // an error case it panics rather than returning an error.
@@ -290,7 +387,7 @@ func MustNewGzipLevelHandler(level int) func(http.Handler) http.Handler {
 }
 
 // NewGzipLevelHandler returns a wrapper function (often known as middleware)
-// which can be used to wrap an HTTP handler to transparently gzip the response
+// which can be used to wrap an HTTP handler to transparently compress the response
 // body if the client supports it (via the Accept-Encoding header). Responses will
 // be encoded at the given gzip compression level. An error will be returned only
 // if an invalid gzip compression level is given, so if one can ensure the level
@@ -305,11 +402,12 @@ func NewGzipLevelAndMinSize(level, minSize int) (func(http.Handler) http.Handler
 	return GzipHandlerWithOpts(CompressionLevel(level), MinSize(minSize))
 }
 
-//GzipHandlerWithOpts options
+//GzipHandlerWithOpts options, the encoding is negotiated among c.encodings by the qvalue of Accept-Encoding
 func GzipHandlerWithOpts(opts ...GzipOption) (func(http.Handler) http.Handler, error) {
 	c := &config{
-		level:   gzip.DefaultCompression,
-		minSize: DefaultMinSize,
+		level:     gzip.DefaultCompression,
+		minSize:   DefaultMinSize,
+		encodings: DefaultEncodings,
 	}
 
 	for _, o := range opts {
@@ -325,20 +423,23 @@ func GzipHandlerWithOpts(opts ...GzipOption) (func(http.Handler) http.Handler, e
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Add(vary, acceptEncoding)
-			if acceptsGzip(r) {
-				gw := &GzipResponseWriter{
+			accepted, _ := parseEncodings(r.Header.Get(acceptEncoding))
+			if encoding := negotiateEncoding(accepted, c.encodings); encoding != "" {
+				cw := &CompressResponseWriter{
 					ResponseWriter: w,
+					encoding:       encoding,
+					accepted:       accepted,
 					index:          index,
 					minSize:        c.minSize,
 					contentTypes:   c.contentTypes,
 				}
-				defer gw.Close()
+				defer cw.Close()
 
 				if _, ok := w.(http.CloseNotifier); ok {
-					gwcn := GzipResponseWriterWithCloseNotify{gw}
-					h.ServeHTTP(gwcn, r)
+					cwcn := CompressResponseWriterWithCloseNotify{cw}
+					h.ServeHTTP(cwcn, r)
 				} else {
-					h.ServeHTTP(gw, r)
+					h.ServeHTTP(cw, r)
 				}
 
 			} else {
@@ -382,6 +483,7 @@ type config struct {
 	minSize      int
 	level        int
 	contentTypes []parsedContentType
+	encodings    []string
 }
 
 func (c *config) validate() error {
@@ -393,6 +495,15 @@ func (c *config) validate() error {
 		return fmt.Errorf("minimum size must be more than zero")
 	}
 
+	if len(c.encodings) == 0 {
+		return fmt.Errorf("at least one encoding is required")
+	}
+	for _, v := range c.encodings {
+		if _, ok := writerPools[v]; !ok {
+			return fmt.Errorf("unsupported encoding requested: %s", v)
+		}
+	}
+
 	return nil
 }
 
@@ -413,6 +524,18 @@ func CompressionLevel(level int) GzipOption {
 	}
 }
 
+// Encodings specifies the encodings to produce, in the server preference order
+// used when the client accepts several of them with the same qvalue. Supported
+// encodings are gzip, br and zstd, DefaultEncodings by default.
+func Encodings(encodings ...string) GzipOption {
+	return func(c *config) {
+		c.encodings = nil
+		for _, v := range encodings {
+			c.encodings = append(c.encodings, strings.ToLower(strings.TrimSpace(v)))
+		}
+	}
+}
+
 // ContentTypes specifies a list of content types to compare
 // the Content-Type header to before compressing. If none
 // match, the response will be returned as-is.
@@ -429,7 +552,7 @@ func CompressionLevel(level int) GzipOption {
 // that has the same MIME type and other directives. I.e.,
 // "text/html; charset=utf-8" will only match "text/html; charset=utf-8".
 //
-// By default, responses are gzipped regardless of
+// By default, responses are compressed regardless of
 // Content-Type.
 func ContentTypes(types []string) GzipOption {
 	return func(c *config) {
@@ -443,19 +566,29 @@ func ContentTypes(types []string) GzipOption {
 	}
 }
 
-// GzipHandler wraps an HTTP handler, to transparently gzip the response body if
-// the client supports it (via the Accept-Encoding header). This will compress at
-// the default compression level.
+// GzipHandler wraps an HTTP handler, to transparently compress the response body
+// by gzip, br or zstd if the client supports it (via the Accept-Encoding header).
+// This will compress at the default compression level.
 func GzipHandler(h http.Handler) http.Handler {
 	wrapper, _ := NewGzipLevelHandler(gzip.DefaultCompression)
 	return wrapper(h)
 }
 
-// acceptsGzip returns true if the given HTTP request indicates that it will
-// accept a gzipped response.
-func acceptsGzip(r *http.Request) bool {
-	acceptedEncodings, _ := parseEncodings(r.Header.Get(acceptEncoding))
-	return acceptedEncodings["gzip"] > 0.0
+// negotiateEncoding returns the offer with the highest qvalue in accepted, the
+// earlier offer wins on tie. An offer not listed takes the qvalue of "*", and
+// "" is returned if no offer has a positive qvalue.
+func negotiateEncoding(accepted codings, offers []string) string {
+	best, bestQ := "", 0.0
+	for _, v := range offers {
+		q, ok := accepted[v]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = v, q
+		}
+	}
+	return best
 }
 
 // returns true if we've been configured to compress the specific content type.
@@ -513,9 +646,9 @@ func parseEncodings(s string) (codings, error) {
 // as might appear in an Accept-Encoding header. It attempts to forgive minor
 // formatting errors.
 func parseCoding(s string) (coding string, qvalue float64, err error) {
+	qvalue = DefaultQValue
 	for n, part := range strings.Split(s, ";") {
 		part = strings.TrimSpace(part)
-		qvalue = DefaultQValue
 
 		if n == 0 {
 			coding = strings.ToLower(part)
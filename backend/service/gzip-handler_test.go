@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"gzip, br, zstd", "zstd"},
+		{"gzip;q=1.0, br;q=0.5, zstd;q=0.8", "gzip"},
+		{"zstd;q=0, br", "br"},
+		{"*", "zstd"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"identity", ""},
+		{"gzip;q=0", ""},
+		{"GZIP", "gzip"},
+	}
+	for _, c := range cases {
+		accepted, _ := parseEncodings(c.accept)
+		if got := negotiateEncoding(accepted, DefaultEncodings); got != c.want {
+			t.Errorf("Accept-Encoding %q: encoding = %q, want %q", c.accept, got, c.want)
+		}
+	}
+}
+
+func TestGzipHandlerEncodings(t *testing.T) {
+	body := strings.Repeat(`{"status":0,"msg":"success"}`, 200)
+	h := GzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}))
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"": func(r io.Reader) (io.Reader, error) { return r, nil },
+		"gzip": func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		"br": func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		},
+		"zstd": func(r io.Reader) (io.Reader, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	}
+	for _, accept := range []string{"", "gzip", "br", "zstd", "gzip;q=0.5, br;q=0.8"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/order", nil)
+		r.Header.Set(acceptEncoding, accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		encoding := w.Header().Get(contentEncoding)
+		decode, ok := decoders[encoding]
+		if !ok {
+			t.Fatalf("%q: unexpected Content-Encoding %s", accept, encoding)
+		}
+		if accept != "" && encoding == "" {
+			t.Fatalf("%q: the response isn't compressed", accept)
+		}
+		dr, err := decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := io.ReadAll(dr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, []byte(body)) {
+			t.Fatalf("%q: the body decoded by %s differs", accept, encoding)
+		}
+		if !strings.Contains(w.Header().Get(vary), acceptEncoding) {
+			t.Fatalf("%q: Vary should contain %s", accept, acceptEncoding)
+		}
+	}
+}
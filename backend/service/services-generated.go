@@ -3,23 +3,31 @@
 package service
 
 import (
-	"w2w.io/serve/authmgmt" //auth-mgmt ,  auth, , XUnion@GMail.com
-	"w2w.io/serve/document" //document ,  document, 13580452503, KManager@GMail.com
-	"w2w.io/serve/logview"  //log-view ,  log-view, 18928776452, XUnion@GMail.com
-	"w2w.io/serve/message"  //message-mgr ,  tom sawyer, 13580452503, KManager@GMail.com
-	"w2w.io/serve/nservice" //newsvc ,  newservice, , aaa@GMail.com
-	"w2w.io/serve/static"   //static ,  static, 18928776452, XUnion@GMail.com
-	"w2w.io/serve/user"     //user-mgmt ,  user, 18928776452, XUnion@GMail.com
+	"w2w.io/serve/audit"          //audit-trail ,  audit, 18928776452, XUnion@GMail.com
+	"w2w.io/serve/authmgmt"       //auth-mgmt ,  auth, , XUnion@GMail.com
+	"w2w.io/serve/document"       //document ,  document, 13580452503, KManager@GMail.com
+	"w2w.io/serve/loglevel"       //log-level ,  log-level, 18928776452, XUnion@GMail.com
+	"w2w.io/serve/logview"        //log-view ,  log-view, 18928776452, XUnion@GMail.com
+	"w2w.io/serve/message"        //message-mgr ,  tom sawyer, 13580452503, KManager@GMail.com
+	"w2w.io/serve/metrics"        //metrics ,  metrics, 18928776452, XUnion@GMail.com
+	"w2w.io/serve/nservice"       //newsvc ,  newservice, , aaa@GMail.com
+	"w2w.io/serve/runningsession" //running-session ,  running-session, 18928776452, XUnion@GMail.com
+	"w2w.io/serve/static"         //static ,  static, 18928776452, XUnion@GMail.com
+	"w2w.io/serve/user"           //user-mgmt ,  user, 18928776452, XUnion@GMail.com
 )
 
 // Enroll will be called from serve cmd
 func Enroll() {
 
+	audit.Enroll(`{"name":"audit","tel":"18928776452","email":"XUnion@GMail.com"}`)
 	authmgmt.Enroll(`{"name":"auth","email":"XUnion@GMail.com"}`)
 	document.Enroll(`{"name":"document","tel":"13580452503","email":"KManager@GMail.com"}`)
+	loglevel.Enroll(`{"name":"log-level","tel":"18928776452","email":"XUnion@GMail.com"}`)
 	logview.Enroll(`{"name":"log-view","tel":"18928776452","email":"XUnion@GMail.com"}`)
 	message.Enroll(`{"name":"tom sawyer","tel":"13580452503", "email":"KManager@GMail.com"}`)
+	metrics.Enroll(`{"name":"metrics","tel":"18928776452","email":"XUnion@GMail.com"}`)
 	nservice.Enroll(`{"name":"newservice","email":"aaa@GMail.com"}`)
+	runningsession.Enroll(`{"name":"running-session","tel":"18928776452","email":"XUnion@GMail.com"}`)
 	static.Enroll(`{"name":"static","tel":"18928776452","email":"XUnion@GMail.com"}`)
 	user.Enroll(`{"name":"user","tel":"18928776452","email":"XUnion@GMail.com"}`)
 }
@@ -6,6 +6,7 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/mux"
@@ -24,7 +25,6 @@ import (
 	"runtime/debug"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 	"w2w.io/cmn"
 )
@@ -79,26 +79,13 @@ func crashed(ctx context.Context) {
 	s := strings.ReplaceAll(templatePanicString, "_CRLF_", "\n\t")
 	webString := strings.ReplaceAll(templatePanicString, "_CRLF_", ", ")
 	q.Err = fmt.Errorf(webString)
-	z.Error(s)
+	q.Logger().Error(s)
 	q.RespErr()
 }
 
-func restoreLog() {
-	logLevel := 0
-	if viper.IsSet("zLogLevel") {
-		logLevel = viper.GetInt("zLogLevel")
-	}
-	cmn.SetLogLevel(int8(logLevel))
-}
-
+//disableLog whether the log of r written by its logger(ServiceCtx.Log) should be suppressed, the others and the level aren't affected
 func disableLog(r *http.Request) bool {
-	if r.URL.Query().Get("token") != "858f8dd898b75fe86926" {
-		return false
-	}
-
-	//100无实际意义，仅表示一个足够大的数，使任何日志的级别也达不到，从而抑制日志输出
-	cmn.SetLogLevel(100)
-	return true
+	return r.URL.Query().Get("token") == "858f8dd898b75fe86926"
 }
 
 var rIsAPI = regexp.MustCompile(`(?i)^/api/(.*)?$`)
@@ -113,22 +100,22 @@ var (
 )
 
 func reqProc(reqPath string, w http.ResponseWriter, r *http.Request) {
-	//以单例运行
-	var door sync.Mutex
-	var shortLiveMutex sync.Mutex
+	reqID := cmn.RequestIDOf(r)
+	w.Header().Set(cmn.CRequestIDHeader, reqID)
+	zr := cmn.RequestLogger(reqID, disableLog(r))
 
-	runningSessionID := time.Now().UnixNano()
+	//the api requests can be listed and canceled by /api/running-session,
+	// the disconnection of the client cancels the request as well
+	reqCtx := r.Context()
 	if rIsAPI.MatchString(r.URL.Path) {
 		start := cmn.GetNowInMS()
-		shortLiveMutex.Lock()
-		cmn.RunningSessions[runningSessionID] =
-			cmn.RunningSession{Api: r.URL.Path, BeginTime: start, RemoteAddr: r.RemoteAddr}
-		shortLiveMutex.Unlock()
+		var done func()
+		reqCtx, done = cmn.TrackSession(reqCtx, r, reqID)
 
 		defer func() {
-			z.Info(fmt.Sprintf("%s: %dms pprof", r.URL.Path, cmn.GetNowInMS()-start))
-			z.Info("------------ end ---------------")
-			delete(cmn.RunningSessions, runningSessionID)
+			zr.Info(fmt.Sprintf("%s: %dms pprof", r.URL.Path, cmn.GetNowInMS()-start))
+			zr.Info("------------ end ---------------")
+			done()
 		}()
 	}
 
@@ -140,11 +127,13 @@ func reqProc(reqPath string, w http.ResponseWriter, r *http.Request) {
 		sqlxInUseNow := sqlxDB.Stats().InUse
 
 		if d := pgxInUseNow - pgxInUse; d > 0 {
-			z.Warn(fmt.Sprintf("%s: pgx connection leaked: %d", r.URL.Path, d))
+			zr.Warn(fmt.Sprintf("%s: pgx connection leaked: %d", r.URL.Path, d))
+			cmn.ObserveLeak("pgx", cmn.Services[reqPath].Name, int64(d))
 		}
 
 		if d := sqlxInUseNow - sqlxInUse; d > 0 {
-			z.Warn(fmt.Sprintf("%s: sqlx connection leaked: %d", r.URL.Path, d))
+			zr.Warn(fmt.Sprintf("%s: sqlx connection leaked: %d", r.URL.Path, d))
+			cmn.ObserveLeak("sqlx", cmn.Services[reqPath].Name, int64(d))
 		}
 
 		cmn.DbState(pgxConn)
@@ -153,21 +142,6 @@ func reqProc(reqPath string, w http.ResponseWriter, r *http.Request) {
 
 	cmn.DebugMode(w)
 
-	if disableLog(r) {
-		defer restoreLog()
-	}
-
-	if cmn.SerializationReq {
-		z.Warn("serializationReq")
-		z.Info("try lock")
-		door.Lock()
-		z.Info("got lock")
-		defer func() {
-			door.Unlock()
-			z.Info("release lock")
-		}()
-	}
-
 	userAgent := r.Header.Get("User-Agent")
 	var clnType = cmn.CPcBrowserCaller
 
@@ -195,7 +169,7 @@ func reqProc(reqPath string, w http.ResponseWriter, r *http.Request) {
 			clnType = cmn.CPcBrowserCaller
 		}
 	} else {
-		z.Warn("userAgent is empty")
+		zr.Warn("userAgent is empty")
 	}
 
 	// ---------------------------
@@ -216,23 +190,68 @@ func reqProc(reqPath string, w http.ResponseWriter, r *http.Request) {
 			Method: r.Method,
 		},
 		BeginTime: time.Now(),
+		RequestID: reqID,
+		Log:       zr,
+
+		PathParams: mux.Vars(r),
 	}
 
 	var err error
 	q.Session, err = store.Get(r, "qNearSessions")
 	if err != nil {
-		z.Error(err.Error())
+		zr.Error(err.Error())
 		return
 	}
 
-	ctx := context.WithValue(context.Background(), cmn.QNearKey, q)
+	ctx := context.WithValue(reqCtx, cmn.QNearKey, q)
+	ctx, span := cmn.StartRequestSpan(ctx, q)
+	defer func() {
+		span.End(q.Err)
+		cmn.ObserveRequest(q.Ep.Name, q.Msg.Status, time.Since(q.BeginTime))
+	}()
 	defer crashed(ctx)
 
+	cmn.RejectBlacklisted(ctx)
+	if q.Err != nil {
+		return
+	}
+
 	//authenticate
 	cmn.Authenticate(ctx)
 	if q.Err != nil {
 		return
 	}
+	cmn.SetSessionUser(ctx)
+
+	cmn.Throttle(ctx)
+	if q.Err != nil {
+		return
+	}
+
+	cmn.ValidateReq(ctx)
+	if q.Err != nil {
+		return
+	}
+
+	//同一用户(未登录时同一地址)的请求依次执行
+	if cmn.SerializationReq && !cmn.Services[reqPath].Streaming {
+		key := cmn.AddrLockKey(r)
+		if q.SysUser != nil && q.SysUser.ID.Valid {
+			key = cmn.UserLockKey(q.SysUser.ID.Int64)
+		}
+		zr.Info("try lock " + key)
+		var unlock func()
+		unlock, q.Err = cmn.LockKey(ctx, key)
+		if q.Err != nil {
+			q.RespErr()
+			return
+		}
+		zr.Info("got lock " + key)
+		defer func() {
+			unlock()
+			zr.Info("release lock " + key)
+		}()
+	}
 
 	cmn.Services[reqPath].Fn(ctx)
 }
@@ -240,6 +259,7 @@ func reqProc(reqPath string, w http.ResponseWriter, r *http.Request) {
 func WebServe(_ *cobra.Command, _ []string) {
 	Enroll()
 	cmn.LoadPayAccount()
+	cmn.LoadBlacklist()
 
 	router := mux.NewRouter()
 
@@ -261,16 +281,26 @@ func WebServe(_ *cobra.Command, _ []string) {
 	for _, k := range pathList {
 		k := k
 
+		var route *mux.Route
 		if cmn.Services[k].IsFileServe {
-			router.PathPrefix(k).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route = router.PathPrefix(k).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reqProc(k, w, r)
+			})
+		} else {
+			route = router.HandleFunc(k, func(w http.ResponseWriter, r *http.Request) {
 				reqProc(k, w, r)
 			})
-			continue
 		}
 
-		router.HandleFunc(k, func(w http.ResponseWriter, r *http.Request) {
-			reqProc(k, w, r)
-		})
+		// the same path with other methods falls through to the 405 handler
+		if methods := cmn.Services[k].Methods; len(methods) > 0 {
+			route.Methods(methods...)
+			if cmn.Services[k].IsFileServe {
+				router.PathPrefix(k).HandlerFunc(cmn.MethodNotAllowed(methods))
+			} else {
+				router.HandleFunc(k, cmn.MethodNotAllowed(methods))
+			}
+		}
 	}
 
 	host := "qnear.cn"
@@ -365,15 +395,41 @@ func WebServe(_ *cobra.Command, _ []string) {
 		Handler: GzipHandler(router),
 	}
 
-	if autoCert {
-		serv.TLSConfig = &tls.Config{GetCertificate: certManager.GetCertificate}
-		go func() { _ = http.ListenAndServe(":http", certManager.HTTPHandler(nil)) }()
-		_ = serv.ListenAndServeTLS("", "")
+	ln, err := listen(ep)
+	if err != nil {
+		z.Fatal(err.Error())
 		return
 	}
+	watchRestart(ln)
+
+	var servers = []*http.Server{serv}
+	cmn.OnShutdown(func(ctx context.Context) {
+		z.Warn(fmt.Sprintf("web serve stop accepting, %d running sessions", cmn.RunningSessionCount()))
+		for _, v := range servers {
+			//Shutdown wait for the active requests until ctx is done
+			if err := v.Shutdown(ctx); err != nil {
+				z.Error(fmt.Sprintf("%s: %s, %d running sessions aborted",
+					v.Addr, err.Error(), cmn.RunningSessionCount()))
+				_ = v.Close()
+			}
+		}
+		z.Warn("web serve stopped")
+	})
+
+	if autoCert {
+		serv.TLSConfig = &tls.Config{GetCertificate: certManager.GetCertificate}
+		acme := &http.Server{Addr: ":http", Handler: certManager.HTTPHandler(nil)}
+		servers = append(servers, acme)
+		go func() { _ = acme.ListenAndServe() }()
+		err = serv.ServeTLS(ln, "", "")
+	} else {
+		cmn.AppStartTime = time.Now()
 
-	cmn.AppStartTime = time.Now()
+		z.Info(cmn.AppStartTime.Format(cmn.AppStartTimeLayout))
+		err = serv.Serve(ln)
+	}
 
-	z.Info(cmn.AppStartTime.Format(cmn.AppStartTimeLayout))
-	_ = serv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		z.Fatal(err.Error())
+	}
 }